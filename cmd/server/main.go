@@ -6,6 +6,7 @@ import (
 
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,7 +18,9 @@ import (
 	"github.com/wizenheimer/swiftcal/pkg/logger"
 	"github.com/wizenheimer/swiftcal/templates"
 
+	"github.com/emersion/go-smtp"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/basicauth"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/recover"
@@ -31,7 +34,9 @@ type Server struct {
 	db           *database.DB
 	authService  *services.AuthService
 	emailService *services.EmailService
+	queueService *services.QueueService
 	cronService  *services.CronService
+	smtpServer   *smtp.Server
 	shutdownChan chan os.Signal
 }
 
@@ -39,15 +44,26 @@ type Server struct {
 func NewServer(cfg *config.Config, db *database.DB) *Server {
 	// Initialize services
 	authService := services.NewAuthService(db, cfg)
+	microsoftAuthService := services.NewMicrosoftAuthService(db, cfg, authService)
+	caldavAccountService := services.NewCalDAVAccountService(db, cfg)
 	openaiService := services.NewOpenAIService(cfg)
-	calendarService := services.NewCalendarService(cfg, authService)
-	emailService := services.NewEmailService(cfg, authService, calendarService, openaiService)
-	cronService := services.NewCronService(db, cfg, authService)
+	createdEventService := services.NewCreatedEventService(db, cfg)
+	feedService := services.NewFeedService(db, cfg, createdEventService)
+	calendarService := services.NewCalendarService(cfg, authService, microsoftAuthService, caldavAccountService, createdEventService)
+	messageLogService := services.NewMessageLogService(db, cfg)
+	importedEventService := services.NewImportedEventService(db, cfg)
+	userSettingsService := services.NewUserSettingsService(db, cfg)
+	calendarRouteService := services.NewCalendarRouteService(db, cfg)
+	emailService := services.NewEmailService(cfg, authService, calendarService, openaiService, messageLogService, importedEventService, feedService, userSettingsService, caldavAccountService, calendarRouteService)
+	queueService := services.NewQueueService(db, cfg, emailService)
+	cronService := services.NewCronService(db, cfg, authService, microsoftAuthService)
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(authService, cfg)
-	emailHandler := handlers.NewEmailHandler(emailService, cfg)
+	authHandler := handlers.NewAuthHandler(authService, microsoftAuthService, cfg)
+	emailHandler := handlers.NewEmailHandler(queueService, cfg)
 	calendarHandler := handlers.NewCalendarHandler(calendarService, authService, cfg)
+	adminHandler := handlers.NewAdminHandler(queueService, cfg)
+	feedHandler := handlers.NewFeedHandler(feedService, cfg)
 
 	// Initialize Fiber app
 	app := createFiberApp()
@@ -56,17 +72,26 @@ func NewServer(cfg *config.Config, db *database.DB) *Server {
 	setupMiddleware(app)
 
 	// Setup routes
-	setupRoutes(app, authHandler, emailHandler, calendarHandler, cfg)
+	setupRoutes(app, authHandler, emailHandler, calendarHandler, adminHandler, feedHandler, cfg)
 
-	return &Server{
+	server := &Server{
 		app:          app,
 		config:       cfg,
 		db:           db,
 		authService:  authService,
 		emailService: emailService,
+		queueService: queueService,
 		cronService:  cronService,
 		shutdownChan: make(chan os.Signal, 1),
 	}
+
+	// Optional built-in mail listener
+	if cfg.InboundProviderEnabled(config.InboundSMTP) {
+		smtpBackend := handlers.NewSMTPBackend(emailHandler, services.NewMailAuthenticator(cfg), cfg)
+		server.smtpServer = createSMTPServer(smtpBackend, cfg)
+	}
+
+	return server
 }
 
 // Start starts the server and background tasks
@@ -75,6 +100,7 @@ func (s *Server) Start() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	s.cronService.StartBackgroundJobs(ctx)
+	s.queueService.Start(ctx)
 
 	// Get port
 	port := s.getPort()
@@ -90,6 +116,19 @@ func (s *Server) Start() error {
 		}
 	}()
 
+	if s.smtpServer != nil {
+		logger.GetLogger().Info("Mail listener starting",
+			zap.String("network", s.smtpServer.Network),
+			zap.String("addr", s.smtpServer.Addr),
+			zap.Bool("lmtp", s.smtpServer.LMTP))
+
+		go func() {
+			if err := s.smtpServer.ListenAndServe(); err != nil && err != smtp.ErrServerClosed {
+				logger.GetLogger().Fatal("Failed to start mail listener", zap.Error(err))
+			}
+		}()
+	}
+
 	// Wait for shutdown signal
 	<-s.shutdownChan
 	logger.GetLogger().Info("Shutting down server...")
@@ -101,11 +140,22 @@ func (s *Server) Start() error {
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer shutdownCancel()
 
+	if s.smtpServer != nil {
+		if err := s.smtpServer.Shutdown(shutdownCtx); err != nil {
+			logger.GetLogger().Error("Mail listener shutdown error", zap.Error(err))
+		}
+	}
+
 	if err := s.app.ShutdownWithContext(shutdownCtx); err != nil {
 		logger.GetLogger().Error("Server shutdown error", zap.Error(err))
 		return err
 	}
 
+	// Let workers finish the jobs they hold; anything cut short is requeued later
+	if err := s.queueService.Shutdown(shutdownCtx); err != nil {
+		logger.GetLogger().Error("Inbound queue shutdown error", zap.Error(err))
+	}
+
 	logger.GetLogger().Info("Server stopped")
 	return nil
 }
@@ -157,6 +207,26 @@ func createFiberApp() *fiber.App {
 	})
 }
 
+func createSMTPServer(backend *handlers.SMTPBackend, cfg *config.Config) *smtp.Server {
+	server := smtp.NewServer(backend)
+
+	server.Network = "tcp"
+	server.Addr = cfg.SMTPListenAddr
+	if path, ok := strings.CutPrefix(cfg.SMTPListenAddr, "unix:"); ok {
+		server.Network = "unix"
+		server.Addr = path
+	}
+
+	server.LMTP = cfg.SMTPMode == config.SMTPModeLMTP
+	server.Domain = cfg.EmailDomain
+	server.MaxMessageBytes = cfg.SMTPMaxMessageBytes
+	server.MaxRecipients = 50
+	server.ReadTimeout = 30 * time.Second
+	server.WriteTimeout = 30 * time.Second
+
+	return server
+}
+
 func setupMiddleware(app *fiber.App) {
 	// Recovery middleware
 	app.Use(recover.New())
@@ -195,13 +265,19 @@ func setupMiddleware(app *fiber.App) {
 	})
 }
 
-func setupRoutes(app *fiber.App, authHandler *handlers.AuthHandler, emailHandler *handlers.EmailHandler, calendarHandler *handlers.CalendarHandler, cfg *config.Config) {
+func setupRoutes(app *fiber.App, authHandler *handlers.AuthHandler, emailHandler *handlers.EmailHandler, calendarHandler *handlers.CalendarHandler, adminHandler *handlers.AdminHandler, feedHandler *handlers.FeedHandler, cfg *config.Config) {
 	// Auth routes
 	setupAuthRoutes(app, authHandler, calendarHandler)
 
+	// Calendar feeds
+	app.Get("/feeds/:token.ics", feedHandler.GetFeed)
+
 	// Webhook routes
 	setupWebhookRoutes(app, emailHandler, cfg)
 
+	// Admin routes
+	setupAdminRoutes(app, adminHandler, cfg)
+
 	// Static pages
 	setupStaticPages(app, cfg)
 
@@ -214,18 +290,53 @@ func setupRoutes(app *fiber.App, authHandler *handlers.AuthHandler, emailHandler
 func setupAuthRoutes(app *fiber.App, authHandler *handlers.AuthHandler, calendarHandler *handlers.CalendarHandler) {
 	app.Get("/signup", authHandler.Signup)
 	app.Get("/auth/callback", authHandler.Callback)
+	app.Get("/signup/microsoft", authHandler.SignupMicrosoft)
+	app.Get("/connect/microsoft", authHandler.ConnectMicrosoft)
+	app.Get("/auth/microsoft/callback", authHandler.MicrosoftCallback)
 	app.Get("/auth/verifyAdditionalEmail", authHandler.VerifyAdditionalEmail)
 	app.Get("/auth/inviteAdditionalAttendees", calendarHandler.InviteAdditionalAttendees)
 }
 
 func setupWebhookRoutes(app *fiber.App, emailHandler *handlers.EmailHandler, cfg *config.Config) {
-	if cfg.MailgunWebhookSecret != "" {
-		endpoint := "/webhooks/mailgun/" + cfg.MailgunWebhookSecret
-		app.Post(endpoint, emailHandler.HandleMailgunWebhook)
-		logger.GetLogger().Info("Mailgun webhook endpoint", zap.String("endpoint", endpoint))
+	if cfg.RawEmailWebhookToken != "" {
+		app.Post("/webhooks/raw", middleware.BearerAuth(cfg.RawEmailWebhookToken), emailHandler.HandleRawEmail)
+		logger.GetLogger().Info("Raw email webhook endpoint registered")
+	}
+
+	if cfg.InboundProviderEnabled(config.InboundMailgun) {
+		app.Post("/webhooks/mailgun", emailHandler.HandleMailgunWebhook)
+		app.Post("/webhooks/mailgun/mime", emailHandler.HandleMailgunMIMEWebhook)
+		logger.GetLogger().Info("Mailgun webhook endpoints registered",
+			zap.Int("signing_keys", len(cfg.MailgunWebhookSigningKeys)))
+	}
+
+	// SendGrid and Postmark don't sign inbound posts; both support basic auth in the webhook URL
+	if cfg.InboundProviderEnabled(config.InboundSendGrid) {
+		app.Post("/webhooks/sendgrid", basicauth.New(basicauth.Config{
+			Users: map[string]string{cfg.SendGridInboundUsername: cfg.SendGridInboundPassword},
+		}), emailHandler.HandleSendGridWebhook)
+		logger.GetLogger().Info("SendGrid webhook endpoint registered")
+	}
+
+	if cfg.InboundProviderEnabled(config.InboundPostmark) {
+		app.Post("/webhooks/postmark", basicauth.New(basicauth.Config{
+			Users: map[string]string{cfg.PostmarkInboundUsername: cfg.PostmarkInboundPassword},
+		}), emailHandler.HandlePostmarkWebhook)
+		logger.GetLogger().Info("Postmark webhook endpoint registered")
 	}
 }
 
+func setupAdminRoutes(app *fiber.App, adminHandler *handlers.AdminHandler, cfg *config.Config) {
+	if cfg.AdminAPIToken == "" {
+		return
+	}
+
+	admin := app.Group("/admin", middleware.BearerAuth(cfg.AdminAPIToken))
+	admin.Get("/jobs", adminHandler.ListJobs)
+	admin.Post("/jobs/:id/retry", adminHandler.RetryJob)
+	logger.GetLogger().Info("Admin endpoints registered")
+}
+
 func setupStaticPages(app *fiber.App, cfg *config.Config) {
 	// Home page redirect
 	app.Get("/", func(c *fiber.Ctx) error {
@@ -2,11 +2,30 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/wizenheimer/swiftcal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Inbound email providers selectable through INBOUND_PROVIDERS
+const (
+	InboundMailgun  = "mailgun"
+	InboundSendGrid = "sendgrid"
+	InboundPostmark = "postmark"
+	InboundSMTP     = "smtp"
+)
+
+// Protocols the built-in mail listener can speak
+const (
+	SMTPModeSMTP = "smtp"
+	SMTPModeLMTP = "lmtp"
 )
 
 type Config struct {
@@ -28,6 +47,21 @@ type Config struct {
 	GoogleClientSecret string
 	GoogleRedirectURL  string
 
+	// Microsoft OAuth2 and Graph
+	MicrosoftClientID     string
+	MicrosoftClientSecret string
+	MicrosoftRedirectURL  string
+	MicrosoftTenant       string
+	MicrosoftLoginURL     string
+	MicrosoftGraphURL     string
+
+	// CalDAVAllowHTTP lets users connect CalDAV servers over plain http, which
+	// sends their password unencrypted; meant for a local test server
+	CalDAVAllowHTTP bool
+	// CalDAVEncryptionKey is the base64 AES-256 key app passwords are
+	// encrypted with. CalDAV accounts can't be connected without it.
+	CalDAVEncryptionKey string
+
 	// OpenAI
 	OpenAIAPIKey string
 
@@ -36,8 +70,42 @@ type Config struct {
 	MailgunDomain    string
 	MainEmailAddress string
 
+	// Inbound Providers
+	InboundProviders []string
+
+	// Sender Authentication
+	TrustedAuthservIDs []string
+
 	// Webhook Security
-	MailgunWebhookSecret string
+	MailgunWebhookSigningKeys []string
+	MailgunWebhookMaxAge      time.Duration
+	RawEmailWebhookToken      string
+	SendGridInboundUsername   string
+	SendGridInboundPassword   string
+	PostmarkInboundUsername   string
+	PostmarkInboundPassword   string
+
+	// Inbound Queue
+	QueueWorkers      int
+	QueueMaxAttempts  int
+	QueuePollInterval time.Duration
+
+	// Admin API
+	AdminAPIToken string
+
+	// Guest Mode
+	GuestModeEnabled  bool
+	GuestMaxPerSender int
+	GuestRateWindow   time.Duration
+
+	// Built-in Mail Listener
+	SMTPListenAddr      string
+	SMTPMode            string
+	SMTPMaxMessageBytes int64
+
+	// Inbound Attachments
+	MaxAttachmentSize       int64
+	MaxAttachmentsTotalSize int64
 
 	// JWT
 	JWTSecret string
@@ -75,6 +143,17 @@ func Load() (*Config, error) {
 		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
 		GoogleRedirectURL:  getEnv("GOOGLE_REDIRECT_URL", ""),
 
+		// Microsoft OAuth2 and Graph
+		MicrosoftClientID:     getEnv("MICROSOFT_CLIENT_ID", ""),
+		MicrosoftClientSecret: getEnv("MICROSOFT_CLIENT_SECRET", ""),
+		MicrosoftRedirectURL:  getEnv("MICROSOFT_REDIRECT_URL", ""),
+		MicrosoftTenant:       getEnv("MICROSOFT_TENANT", "common"),
+		MicrosoftLoginURL:     getEnv("MICROSOFT_LOGIN_URL", "https://login.microsoftonline.com"),
+		MicrosoftGraphURL:     getEnv("MICROSOFT_GRAPH_URL", "https://graph.microsoft.com/v1.0"),
+
+		CalDAVAllowHTTP:     getEnvBool("CALDAV_ALLOW_HTTP", false),
+		CalDAVEncryptionKey: getEnv("CALDAV_ENCRYPTION_KEY", ""),
+
 		// OpenAI
 		OpenAIAPIKey: getEnv("OPENAI_API_KEY", ""),
 
@@ -83,8 +162,42 @@ func Load() (*Config, error) {
 		MailgunDomain:    getEnv("MAILGUN_DOMAIN", ""),
 		MainEmailAddress: getEnv("MAIN_EMAIL_ADDRESS", "swiftcal@"+getEnv("EMAIL_DOMAIN", "swiftcallabs.com")),
 
+		// Inbound Providers
+		InboundProviders: getEnvList("INBOUND_PROVIDERS"),
+
+		// Sender Authentication
+		TrustedAuthservIDs: getEnvList("TRUSTED_AUTHSERV_IDS"),
+
 		// Webhook Security
-		MailgunWebhookSecret: getEnv("MAILGUN_WEBHOOK_SECRET", "incoming"),
+		MailgunWebhookSigningKeys: getEnvList("MAILGUN_WEBHOOK_SIGNING_KEYS"),
+		MailgunWebhookMaxAge:      getEnvDuration("MAILGUN_WEBHOOK_MAX_AGE", 5*time.Minute),
+		RawEmailWebhookToken:      getEnv("RAW_EMAIL_WEBHOOK_TOKEN", ""),
+		SendGridInboundUsername:   getEnv("SENDGRID_INBOUND_USERNAME", ""),
+		SendGridInboundPassword:   getEnv("SENDGRID_INBOUND_PASSWORD", ""),
+		PostmarkInboundUsername:   getEnv("POSTMARK_INBOUND_USERNAME", ""),
+		PostmarkInboundPassword:   getEnv("POSTMARK_INBOUND_PASSWORD", ""),
+
+		// Inbound Queue
+		QueueWorkers:      int(getEnvInt64("QUEUE_WORKERS", 4)),
+		QueueMaxAttempts:  int(getEnvInt64("QUEUE_MAX_ATTEMPTS", 6)),
+		QueuePollInterval: getEnvDuration("QUEUE_POLL_INTERVAL", 2*time.Second),
+
+		// Admin API
+		AdminAPIToken: getEnv("ADMIN_API_TOKEN", ""),
+
+		// Guest Mode
+		GuestModeEnabled:  getEnvBool("GUEST_MODE_ENABLED", false),
+		GuestMaxPerSender: int(getEnvInt64("GUEST_MAX_PER_SENDER", 3)),
+		GuestRateWindow:   getEnvDuration("GUEST_RATE_WINDOW", 24*time.Hour),
+
+		// Built-in Mail Listener
+		SMTPListenAddr:      getEnv("SMTP_LISTEN_ADDR", ":2525"),
+		SMTPMode:            getEnv("SMTP_MODE", SMTPModeSMTP),
+		SMTPMaxMessageBytes: getEnvInt64("SMTP_MAX_MESSAGE_BYTES", 10*1024*1024),
+
+		// Inbound Attachments
+		MaxAttachmentSize:       getEnvInt64("MAX_ATTACHMENT_SIZE", 2*1024*1024),
+		MaxAttachmentsTotalSize: getEnvInt64("MAX_ATTACHMENTS_TOTAL_SIZE", 8*1024*1024),
 
 		// JWT
 		JWTSecret: getEnv("JWT_SECRET", ""),
@@ -95,6 +208,10 @@ func Load() (*Config, error) {
 		EmailDomain: getEnv("EMAIL_DOMAIN", "swiftcallabs.com"),
 	}
 
+	if len(config.InboundProviders) == 0 {
+		config.InboundProviders = []string{InboundMailgun}
+	}
+
 	// Build database URL if not provided
 	if config.DatabaseURL == "" {
 		config.DatabaseURL = fmt.Sprintf(
@@ -135,9 +252,69 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("mailgun must be configured")
 	}
 
+	if c.MicrosoftEnabled() && (c.MicrosoftClientSecret == "" || c.MicrosoftRedirectURL == "") {
+		return fmt.Errorf("MICROSOFT_CLIENT_ID requires MICROSOFT_CLIENT_SECRET and MICROSOFT_REDIRECT_URL")
+	}
+
+	if c.CalDAVEncryptionKey != "" {
+		if key, err := base64.StdEncoding.DecodeString(c.CalDAVEncryptionKey); err != nil || len(key) != 32 {
+			return fmt.Errorf("CALDAV_ENCRYPTION_KEY must be 32 random bytes in base64")
+		}
+	}
+
+	if c.QueueWorkers < 1 || c.QueueMaxAttempts < 1 || c.QueuePollInterval <= 0 {
+		return fmt.Errorf("QUEUE_WORKERS, QUEUE_MAX_ATTEMPTS and QUEUE_POLL_INTERVAL must be positive")
+	}
+
+	// Guest replies are counted in processed_messages, which keeps 30 days
+	if c.GuestModeEnabled && (c.GuestMaxPerSender < 1 || c.GuestRateWindow <= 0 || c.GuestRateWindow > 30*24*time.Hour) {
+		return fmt.Errorf("GUEST_MAX_PER_SENDER must be positive and GUEST_RATE_WINDOW between 0 and 720h")
+	}
+
+	if c.SMTPMode != SMTPModeSMTP && c.SMTPMode != SMTPModeLMTP {
+		return fmt.Errorf("SMTP_MODE must be %q or %q", SMTPModeSMTP, SMTPModeLMTP)
+	}
+
+	// Every enabled inbound provider must be able to authenticate its requests
+	for _, provider := range c.InboundProviders {
+		switch provider {
+		case InboundMailgun:
+			if len(c.MailgunWebhookSigningKeys) == 0 {
+				return fmt.Errorf("inbound provider mailgun requires MAILGUN_WEBHOOK_SIGNING_KEYS")
+			}
+		case InboundSendGrid:
+			if c.SendGridInboundUsername == "" || c.SendGridInboundPassword == "" {
+				return fmt.Errorf("inbound provider sendgrid requires SENDGRID_INBOUND_USERNAME and SENDGRID_INBOUND_PASSWORD")
+			}
+		case InboundPostmark:
+			if c.PostmarkInboundUsername == "" || c.PostmarkInboundPassword == "" {
+				return fmt.Errorf("inbound provider postmark requires POSTMARK_INBOUND_USERNAME and POSTMARK_INBOUND_PASSWORD")
+			}
+		case InboundSMTP:
+			// Authenticated per message with SPF and DKIM
+		default:
+			return fmt.Errorf("unknown inbound provider %q", provider)
+		}
+	}
+
 	return nil
 }
 
+// InboundProviderEnabled reports whether webhooks from the named provider are accepted
+func (c *Config) InboundProviderEnabled(provider string) bool {
+	for _, enabled := range c.InboundProviders {
+		if enabled == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// MicrosoftEnabled reports whether users can connect a Microsoft 365 or Outlook.com calendar
+func (c *Config) MicrosoftEnabled() bool {
+	return c.MicrosoftClientID != ""
+}
+
 func (c *Config) IsProduction() bool {
 	return c.Environment == "production"
 }
@@ -168,3 +345,62 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvList reads a comma-separated environment variable, dropping empty entries
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.GetLogger().Warn("Invalid boolean, using default",
+			zap.String("key", key),
+			zap.Bool("default", defaultValue))
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvInt64(key string, defaultValue int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		logger.GetLogger().Warn("Invalid integer, using default",
+			zap.String("key", key),
+			zap.Int64("default", defaultValue))
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		logger.GetLogger().Warn("Invalid duration, using default",
+			zap.String("key", key),
+			zap.Duration("default", defaultValue))
+		return defaultValue
+	}
+	return duration
+}
@@ -108,3 +108,204 @@ CREATE INDEX idx_pending_emails_expires_at ON pending_email_addresses(expires_at
 /*
 DROP TABLE IF EXISTS pending_email_addresses;
 */
+
+// internal/database/migrations/004_create_inbound_jobs.up.sql
+/*
+CREATE TABLE inbound_jobs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    webhook JSONB NOT NULL,
+    files JSONB,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL,
+    last_error TEXT,
+    run_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    locked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_inbound_jobs_runnable ON inbound_jobs(run_at) WHERE status = 'pending';
+CREATE INDEX idx_inbound_jobs_status ON inbound_jobs(status, updated_at);
+*/
+
+// internal/database/migrations/004_create_inbound_jobs.down.sql
+/*
+DROP TABLE IF EXISTS inbound_jobs;
+*/
+
+// internal/database/migrations/005_create_processed_messages.up.sql
+/*
+CREATE TABLE processed_messages (
+    message_key VARCHAR(512) PRIMARY KEY,
+    sender VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    outcome VARCHAR(50),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_processed_messages_updated_at ON processed_messages(updated_at);
+*/
+
+// internal/database/migrations/005_create_processed_messages.down.sql
+/*
+DROP TABLE IF EXISTS processed_messages;
+*/
+
+// internal/database/migrations/006_create_imported_events.up.sql
+/*
+CREATE TABLE imported_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ical_uid VARCHAR(512) NOT NULL,
+    recurrence_id VARCHAR(32) NOT NULL DEFAULT '',
+    sequence INT NOT NULL DEFAULT 0,
+    calendar_id VARCHAR(255) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (user_id, ical_uid, recurrence_id)
+);
+*/
+
+// internal/database/migrations/006_create_imported_events.down.sql
+/*
+DROP TABLE IF EXISTS imported_events;
+*/
+
+// internal/database/migrations/007_index_processed_messages_sender.up.sql
+/*
+CREATE INDEX idx_processed_messages_sender ON processed_messages(sender, outcome, created_at);
+*/
+
+// internal/database/migrations/007_index_processed_messages_sender.down.sql
+/*
+DROP INDEX IF EXISTS idx_processed_messages_sender;
+*/
+
+// internal/database/migrations/008_create_calendar_feeds.up.sql
+/*
+CREATE TABLE created_events (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_id VARCHAR(255) NOT NULL,
+    calendar_id VARCHAR(255) NOT NULL,
+    ical_uid VARCHAR(512) NOT NULL,
+    summary TEXT NOT NULL,
+    description TEXT,
+    location TEXT,
+    start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    time_zone VARCHAR(64) NOT NULL,
+    all_day BOOLEAN NOT NULL DEFAULT FALSE,
+    recurrence TEXT[],
+    html_link TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (user_id, event_id)
+);
+
+CREATE TABLE calendar_feeds (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+*/
+
+// internal/database/migrations/008_create_calendar_feeds.down.sql
+/*
+DROP TABLE IF EXISTS calendar_feeds;
+DROP TABLE IF EXISTS created_events;
+*/
+
+// internal/database/migrations/009_create_user_settings.up.sql
+/*
+CREATE TABLE user_settings (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    default_reminders JSONB,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+*/
+
+// internal/database/migrations/009_create_user_settings.down.sql
+/*
+DROP TABLE IF EXISTS user_settings;
+*/
+
+// internal/database/migrations/010_add_calendar_providers.up.sql
+/*
+ALTER TABLE users ADD COLUMN calendar_provider VARCHAR(20) NOT NULL DEFAULT 'google';
+
+CREATE TABLE microsoft_tokens (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    tenant_id VARCHAR(64) NOT NULL, -- tid and oid from the ID token
+    object_id VARCHAR(64) NOT NULL,
+    access_token TEXT NOT NULL,
+    refresh_token TEXT,
+    expiry_date TIMESTAMP WITH TIME ZONE,
+    token_scope TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (tenant_id, object_id)
+);
+
+CREATE INDEX idx_microsoft_tokens_expiry_date ON microsoft_tokens(expiry_date);
+*/
+
+// internal/database/migrations/010_add_calendar_providers.down.sql
+/*
+DROP TABLE IF EXISTS microsoft_tokens;
+ALTER TABLE users DROP COLUMN IF EXISTS calendar_provider;
+*/
+
+// internal/database/migrations/011_create_caldav_accounts.up.sql
+/*
+CREATE TABLE caldav_accounts (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    server_url TEXT NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    password TEXT NOT NULL, -- AES-256-GCM with CALDAV_ENCRYPTION_KEY
+    calendar_url TEXT NOT NULL,
+    calendar_name VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+*/
+
+// internal/database/migrations/011_create_caldav_accounts.down.sql
+/*
+DROP TABLE IF EXISTS caldav_accounts;
+*/
+
+// internal/database/migrations/012_create_calendar_routes.up.sql
+/*
+CREATE TABLE calendar_routes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    pattern VARCHAR(255) NOT NULL,
+    calendar_id TEXT NOT NULL,
+    calendar_name VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (user_id, kind, pattern)
+);
+*/
+
+// internal/database/migrations/012_create_calendar_routes.down.sql
+/*
+DROP TABLE IF EXISTS calendar_routes;
+*/
+
+// internal/database/migrations/013_add_created_events_source_key.up.sql
+/*
+ALTER TABLE created_events ADD COLUMN source_key TEXT; -- the message and event it was read from
+
+CREATE INDEX idx_created_events_source_key ON created_events(user_id, source_key) WHERE source_key IS NOT NULL;
+*/
+
+// internal/database/migrations/013_add_created_events_source_key.down.sql
+/*
+DROP INDEX IF EXISTS idx_created_events_source_key;
+ALTER TABLE created_events DROP COLUMN IF EXISTS source_key;
+*/
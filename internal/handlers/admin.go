@@ -0,0 +1,89 @@
+// internal/handlers/admin.go
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/models"
+	"github.com/wizenheimer/swiftcal/internal/services"
+	"github.com/wizenheimer/swiftcal/pkg/logger"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+type AdminHandler struct {
+	queueService *services.QueueService
+	config       *config.Config
+}
+
+func NewAdminHandler(queueService *services.QueueService, cfg *config.Config) *AdminHandler {
+	return &AdminHandler{
+		queueService: queueService,
+		config:       cfg,
+	}
+}
+
+// ListJobs returns inbound jobs in one state, dead-lettered ones by default
+func (h *AdminHandler) ListJobs(c *fiber.Ctx) error {
+	status := c.Query("status", models.JobStatusDead)
+	switch status {
+	case models.JobStatusPending, models.JobStatusProcessing, models.JobStatusDone, models.JobStatusDead:
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid status",
+		})
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "limit must be between 1 and 500",
+		})
+	}
+
+	jobs, err := h.queueService.ListJobs(c.Context(), status, limit)
+	if err != nil {
+		logger.GetLogger().Error("Failed to list inbound jobs", zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list jobs",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"jobs": jobs,
+	})
+}
+
+// RetryJob requeues a dead-lettered job
+func (h *AdminHandler) RetryJob(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid job ID",
+		})
+	}
+
+	if err := h.queueService.RetryJob(c.Context(), id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{
+				"error": "No dead job with that ID",
+			})
+		}
+
+		logger.GetLogger().Error("Failed to retry inbound job", zap.Error(err), zap.String("job_id", id.String()))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retry job",
+		})
+	}
+
+	logger.GetLogger().Info("Inbound job requeued by admin", zap.String("job_id", id.String()))
+	return c.JSON(fiber.Map{
+		"message": "Job requeued",
+	})
+}
@@ -2,11 +2,14 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/wizenheimer/swiftcal/internal/config"
 	"github.com/wizenheimer/swiftcal/internal/services"
 	"github.com/wizenheimer/swiftcal/pkg/logger"
+	"github.com/wizenheimer/swiftcal/templates"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -14,14 +17,16 @@ import (
 )
 
 type AuthHandler struct {
-	authService *services.AuthService
-	config      *config.Config
+	authService   *services.AuthService
+	microsoftAuth *services.MicrosoftAuthService
+	config        *config.Config
 }
 
-func NewAuthHandler(authService *services.AuthService, cfg *config.Config) *AuthHandler {
+func NewAuthHandler(authService *services.AuthService, microsoftAuth *services.MicrosoftAuthService, cfg *config.Config) *AuthHandler {
 	return &AuthHandler{
-		authService: authService,
-		config:      cfg,
+		authService:   authService,
+		microsoftAuth: microsoftAuth,
+		config:        cfg,
 	}
 }
 
@@ -51,6 +56,110 @@ func (h *AuthHandler) Callback(c *fiber.Ctx) error {
 	return c.Redirect(h.config.GetWebURL("/thanks"), http.StatusFound)
 }
 
+// SignupMicrosoft signs in with a Microsoft account that is already linked
+func (h *AuthHandler) SignupMicrosoft(c *fiber.Ctx) error {
+	if !h.config.MicrosoftEnabled() {
+		return c.Redirect(h.config.GetWebURL("/not-found"), http.StatusFound)
+	}
+
+	return h.startMicrosoftSignIn(c, "")
+}
+
+// ConnectMicrosoft starts linking a Microsoft 365 or Outlook.com calendar from
+// the link swiftcal emails in reply to "connect microsoft"
+func (h *AuthHandler) ConnectMicrosoft(c *fiber.Ctx) error {
+	if !h.config.MicrosoftEnabled() {
+		return c.Redirect(h.config.GetWebURL("/not-found"), http.StatusFound)
+	}
+
+	email, err := h.microsoftAuth.VerifyLinkToken(c.Query("token"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).Type("html").SendString(templates.GetMicrosoftLinkExpiredPageHTML(h.config.EmailDomain))
+	}
+
+	return h.startMicrosoftSignIn(c, email)
+}
+
+// microsoftStateCookie carries the signed OAuth state to the callback
+const microsoftStateCookie = "swiftcal_microsoft_state"
+
+// startMicrosoftSignIn sends the browser to Microsoft with a fresh state,
+// bound to it by a cookie only the callback reads
+func (h *AuthHandler) startMicrosoftSignIn(c *fiber.Ctx, linkEmail string) error {
+	state, cookie, err := h.microsoftAuth.NewState(linkEmail)
+	if err != nil {
+		logger.GetLogger().Error("Failed to start Microsoft sign-in", zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Authentication failed",
+		})
+	}
+
+	setMicrosoftStateCookie(c, cookie, time.Now().Add(15*time.Minute))
+	return c.Redirect(h.microsoftAuth.GetAuthURL(state), http.StatusFound)
+}
+
+// setMicrosoftStateCookie sets the state cookie, or deletes it given a past
+// expiry. Lax still sends it on Microsoft's top-level redirect back to us
+func setMicrosoftStateCookie(c *fiber.Ctx, value string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     microsoftStateCookie,
+		Value:    value,
+		Path:     "/auth/microsoft",
+		Expires:  expires,
+		Secure:   true,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+func (h *AuthHandler) MicrosoftCallback(c *fiber.Ctx) error {
+	if !h.config.MicrosoftEnabled() {
+		return c.Redirect(h.config.GetWebURL("/not-found"), http.StatusFound)
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		logger.GetLogger().Error("No authorization code received",
+			zap.String("error", c.Query("error")),
+			zap.String("error_description", c.Query("error_description")))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "No authorization code received",
+		})
+	}
+
+	// The state can only be used once, whatever happens next
+	cookie := c.Cookies(microsoftStateCookie)
+	setMicrosoftStateCookie(c, "", time.Unix(0, 0))
+
+	linkEmail, err := h.microsoftAuth.VerifyState(c.Query("state"), cookie)
+	if err != nil {
+		logger.GetLogger().Warn("Rejected Microsoft callback with an invalid state", zap.Error(err), zap.String("ip", c.IP()))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "This sign-in has expired or was started elsewhere. Please try again.",
+		})
+	}
+
+	user, err := h.microsoftAuth.HandleCallback(c.Context(), code, linkEmail)
+	switch {
+	case errors.Is(err, services.ErrMicrosoftAccountNotLinked):
+		return c.Status(http.StatusForbidden).Type("html").SendString(templates.GetMicrosoftNotLinkedPageHTML(h.config.EmailDomain))
+	case errors.Is(err, services.ErrMicrosoftAccountInUse):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{
+			"error": "This Microsoft account is connected to another swiftcal account",
+		})
+	case err != nil:
+		logger.GetLogger().Error("Microsoft OAuth callback failed", zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Authentication failed",
+		})
+	}
+
+	logger.GetLogger().Info("User authenticated successfully",
+		zap.String("user_id", user.ID.String()),
+		zap.String("provider", user.CalendarProvider))
+	return c.Redirect(h.config.GetWebURL("/thanks"), http.StatusFound)
+}
+
 func (h *AuthHandler) VerifyAdditionalEmail(c *fiber.Ctx) error {
 	uuidParam := c.Query("uuid")
 	if uuidParam == "" {
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMicrosoftCallbackChecksState(t *testing.T) {
+	cfg := &config.Config{
+		JWTSecret:            "secret",
+		MicrosoftClientID:    "client-id",
+		MicrosoftTenant:      "common",
+		MicrosoftRedirectURL: "https://cal.example.com/auth/microsoft/callback",
+	}
+	handler := NewAuthHandler(nil, services.NewMicrosoftAuthService(nil, cfg, nil), cfg)
+
+	app := fiber.New()
+	app.Get("/signup/microsoft", handler.SignupMicrosoft)
+	app.Get("/auth/microsoft/callback", handler.MicrosoftCallback)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/signup/microsoft", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("signup = %d to %q, want a redirect to Microsoft", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	state := location.Query().Get("state")
+	if len(state) < 32 {
+		t.Fatalf("state = %q, want a random value", state)
+	}
+
+	var cookie *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == microsoftStateCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/auth/microsoft" {
+		t.Fatalf("state cookie = %+v", cookie)
+	}
+
+	// Each of these could be a callback forged on another site, so none may
+	// reach the code exchange
+	tests := []struct {
+		name   string
+		state  string
+		cookie string
+	}{
+		{name: "no cookie", state: state},
+		{name: "another state", state: strings.Repeat("A", len(state)), cookie: cookie.Value},
+		{name: "literal state", state: "state", cookie: cookie.Value},
+		{name: "tampered cookie", state: state, cookie: cookie.Value + "x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/auth/microsoft/callback?code=code&state="+url.QueryEscape(tt.state), nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: microsoftStateCookie, Value: tt.cookie})
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("callback = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+			}
+			if !strings.Contains(resp.Header.Get("Set-Cookie"), microsoftStateCookie+"=;") {
+				t.Errorf("Set-Cookie = %q, want the state cookie cleared", resp.Header.Get("Set-Cookie"))
+			}
+		})
+	}
+}
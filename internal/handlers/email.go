@@ -4,26 +4,38 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/wizenheimer/swiftcal/internal/config"
 	"github.com/wizenheimer/swiftcal/internal/models"
 	"github.com/wizenheimer/swiftcal/internal/services"
+	"github.com/wizenheimer/swiftcal/internal/utils"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/mailgun/mailgun-go/v4"
 	"github.com/wizenheimer/swiftcal/pkg/logger"
 	"go.uber.org/zap"
 )
 
 type EmailHandler struct {
-	emailService *services.EmailService
-	config       *config.Config
+	queueService      *services.QueueService
+	mailgun           *services.MailgunProvider
+	mailgunVerifier   *services.MailgunVerifier
+	mailAuthenticator *services.MailAuthenticator
+	config            *config.Config
 }
 
-func NewEmailHandler(emailService *services.EmailService, cfg *config.Config) *EmailHandler {
+func NewEmailHandler(queueService *services.QueueService, cfg *config.Config) *EmailHandler {
 	return &EmailHandler{
-		emailService: emailService,
-		config:       cfg,
+		queueService:      queueService,
+		mailgun:           services.NewMailgunProvider(cfg),
+		mailgunVerifier:   services.NewMailgunVerifier(cfg),
+		mailAuthenticator: services.NewMailAuthenticator(cfg),
+		config:            cfg,
 	}
 }
 
@@ -34,12 +46,14 @@ func (h *EmailHandler) HandleMailgunWebhook(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check spam filtering headers from Mailgun
-	spamFlag := c.Get("X-Mailgun-Sflag")
-	spamScore := c.Get("X-Mailgun-Sscore")
+	token, ok := h.verifyMailgunRequest(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid webhook signature",
+		})
+	}
 
-	if spamFlag == "Yes" || (spamScore != "" && spamScore > "0.5") {
-		logger.GetLogger().Warn("Rejected spam email", zap.String("spam_flag", spamFlag), zap.String("spam_score", spamScore))
+	if h.isMailgunSpam(c) {
 		return c.JSON(fiber.Map{
 			"message": "rejected spam",
 		})
@@ -54,24 +68,177 @@ func (h *EmailHandler) HandleMailgunWebhook(c *fiber.Ctx) error {
 		})
 	}
 
-	// Process the email
-	if err := h.emailService.HandleWebhook(c.Context(), webhook, files); err != nil {
-		logger.GetLogger().Error("Failed to process email webhook", zap.Error(err))
+	err = h.dispatchWebhook(c, webhook, files)
+	if c.Response().StatusCode() >= http.StatusInternalServerError {
+		// Let Mailgun's retry through the replay check
+		h.mailgunVerifier.Release(token)
+	}
+	return err
+}
+
+// HandleMailgunMIMEWebhook handles Mailgun routes that forward to a URL ending in
+// "mime", which post the full message as body-mime, and store() notifications
+// that only carry a message-url.
+func (h *EmailHandler) HandleMailgunMIMEWebhook(c *fiber.Ctx) error {
+	token, ok := h.verifyMailgunRequest(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid webhook signature",
+		})
+	}
+
+	if h.isMailgunSpam(c) {
+		return c.JSON(fiber.Map{
+			"message": "rejected spam",
+		})
+	}
+
+	raw := c.FormValue("body-mime")
+	if raw == "" {
+		messageURL := c.FormValue("message-url")
+		if !isMailgunStorageURL(messageURL) {
+			logger.GetLogger().Error("Mailgun MIME webhook has no message body", zap.String("message_url", messageURL))
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "Missing message body",
+			})
+		}
+
+		stored, err := h.mailgun.GetStoredMessageRaw(c.Context(), messageURL)
+		if err != nil {
+			logger.GetLogger().Error("Failed to fetch stored message", zap.Error(err))
+			h.mailgunVerifier.Release(token)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch message",
+			})
+		}
+		raw = stored
+	}
+
+	var recipients []string
+	if recipient := c.FormValue("recipient"); recipient != "" {
+		recipients = append(recipients, recipient)
+	}
+
+	err := h.ingestRawEmail(c, []byte(raw), c.FormValue("sender"), recipients)
+	if c.Response().StatusCode() >= http.StatusInternalServerError {
+		h.mailgunVerifier.Release(token)
+	}
+	return err
+}
+
+// HandleRawEmail accepts a message/rfc822 request body, such as an .eml file
+// posted by a local MTA. The route is guarded by the raw email bearer token.
+func (h *EmailHandler) HandleRawEmail(c *fiber.Ctx) error {
+	raw := c.Body()
+	if len(raw) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Missing message body",
+		})
+	}
+
+	// Envelope data is optional; without it the From and To headers are used
+	var recipients []string
+	for _, recipient := range strings.Split(c.Get("X-Envelope-To"), ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			recipients = append(recipients, recipient)
+		}
+	}
+
+	return h.ingestRawEmail(c, raw, c.Get("X-Envelope-From"), recipients)
+}
+
+func (h *EmailHandler) ingestRawEmail(c *fiber.Ctx, raw []byte, sender string, recipients []string) error {
+	webhook, files, err := h.webhookFromRawEmail(raw, sender, recipients)
+	if err != nil {
+		logger.GetLogger().Error("Failed to parse raw email", zap.Error(err))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse email",
+		})
+	}
+
+	// We have the signed bytes, so DKIM can be verified here. SPF needs the
+	// connecting IP, which only the receiving MTA saw; its result is read from
+	// that MTA's trusted Authentication-Results or Received-SPF header.
+	webhook.DKIM = h.mailAuthenticator.VerifyDKIM(raw)
+
+	return h.dispatchWebhook(c, webhook, files)
+}
+
+func (h *EmailHandler) webhookFromRawEmail(raw []byte, sender string, recipients []string) (*models.EmailWebhook, []models.EmailFile, error) {
+	parsed, err := utils.ParseEmailMessage(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return utils.BuildEmailWebhook(parsed, sender, recipients), h.filterAttachments(parsed.Attachments), nil
+}
+
+// dispatchWebhook queues a normalized email for the workers and writes the
+// response. Providers are acknowledged as soon as the job is stored.
+func (h *EmailHandler) dispatchWebhook(c *fiber.Ctx, webhook *models.EmailWebhook, files []models.EmailFile) error {
+	jobID, err := h.queueService.Enqueue(c.Context(), webhook, files)
+	if err != nil {
+		logger.GetLogger().Error("Failed to queue email webhook", zap.Error(err))
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to process email",
+			"error": "Failed to queue email",
 		})
 	}
 
 	return c.JSON(fiber.Map{
-		"message": "Email processed successfully",
+		"message": "Email queued",
+		"job_id":  jobID,
 	})
 }
 
+// filterAttachments applies the attachment limits to parts recovered from a MIME tree
+func (h *EmailHandler) filterAttachments(attachments []models.EmailFile) []models.EmailFile {
+	var files []models.EmailFile
+	var totalSize int64
+
+	for _, attachment := range attachments {
+		size := int64(len(attachment.Content))
+		if !h.acceptAttachment(attachment.Filename, attachment.MimeType, size, totalSize) {
+			continue
+		}
+
+		totalSize += size
+		files = append(files, attachment)
+	}
+
+	return files
+}
+
+// verifyMailgunRequest checks the request signature and returns its token so the
+// caller can release it if processing fails
+func (h *EmailHandler) verifyMailgunRequest(c *fiber.Ctx) (string, bool) {
+	token := c.FormValue("token")
+	if err := h.mailgunVerifier.Verify(c.FormValue("timestamp"), token, c.FormValue("signature")); err != nil {
+		logger.GetLogger().Warn("Rejected unverified Mailgun webhook",
+			zap.Error(err),
+			zap.String("ip", c.IP()))
+		return "", false
+	}
+
+	return token, true
+}
+
+func (h *EmailHandler) isMailgunSpam(c *fiber.Ctx) bool {
+	// Check spam filtering headers from Mailgun
+	spamFlag := c.Get("X-Mailgun-Sflag")
+	spamScore := c.Get("X-Mailgun-Sscore")
+
+	if spamFlag == "Yes" || (spamScore != "" && spamScore > "0.5") {
+		logger.GetLogger().Warn("Rejected spam email", zap.String("spam_flag", spamFlag), zap.String("spam_score", spamScore))
+		return true
+	}
+
+	return false
+}
+
 func (h *EmailHandler) parseMailgunWebhook(c *fiber.Ctx) (*models.EmailWebhook, []models.EmailFile, error) {
-	// Mailgun sends webhook data as form-encoded data, not multipart form data
-	// Parse form data using FormValue instead of MultipartForm
+	// Mailgun sends form-encoded data, or multipart when the message has attachments.
+	// FormValue handles both.
 	webhook := &models.EmailWebhook{}
-	var files []models.EmailFile
 
 	// Extract form values using FormValue
 	getValue := func(key string) string {
@@ -97,66 +264,184 @@ func (h *EmailHandler) parseMailgunWebhook(c *fiber.Ctx) (*models.EmailWebhook,
 	envelopeBytes, _ := json.Marshal(envelope)
 	webhook.Envelope = string(envelopeBytes)
 
-	// Set spam filtering results (default to pass since we filtered at header level)
-	webhook.SPF = "pass"
-	webhook.DKIM = "pass"
+	// Mailgun records its own SPF and DKIM checks as headers on the message.
+	// Trusted Authentication-Results headers refine these in the email service.
+	webhook.SPF = strings.ToLower(utils.HeaderValue(webhook.Headers, "X-Mailgun-Spf"))
+	webhook.DKIM = strings.ToLower(utils.HeaderValue(webhook.Headers, "X-Mailgun-Dkim-Check-Result"))
 
-	// Note: Mailgun typically doesn't send file attachments in webhooks
-	// If you need to handle attachments, you would need to fetch them separately
-	// using Mailgun's API with the message ID
+	files, err := h.parseMailgunAttachments(c)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse attachments: %w", err)
+	}
 
 	return webhook, files, nil
 }
 
+// parseMailgunAttachments collects attachments from either the forward() action,
+// which posts them as attachment-N multipart files, or the store() action, which
+// posts a JSON list of URLs to fetch from Mailgun's storage.
+func (h *EmailHandler) parseMailgunAttachments(c *fiber.Ctx) ([]models.EmailFile, error) {
+	if stored := c.FormValue("attachments"); stored != "" {
+		return h.fetchStoredAttachments(c, stored)
+	}
+
+	count, _ := strconv.Atoi(c.FormValue("attachment-count"))
+	if count == 0 {
+		return nil, nil
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read multipart form: %w", err)
+	}
+
+	var files []models.EmailFile
+	var totalSize int64
+
+	for i := 1; i <= count; i++ {
+		headers := form.File[fmt.Sprintf("attachment-%d", i)]
+		if len(headers) == 0 {
+			continue
+		}
+		header := headers[0]
+		contentType := header.Header.Get("Content-Type")
+
+		if !h.acceptAttachment(header.Filename, contentType, header.Size, totalSize) {
+			continue
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open attachment %d: %w", i, err)
+		}
+		content, err := io.ReadAll(io.LimitReader(file, h.config.MaxAttachmentSize+1))
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment %d: %w", i, err)
+		}
+
+		if !h.acceptAttachment(header.Filename, contentType, int64(len(content)), totalSize) {
+			continue
+		}
+
+		totalSize += int64(len(content))
+		files = append(files, models.EmailFile{
+			Filename: header.Filename,
+			Content:  content,
+			MimeType: utils.NormalizeMimeType(contentType),
+		})
+	}
+
+	return files, nil
+}
+
+func (h *EmailHandler) fetchStoredAttachments(c *fiber.Ctx, stored string) ([]models.EmailFile, error) {
+	var attachments []mailgun.StoredAttachment
+	if err := json.Unmarshal([]byte(stored), &attachments); err != nil {
+		return nil, fmt.Errorf("failed to decode stored attachments: %w", err)
+	}
+
+	var files []models.EmailFile
+	var totalSize int64
+
+	for _, attachment := range attachments {
+		if !h.acceptAttachment(attachment.Name, attachment.ContentType, int64(attachment.Size), totalSize) {
+			continue
+		}
+
+		if !isMailgunStorageURL(attachment.Url) {
+			logger.GetLogger().Warn("Skipping stored attachment with unexpected URL",
+				zap.String("filename", attachment.Name),
+				zap.String("url", attachment.Url))
+			continue
+		}
+
+		content, err := h.mailgun.GetStoredAttachment(c.Context(), attachment.Url)
+		if err != nil {
+			return nil, err
+		}
+
+		// The declared size comes from the request, so check what we actually received
+		if !h.acceptAttachment(attachment.Name, attachment.ContentType, int64(len(content)), totalSize) {
+			continue
+		}
+
+		totalSize += int64(len(content))
+		files = append(files, models.EmailFile{
+			Filename: attachment.Name,
+			Content:  content,
+			MimeType: utils.NormalizeMimeType(attachment.ContentType),
+		})
+	}
+
+	return files, nil
+}
+
+// acceptAttachment applies the content type allowlist and the per-file and total size limits
+func (h *EmailHandler) acceptAttachment(filename, contentType string, size, totalSize int64) bool {
+	if !utils.IsCalendarAttachment(filename, contentType) {
+		logger.GetLogger().Debug("Skipping unsupported attachment",
+			zap.String("filename", filename),
+			zap.String("content_type", contentType))
+		return false
+	}
+
+	if size > h.config.MaxAttachmentSize {
+		logger.GetLogger().Warn("Skipping attachment over size limit",
+			zap.String("filename", filename),
+			zap.Int64("size", size),
+			zap.Int64("limit", h.config.MaxAttachmentSize))
+		return false
+	}
+
+	if totalSize+size > h.config.MaxAttachmentsTotalSize {
+		logger.GetLogger().Warn("Skipping attachment over total size limit",
+			zap.String("filename", filename),
+			zap.Int64("size", size),
+			zap.Int64("limit", h.config.MaxAttachmentsTotalSize))
+		return false
+	}
+
+	return true
+}
+
+// isMailgunStorageURL guards against fetching arbitrary URLs with our API key
+func isMailgunStorageURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	return host == "mailgun.net" || strings.HasSuffix(host, ".mailgun.net")
+}
+
 func (h *EmailHandler) constructMailgunHeaders(messageHeaders, timestamp, subject, from, to string) string {
-	headers := ""
-	var messageID string
-	var existingReferences string
+	var headersList [][2]string
 
 	// Parse message-headers if available
 	if messageHeaders != "" {
-		var headersList [][2]string
-		if err := json.Unmarshal([]byte(messageHeaders), &headersList); err == nil {
-			for _, header := range headersList {
-				headers += fmt.Sprintf("%s: %s\n", header[0], header[1])
-
-				if header[0] == "Message-Id" {
-					messageID = header[1]
-				}
-				if header[0] == "References" {
-					existingReferences = header[1]
-				}
-			}
+		if err := json.Unmarshal([]byte(messageHeaders), &headersList); err != nil {
+			headersList = nil
 		}
 	}
 
 	// Fallback headers if message-headers parsing failed
-	if headers == "" {
+	if len(headersList) == 0 {
 		if timestamp != "" {
 			// Convert timestamp to date
-			headers += fmt.Sprintf("Date: %s\n", timestamp)
+			headersList = append(headersList, [2]string{"Date", timestamp})
 		}
 		if subject != "" {
-			headers += fmt.Sprintf("Subject: %s\n", subject)
+			headersList = append(headersList, [2]string{"Subject", subject})
 		}
 		if from != "" {
-			headers += fmt.Sprintf("From: %s\n", from)
+			headersList = append(headersList, [2]string{"From", from})
 		}
 		if to != "" {
-			headers += fmt.Sprintf("To: %s\n", to)
-		}
-	}
-
-	// Add threading headers for responses
-	if messageID != "" {
-		headers += fmt.Sprintf("In-Reply-To: %s\n", messageID)
-
-		if existingReferences != "" {
-			headers += fmt.Sprintf("References: %s %s\n", existingReferences, messageID)
-		} else {
-			headers += fmt.Sprintf("References: %s\n", messageID)
+			headersList = append(headersList, [2]string{"To", to})
 		}
 	}
 
-	return headers
+	return utils.FormatHeaders(headersList)
 }
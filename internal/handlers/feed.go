@@ -0,0 +1,48 @@
+// internal/handlers/feed.go
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/services"
+	"github.com/wizenheimer/swiftcal/pkg/logger"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+type FeedHandler struct {
+	feedService *services.FeedService
+	config      *config.Config
+}
+
+func NewFeedHandler(feedService *services.FeedService, cfg *config.Config) *FeedHandler {
+	return &FeedHandler{
+		feedService: feedService,
+		config:      cfg,
+	}
+}
+
+// GetFeed serves a user's events as an iCalendar feed. The token in the URL
+// is the only credential, so unknown and revoked tokens look the same.
+func (h *FeedHandler) GetFeed(c *fiber.Ctx) error {
+	content, err := h.feedService.RenderFeed(c.Context(), c.Params("token"))
+	if err != nil {
+		if errors.Is(err, services.ErrFeedNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{
+				"error": "Feed not found",
+			})
+		}
+
+		logger.GetLogger().Error("Failed to render calendar feed", zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to render feed",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+	c.Set(fiber.HeaderCacheControl, "private, max-age=300")
+	return c.Send(content)
+}
@@ -0,0 +1,156 @@
+// internal/handlers/postmark.go
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/internal/models"
+	"github.com/wizenheimer/swiftcal/internal/utils"
+	"github.com/wizenheimer/swiftcal/pkg/logger"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+type postmarkAddress struct {
+	Email string `json:"Email"`
+	Name  string `json:"Name"`
+}
+
+type postmarkInbound struct {
+	From              string            `json:"From"`
+	FromFull          postmarkAddress   `json:"FromFull"`
+	To                string            `json:"To"`
+	ToFull            []postmarkAddress `json:"ToFull"`
+	OriginalRecipient string            `json:"OriginalRecipient"`
+	Subject           string            `json:"Subject"`
+	Date              string            `json:"Date"`
+	TextBody          string            `json:"TextBody"`
+	HtmlBody          string            `json:"HtmlBody"`
+	Headers           []struct {
+		Name  string `json:"Name"`
+		Value string `json:"Value"`
+	} `json:"Headers"`
+	Attachments []struct {
+		Name          string `json:"Name"`
+		Content       string `json:"Content"`
+		ContentType   string `json:"ContentType"`
+		ContentLength int64  `json:"ContentLength"`
+	} `json:"Attachments"`
+}
+
+// HandlePostmarkWebhook handles Postmark inbound JSON posts. Postmark does not
+// sign these requests, so the route is protected with basic auth in main.
+func (h *EmailHandler) HandlePostmarkWebhook(c *fiber.Ctx) error {
+	webhook, files, err := h.parsePostmarkWebhook(c)
+	if err != nil {
+		logger.GetLogger().Error("Failed to parse Postmark webhook", zap.Error(err))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse webhook data",
+		})
+	}
+
+	return h.dispatchWebhook(c, webhook, files)
+}
+
+func (h *EmailHandler) parsePostmarkWebhook(c *fiber.Ctx) (*models.EmailWebhook, []models.EmailFile, error) {
+	var inbound postmarkInbound
+	if err := json.Unmarshal(c.Body(), &inbound); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode payload: %w", err)
+	}
+
+	webhook := &models.EmailWebhook{
+		Subject: inbound.Subject,
+		Text:    inbound.TextBody,
+		HTML:    inbound.HtmlBody,
+		From:    inbound.From,
+		To:      inbound.OriginalRecipient,
+	}
+
+	// Postmark formats offsets with a colon, e.g. "Fri, 1 Aug 2014 16:45:32 -04:00"
+	for _, layout := range []string{"Mon, 2 Jan 2006 15:04:05 -07:00", time.RFC1123Z} {
+		if date, err := time.Parse(layout, inbound.Date); err == nil {
+			webhook.Timestamp = strconv.FormatInt(date.Unix(), 10)
+			break
+		}
+	}
+
+	var headers [][2]string
+	headers = append(headers,
+		[2]string{"Date", inbound.Date},
+		[2]string{"Subject", inbound.Subject},
+		[2]string{"From", inbound.From},
+		[2]string{"To", inbound.To},
+	)
+	// Postmark adds its own Received-SPF and Return-Path above the sender's,
+	// so only the first of each is its own. FromFull is the From header, not
+	// the address SPF checked, so it can't be the envelope sender.
+	var spfDomain, returnPath string
+	seenSPF := false
+	for _, header := range inbound.Headers {
+		headers = append(headers, [2]string{header.Name, header.Value})
+
+		switch strings.ToLower(header.Name) {
+		case "received-spf":
+			if !seenSPF {
+				seenSPF = true
+				spf := utils.ParseReceivedSPF(header.Value)
+				webhook.SPF, spfDomain = spf.Result, spf.Domain
+			}
+		case "return-path":
+			if returnPath == "" {
+				returnPath = strings.Trim(strings.TrimSpace(header.Value), "<>")
+			}
+		case "x-spam-tests":
+			if strings.Contains(header.Value, "DKIM_VALID") {
+				webhook.DKIM = "pass"
+			}
+		}
+	}
+	webhook.Headers = utils.FormatHeaders(headers)
+
+	sender := spfDomain
+	if sender == "" {
+		sender = returnPath
+	}
+
+	envelope := map[string]interface{}{
+		"from": sender,
+		"to":   []string{inbound.OriginalRecipient},
+	}
+	envelopeBytes, _ := json.Marshal(envelope)
+	webhook.Envelope = string(envelopeBytes)
+
+	var files []models.EmailFile
+	var totalSize int64
+
+	for _, attachment := range inbound.Attachments {
+		if !h.acceptAttachment(attachment.Name, attachment.ContentType, attachment.ContentLength, totalSize) {
+			continue
+		}
+
+		content, err := base64.StdEncoding.DecodeString(attachment.Content)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode attachment %s: %w", attachment.Name, err)
+		}
+
+		if !h.acceptAttachment(attachment.Name, attachment.ContentType, int64(len(content)), totalSize) {
+			continue
+		}
+
+		totalSize += int64(len(content))
+		files = append(files, models.EmailFile{
+			Filename: attachment.Name,
+			Content:  content,
+			MimeType: utils.NormalizeMimeType(attachment.ContentType),
+		})
+	}
+
+	return webhook, files, nil
+}
@@ -0,0 +1,149 @@
+// internal/handlers/sendgrid.go
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/wizenheimer/swiftcal/internal/models"
+	"github.com/wizenheimer/swiftcal/internal/utils"
+	"github.com/wizenheimer/swiftcal/pkg/logger"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// HandleSendGridWebhook handles SendGrid Inbound Parse posts. SendGrid does not
+// sign these requests, so the route is protected with basic auth in main.
+func (h *EmailHandler) HandleSendGridWebhook(c *fiber.Ctx) error {
+	webhook, files, err := h.parseSendGridWebhook(c)
+	if err != nil {
+		logger.GetLogger().Error("Failed to parse SendGrid webhook", zap.Error(err))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse webhook data",
+		})
+	}
+
+	return h.dispatchWebhook(c, webhook, files)
+}
+
+func (h *EmailHandler) parseSendGridWebhook(c *fiber.Ctx) (*models.EmailWebhook, []models.EmailFile, error) {
+	var envelope struct {
+		From string   `json:"from"`
+		To   []string `json:"to"`
+	}
+	if err := json.Unmarshal([]byte(c.FormValue("envelope")), &envelope); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode envelope: %w", err)
+	}
+
+	// With "POST the raw, full MIME message" enabled the content arrives as one field
+	if raw := c.FormValue("email"); raw != "" {
+		webhook, files, err := h.webhookFromRawEmail([]byte(raw), envelope.From, envelope.To)
+		if err != nil {
+			return nil, nil, err
+		}
+		webhook.SPF = c.FormValue("SPF")
+		webhook.DKIM = c.FormValue("dkim")
+		return webhook, files, nil
+	}
+
+	// The parsed payload already uses the field names EmailWebhook was modelled on
+	webhook := &models.EmailWebhook{
+		Subject:  c.FormValue("subject"),
+		Text:     c.FormValue("text"),
+		HTML:     c.FormValue("html"),
+		From:     c.FormValue("from"),
+		To:       c.FormValue("to"),
+		Envelope: c.FormValue("envelope"),
+		SPF:      c.FormValue("SPF"),
+		DKIM:     c.FormValue("dkim"),
+	}
+
+	headers, err := utils.ParseHeaderBlock(c.FormValue("headers"))
+	if err != nil {
+		return nil, nil, err
+	}
+	webhook.Headers = utils.FormatHeaders(headers)
+
+	files, err := h.parseSendGridAttachments(c)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse attachments: %w", err)
+	}
+
+	return webhook, files, nil
+}
+
+func (h *EmailHandler) parseSendGridAttachments(c *fiber.Ctx) ([]models.EmailFile, error) {
+	count, _ := strconv.Atoi(c.FormValue("attachments"))
+	if count == 0 {
+		return nil, nil
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read multipart form: %w", err)
+	}
+
+	var info map[string]struct {
+		Filename string `json:"filename"`
+		Type     string `json:"type"`
+	}
+	if raw := c.FormValue("attachment-info"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &info); err != nil {
+			logger.GetLogger().Warn("Failed to decode SendGrid attachment-info", zap.Error(err))
+		}
+	}
+
+	var files []models.EmailFile
+	var totalSize int64
+
+	for i := 1; i <= count; i++ {
+		key := fmt.Sprintf("attachment%d", i)
+		headers := form.File[key]
+		if len(headers) == 0 {
+			continue
+		}
+		header := headers[0]
+
+		filename := header.Filename
+		contentType := header.Header.Get("Content-Type")
+		if meta, ok := info[key]; ok {
+			if meta.Filename != "" {
+				filename = meta.Filename
+			}
+			if meta.Type != "" {
+				contentType = meta.Type
+			}
+		}
+
+		if !h.acceptAttachment(filename, contentType, header.Size, totalSize) {
+			continue
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", key, err)
+		}
+		content, err := io.ReadAll(io.LimitReader(file, h.config.MaxAttachmentSize+1))
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", key, err)
+		}
+
+		if !h.acceptAttachment(filename, contentType, int64(len(content)), totalSize) {
+			continue
+		}
+
+		totalSize += int64(len(content))
+		files = append(files, models.EmailFile{
+			Filename: filename,
+			Content:  content,
+			MimeType: utils.NormalizeMimeType(contentType),
+		})
+	}
+
+	return files, nil
+}
@@ -0,0 +1,137 @@
+// internal/handlers/smtp.go
+package handlers
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/models"
+	"github.com/wizenheimer/swiftcal/internal/services"
+	"github.com/wizenheimer/swiftcal/pkg/logger"
+
+	"github.com/emersion/go-smtp"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// MailQueue stores accepted messages for the workers. Tests can supply one
+// that records them instead of writing to the database.
+type MailQueue interface {
+	Enqueue(ctx context.Context, webhook *models.EmailWebhook, files []models.EmailFile) (uuid.UUID, error)
+}
+
+// SMTPBackend accepts mail directly over SMTP or LMTP, for self-hosted
+// deployments that don't use a third-party inbound webhook.
+type SMTPBackend struct {
+	emailHandler  *EmailHandler
+	queue         MailQueue
+	authenticator *services.MailAuthenticator
+	config        *config.Config
+}
+
+func NewSMTPBackend(emailHandler *EmailHandler, authenticator *services.MailAuthenticator, cfg *config.Config) *SMTPBackend {
+	return &SMTPBackend{
+		emailHandler:  emailHandler,
+		queue:         emailHandler.queueService,
+		authenticator: authenticator,
+		config:        cfg,
+	}
+}
+
+func (b *SMTPBackend) NewSession(c *smtp.Conn) (smtp.Session, error) {
+	session := &smtpSession{
+		backend: b,
+		helo:    c.Hostname(),
+	}
+
+	if addr, ok := c.Conn().RemoteAddr().(*net.TCPAddr); ok {
+		session.remoteIP = addr.IP
+	}
+
+	return session, nil
+}
+
+type smtpSession struct {
+	backend    *SMTPBackend
+	remoteIP   net.IP
+	helo       string
+	from       string
+	recipients []string
+}
+
+func (s *smtpSession) Mail(from string, opts *smtp.MailOptions) error {
+	s.from = from
+	return nil
+}
+
+func (s *smtpSession) Rcpt(to string, opts *smtp.RcptOptions) error {
+	at := strings.LastIndex(to, "@")
+	if at < 0 || !strings.EqualFold(to[at+1:], s.backend.config.EmailDomain) {
+		return &smtp.SMTPError{
+			Code:         550,
+			EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+			Message:      "Relaying denied",
+		}
+	}
+
+	s.recipients = append(s.recipients, to)
+	return nil
+}
+
+func (s *smtpSession) Data(r io.Reader) error {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	webhook, files, err := s.backend.emailHandler.webhookFromRawEmail(raw, s.from, s.recipients)
+	if err != nil {
+		logger.GetLogger().Warn("Rejected unparseable SMTP message", zap.Error(err))
+		return &smtp.SMTPError{
+			Code:         554,
+			EnhancedCode: smtp.EnhancedCode{5, 6, 0},
+			Message:      "Message could not be parsed",
+		}
+	}
+
+	// Over LMTP we sit behind a trusted MTA and the peer address is that MTA's,
+	// so the SPF result comes from the headers it added, matched by authserv-id
+	if s.backend.config.SMTPMode != config.SMTPModeLMTP && s.remoteIP != nil {
+		webhook.SPF = s.backend.authenticator.CheckSPF(s.remoteIP, s.helo, s.from)
+	}
+	webhook.DKIM = s.backend.authenticator.VerifyDKIM(raw)
+
+	logger.GetLogger().Info("Received message over SMTP",
+		zap.String("from", s.from),
+		zap.Strings("recipients", s.recipients),
+		zap.String("spf", webhook.SPF),
+		zap.String("dkim", webhook.DKIM))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := s.backend.queue.Enqueue(ctx, webhook, files); err != nil {
+		logger.GetLogger().Error("Failed to queue SMTP message", zap.Error(err))
+		// A temporary failure makes the sending MTA retry later
+		return &smtp.SMTPError{
+			Code:         451,
+			EnhancedCode: smtp.EnhancedCode{4, 3, 0},
+			Message:      "Temporary processing failure",
+		}
+	}
+
+	return nil
+}
+
+func (s *smtpSession) Reset() {
+	s.from = ""
+	s.recipients = nil
+}
+
+func (s *smtpSession) Logout() error {
+	return nil
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/models"
+	"github.com/wizenheimer/swiftcal/internal/services"
+
+	"github.com/emersion/go-smtp"
+	"github.com/google/uuid"
+)
+
+// fakeMailQueue records queued messages, or fails like a database outage
+type fakeMailQueue struct {
+	mu       sync.Mutex
+	webhooks []*models.EmailWebhook
+	err      error
+}
+
+func (q *fakeMailQueue) Enqueue(ctx context.Context, webhook *models.EmailWebhook, files []models.EmailFile) (uuid.UUID, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.err != nil {
+		return uuid.Nil, q.err
+	}
+	q.webhooks = append(q.webhooks, webhook)
+	return uuid.New(), nil
+}
+
+func (q *fakeMailQueue) queued() []*models.EmailWebhook {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.webhooks
+}
+
+// startSMTPListener serves the backend on a loopback port, configured as
+// cmd/server configures the real listener
+func startSMTPListener(t *testing.T, mode string, queue MailQueue) string {
+	cfg := &config.Config{
+		EmailDomain:         "cal.example.com",
+		SMTPMode:            mode,
+		SMTPMaxMessageBytes: 4096,
+	}
+	backend := NewSMTPBackend(NewEmailHandler(nil, cfg), services.NewMailAuthenticator(cfg), cfg)
+	backend.queue = queue
+
+	server := smtp.NewServer(backend)
+	server.LMTP = mode == config.SMTPModeLMTP
+	server.Domain = cfg.EmailDomain
+	server.MaxMessageBytes = cfg.SMTPMaxMessageBytes
+	server.MaxRecipients = 50
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return listener.Addr().String()
+}
+
+const smtpTestMessage = "From: Priya Shah <priya@example.com>\r\n" +
+	"To: add@cal.example.com\r\n" +
+	"Subject: Design review Thursday 3pm\r\n" +
+	"Date: Tue, 13 Oct 2026 16:12:00 +0100\r\n" +
+	"Message-ID: <CAF=1234@mail.example.com>\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Design review on Thursday 15 October at 3pm in Room 4.\r\n"
+
+// send writes one message through an open client
+func send(client *smtp.Client, from string, to []string, message string) error {
+	if err := client.Mail(from, nil); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt, nil); err != nil {
+			return err
+		}
+	}
+
+	data, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := data.Write([]byte(message)); err != nil {
+		return err
+	}
+	return data.Close()
+}
+
+func smtpCode(err error) int {
+	var smtpErr *smtp.SMTPError
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code
+	}
+	return 0
+}
+
+func TestSMTPListener(t *testing.T) {
+	queue := &fakeMailQueue{}
+	addr := startSMTPListener(t, config.SMTPModeSMTP, queue)
+
+	client, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+	if err := client.Hello("mail.example.com"); err != nil {
+		t.Fatalf("EHLO: %v", err)
+	}
+
+	if size, ok := client.MaxMessageSize(); !ok || size != 4096 {
+		t.Errorf("advertised SIZE = %d, %v, want 4096", size, ok)
+	}
+
+	// Only our own domain is accepted, whatever its case
+	if err := client.Mail("priya@example.com", nil); err != nil {
+		t.Fatalf("MAIL: %v", err)
+	}
+	for _, rcpt := range []string{"sam@gmail.com", "add@cal.example.com.evil.test", "add@sub.cal.example.com"} {
+		if err := client.Rcpt(rcpt, nil); smtpCode(err) != 550 {
+			t.Errorf("RCPT %s: err = %v, want 550", rcpt, err)
+		}
+	}
+	if err := client.Rcpt("Add@CAL.Example.com", nil); err != nil {
+		t.Fatalf("RCPT: %v", err)
+	}
+	data, err := client.Data()
+	if err != nil {
+		t.Fatalf("DATA: %v", err)
+	}
+	data.Write([]byte(smtpTestMessage))
+	if err := data.Close(); err != nil {
+		t.Fatalf("end of DATA: %v", err)
+	}
+
+	queued := queue.queued()
+	if len(queued) != 1 {
+		t.Fatalf("queued %d messages, want 1", len(queued))
+	}
+	if queued[0].Subject != "Design review Thursday 3pm" || queued[0].To != "Add@CAL.Example.com" {
+		t.Errorf("queued %q to %q", queued[0].Subject, queued[0].To)
+	}
+	if !strings.Contains(queued[0].Envelope, `"from":"priya@example.com"`) {
+		t.Errorf("envelope = %s", queued[0].Envelope)
+	}
+
+	// A message over the limit is refused and never queued
+	large := smtpTestMessage + strings.Repeat("Agenda item to go through.\r\n", 200)
+	if err := client.Mail("priya@example.com", &smtp.MailOptions{Size: int64(len(large))}); smtpCode(err) != 552 {
+		t.Errorf("MAIL with SIZE=%d: err = %v, want 552", len(large), err)
+	}
+	client.Reset()
+	if err := send(client, "priya@example.com", []string{"add@cal.example.com"}, large); smtpCode(err) != 552 {
+		t.Errorf("sending %d bytes: err = %v, want 552", len(large), err)
+	}
+	if len(queue.queued()) != 1 {
+		t.Errorf("queued %d messages, want the oversized one refused", len(queue.queued()))
+	}
+
+	// If the queue is down the sender is told to retry
+	queue.mu.Lock()
+	queue.err = errors.New("connection refused")
+	queue.mu.Unlock()
+	if err := send(client, "priya@example.com", []string{"add@cal.example.com"}, smtpTestMessage); smtpCode(err) != 451 {
+		t.Errorf("sending while the queue is down: err = %v, want 451", err)
+	}
+}
+
+func TestLMTPListenerRepliesPerRecipient(t *testing.T) {
+	queue := &fakeMailQueue{}
+	addr := startSMTPListener(t, config.SMTPModeLMTP, queue)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	client := smtp.NewClientLMTP(conn)
+	defer client.Close()
+	if err := client.Hello("mx.example.com"); err != nil {
+		t.Fatalf("LHLO: %v", err)
+	}
+
+	deliver := func() (map[string]*smtp.DataResponse, error) {
+		// The client only forgets the last transaction's recipients on RSET
+		if err := client.Reset(); err != nil {
+			return nil, err
+		}
+		if err := client.Mail("priya@example.com", nil); err != nil {
+			return nil, err
+		}
+		for _, rcpt := range []string{"add@cal.example.com", "sam@example.org", "team@cal.example.com"} {
+			if err := client.Rcpt(rcpt, nil); err != nil && rcpt != "sam@example.org" {
+				return nil, err
+			}
+		}
+
+		data, err := client.Data()
+		if err != nil {
+			return nil, err
+		}
+		data.Write([]byte(smtpTestMessage))
+		return data.CloseWithLMTPResponse()
+	}
+
+	// Each accepted recipient gets its own reply; the refused one gets none
+	replies, err := deliver()
+	if err != nil {
+		t.Fatalf("delivering: %v", err)
+	}
+	if len(replies) != 2 || replies["add@cal.example.com"] == nil || replies["team@cal.example.com"] == nil {
+		t.Errorf("replies = %v, want one for each of our addresses", replies)
+	}
+
+	queued := queue.queued()
+	if len(queued) != 1 || queued[0].To != "add@cal.example.com, team@cal.example.com" {
+		t.Fatalf("queued = %+v, want one message to both of our addresses", queued)
+	}
+	// Behind an MTA the loopback peer is that MTA, so no SPF check is made
+	if queued[0].SPF != "" {
+		t.Errorf("SPF = %q, want it left to the MTA's headers", queued[0].SPF)
+	}
+
+	queue.mu.Lock()
+	queue.err = errors.New("connection refused")
+	queue.mu.Unlock()
+
+	_, err = deliver()
+	var lmtpErr smtp.LMTPDataError
+	if !errors.As(err, &lmtpErr) {
+		t.Fatalf("delivering while the queue is down: err = %v, want per-recipient errors", err)
+	}
+	for _, rcpt := range []string{"add@cal.example.com", "team@cal.example.com"} {
+		if reply := lmtpErr[rcpt]; reply == nil || reply.Code != 451 {
+			t.Errorf("reply for %s = %v, want 451", rcpt, reply)
+		}
+	}
+}
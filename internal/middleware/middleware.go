@@ -2,6 +2,7 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -31,3 +32,21 @@ func RequestLogger() fiber.Handler {
 		return err
 	}
 }
+
+// BearerAuth rejects requests whose Authorization header doesn't carry the given token
+func BearerAuth(token string) fiber.Handler {
+	expected := []byte("Bearer " + token)
+
+	return func(c *fiber.Ctx) error {
+		if token == "" || subtle.ConstantTimeCompare([]byte(c.Get("Authorization")), expected) != 1 {
+			logger.GetLogger().Warn("Rejected unauthorized request",
+				zap.String("path", c.Path()),
+				zap.String("ip", c.IP()))
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -22,3 +22,20 @@ type PendingEmailAddress struct {
 	CreatedAt        time.Time `json:"created_at" db:"created_at"`
 	ExpiresAt        time.Time `json:"expires_at" db:"expires_at"`
 }
+
+// Processed message states. A message stays processing while a worker holds it.
+const (
+	MessageStatusProcessing = "processing"
+	MessageStatusDone       = "done"
+)
+
+// ProcessedMessage records an inbound message so redeliveries are recognised.
+// MessageKey is the sender and Message-Id, or a content hash when the header is missing.
+type ProcessedMessage struct {
+	MessageKey string    `json:"message_key" db:"message_key"`
+	Sender     string    `json:"sender" db:"sender"`
+	Status     string    `json:"status" db:"status"`
+	Outcome    *string   `json:"outcome,omitempty" db:"outcome"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
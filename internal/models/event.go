@@ -3,6 +3,8 @@ package models
 
 import (
 	"time"
+
+	"github.com/google/uuid"
 )
 
 type Event struct {
@@ -11,10 +13,47 @@ type Event struct {
 	Description    *string  `json:"description"`
 	ConferenceCall bool     `json:"conference_call"`
 	Date           string   `json:"date" validate:"required"`
-	StartTime      string   `json:"start_time" validate:"required"`
+	StartTime      string   `json:"start_time" validate:"required_unless=AllDay true"`
 	EndTime        *string  `json:"end_time"`
 	TimeZone       *string  `json:"time_zone"`
 	Attendees      []string `json:"attendees" validate:"required"`
+
+	// AllDay events have no times; EndDate is set when an event ends on a later day.
+	// Invites set them from DTSTART;VALUE=DATE and from a DTEND on another day;
+	// AI extraction sets them for whole-day and multi-day events.
+	AllDay  bool    `json:"all_day,omitempty"`
+	EndDate *string `json:"end_date,omitempty"`
+	// Deadline marks a due date rather than time spent, so it doesn't block the calendar
+	Deadline bool `json:"deadline,omitempty"`
+
+	// RFC 5545 RRULE, EXDATE and RDATE lines, e.g. "RRULE:FREQ=WEEKLY;BYDAY=TU"
+	Recurrence []string `json:"recurrence,omitempty"`
+
+	// Reminders replace the calendar's defaults when set
+	Reminders []Reminder `json:"reminders,omitempty"`
+
+	// iCalendar identity of events read from .ics files, used to apply later
+	// updates and cancellations to the event they were imported as
+	UID          string `json:"uid,omitempty"`
+	RecurrenceID string `json:"recurrence_id,omitempty"`
+	Sequence     int    `json:"sequence,omitempty"`
+	Cancelled    bool   `json:"cancelled,omitempty"`
+
+	// SourceKey names the message the event was read from and its place in
+	// it, so a retried insert reuses the same event ID
+	SourceKey string `json:"-"`
+}
+
+// Reminder methods Google Calendar supports
+const (
+	ReminderEmail = "email"
+	ReminderPopup = "popup"
+)
+
+// Reminder alerts the user a number of minutes before an event starts
+type Reminder struct {
+	Method  string `json:"method"`
+	Minutes int    `json:"minutes"`
 }
 
 type EventsResponse struct {
@@ -30,16 +69,44 @@ type TimezoneResponse struct {
 
 type GoogleCalendarEvent struct {
 	ID          string                   `json:"id"`
+	CalendarID  string                   `json:"calendar_id"`
+	ICalUID     string                   `json:"ical_uid"`
 	Summary     string                   `json:"summary"`
 	Description string                   `json:"description"`
 	Location    string                   `json:"location"`
 	StartTime   time.Time                `json:"start_time"`
 	EndTime     time.Time                `json:"end_time"`
 	TimeZone    string                   `json:"timezone"`
+	AllDay      bool                     `json:"all_day,omitempty"`
 	HTMLLink    string                   `json:"html_link"`
+	Recurrence  []string                 `json:"recurrence,omitempty"`
+	Reminders   []Reminder               `json:"reminders,omitempty"`
 	Attendees   []GoogleCalendarAttendee `json:"attendees"`
 }
 
+// Calendar is one of the calendars a user's provider lists
+type Calendar struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Primary bool   `json:"primary"`
+	// Writable calendars are ones the user can add events to
+	Writable bool `json:"writable"`
+}
+
+// ImportedEvent links an iCalendar UID, and RECURRENCE-ID for a changed
+// occurrence, to the Google event it was added as
+type ImportedEvent struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	UserID       uuid.UUID `json:"user_id" db:"user_id"`
+	ICalUID      string    `json:"ical_uid" db:"ical_uid"`
+	RecurrenceID string    `json:"recurrence_id" db:"recurrence_id"`
+	Sequence     int       `json:"sequence" db:"sequence"`
+	CalendarID   string    `json:"calendar_id" db:"calendar_id"`
+	EventID      string    `json:"event_id" db:"event_id"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
 type GoogleCalendarAttendee struct {
 	Email       string `json:"email"`
 	DisplayName string `json:"display_name,omitempty"`
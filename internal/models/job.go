@@ -0,0 +1,33 @@
+// internal/models/job.go
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Inbound job states. Dead jobs exhausted their attempts and wait for an admin.
+const (
+	JobStatusPending    = "pending"
+	JobStatusProcessing = "processing"
+	JobStatusDone       = "done"
+	JobStatusDead       = "dead"
+)
+
+type InboundJob struct {
+	ID          uuid.UUID    `json:"id" db:"id"`
+	Webhook     EmailWebhook `json:"-" db:"webhook"`
+	Files       []EmailFile  `json:"-" db:"files"`
+	From        string       `json:"from" db:"-"`
+	To          string       `json:"to" db:"-"`
+	Subject     string       `json:"subject" db:"-"`
+	Status      string       `json:"status" db:"status"`
+	Attempts    int          `json:"attempts" db:"attempts"`
+	MaxAttempts int          `json:"max_attempts" db:"max_attempts"`
+	LastError   *string      `json:"last_error,omitempty" db:"last_error"`
+	RunAt       time.Time    `json:"run_at" db:"run_at"`
+	LockedAt    *time.Time   `json:"locked_at,omitempty" db:"locked_at"`
+	CreatedAt   time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at" db:"updated_at"`
+}
@@ -7,6 +7,13 @@ import (
 	"github.com/google/uuid"
 )
 
+// Calendar providers a user can connect
+const (
+	CalendarProviderGoogle    = "google"
+	CalendarProviderMicrosoft = "microsoft"
+	CalendarProviderCalDAV    = "caldav"
+)
+
 type User struct {
 	ID           uuid.UUID  `json:"id" db:"id"`
 	Email        string     `json:"email" db:"email"`
@@ -14,6 +21,69 @@ type User struct {
 	RefreshToken *string    `json:"-" db:"refresh_token"`
 	ExpiryDate   *time.Time `json:"-" db:"expiry_date"`
 	TokenScope   *string    `json:"-" db:"token_scope"`
+	// CalendarProvider is where the user's events are added
+	CalendarProvider string    `json:"calendar_provider" db:"calendar_provider"`
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// UserSettings holds a user's preferences. A user without a row gets the defaults.
+type UserSettings struct {
+	UserID           uuid.UUID  `json:"user_id" db:"user_id"`
+	DefaultReminders []Reminder `json:"default_reminders" db:"default_reminders"`
+	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// MicrosoftToken is a user's Microsoft identity platform OAuth token
+type MicrosoftToken struct {
+	UserID       uuid.UUID  `json:"user_id" db:"user_id"`
+	AccessToken  string     `json:"-" db:"access_token"`
+	RefreshToken *string    `json:"-" db:"refresh_token"`
+	ExpiryDate   *time.Time `json:"-" db:"expiry_date"`
+	TokenScope   *string    `json:"-" db:"token_scope"`
 	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
 }
+
+// CalDAVAccount is a user's CalDAV server login and the calendar collection
+// their events are added to. Password is usually an app password.
+type CalDAVAccount struct {
+	UserID       uuid.UUID `json:"user_id" db:"user_id"`
+	ServerURL    string    `json:"server_url" db:"server_url"`
+	Username     string    `json:"username" db:"username"`
+	Password     string    `json:"-" db:"password"`
+	CalendarURL  string    `json:"calendar_url" db:"calendar_url"`
+	CalendarName string    `json:"calendar_name" db:"calendar_name"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// CalDAVCalendar is a calendar collection found on a CalDAV server
+type CalDAVCalendar struct {
+	URL      string `json:"url"`
+	Name     string `json:"name"`
+	Writable bool   `json:"writable"`
+}
+
+// Ways a calendar route can match a forwarded email
+const (
+	// RouteKindAlias matches the tag of a plus address, "family" in swiftcal+family@
+	RouteKindAlias = "alias"
+	// RouteKindSenderDomain matches the domain the email came from, or its subdomains
+	RouteKindSenderDomain = "sender_domain"
+	// RouteKindKeyword matches a word or phrase in the subject or body
+	RouteKindKeyword = "keyword"
+)
+
+// CalendarRoute sends the events from matching emails to one of the user's
+// calendars instead of their default one
+type CalendarRoute struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	UserID       uuid.UUID `json:"user_id" db:"user_id"`
+	Kind         string    `json:"kind" db:"kind"`
+	Pattern      string    `json:"pattern" db:"pattern"`
+	CalendarID   string    `json:"calendar_id" db:"calendar_id"`
+	CalendarName string    `json:"calendar_name" db:"calendar_name"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
@@ -94,6 +94,12 @@ func (s *AuthService) HandleCallback(ctx context.Context, code string) (*models.
 		if err := s.UpdateUserTokens(ctx, user.ID, token); err != nil {
 			return nil, fmt.Errorf("failed to update user tokens: %w", err)
 		}
+
+		// Connecting Google makes it the calendar events go to
+		if err := s.SetCalendarProvider(ctx, user.ID, models.CalendarProviderGoogle); err != nil {
+			return nil, fmt.Errorf("failed to set calendar provider: %w", err)
+		}
+		user.CalendarProvider = models.CalendarProviderGoogle
 	}
 
 	return user, nil
@@ -106,8 +112,10 @@ func (s *AuthService) CreateUser(ctx context.Context, email string, token *oauth
 		AccessToken:  &token.AccessToken,
 		RefreshToken: &token.RefreshToken,
 		ExpiryDate:   &token.Expiry,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+		// Set by the column default
+		CalendarProvider: models.CalendarProviderGoogle,
+		CreatedAt:        time.Now(),
+		UpdatedAt:        time.Now(),
 	}
 
 	if len(token.Extra("scope").(string)) > 0 {
@@ -133,9 +141,39 @@ func (s *AuthService) CreateUser(ctx context.Context, email string, token *oauth
 	return user, nil
 }
 
+// CreateProviderUser creates a user who signed up with a calendar provider
+// other than Google, so has no Google tokens
+func (s *AuthService) CreateProviderUser(ctx context.Context, email, provider string) (*models.User, error) {
+	user := &models.User{
+		ID:               uuid.New(),
+		Email:            email,
+		CalendarProvider: provider,
+	}
+
+	query := `
+		INSERT INTO users (id, email, calendar_provider)
+		VALUES ($1, $2, $3)
+		RETURNING created_at, updated_at
+	`
+
+	if err := s.db.Pool.QueryRow(ctx, query, user.ID, user.Email, user.CalendarProvider).Scan(&user.CreatedAt, &user.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return user, nil
+}
+
+// SetCalendarProvider chooses which connected calendar the user's events go to
+func (s *AuthService) SetCalendarProvider(ctx context.Context, userID uuid.UUID, provider string) error {
+	query := `UPDATE users SET calendar_provider = $1, updated_at = NOW() WHERE id = $2`
+
+	_, err := s.db.Pool.Exec(ctx, query, provider, userID)
+	return err
+}
+
 func (s *AuthService) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT u.id, u.email, u.access_token, u.refresh_token, u.expiry_date, u.token_scope, u.created_at, u.updated_at
+		SELECT u.id, u.email, u.access_token, u.refresh_token, u.expiry_date, u.token_scope, u.calendar_provider, u.created_at, u.updated_at
 		FROM users u
 		JOIN email_addresses ea ON u.id = ea.user_id
 		WHERE ea.email = $1
@@ -144,7 +182,7 @@ func (s *AuthService) GetUserByEmail(ctx context.Context, email string) (*models
 	user := &models.User{}
 	err := s.db.Pool.QueryRow(ctx, query, email).Scan(
 		&user.ID, &user.Email, &user.AccessToken, &user.RefreshToken,
-		&user.ExpiryDate, &user.TokenScope, &user.CreatedAt, &user.UpdatedAt,
+		&user.ExpiryDate, &user.TokenScope, &user.CalendarProvider, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err != nil {
@@ -156,7 +194,7 @@ func (s *AuthService) GetUserByEmail(ctx context.Context, email string) (*models
 
 func (s *AuthService) GetUserByID(ctx context.Context, userID uuid.UUID) (*models.User, error) {
 	query := `
-		SELECT id, email, access_token, refresh_token, expiry_date, token_scope, created_at, updated_at
+		SELECT id, email, access_token, refresh_token, expiry_date, token_scope, calendar_provider, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`
@@ -164,7 +202,7 @@ func (s *AuthService) GetUserByID(ctx context.Context, userID uuid.UUID) (*model
 	user := &models.User{}
 	err := s.db.Pool.QueryRow(ctx, query, userID).Scan(
 		&user.ID, &user.Email, &user.AccessToken, &user.RefreshToken,
-		&user.ExpiryDate, &user.TokenScope, &user.CreatedAt, &user.UpdatedAt,
+		&user.ExpiryDate, &user.TokenScope, &user.CalendarProvider, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err != nil {
@@ -194,7 +232,7 @@ func (s *AuthService) RefreshAccessToken(ctx context.Context, userID uuid.UUID)
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	if user.RefreshToken == nil {
+	if user.AccessToken == nil || user.RefreshToken == nil || user.ExpiryDate == nil {
 		return nil, fmt.Errorf("no refresh token available")
 	}
 
@@ -225,6 +263,11 @@ func (s *AuthService) GetOAuthClient(ctx context.Context, userID uuid.UUID) (*ht
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
+	// Users who signed up with another provider have no Google tokens
+	if user.AccessToken == nil || user.RefreshToken == nil || user.ExpiryDate == nil {
+		return nil, fmt.Errorf("no Google Calendar connected")
+	}
+
 	token := &oauth2.Token{
 		AccessToken:  *user.AccessToken,
 		RefreshToken: *user.RefreshToken,
@@ -341,9 +384,9 @@ func (s *AuthService) DeleteUser(ctx context.Context, userID uuid.UUID) error {
 
 func (s *AuthService) FindUsersWithExpiringTokens(ctx context.Context) ([]*models.User, error) {
 	query := `
-		SELECT id, email, access_token, refresh_token, expiry_date, token_scope, created_at, updated_at
+		SELECT id, email, access_token, refresh_token, expiry_date, token_scope, calendar_provider, created_at, updated_at
 		FROM users
-		WHERE expiry_date <= $1
+		WHERE expiry_date <= $1 AND refresh_token IS NOT NULL
 	`
 
 	twoHoursLater := time.Now().Add(2 * time.Hour)
@@ -358,7 +401,7 @@ func (s *AuthService) FindUsersWithExpiringTokens(ctx context.Context) ([]*model
 		user := &models.User{}
 		err := rows.Scan(
 			&user.ID, &user.Email, &user.AccessToken, &user.RefreshToken,
-			&user.ExpiryDate, &user.TokenScope, &user.CreatedAt, &user.UpdatedAt,
+			&user.ExpiryDate, &user.TokenScope, &user.CalendarProvider, &user.CreatedAt, &user.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
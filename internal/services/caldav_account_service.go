@@ -0,0 +1,189 @@
+// internal/services/caldav_account_service.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/database"
+	"github.com/wizenheimer/swiftcal/internal/models"
+	"github.com/wizenheimer/swiftcal/internal/utils"
+	"github.com/wizenheimer/swiftcal/pkg/logger"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// CalDAVAccountService stores the CalDAV servers users connect with an app
+// password, for calendars such as iCloud, Fastmail, Nextcloud or Radicale
+type CalDAVAccountService struct {
+	db     *database.DB
+	config *config.Config
+}
+
+func NewCalDAVAccountService(db *database.DB, cfg *config.Config) *CalDAVAccountService {
+	return &CalDAVAccountService{
+		db:     db,
+		config: cfg,
+	}
+}
+
+// DiscoverAccount signs in to the server and finds the user's calendars,
+// choosing the one named, or the first writable one when no name is given. It returns
+// every calendar found so the user can pick another. The account isn't saved.
+func (s *CalDAVAccountService) DiscoverAccount(ctx context.Context, serverURL, username, password, calendarName string) (*models.CalDAVAccount, []models.CalDAVCalendar, error) {
+	parsed, err := url.Parse(serverURL)
+	if err != nil || parsed.Host == "" {
+		return nil, nil, fmt.Errorf("%q is not a valid server URL", serverURL)
+	}
+	if parsed.Scheme != "https" && !(parsed.Scheme == "http" && s.config.CalDAVAllowHTTP) {
+		return nil, nil, fmt.Errorf("the server URL must start with https://")
+	}
+	if _, err := s.encryptionKey(); err != nil {
+		logger.GetLogger().Error("CalDAV accounts can't be saved", zap.Error(err))
+		return nil, nil, fmt.Errorf("CalDAV calendars can't be connected right now")
+	}
+
+	// Only a rejected password is passed on; the server's answers and
+	// addresses stay in the logs rather than the reply
+	calendars, err := newCalDAVClient(username, password, s.config.CalDAVAllowHTTP).Discover(ctx, serverURL)
+	if err != nil {
+		if errors.Is(err, ErrCalDAVUnauthorized) {
+			return nil, nil, err
+		}
+		logger.GetLogger().Info("CalDAV discovery failed", zap.Error(err), zap.String("server_url", serverURL))
+		return nil, nil, fmt.Errorf("we couldn't find any calendars at that server address")
+	}
+
+	var chosen *models.CalDAVCalendar
+	for i, calendar := range calendars {
+		if calendarName == "" && calendar.Writable {
+			chosen = &calendars[i]
+			break
+		}
+		if calendarName != "" && (strings.EqualFold(calendar.Name, calendarName) || strings.TrimSuffix(calendar.URL, "/") == strings.TrimSuffix(calendarName, "/")) {
+			chosen = &calendars[i]
+			break
+		}
+	}
+
+	if chosen == nil {
+		if calendarName == "" {
+			return nil, calendars, fmt.Errorf("none of your calendars can have events added to them")
+		}
+		return nil, calendars, fmt.Errorf("no calendar named %q was found", calendarName)
+	}
+	if !chosen.Writable {
+		return nil, calendars, fmt.Errorf("%s is read-only", chosen.Name)
+	}
+
+	account := &models.CalDAVAccount{
+		ServerURL:    serverURL,
+		Username:     username,
+		Password:     password,
+		CalendarURL:  chosen.URL,
+		CalendarName: chosen.Name,
+	}
+
+	return account, calendars, nil
+}
+
+// SaveAccount stores the account with its password encrypted
+func (s *CalDAVAccountService) SaveAccount(ctx context.Context, account *models.CalDAVAccount) error {
+	key, err := s.encryptionKey()
+	if err != nil {
+		return err
+	}
+
+	password, err := utils.EncryptSecret(key, account.Password)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt caldav password: %w", err)
+	}
+
+	query := `
+		INSERT INTO caldav_accounts (user_id, server_url, username, password, calendar_url, calendar_name)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE
+		SET server_url = EXCLUDED.server_url,
+		    username = EXCLUDED.username,
+		    password = EXCLUDED.password,
+		    calendar_url = EXCLUDED.calendar_url,
+		    calendar_name = EXCLUDED.calendar_name,
+		    updated_at = NOW()
+	`
+
+	_, err = s.db.Pool.Exec(ctx, query,
+		account.UserID, account.ServerURL, account.Username, password, account.CalendarURL, account.CalendarName,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save caldav account: %w", err)
+	}
+
+	return nil
+}
+
+func (s *CalDAVAccountService) GetAccount(ctx context.Context, userID uuid.UUID) (*models.CalDAVAccount, error) {
+	query := `
+		SELECT user_id, server_url, username, password, calendar_url, calendar_name, created_at, updated_at
+		FROM caldav_accounts
+		WHERE user_id = $1
+	`
+
+	account := &models.CalDAVAccount{}
+	err := s.db.Pool.QueryRow(ctx, query, userID).Scan(
+		&account.UserID, &account.ServerURL, &account.Username, &account.Password,
+		&account.CalendarURL, &account.CalendarName, &account.CreatedAt, &account.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("no CalDAV calendar connected")
+		}
+		return nil, fmt.Errorf("failed to get caldav account: %w", err)
+	}
+
+	key, err := s.encryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := utils.DecryptSecret(key, account.Password)
+	switch {
+	case errors.Is(err, utils.ErrNotEncrypted):
+		// Saved before passwords were encrypted; the next save encrypts it
+		logger.GetLogger().Warn("CalDAV password is stored unencrypted", zap.String("user_id", userID.String()))
+	case err != nil:
+		return nil, fmt.Errorf("failed to decrypt caldav password: %w", err)
+	default:
+		account.Password = password
+	}
+
+	return account, nil
+}
+
+// encryptionKey is the key app passwords are encrypted with. Without one,
+// CalDAV accounts can't be saved or used.
+func (s *CalDAVAccountService) encryptionKey() ([]byte, error) {
+	if s.config.CalDAVEncryptionKey == "" {
+		return nil, fmt.Errorf("CALDAV_ENCRYPTION_KEY is not set")
+	}
+
+	key, err := utils.ParseSecretKey(s.config.CalDAVEncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CALDAV_ENCRYPTION_KEY: %w", err)
+	}
+
+	return key, nil
+}
+
+func (s *CalDAVAccountService) DeleteAccount(ctx context.Context, userID uuid.UUID) error {
+	if _, err := s.db.Pool.Exec(ctx, `DELETE FROM caldav_accounts WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete caldav account: %w", err)
+	}
+
+	return nil
+}
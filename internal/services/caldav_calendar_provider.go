@@ -0,0 +1,425 @@
+// internal/services/caldav_calendar_provider.go
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/models"
+	"github.com/wizenheimer/swiftcal/internal/utils"
+	"github.com/wizenheimer/swiftcal/pkg/logger"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// CalDAVAccountSource looks up the CalDAV account a user connected. Tests can
+// supply accounts pointed at a fake server.
+type CalDAVAccountSource interface {
+	GetAccount(ctx context.Context, userID uuid.UUID) (*models.CalDAVAccount, error)
+}
+
+// CalDAVCalendarProvider adds events to any CalDAV server by writing each one
+// as an iCalendar object in the calendar collection the user chose. Event IDs
+// are the objects' UIDs and calendar IDs are the collections' URLs.
+type CalDAVCalendarProvider struct {
+	config      *config.Config
+	accounts    CalDAVAccountSource
+	authService *AuthService
+}
+
+func NewCalDAVCalendarProvider(cfg *config.Config, accounts CalDAVAccountSource, authService *AuthService) *CalDAVCalendarProvider {
+	return &CalDAVCalendarProvider{
+		config:      cfg,
+		accounts:    accounts,
+		authService: authService,
+	}
+}
+
+func (s *CalDAVCalendarProvider) AddEvent(ctx context.Context, userID uuid.UUID, calendarID string, event *models.Event) (*models.GoogleCalendarEvent, error) {
+	account, client, err := s.connect(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	calendarURL := s.calendarURL(account, calendarID)
+
+	organizer, err := s.organizer(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	// Servers have no default zone to offer, so times without one are UTC
+	times, err := resolveEventTimes(event, "UTC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert event: %w", err)
+	}
+
+	// A retry of the same message writes to the same resource, which the
+	// server refuses to create twice
+	uid := uuid.New().String()
+	if event.SourceKey != "" {
+		uid = sourceEventID(event.SourceKey)
+	}
+	result := s.toCalendarEvent(event, times, uid, calendarURL)
+	result.Description = withDescriptionFooter(s.config, result.Description)
+
+	data, err := utils.GenerateCalendarObject(result, organizer, 0, event.Deadline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert event: %w", err)
+	}
+
+	if err := client.PutObject(ctx, objectURL(calendarURL, uid), data, ""); err != nil {
+		if isCalDAVPreconditionError(err) {
+			existing, getErr := s.GetEvent(ctx, userID, calendarURL, uid)
+			if getErr != nil {
+				return nil, fmt.Errorf("failed to get existing calendar event: %w", getErr)
+			}
+			logger.GetLogger().Info("Calendar event was already created",
+				zap.String("user_id", userID.String()),
+				zap.String("event_id", existing.ID))
+			return existing, nil
+		}
+		if isCalDAVForbiddenError(err) || (calendarURL != account.CalendarURL && isCalDAVGoneError(err)) {
+			return nil, fmt.Errorf("calendar %s: %w", calendarURL, ErrCalendarNotWritable)
+		}
+		return nil, fmt.Errorf("failed to create calendar event: %w", err)
+	}
+
+	logger.GetLogger().Info("Calendar event created",
+		zap.String("user_id", userID.String()),
+		zap.String("provider", models.CalendarProviderCalDAV),
+		zap.String("event_id", result.ID),
+		zap.String("summary", result.Summary))
+
+	return result, nil
+}
+
+// ListCalendars finds the calendars on the user's server again, so ones
+// created since they connected can be chosen
+func (s *CalDAVCalendarProvider) ListCalendars(ctx context.Context, userID uuid.UUID) ([]models.Calendar, error) {
+	account, client, err := s.connect(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := client.Discover(ctx, account.ServerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get calendar list: %w", err)
+	}
+
+	var calendars []models.Calendar
+	for _, calendar := range found {
+		calendars = append(calendars, models.Calendar{
+			ID:       calendar.URL,
+			Name:     calendar.Name,
+			Primary:  calendar.URL == account.CalendarURL,
+			Writable: calendar.Writable,
+		})
+	}
+
+	return calendars, nil
+}
+
+// ListEvents returns the events overlapping the given times, asking the
+// server to expand recurring ones into their occurrences
+func (s *CalDAVCalendarProvider) ListEvents(ctx context.Context, userID uuid.UUID, calendarID string, from, to time.Time) ([]models.GoogleCalendarEvent, error) {
+	account, client, err := s.connect(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	calendarURL := s.calendarURL(account, calendarID)
+	objects, err := client.EventsBetween(ctx, calendarURL, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	var events []models.GoogleCalendarEvent
+	for _, data := range objects {
+		parsed, err := utils.ParseICSFile(data)
+		if err != nil {
+			logger.GetLogger().Warn("Skipping unreadable calendar object", zap.Error(err))
+			continue
+		}
+
+		for i := range parsed {
+			if parsed[i].Cancelled {
+				continue
+			}
+			times, err := resolveEventTimes(&parsed[i], "UTC")
+			if err != nil {
+				continue
+			}
+			events = append(events, *s.toCalendarEvent(&parsed[i], times, parsed[i].UID, calendarURL))
+		}
+	}
+
+	return events, nil
+}
+
+// GetEvent returns an event, or ErrEventNotFound when it has been deleted
+func (s *CalDAVCalendarProvider) GetEvent(ctx context.Context, userID uuid.UUID, calendarID, eventID string) (*models.GoogleCalendarEvent, error) {
+	account, client, err := s.connect(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	calendarURL := s.calendarURL(account, calendarID)
+	existing, _, err := s.getEvent(ctx, client, calendarURL, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	times, err := resolveEventTimes(existing, "UTC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read calendar event: %w", err)
+	}
+
+	return s.toCalendarEvent(existing, times, eventID, calendarURL), nil
+}
+
+// UpdateEvent rewrites an event, keeping guests that were invited to it since
+func (s *CalDAVCalendarProvider) UpdateEvent(ctx context.Context, userID uuid.UUID, calendarID, eventID string, event *models.Event) (*models.GoogleCalendarEvent, error) {
+	account, client, err := s.connect(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	organizer, err := s.organizer(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	calendarURL := s.calendarURL(account, calendarID)
+	existing, etag, err := s.getEvent(ctx, client, calendarURL, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The event's own zone is the best default for times given without one
+	defaultZone := "UTC"
+	if existing.TimeZone != nil && *existing.TimeZone != "" {
+		defaultZone = *existing.TimeZone
+	}
+
+	times, err := resolveEventTimes(event, defaultZone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert event: %w", err)
+	}
+
+	result := s.toCalendarEvent(event, times, eventID, calendarURL)
+	result.Description = withDescriptionFooter(s.config, result.Description)
+
+	// Keep guests added to the event after it was imported
+	seen := make(map[string]bool)
+	for _, attendee := range result.Attendees {
+		seen[strings.ToLower(attendee.Email)] = true
+	}
+	for _, email := range existing.Attendees {
+		if isValidEmail(email) && !seen[strings.ToLower(email)] {
+			seen[strings.ToLower(email)] = true
+			result.Attendees = append(result.Attendees, models.GoogleCalendarAttendee{Email: email})
+		}
+	}
+
+	// A higher sequence tells guests' calendars to take the change
+	data, err := utils.GenerateCalendarObject(result, organizer, existing.Sequence+1, event.Deadline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert event: %w", err)
+	}
+
+	if err := client.PutObject(ctx, objectURL(calendarURL, eventID), data, etag); err != nil {
+		if isCalDAVGoneError(err) {
+			return nil, ErrEventNotFound
+		}
+		return nil, fmt.Errorf("failed to update calendar event: %w", err)
+	}
+
+	logger.GetLogger().Info("Calendar event updated",
+		zap.String("user_id", userID.String()),
+		zap.String("provider", models.CalendarProviderCalDAV),
+		zap.String("event_id", result.ID),
+		zap.String("summary", result.Summary))
+
+	return result, nil
+}
+
+// DeleteEvent removes an event. An event the user already deleted counts as removed.
+func (s *CalDAVCalendarProvider) DeleteEvent(ctx context.Context, userID uuid.UUID, calendarID, eventID string) error {
+	account, client, err := s.connect(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := client.DeleteObject(ctx, objectURL(s.calendarURL(account, calendarID), eventID)); err != nil && !isCalDAVGoneError(err) {
+		return fmt.Errorf("failed to delete calendar event: %w", err)
+	}
+
+	logger.GetLogger().Info("Calendar event deleted",
+		zap.String("user_id", userID.String()),
+		zap.String("provider", models.CalendarProviderCalDAV),
+		zap.String("event_id", eventID))
+
+	return nil
+}
+
+// InviteAttendees adds guests to the event. Servers that support scheduling
+// send the invitations when they see the new attendees.
+func (s *CalDAVCalendarProvider) InviteAttendees(ctx context.Context, userID uuid.UUID, eventID, calendarID string, attendees []string) error {
+	account, client, err := s.connect(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	target := objectURL(s.calendarURL(account, calendarID), eventID)
+	data, etag, err := client.GetObject(ctx, target)
+	if err != nil {
+		if isCalDAVGoneError(err) {
+			return ErrEventNotFound
+		}
+		return fmt.Errorf("failed to get event: %w", err)
+	}
+
+	var valid []string
+	for _, email := range attendees {
+		if isValidEmail(email) {
+			valid = append(valid, email)
+		}
+	}
+
+	if data, err = utils.AddCalendarObjectAttendees(data, valid); err != nil {
+		return fmt.Errorf("failed to update event: %w", err)
+	}
+
+	if err := client.PutObject(ctx, target, data, etag); err != nil {
+		return fmt.Errorf("failed to update event: %w", err)
+	}
+
+	logger.GetLogger().Info("Additional attendees invited",
+		zap.String("user_id", userID.String()),
+		zap.String("provider", models.CalendarProviderCalDAV),
+		zap.String("event_id", eventID),
+		zap.Strings("attendees", attendees))
+
+	return nil
+}
+
+// connect returns the user's account and a client signed in to it
+func (s *CalDAVCalendarProvider) connect(ctx context.Context, userID uuid.UUID) (*models.CalDAVAccount, *caldavClient, error) {
+	account, err := s.accounts.GetAccount(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return account, newCalDAVClient(account.Username, account.Password, s.config.CalDAVAllowHTTP), nil
+}
+
+// organizer is the address invitations come from. Most servers sign in with
+// an email address; otherwise the user's own address is used.
+func (s *CalDAVCalendarProvider) organizer(ctx context.Context, account *models.CalDAVAccount) (string, error) {
+	if isValidEmail(account.Username) {
+		return account.Username, nil
+	}
+
+	user, err := s.authService.GetUserByID(ctx, account.UserID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user.Email, nil
+}
+
+// calendarURL returns the collection an event was added to. The user's
+// password is only ever sent to the server they connected, so an ID on
+// another host, or a placeholder like "primary", means their chosen calendar.
+func (s *CalDAVCalendarProvider) calendarURL(account *models.CalDAVAccount, calendarID string) string {
+	chosen, err := url.Parse(account.CalendarURL)
+	if err != nil {
+		return account.CalendarURL
+	}
+
+	requested, err := url.Parse(calendarID)
+	if err != nil || requested.Scheme != chosen.Scheme || requested.Host != chosen.Host {
+		return account.CalendarURL
+	}
+
+	return calendarID
+}
+
+func (s *CalDAVCalendarProvider) getEvent(ctx context.Context, client *caldavClient, calendarURL, eventID string) (*models.Event, string, error) {
+	data, etag, err := client.GetObject(ctx, objectURL(calendarURL, eventID))
+	if err != nil {
+		if isCalDAVGoneError(err) {
+			return nil, "", ErrEventNotFound
+		}
+		return nil, "", fmt.Errorf("failed to get event: %w", err)
+	}
+
+	events, err := utils.ParseICSFile(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read calendar event: %w", err)
+	}
+
+	// Overrides of single occurrences follow the series they belong to
+	for i := range events {
+		if events[i].RecurrenceID == "" {
+			if events[i].Cancelled {
+				return nil, "", ErrEventNotFound
+			}
+			return &events[i], etag, nil
+		}
+	}
+
+	return &events[0], etag, nil
+}
+
+// toCalendarEvent fills our model from an event and its resolved times
+func (s *CalDAVCalendarProvider) toCalendarEvent(event *models.Event, times *eventTimes, eventID, calendarURL string) *models.GoogleCalendarEvent {
+	result := &models.GoogleCalendarEvent{
+		ID:         eventID,
+		CalendarID: calendarURL,
+		ICalUID:    eventID,
+		Summary:    event.Summary,
+		StartTime:  times.Start,
+		EndTime:    times.End,
+		TimeZone:   times.TimeZone,
+		AllDay:     times.AllDay,
+		Recurrence: event.Recurrence,
+		Reminders:  utils.NormalizeReminders(event.Reminders),
+	}
+
+	// All-day dates are kept as UTC midnights
+	if times.AllDay {
+		result.TimeZone = "UTC"
+	}
+
+	if event.Description != nil {
+		result.Description = *event.Description
+	}
+	if event.Location != nil {
+		result.Location = *event.Location
+	}
+
+	for _, email := range event.Attendees {
+		if isValidEmail(email) {
+			result.Attendees = append(result.Attendees, models.GoogleCalendarAttendee{Email: email})
+		} else {
+			logger.GetLogger().Warn("Skipping invalid email address",
+				zap.String("email", email))
+		}
+	}
+
+	return result
+}
+
+// objectURL is where an event's calendar object lives in its collection
+func objectURL(calendarURL, eventID string) string {
+	if !strings.HasSuffix(calendarURL, "/") {
+		calendarURL += "/"
+	}
+	return calendarURL + url.PathEscape(eventID) + ".ics"
+}
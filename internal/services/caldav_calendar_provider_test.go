@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// fakeCalDAVAccounts connects every user to the same calendar
+type fakeCalDAVAccounts struct {
+	account models.CalDAVAccount
+}
+
+func (f fakeCalDAVAccounts) GetAccount(ctx context.Context, userID uuid.UUID) (*models.CalDAVAccount, error) {
+	account := f.account
+	account.UserID = userID
+	return &account, nil
+}
+
+func TestCalDAVAddEventIsRetrySafe(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		objects = make(map[string][]byte)
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("ETag", `"1"`)
+			w.Write(data)
+		case http.MethodPut:
+			if _, ok := objects[r.URL.Path]; ok && r.Header.Get("If-None-Match") == "*" {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			objects[r.URL.Path], _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	provider := NewCalDAVCalendarProvider(&config.Config{CalDAVAllowHTTP: true}, fakeCalDAVAccounts{account: models.CalDAVAccount{
+		ServerURL:   server.URL,
+		Username:    "sam@fastmail.com",
+		CalendarURL: server.URL + "/calendars/sam/personal/",
+	}}, nil)
+	ctx := context.Background()
+	userID := uuid.New()
+
+	event := func() *models.Event {
+		return &models.Event{
+			Summary:   "Design review",
+			Date:      "20 October 2026",
+			StartTime: "09:00",
+			SourceKey: "mid:priya@example.com:caf=1234@mail.example.com#event:abc",
+		}
+	}
+
+	created, err := provider.AddEvent(ctx, userID, "", event())
+	if err != nil {
+		t.Fatalf("AddEvent: %v", err)
+	}
+
+	// A retry after the response was lost finds the object it wrote before
+	retried, err := provider.AddEvent(ctx, userID, "", event())
+	if err != nil {
+		t.Fatalf("AddEvent again: %v", err)
+	}
+	if retried.ID != created.ID || retried.Summary != "Design review" {
+		t.Errorf("retry = %+v, want the event created first (%s)", retried, created.ID)
+	}
+	mu.Lock()
+	if len(objects) != 1 {
+		t.Errorf("server has %d objects, want 1", len(objects))
+	}
+	mu.Unlock()
+
+	other := event()
+	other.SourceKey = ""
+	if added, err := provider.AddEvent(ctx, userID, "", other); err != nil || added.ID == created.ID {
+		t.Errorf("AddEvent without a source key = %+v, %v, want a new event", added, err)
+	}
+}
@@ -0,0 +1,545 @@
+// internal/services/caldav_client.go
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/internal/models"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// caldavMaxRedirects bounds the redirects followed during discovery, such as
+// the one from /.well-known/caldav to the server's real root
+const caldavMaxRedirects = 5
+
+// ErrCalDAVUnauthorized means the server rejected the username or password
+var ErrCalDAVUnauthorized = errors.New("the CalDAV server rejected the username or password")
+
+// errCalDAVAddressNotAllowed means a server resolved to an internal address
+var errCalDAVAddressNotAllowed = errors.New("address is not public")
+
+const (
+	propfindPrincipal = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:current-user-principal/></d:prop></d:propfind>`
+
+	propfindHomeSet = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><c:calendar-home-set/></d:prop></d:propfind>`
+
+	propfindCalendars = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><d:resourcetype/><d:displayname/><c:supported-calendar-component-set/><d:current-user-privilege-set/></d:prop></d:propfind>`
+
+	// reportEventsBetween asks for the events overlapping a time range, with
+	// recurring ones expanded into the occurrences in it
+	reportEventsBetween = `<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><c:calendar-data><c:expand start="%[1]s" end="%[2]s"/></c:calendar-data></d:prop><c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT"><c:time-range start="%[1]s" end="%[2]s"/></c:comp-filter></c:comp-filter></c:filter></c:calendar-query>`
+)
+
+// caldavError is a request the server answered with an error status
+type caldavError struct {
+	Method     string
+	StatusCode int
+}
+
+func (e *caldavError) Error() string {
+	return fmt.Sprintf("caldav %s failed: status %d", e.Method, e.StatusCode)
+}
+
+// isCalDAVGoneError reports whether the object doesn't exist any more
+func isCalDAVGoneError(err error) bool {
+	var davErr *caldavError
+	return errors.As(err, &davErr) && (davErr.StatusCode == http.StatusNotFound || davErr.StatusCode == http.StatusGone)
+}
+
+// isCalDAVForbiddenError reports whether the user lacks the privilege to
+// make the change, as on a calendar shared read-only with them
+func isCalDAVForbiddenError(err error) bool {
+	var davErr *caldavError
+	return errors.As(err, &davErr) && davErr.StatusCode == http.StatusForbidden
+}
+
+// isCalDAVPreconditionError reports whether a conditional write found the
+// object in another state, as when creating one that already exists
+func isCalDAVPreconditionError(err error) bool {
+	var davErr *caldavError
+	return errors.As(err, &davErr) && davErr.StatusCode == http.StatusPreconditionFailed
+}
+
+type davMultistatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+type davResponse struct {
+	Href      string        `xml:"DAV: href"`
+	Propstats []davPropstat `xml:"DAV: propstat"`
+}
+
+type davPropstat struct {
+	Status string  `xml:"DAV: status"`
+	Prop   davProp `xml:"DAV: prop"`
+}
+
+type davProp struct {
+	CurrentUserPrincipal *davHref `xml:"DAV: current-user-principal"`
+	CalendarHomeSet      *davHref `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set"`
+	DisplayName          string   `xml:"DAV: displayname"`
+	CalendarData         string   `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+	ResourceType         struct {
+		Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+	} `xml:"DAV: resourcetype"`
+	SupportedComponents *struct {
+		Comps []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"urn:ietf:params:xml:ns:caldav comp"`
+	} `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-component-set"`
+	Privileges *struct {
+		Privilege []struct {
+			All          *struct{} `xml:"DAV: all"`
+			Write        *struct{} `xml:"DAV: write"`
+			WriteContent *struct{} `xml:"DAV: write-content"`
+			Bind         *struct{} `xml:"DAV: bind"`
+		} `xml:"DAV: privilege"`
+	} `xml:"DAV: current-user-privilege-set"`
+}
+
+// writable reports whether the user may add objects to the collection.
+// Servers that don't report privileges are taken at their word later.
+func (p *davProp) writable() bool {
+	if p.Privileges == nil {
+		return true
+	}
+	for _, privilege := range p.Privileges.Privilege {
+		if privilege.All != nil || privilege.Write != nil || privilege.WriteContent != nil || privilege.Bind != nil {
+			return true
+		}
+	}
+	return false
+}
+
+type davHref struct {
+	Href string `xml:"DAV: href"`
+}
+
+// found returns the properties the server had values for
+func (r *davResponse) found() *davProp {
+	for i := range r.Propstats {
+		if strings.Contains(r.Propstats[i].Status, " 200 ") {
+			return &r.Propstats[i].Prop
+		}
+	}
+	return nil
+}
+
+// caldavClient speaks the small part of CalDAV swiftcal needs, signing in
+// with HTTP basic auth
+type caldavClient struct {
+	httpClient *http.Client
+	username   string
+	password   string
+}
+
+// newCalDAVClient returns a client for a user's server. Unless allowPrivate
+// is set, for a local test server, it refuses to connect to loopback, private
+// and link-local addresses, so a server URL from an email can't reach into
+// the network swiftcal runs in.
+func newCalDAVClient(username, password string, allowPrivate bool) *caldavClient {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !allowPrivate {
+		dialer.Control = rejectNonPublicAddress
+	}
+
+	return &caldavClient{
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: 10 * time.Second},
+			// PROPFIND can't be replayed as the GET the client turns some
+			// redirects into, so they are followed by hand
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		username: username,
+		password: password,
+	}
+}
+
+func (c *caldavClient) do(ctx context.Context, method, target string, headers map[string]string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.SetBasicAuth(c.username, c.password)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		return nil, ErrCalDAVUnauthorized
+	}
+
+	return resp, nil
+}
+
+// propfind returns the responses to a PROPFIND and the URL that answered it,
+// after any redirects
+func (c *caldavClient) propfind(ctx context.Context, target, depth, body string) ([]davResponse, string, error) {
+	for range caldavMaxRedirects {
+		resp, err := c.do(ctx, "PROPFIND", target, map[string]string{
+			"Depth":        depth,
+			"Content-Type": "application/xml; charset=utf-8",
+		}, []byte(body))
+		if err != nil {
+			return nil, "", err
+		}
+
+		if resp.StatusCode >= http.StatusMultipleChoices && resp.StatusCode < http.StatusBadRequest {
+			resp.Body.Close()
+			next, err := redirectTarget(target, resp.Header.Get("Location"))
+			if err != nil {
+				return nil, "", err
+			}
+			target = next
+			continue
+		}
+
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusMultiStatus {
+			return nil, "", &caldavError{Method: "PROPFIND", StatusCode: resp.StatusCode}
+		}
+
+		var multistatus davMultistatus
+		if err := xml.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&multistatus); err != nil {
+			return nil, "", fmt.Errorf("failed to decode PROPFIND response: %w", err)
+		}
+
+		return multistatus.Responses, target, nil
+	}
+
+	return nil, "", fmt.Errorf("too many redirects from %s", target)
+}
+
+// rejectNonPublicAddress runs once the host has been resolved, so a name
+// that resolves to an internal address is caught too
+func rejectNonPublicAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !isPublicAddress(ip.Unmap()) {
+		return fmt.Errorf("%w: %s", errCalDAVAddressNotAllowed, host)
+	}
+
+	return nil
+}
+
+// nonPublicPrefixes are ranges the netip predicates don't cover: shared
+// carrier NAT, "this network", IETF protocol assignments and benchmarking
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// isPublicAddress rejects loopback, private, link-local (including the cloud
+// metadata address 169.254.169.254), multicast and unspecified addresses
+func isPublicAddress(ip netip.Addr) bool {
+	if !ip.IsValid() || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sameSite reports whether two URLs belong to the same registered domain.
+// Servers such as iCloud answer on one host and keep calendars on another of
+// their own, but nothing may point the user's password at someone else's.
+func sameSite(a, b *url.URL) bool {
+	hostA, hostB := strings.ToLower(a.Hostname()), strings.ToLower(b.Hostname())
+	if hostA == hostB {
+		return true
+	}
+	if net.ParseIP(hostA) != nil || net.ParseIP(hostB) != nil {
+		return false
+	}
+
+	siteA, errA := publicsuffix.EffectiveTLDPlusOne(hostA)
+	siteB, errB := publicsuffix.EffectiveTLDPlusOne(hostB)
+	return errA == nil && errB == nil && siteA == siteB
+}
+
+// redirectTarget resolves a Location header. Credentials are never sent on
+// from https to plain http, or to another site.
+func redirectTarget(current, location string) (string, error) {
+	if location == "" {
+		return "", fmt.Errorf("redirect from %s has no location", current)
+	}
+
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	next, err := base.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect location: %w", err)
+	}
+	if base.Scheme == "https" && next.Scheme != "https" {
+		return "", fmt.Errorf("refusing redirect from https to %s", next.Scheme)
+	}
+	if !sameSite(base, next) {
+		return "", fmt.Errorf("refusing redirect from %s to %s", base.Host, next.Host)
+	}
+
+	return next.String(), nil
+}
+
+// Discover finds the calendars the user can add events to, following the
+// server's principal to its calendar home
+func (c *caldavClient) Discover(ctx context.Context, serverURL string) ([]models.CalDAVCalendar, error) {
+	principal, err := c.findPrincipal(ctx, serverURL)
+	if err != nil {
+		return nil, err
+	}
+
+	responses, principal, err := c.propfind(ctx, principal, "0", propfindHomeSet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read calendar home: %w", err)
+	}
+
+	var home string
+	for _, response := range responses {
+		if prop := response.found(); prop != nil && prop.CalendarHomeSet != nil && prop.CalendarHomeSet.Href != "" {
+			home, err = resolveHref(principal, prop.CalendarHomeSet.Href)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if home == "" {
+		return nil, fmt.Errorf("the CalDAV server didn't say where the calendars are")
+	}
+
+	responses, home, err = c.propfind(ctx, home, "1", propfindCalendars)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list calendars: %w", err)
+	}
+
+	var calendars []models.CalDAVCalendar
+	for _, response := range responses {
+		prop := response.found()
+		if prop == nil || prop.ResourceType.Calendar == nil {
+			continue
+		}
+
+		// A collection that doesn't list its components takes any of them
+		if prop.SupportedComponents != nil && len(prop.SupportedComponents.Comps) > 0 {
+			events := false
+			for _, comp := range prop.SupportedComponents.Comps {
+				if strings.EqualFold(comp.Name, "VEVENT") {
+					events = true
+				}
+			}
+			if !events {
+				continue
+			}
+		}
+
+		calendarURL, err := resolveHref(home, response.Href)
+		if err != nil {
+			continue
+		}
+		if !strings.HasSuffix(calendarURL, "/") {
+			calendarURL += "/"
+		}
+
+		name := strings.TrimSpace(prop.DisplayName)
+		if name == "" {
+			name = path.Base(strings.TrimSuffix(calendarURL, "/"))
+		}
+
+		calendars = append(calendars, models.CalDAVCalendar{URL: calendarURL, Name: name, Writable: prop.writable()})
+	}
+
+	if len(calendars) == 0 {
+		return nil, fmt.Errorf("no calendars for events were found on the CalDAV server")
+	}
+
+	return calendars, nil
+}
+
+// findPrincipal asks the server URL for the signed-in user's principal,
+// falling back to the well-known CalDAV location
+func (c *caldavClient) findPrincipal(ctx context.Context, serverURL string) (string, error) {
+	base, err := url.Parse(serverURL)
+	if err != nil || (base.Scheme != "https" && base.Scheme != "http") || base.Host == "" {
+		return "", fmt.Errorf("%q is not a valid server URL", serverURL)
+	}
+
+	wellKnown := &url.URL{Scheme: base.Scheme, Host: base.Host, Path: "/.well-known/caldav"}
+
+	var lastErr error
+	for _, candidate := range []string{base.String(), wellKnown.String()} {
+		responses, answered, err := c.propfind(ctx, candidate, "0", propfindPrincipal)
+		if err != nil {
+			if errors.Is(err, ErrCalDAVUnauthorized) {
+				return "", err
+			}
+			lastErr = err
+			continue
+		}
+
+		for _, response := range responses {
+			if prop := response.found(); prop != nil && prop.CurrentUserPrincipal != nil && prop.CurrentUserPrincipal.Href != "" {
+				return resolveHref(answered, prop.CurrentUserPrincipal.Href)
+			}
+		}
+	}
+
+	if lastErr != nil {
+		return "", fmt.Errorf("failed to find CalDAV principal: %w", lastErr)
+	}
+	return "", fmt.Errorf("the server didn't identify a CalDAV account")
+}
+
+// GetObject returns a calendar object and its ETag
+func (c *caldavClient) GetObject(ctx context.Context, objectURL string) ([]byte, string, error) {
+	resp, err := c.do(ctx, http.MethodGet, objectURL, map[string]string{"Accept": "text/calendar"}, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", &caldavError{Method: http.MethodGet, StatusCode: resp.StatusCode}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read calendar object: %w", err)
+	}
+
+	return data, resp.Header.Get("ETag"), nil
+}
+
+// PutObject writes a calendar object. Without an ETag it only creates a new
+// object; with one it only replaces that version.
+func (c *caldavClient) PutObject(ctx context.Context, objectURL string, data []byte, etag string) error {
+	headers := map[string]string{"Content-Type": "text/calendar; charset=utf-8"}
+	if etag == "" {
+		headers["If-None-Match"] = "*"
+	} else {
+		headers["If-Match"] = etag
+	}
+
+	resp, err := c.do(ctx, http.MethodPut, objectURL, headers, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return &caldavError{Method: http.MethodPut, StatusCode: resp.StatusCode}
+	}
+
+	return nil
+}
+
+func (c *caldavClient) DeleteObject(ctx context.Context, objectURL string) error {
+	resp, err := c.do(ctx, http.MethodDelete, objectURL, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return &caldavError{Method: http.MethodDelete, StatusCode: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// EventsBetween returns the calendar objects in a collection with events
+// overlapping the given times
+func (c *caldavClient) EventsBetween(ctx context.Context, calendarURL string, from, to time.Time) ([][]byte, error) {
+	const layout = "20060102T150405Z"
+	body := fmt.Sprintf(reportEventsBetween, from.UTC().Format(layout), to.UTC().Format(layout))
+
+	resp, err := c.do(ctx, "REPORT", calendarURL, map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml; charset=utf-8",
+	}, []byte(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, &caldavError{Method: "REPORT", StatusCode: resp.StatusCode}
+	}
+
+	var multistatus davMultistatus
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&multistatus); err != nil {
+		return nil, fmt.Errorf("failed to decode REPORT response: %w", err)
+	}
+
+	var objects [][]byte
+	for _, response := range multistatus.Responses {
+		if prop := response.found(); prop != nil && strings.TrimSpace(prop.CalendarData) != "" {
+			objects = append(objects, []byte(prop.CalendarData))
+		}
+	}
+
+	return objects, nil
+}
+
+// resolveHref turns an href from a response into an absolute URL
+func resolveHref(base, href string) (string, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := baseURL.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return "", fmt.Errorf("invalid href %q: %w", href, err)
+	}
+	if (baseURL.Scheme == "https" && resolved.Scheme != "https") || !sameSite(baseURL, resolved) {
+		return "", fmt.Errorf("refusing href %q outside %s", href, baseURL.Host)
+	}
+	return resolved.String(), nil
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const multistatusTemplate = `<?xml version="1.0" encoding="utf-8"?>
+<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">%s</d:multistatus>`
+
+// fakeCalDAVServer answers discovery the way Nextcloud-style servers do: the
+// root redirects to the DAV endpoint and every href after that is relative
+func fakeCalDAVServer(t *testing.T) *httptest.Server {
+	multistatus := func(w http.ResponseWriter, responses string) {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprintf(w, multistatusTemplate, responses)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/remote.php/dav/", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/remote.php/dav/", func(w http.ResponseWriter, r *http.Request) {
+		if user, password, _ := r.BasicAuth(); user != "alice" || password != "app-password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != "PROPFIND" {
+			http.Error(w, "unexpected method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.URL.Path == "/remote.php/dav/" && strings.Contains(string(body), "current-user-principal"):
+			multistatus(w, `<d:response><d:href>/remote.php/dav/</d:href><d:propstat><d:prop>
+				<d:current-user-principal><d:href>principals/users/alice/</d:href></d:current-user-principal>
+			</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`)
+		case r.URL.Path == "/remote.php/dav/principals/users/alice/":
+			multistatus(w, `<d:response><d:href>/remote.php/dav/principals/users/alice/</d:href><d:propstat><d:prop>
+				<c:calendar-home-set><d:href>../../../calendars/alice/</d:href></c:calendar-home-set>
+			</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`)
+		case r.URL.Path == "/remote.php/dav/calendars/alice/" && r.Header.Get("Depth") == "1":
+			multistatus(w, `
+			<d:response><d:href>/remote.php/dav/calendars/alice/</d:href><d:propstat><d:prop>
+				<d:resourcetype><d:collection/></d:resourcetype>
+			</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+			<d:response><d:href>personal/</d:href><d:propstat><d:prop>
+				<d:resourcetype><d:collection/><c:calendar/></d:resourcetype>
+				<d:displayname>Personal</d:displayname>
+				<c:supported-calendar-component-set><c:comp name="VEVENT"/><c:comp name="VTODO"/></c:supported-calendar-component-set>
+				<d:current-user-privilege-set><d:privilege><d:read/></d:privilege><d:privilege><d:write/></d:privilege></d:current-user-privilege-set>
+			</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+			<d:response><d:href>tasks</d:href><d:propstat><d:prop>
+				<d:resourcetype><d:collection/><c:calendar/></d:resourcetype>
+				<d:displayname>Tasks</d:displayname>
+				<c:supported-calendar-component-set><c:comp name="VTODO"/></c:supported-calendar-component-set>
+			</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+			<d:response><d:href>/remote.php/dav/calendars/alice/team_shared_by_bob/</d:href><d:propstat><d:prop>
+				<d:resourcetype><d:collection/><c:calendar/></d:resourcetype>
+				<d:displayname>Team</d:displayname>
+				<d:current-user-privilege-set><d:privilege><d:read/></d:privilege></d:current-user-privilege-set>
+			</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+			<d:response><d:href>https://evil.test/calendars/alice/</d:href><d:propstat><d:prop>
+				<d:resourcetype><d:collection/><c:calendar/></d:resourcetype>
+				<d:displayname>Elsewhere</d:displayname>
+			</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestCalDAVDiscover(t *testing.T) {
+	server := fakeCalDAVServer(t)
+	ctx := context.Background()
+
+	calendars, err := newCalDAVClient("alice", "app-password", true).Discover(ctx, server.URL)
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+
+	want := []struct {
+		url      string
+		name     string
+		writable bool
+	}{
+		{server.URL + "/remote.php/dav/calendars/alice/personal/", "Personal", true},
+		{server.URL + "/remote.php/dav/calendars/alice/team_shared_by_bob/", "Team", false},
+	}
+	if len(calendars) != len(want) {
+		t.Fatalf("found %d calendars, want %d: %+v", len(calendars), len(want), calendars)
+	}
+	for i, calendar := range calendars {
+		if calendar.URL != want[i].url || calendar.Name != want[i].name || calendar.Writable != want[i].writable {
+			t.Errorf("calendar %d = %+v, want %+v", i, calendar, want[i])
+		}
+	}
+
+	if _, err := newCalDAVClient("alice", "wrong", true).Discover(ctx, server.URL); !errors.Is(err, ErrCalDAVUnauthorized) {
+		t.Errorf("wrong password: err = %v, want ErrCalDAVUnauthorized", err)
+	}
+
+	if _, err := newCalDAVClient("alice", "app-password", false).Discover(ctx, server.URL); !errors.Is(err, errCalDAVAddressNotAllowed) {
+		t.Errorf("loopback server without allowPrivate: err = %v, want errCalDAVAddressNotAllowed", err)
+	}
+}
+
+func TestCalDAVPutObjectETags(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		objects = make(map[string]string)
+		version int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		current, exists := objects[r.URL.Path]
+		etag := fmt.Sprintf(`"%d"`, version)
+		switch r.Method {
+		case http.MethodGet:
+			if !exists {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			io.WriteString(w, current)
+		case http.MethodPut:
+			if r.Header.Get("If-None-Match") == "*" && exists {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			if match := r.Header.Get("If-Match"); match != "" && (!exists || match != etag) {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = string(body)
+			version++
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := newCalDAVClient("alice", "app-password", true)
+	ctx := context.Background()
+	objectURL := server.URL + "/calendars/alice/personal/abc.ics"
+
+	if err := client.PutObject(ctx, objectURL, []byte("v1"), ""); err != nil {
+		t.Fatalf("creating object: %v", err)
+	}
+
+	var davErr *caldavError
+	if err := client.PutObject(ctx, objectURL, []byte("again"), ""); !errors.As(err, &davErr) || davErr.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("creating over an existing object: err = %v, want 412", err)
+	}
+
+	data, etag, err := client.GetObject(ctx, objectURL)
+	if err != nil || string(data) != "v1" || etag == "" {
+		t.Fatalf("GetObject = %q, %q, %v", data, etag, err)
+	}
+
+	if err := client.PutObject(ctx, objectURL, []byte("v2"), etag); err != nil {
+		t.Fatalf("updating with the current ETag: %v", err)
+	}
+	if err := client.PutObject(ctx, objectURL, []byte("v3"), etag); !errors.As(err, &davErr) || davErr.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("updating with a stale ETag: err = %v, want 412", err)
+	}
+
+	if data, _, _ := client.GetObject(ctx, objectURL); string(data) != "v2" {
+		t.Errorf("object is %q, want v2", data)
+	}
+}
+
+func TestCalDAVRedirectsAndHrefs(t *testing.T) {
+	tests := []struct {
+		name    string
+		resolve func() (string, error)
+		want    string
+	}{
+		{
+			name:    "relative redirect",
+			resolve: func() (string, error) { return redirectTarget("https://dav.example.com/", "/remote.php/dav/") },
+			want:    "https://dav.example.com/remote.php/dav/",
+		},
+		{
+			name: "redirect to another host of the same provider",
+			resolve: func() (string, error) {
+				return redirectTarget("https://caldav.icloud.com/", "https://p42-caldav.icloud.com/123/principal/")
+			},
+			want: "https://p42-caldav.icloud.com/123/principal/",
+		},
+		{
+			name: "redirect to another site",
+			resolve: func() (string, error) {
+				return redirectTarget("https://dav.example.com/", "https://collector.evil.test/")
+			},
+		},
+		{
+			name:    "redirect from https to http",
+			resolve: func() (string, error) { return redirectTarget("https://dav.example.com/", "http://dav.example.com/") },
+		},
+		{
+			name:    "redirect to an address",
+			resolve: func() (string, error) { return redirectTarget("https://dav.example.com/", "https://169.254.169.254/") },
+		},
+		{
+			name: "parent-relative href",
+			resolve: func() (string, error) {
+				return resolveHref("https://dav.example.com/dav/principals/alice/", "../../calendars/alice/")
+			},
+			want: "https://dav.example.com/dav/calendars/alice/",
+		},
+		{
+			name: "absolute href on another site",
+			resolve: func() (string, error) {
+				return resolveHref("https://dav.example.com/dav/", "https://evil.test/calendars/")
+			},
+		},
+		{
+			name: "scheme-relative href on another site",
+			resolve: func() (string, error) {
+				return resolveHref("https://dav.example.com/dav/", "//127.0.0.1:8080/calendars/")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.resolve()
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("got %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.215.14":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"fe80::1":         false,
+		"fd00:ec2::254":   false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"::ffff:10.0.0.1": false,
+	}
+
+	for address, want := range tests {
+		if got := isPublicAddress(netip.MustParseAddr(address).Unmap()); got != want {
+			t.Errorf("isPublicAddress(%s) = %v, want %v", address, got, want)
+		}
+	}
+}
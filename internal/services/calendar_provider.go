@@ -0,0 +1,166 @@
+// internal/services/calendar_provider.go
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/models"
+	"github.com/wizenheimer/swiftcal/internal/utils"
+	"github.com/wizenheimer/swiftcal/pkg/logger"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ErrEventNotFound means the calendar event no longer exists
+var ErrEventNotFound = errors.New("calendar event not found")
+
+// ErrCalendarNotWritable means the user can't add events to the calendar,
+// because it is shared read-only with them or no longer exists
+var ErrCalendarNotWritable = errors.New("calendar is read-only or no longer exists")
+
+// CalendarProvider adds events to one kind of calendar. Calendar and event IDs
+// are the provider's own, and events come back in the same model whichever
+// provider made them.
+type CalendarProvider interface {
+	// AddEvent creates the event in a calendar the user can write to, or in
+	// their default calendar when calendarID is empty
+	AddEvent(ctx context.Context, userID uuid.UUID, calendarID string, event *models.Event) (*models.GoogleCalendarEvent, error)
+
+	// ListCalendars returns the user's calendars and whether they can add events to each
+	ListCalendars(ctx context.Context, userID uuid.UUID) ([]models.Calendar, error)
+
+	// ListEvents returns the events in a calendar, or the default one when
+	// calendarID is empty, that overlap the given times. Recurring events
+	// come back as their occurrences.
+	ListEvents(ctx context.Context, userID uuid.UUID, calendarID string, from, to time.Time) ([]models.GoogleCalendarEvent, error)
+
+	// GetEvent looks an event up, returning ErrEventNotFound once it has been deleted
+	GetEvent(ctx context.Context, userID uuid.UUID, calendarID, eventID string) (*models.GoogleCalendarEvent, error)
+
+	// UpdateEvent rewrites an event, returning ErrEventNotFound once it has been deleted
+	UpdateEvent(ctx context.Context, userID uuid.UUID, calendarID, eventID string, event *models.Event) (*models.GoogleCalendarEvent, error)
+
+	// DeleteEvent removes an event; one already deleted counts as removed
+	DeleteEvent(ctx context.Context, userID uuid.UUID, calendarID, eventID string) error
+
+	// InviteAttendees adds guests to an event and sends them invitations
+	InviteAttendees(ctx context.Context, userID uuid.UUID, eventID, calendarID string, attendees []string) error
+}
+
+// sourceEventID derives an event ID from a source key, so every attempt at
+// the same message names its events the same way. It is base32hex, lowercase
+// letters a-v and digits, which Google accepts as an event ID and which is
+// safe as a CalDAV resource name or a Graph transactionId.
+func sourceEventID(sourceKey string) string {
+	sum := sha256.Sum256([]byte(sourceKey))
+	return strings.ToLower(base32.HexEncoding.WithPadding(base32.NoPadding).EncodeToString(sum[:]))
+}
+
+// eventTimes is when an event happens, resolved against its time zone
+type eventTimes struct {
+	// Start and End are in the event's zone for timed events. All-day events
+	// have UTC midnights, with End the day after the last day.
+	Start  time.Time
+	End    time.Time
+	AllDay bool
+
+	// TimeZone is the IANA name of the zone the times were read in
+	TimeZone string
+}
+
+// resolveEventTimes reads an event's dates and wall clock times in its own
+// zone, or in the calendar's when it has none
+func resolveEventTimes(event *models.Event, defaultTimezone string) (*eventTimes, error) {
+	// Resolve the event's zone, accepting Windows names; fall back to the calendar's
+	loc, timezone, ok := utils.ResolveTimeZone(defaultTimezone)
+	if !ok {
+		loc, timezone = time.UTC, "UTC"
+	}
+
+	if event.TimeZone != nil && *event.TimeZone != "" {
+		if eventLoc, eventZone, ok := utils.ResolveTimeZone(*event.TimeZone); ok {
+			loc, timezone = eventLoc, eventZone
+		} else {
+			logger.GetLogger().Warn("Invalid timezone, using default",
+				zap.String("timezone", *event.TimeZone),
+				zap.String("default", timezone))
+		}
+	}
+
+	// An event with a date but no start time is a whole-day event
+	if event.AllDay || strings.TrimSpace(event.StartTime) == "" {
+		startDate, err := time.Parse("2 January 2006", event.Date)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse start date: %w", err)
+		}
+
+		endDate := startDate
+		if event.EndDate != nil && *event.EndDate != "" {
+			if parsed, err := time.Parse("2 January 2006", *event.EndDate); err == nil && !parsed.Before(startDate) {
+				endDate = parsed
+			}
+		}
+
+		// End dates are exclusive, as calendars store them
+		return &eventTimes{Start: startDate, End: endDate.AddDate(0, 0, 1), AllDay: true, TimeZone: timezone}, nil
+	}
+
+	// Times are wall clock in the event's zone
+	startTime, err := time.ParseInLocation("2 January 2006 15:04", fmt.Sprintf("%s %s", event.Date, event.StartTime), loc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse start time: %w", err)
+	}
+
+	endTime := startTime.Add(30 * time.Minute)
+	if event.EndTime != nil && *event.EndTime != "" {
+		endDate := event.Date
+		if event.EndDate != nil && *event.EndDate != "" {
+			endDate = *event.EndDate
+		}
+
+		parsed, err := time.ParseInLocation("2 January 2006 15:04", fmt.Sprintf("%s %s", endDate, *event.EndTime), loc)
+		if err == nil && !parsed.After(startTime) && endDate == event.Date {
+			// "10pm to 2am" without an end date runs past midnight
+			parsed = parsed.AddDate(0, 0, 1)
+		}
+
+		if err != nil {
+			logger.GetLogger().Warn("Failed to parse end time, using default duration",
+				zap.Error(err))
+		} else if !parsed.After(startTime) {
+			// Validate end time is after start time
+			logger.GetLogger().Warn("End time is not after start time, using default duration")
+		} else {
+			endTime = parsed
+		}
+	}
+
+	return &eventTimes{Start: startTime, End: endTime, TimeZone: timezone}, nil
+}
+
+// withDescriptionFooter credits swiftcal at the end of an event's description
+func withDescriptionFooter(cfg *config.Config, description string) string {
+	if description != "" {
+		description += "\n\n"
+	}
+	return description + "This event was generated by AI with swiftcal.\nDon't waste time creating events, just forward them to " + cfg.MainEmailAddress + "."
+}
+
+func isValidEmail(email string) bool {
+	// Basic email validation
+	return strings.Contains(email, "@") &&
+		strings.Contains(email, ".") &&
+		len(email) > 5 &&
+		!strings.HasPrefix(email, "@") &&
+		!strings.HasSuffix(email, "@") &&
+		!strings.Contains(email, "..") &&
+		!strings.Contains(email, " ")
+}
@@ -0,0 +1,175 @@
+// internal/services/calendar_route_service.go
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/database"
+	"github.com/wizenheimer/swiftcal/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// CalendarRouteService keeps each user's rules for which calendar a
+// forwarded email's events go to
+type CalendarRouteService struct {
+	db     *database.DB
+	config *config.Config
+}
+
+func NewCalendarRouteService(db *database.DB, cfg *config.Config) *CalendarRouteService {
+	return &CalendarRouteService{
+		db:     db,
+		config: cfg,
+	}
+}
+
+// ListRoutes returns the user's routes, plus addresses first
+func (s *CalendarRouteService) ListRoutes(ctx context.Context, userID uuid.UUID) ([]models.CalendarRoute, error) {
+	query := `
+		SELECT id, user_id, kind, pattern, calendar_id, calendar_name, created_at, updated_at
+		FROM calendar_routes
+		WHERE user_id = $1
+		ORDER BY CASE kind WHEN 'alias' THEN 0 WHEN 'sender_domain' THEN 1 ELSE 2 END, pattern
+	`
+
+	rows, err := s.db.Pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list calendar routes: %w", err)
+	}
+	defer rows.Close()
+
+	var routes []models.CalendarRoute
+	for rows.Next() {
+		var route models.CalendarRoute
+		if err := rows.Scan(
+			&route.ID, &route.UserID, &route.Kind, &route.Pattern,
+			&route.CalendarID, &route.CalendarName, &route.CreatedAt, &route.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan calendar route: %w", err)
+		}
+		routes = append(routes, route)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list calendar routes: %w", err)
+	}
+
+	return routes, nil
+}
+
+// SaveRoute adds a route, or points an existing one with the same kind and
+// pattern at the new calendar
+func (s *CalendarRouteService) SaveRoute(ctx context.Context, route *models.CalendarRoute) error {
+	query := `
+		INSERT INTO calendar_routes (user_id, kind, pattern, calendar_id, calendar_name)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, kind, pattern) DO UPDATE
+		SET calendar_id = EXCLUDED.calendar_id,
+		    calendar_name = EXCLUDED.calendar_name,
+		    updated_at = NOW()
+		RETURNING id, created_at, updated_at
+	`
+
+	err := s.db.Pool.QueryRow(ctx, query,
+		route.UserID, route.Kind, route.Pattern, route.CalendarID, route.CalendarName,
+	).Scan(&route.ID, &route.CreatedAt, &route.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save calendar route: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteRoute removes a route, reporting whether there was one to remove
+func (s *CalendarRouteService) DeleteRoute(ctx context.Context, userID uuid.UUID, kind, pattern string) (bool, error) {
+	query := `DELETE FROM calendar_routes WHERE user_id = $1 AND kind = $2 AND pattern = $3`
+
+	result, err := s.db.Pool.Exec(ctx, query, userID, kind, pattern)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete calendar route: %w", err)
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// MatchRoute finds the route for an email. A plus address wins over the
+// sender's domain, which wins over a keyword. It returns nil when no route
+// matches.
+func (s *CalendarRouteService) MatchRoute(ctx context.Context, userID uuid.UUID, alias string, senderDomains []string, text string) (*models.CalendarRoute, error) {
+	routes, err := s.ListRoutes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, kind := range []string{models.RouteKindAlias, models.RouteKindSenderDomain, models.RouteKindKeyword} {
+		for i := range routes {
+			route := &routes[i]
+			if route.Kind != kind {
+				continue
+			}
+
+			switch kind {
+			case models.RouteKindAlias:
+				if alias != "" && route.Pattern == alias {
+					return route, nil
+				}
+			case models.RouteKindSenderDomain:
+				for _, domain := range senderDomains {
+					if domain == route.Pattern || strings.HasSuffix(domain, "."+route.Pattern) {
+						return route, nil
+					}
+				}
+			case models.RouteKindKeyword:
+				if containsKeyword(text, route.Pattern) {
+					return route, nil
+				}
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// NormalizeRoutePattern puts a pattern in the form routes are stored and
+// matched in, returning "" for one that can't be used
+func NormalizeRoutePattern(kind, pattern string) string {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+
+	switch kind {
+	case models.RouteKindAlias:
+		if !routeAliasRegex.MatchString(pattern) {
+			return ""
+		}
+	case models.RouteKindSenderDomain:
+		pattern = strings.TrimPrefix(pattern, "@")
+		if !routeDomainRegex.MatchString(pattern) {
+			return ""
+		}
+	case models.RouteKindKeyword:
+		pattern = strings.Join(strings.Fields(strings.Trim(pattern, `"'`)), " ")
+		if len(pattern) < 3 || len(pattern) > 100 {
+			return ""
+		}
+	default:
+		return ""
+	}
+
+	return pattern
+}
+
+var (
+	routeAliasRegex  = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+	routeDomainRegex = regexp.MustCompile(`^[a-z0-9-]+(\.[a-z0-9-]+)*\.[a-z]{2,}$`)
+)
+
+// containsKeyword matches whole words, so "soccer" doesn't match "soccerball"
+func containsKeyword(text, keyword string) bool {
+	pattern := `(?i)(^|\W)` + strings.ReplaceAll(regexp.QuoteMeta(keyword), " ", `\s+`) + `($|\W)`
+	matched, err := regexp.MatchString(pattern, text)
+	return err == nil && matched
+}
@@ -3,7 +3,9 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -13,284 +15,235 @@ import (
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
-	"google.golang.org/api/calendar/v3"
-	"google.golang.org/api/option"
 )
 
+// CalendarService sends each user's events to the calendar provider they
+// connected, and keeps the copies their calendar feed is built from
 type CalendarService struct {
-	config      *config.Config
-	authService *AuthService
+	config        *config.Config
+	authService   *AuthService
+	createdEvents *CreatedEventService
+	google        *GoogleCalendarProvider
+	providers     map[string]CalendarProvider
 }
 
-func NewCalendarService(cfg *config.Config, authService *AuthService) *CalendarService {
-	return &CalendarService{
-		config:      cfg,
-		authService: authService,
-	}
-}
+func NewCalendarService(cfg *config.Config, authService *AuthService, microsoftAuth *MicrosoftAuthService, caldavAccounts *CalDAVAccountService, createdEvents *CreatedEventService) *CalendarService {
+	google := NewGoogleCalendarProvider(cfg, authService)
 
-func (s *CalendarService) AddEvent(ctx context.Context, userID uuid.UUID, event *models.Event) (*models.GoogleCalendarEvent, error) {
-	// Get OAuth client for the user
-	client, err := s.authService.GetOAuthClient(ctx, userID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get OAuth client: %w", err)
+	providers := map[string]CalendarProvider{
+		models.CalendarProviderGoogle: google,
+		models.CalendarProviderCalDAV: NewCalDAVCalendarProvider(cfg, caldavAccounts, authService),
+	}
+	if cfg.MicrosoftEnabled() {
+		providers[models.CalendarProviderMicrosoft] = NewMicrosoftCalendarProvider(cfg, microsoftAuth)
 	}
 
-	// Create calendar service
-	calendarService, err := calendar.NewService(ctx, option.WithHTTPClient(client))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create calendar service: %w", err)
+	return &CalendarService{
+		config:        cfg,
+		authService:   authService,
+		createdEvents: createdEvents,
+		google:        google,
+		providers:     providers,
 	}
+}
 
-	// Get primary calendar
-	calendarList, err := calendarService.CalendarList.List().Do()
+// providerFor returns the provider the user's events go to
+func (s *CalendarService) providerFor(ctx context.Context, userID uuid.UUID) (CalendarProvider, error) {
+	user, err := s.authService.GetUserByID(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get calendar list: %w", err)
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	var primaryCalendar *calendar.CalendarListEntry
-	for _, cal := range calendarList.Items {
-		if cal.Primary {
-			primaryCalendar = cal
-			break
-		}
+	provider, ok := s.providers[user.CalendarProvider]
+	if !ok {
+		return nil, fmt.Errorf("calendar provider %q is not available", user.CalendarProvider)
 	}
 
-	if primaryCalendar == nil {
-		return nil, fmt.Errorf("primary calendar not found")
-	}
+	return provider, nil
+}
 
-	// Convert event to Google Calendar format
-	googleEvent, err := s.convertToGoogleEvent(event, primaryCalendar.TimeZone)
+// AddEvent creates the event in the given calendar, or the user's default
+// one when calendarID is empty. A calendar that has become read-only or was
+// deleted since it was chosen gives way to the default.
+func (s *CalendarService) AddEvent(ctx context.Context, userID uuid.UUID, calendarID string, event *models.Event) (*models.GoogleCalendarEvent, error) {
+	provider, err := s.providerFor(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert event: %w", err)
+		return nil, err
 	}
 
-	// Add description footer
-	if googleEvent.Description != "" {
-		googleEvent.Description += "\n\n"
+	result, err := provider.AddEvent(ctx, userID, calendarID, event)
+	if err != nil && calendarID != "" && errors.Is(err, ErrCalendarNotWritable) {
+		logger.GetLogger().Warn("Routed calendar can't be written to, using the default",
+			zap.Error(err),
+			zap.String("user_id", userID.String()),
+			zap.String("calendar_id", calendarID))
+		result, err = provider.AddEvent(ctx, userID, "", event)
 	}
-	googleEvent.Description += "This event was generated by AI with swiftcal.\nDon't waste time creating events, just forward them to " + s.config.MainEmailAddress + "."
-
-	// Create the event
-	createdEvent, err := calendarService.Events.Insert(primaryCalendar.Id, googleEvent).
-		ConferenceDataVersion(1).
-		SendNotifications(true).
-		SendUpdates("all").
-		Do()
-
 	if err != nil {
-		return nil, fmt.Errorf("failed to create calendar event: %w", err)
+		return nil, err
 	}
 
-	// Convert back to our model
-	result := &models.GoogleCalendarEvent{
-		ID:          createdEvent.Id,
-		Summary:     createdEvent.Summary,
-		Description: createdEvent.Description,
-		Location:    createdEvent.Location,
-		HTMLLink:    createdEvent.HtmlLink,
-	}
-
-	if createdEvent.Start != nil {
-		if createdEvent.Start.DateTime != "" {
-			if startTime, err := time.Parse(time.RFC3339, createdEvent.Start.DateTime); err == nil {
-				result.StartTime = startTime
-				result.TimeZone = createdEvent.Start.TimeZone
-			}
-		}
-	}
+	s.recordEvent(ctx, userID, result, event.SourceKey)
 
-	if createdEvent.End != nil {
-		if createdEvent.End.DateTime != "" {
-			if endTime, err := time.Parse(time.RFC3339, createdEvent.End.DateTime); err == nil {
-				result.EndTime = endTime
-			}
-		}
-	}
+	return result, nil
+}
 
-	// Convert attendees
-	for _, attendee := range createdEvent.Attendees {
-		result.Attendees = append(result.Attendees, models.GoogleCalendarAttendee{
-			Email:       attendee.Email,
-			DisplayName: attendee.DisplayName,
-			Organizer:   attendee.Organizer,
-		})
+// ListCalendars returns the calendars of the provider the user's events go to
+func (s *CalendarService) ListCalendars(ctx context.Context, userID uuid.UUID) ([]models.Calendar, error) {
+	provider, err := s.providerFor(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
 
-	logger.GetLogger().Info("Calendar event created",
-		zap.String("user_id", userID.String()),
-		zap.String("event_id", result.ID),
-		zap.String("summary", result.Summary))
-
-	return result, nil
+	return provider.ListCalendars(ctx, userID)
 }
 
-func (s *CalendarService) convertToGoogleEvent(event *models.Event, defaultTimezone string) (*calendar.Event, error) {
-	// Parse date and times
-	timezone := defaultTimezone
-	if event.TimeZone != nil && *event.TimeZone != "" {
-		timezone = *event.TimeZone
+// FindDuplicate looks for an event already in the calendar, or the user's
+// default one when calendarID is empty, that is likely the one being added:
+// the same invite, or one at the same time with a similar name, location or
+// guests. It returns nil when there is none. An event the same message
+// created before it was retried is left for AddEvent to find.
+func (s *CalendarService) FindDuplicate(ctx context.Context, userID uuid.UUID, calendarID string, event *models.Event) (*models.GoogleCalendarEvent, error) {
+	provider, err := s.providerFor(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Parse start time
-	startTimeStr := fmt.Sprintf("%s %s", event.Date, event.StartTime)
-	startTime, err := time.Parse("2 January 2006 15:04", startTimeStr)
+	// Times without a zone could be in any, so look a day either side
+	times, err := resolveEventTimes(event, "UTC")
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse start time: %w", err)
+		return nil, fmt.Errorf("failed to convert event: %w", err)
 	}
 
-	// Load timezone
-	loc, err := time.LoadLocation(timezone)
+	candidates, err := provider.ListEvents(ctx, userID, calendarID, times.Start.Add(-24*time.Hour), times.End.Add(24*time.Hour))
 	if err != nil {
-		logger.GetLogger().Warn("Invalid timezone, using default",
-			zap.String("timezone", timezone),
-			zap.Error(err))
-		loc, _ = time.LoadLocation(defaultTimezone)
+		return nil, err
 	}
 
-	startTime = startTime.In(loc)
-
-	// Parse end time
-	var endTime time.Time
-	if event.EndTime != nil && *event.EndTime != "" {
-		endTimeStr := fmt.Sprintf("%s %s", event.Date, *event.EndTime)
-		endTime, err = time.Parse("2 January 2006 15:04", endTimeStr)
+	// The copy a retried message already created is its own, not a duplicate.
+	// Google and CalDAV copies have IDs derived from the source key even when
+	// they couldn't be recorded.
+	if event.SourceKey != "" {
+		ownIDs, err := s.createdEvents.EventIDsForSource(ctx, userID, event.SourceKey)
 		if err != nil {
-			logger.GetLogger().Warn("Failed to parse end time, using default duration",
-				zap.Error(err))
-			endTime = startTime.Add(30 * time.Minute)
-		} else {
-			endTime = endTime.In(loc)
-			// Validate end time is after start time
-			if !endTime.After(startTime) {
-				logger.GetLogger().Warn("End time is not after start time, using default duration")
-				endTime = startTime.Add(30 * time.Minute)
-			}
+			return nil, err
 		}
-	} else {
-		// Default 30 minutes
-		endTime = startTime.Add(30 * time.Minute)
-	}
+		ownIDs = append(ownIDs, sourceEventID(event.SourceKey))
 
-	// Create Google Calendar event
-	googleEvent := &calendar.Event{
-		Summary: event.Summary,
-		Start: &calendar.EventDateTime{
-			DateTime: startTime.Format(time.RFC3339),
-			TimeZone: timezone,
-		},
-		End: &calendar.EventDateTime{
-			DateTime: endTime.Format(time.RFC3339),
-			TimeZone: timezone,
-		},
-		Status:                  "confirmed",
-		GuestsCanInviteOthers:   &[]bool{true}[0],
-		GuestsCanModify:         true,
-		GuestsCanSeeOtherGuests: &[]bool{true}[0],
+		candidates = slices.DeleteFunc(candidates, func(candidate models.GoogleCalendarEvent) bool {
+			return slices.Contains(ownIDs, candidate.ID)
+		})
 	}
 
-	if event.Description != nil {
-		googleEvent.Description = *event.Description
+	return findDuplicateEvent(event, candidates), nil
+}
+
+// MergeDuplicate adds an event's guests to the copy of it already in the
+// calendar, returning whether swiftcal created that copy and the guests
+// invited. Only events swiftcal created are changed; others belong to
+// whoever invited the user.
+func (s *CalendarService) MergeDuplicate(ctx context.Context, userID uuid.UUID, existing *models.GoogleCalendarEvent, event *models.Event) (bool, []string, error) {
+	created, err := s.createdEvents.HasEvent(ctx, userID, existing.ID)
+	if err != nil || !created {
+		return false, nil, err
 	}
 
-	if event.Location != nil {
-		googleEvent.Location = *event.Location
+	invited := make(map[string]bool)
+	for _, attendee := range existing.Attendees {
+		invited[strings.ToLower(attendee.Email)] = true
 	}
 
-	// Add attendees (filter out invalid emails)
-	var validAttendees []*calendar.EventAttendee
+	var guests []string
 	for _, email := range event.Attendees {
-		if s.isValidEmail(email) {
-			validAttendees = append(validAttendees, &calendar.EventAttendee{
-				Email: email,
-			})
-		} else {
-			logger.GetLogger().Warn("Skipping invalid email address",
-				zap.String("email", email))
+		if !invited[strings.ToLower(email)] {
+			invited[strings.ToLower(email)] = true
+			guests = append(guests, email)
 		}
 	}
-	googleEvent.Attendees = validAttendees
+	if len(guests) == 0 {
+		return true, nil, nil
+	}
 
-	return googleEvent, nil
-}
+	if err := s.InviteAdditionalAttendees(ctx, userID, existing.ID, existing.CalendarID, guests); err != nil {
+		return true, nil, err
+	}
 
-func (s *CalendarService) isValidEmail(email string) bool {
-	// Basic email validation
-	return strings.Contains(email, "@") &&
-		strings.Contains(email, ".") &&
-		len(email) > 5 &&
-		!strings.HasPrefix(email, "@") &&
-		!strings.HasSuffix(email, "@") &&
-		!strings.Contains(email, "..") &&
-		!strings.Contains(email, " ")
+	return true, guests, nil
 }
 
-func (s *CalendarService) InviteAdditionalAttendees(ctx context.Context, userID uuid.UUID, eventID, calendarID string, attendees []string) error {
-	// Get OAuth client for the user
-	client, err := s.authService.GetOAuthClient(ctx, userID)
+// GetEvent looks up an event swiftcal created. It returns ErrEventNotFound
+// when the event has been deleted from the calendar.
+func (s *CalendarService) GetEvent(ctx context.Context, userID uuid.UUID, calendarID, eventID string) (*models.GoogleCalendarEvent, error) {
+	provider, err := s.providerFor(ctx, userID)
 	if err != nil {
-		return fmt.Errorf("failed to get OAuth client: %w", err)
+		return nil, err
 	}
 
-	// Create calendar service
-	calendarService, err := calendar.NewService(ctx, option.WithHTTPClient(client))
+	return provider.GetEvent(ctx, userID, calendarID, eventID)
+}
+
+// UpdateEvent rewrites an event swiftcal created earlier with new details,
+// keeping guests that were invited to it since. It returns ErrEventNotFound
+// when the event has been deleted from the calendar.
+func (s *CalendarService) UpdateEvent(ctx context.Context, userID uuid.UUID, calendarID, eventID string, event *models.Event) (*models.GoogleCalendarEvent, error) {
+	provider, err := s.providerFor(ctx, userID)
 	if err != nil {
-		return fmt.Errorf("failed to create calendar service: %w", err)
+		return nil, err
 	}
 
-	// Get the existing event
-	event, err := calendarService.Events.Get(calendarID, eventID).Do()
+	result, err := provider.UpdateEvent(ctx, userID, calendarID, eventID, event)
 	if err != nil {
-		return fmt.Errorf("failed to get event: %w", err)
+		return nil, err
 	}
 
-	// Add new attendees
-	for _, email := range attendees {
-		if s.isValidEmail(email) {
-			event.Attendees = append(event.Attendees, &calendar.EventAttendee{
-				Email: email,
-			})
-		}
-	}
+	s.recordEvent(ctx, userID, result, event.SourceKey)
 
-	// Update the event
-	_, err = calendarService.Events.Update(calendarID, eventID, event).
-		SendNotifications(true).
-		SendUpdates("all").
-		ConferenceDataVersion(1).
-		Do()
+	return result, nil
+}
 
+// DeleteEvent removes an event swiftcal created earlier. An event the user
+// already deleted counts as removed.
+func (s *CalendarService) DeleteEvent(ctx context.Context, userID uuid.UUID, calendarID, eventID string) error {
+	provider, err := s.providerFor(ctx, userID)
 	if err != nil {
-		return fmt.Errorf("failed to update event: %w", err)
+		return err
 	}
 
-	logger.GetLogger().Info("Additional attendees invited",
-		zap.String("user_id", userID.String()),
-		zap.String("event_id", eventID),
-		zap.Strings("attendees", attendees))
+	if err := provider.DeleteEvent(ctx, userID, calendarID, eventID); err != nil {
+		return err
+	}
+
+	if err := s.createdEvents.ForgetEvent(ctx, userID, eventID); err != nil {
+		logger.GetLogger().Error("Failed to forget deleted event", zap.Error(err), zap.String("event_id", eventID))
+	}
 
 	return nil
 }
 
-func (s *CalendarService) GetUserCalendars(ctx context.Context, userID uuid.UUID) ([]*calendar.CalendarListEntry, error) {
-	// Get OAuth client for the user
-	client, err := s.authService.GetOAuthClient(ctx, userID)
+func (s *CalendarService) InviteAdditionalAttendees(ctx context.Context, userID uuid.UUID, eventID, calendarID string, attendees []string) error {
+	provider, err := s.providerFor(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get OAuth client: %w", err)
+		return err
 	}
 
-	// Create calendar service
-	calendarService, err := calendar.NewService(ctx, option.WithHTTPClient(client))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create calendar service: %w", err)
-	}
+	return provider.InviteAttendees(ctx, userID, eventID, calendarID, attendees)
+}
 
-	// Get calendar list
-	calendarList, err := calendarService.CalendarList.List().Do()
+// PreviewEvent resolves an event's times the way AddEvent would, without a
+// calendar to add it to. Times without a zone are taken as UTC.
+func (s *CalendarService) PreviewEvent(event *models.Event) (*models.GoogleCalendarEvent, error) {
+	googleEvent, err := s.google.convertToGoogleEvent(event, "UTC")
 	if err != nil {
-		return nil, fmt.Errorf("failed to get calendar list: %w", err)
+		return nil, fmt.Errorf("failed to convert event: %w", err)
 	}
 
-	return calendarList.Items, nil
+	return s.google.toCalendarEvent(googleEvent, ""), nil
+}
+
+// recordEvent keeps a copy for the user's feed. The event is already in the
+// calendar, so a failure here is logged rather than returned.
+func (s *CalendarService) recordEvent(ctx context.Context, userID uuid.UUID, event *models.GoogleCalendarEvent, sourceKey string) {
+	if err := s.createdEvents.RecordEvent(ctx, userID, event, sourceKey); err != nil {
+		logger.GetLogger().Error("Failed to record created event", zap.Error(err), zap.String("event_id", event.ID))
+	}
 }
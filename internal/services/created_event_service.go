@@ -0,0 +1,153 @@
+// internal/services/created_event_service.go
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/database"
+	"github.com/wizenheimer/swiftcal/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// CreatedEventService keeps a copy of every event swiftcal has put in a
+// user's calendar, which their calendar feed is built from
+type CreatedEventService struct {
+	db     *database.DB
+	config *config.Config
+}
+
+func NewCreatedEventService(db *database.DB, cfg *config.Config) *CreatedEventService {
+	return &CreatedEventService{
+		db:     db,
+		config: cfg,
+	}
+}
+
+// RecordEvent stores an event as it was created or last updated, with the
+// source key of the event it was read from. An update without one keeps the
+// key it was created with.
+func (s *CreatedEventService) RecordEvent(ctx context.Context, userID uuid.UUID, event *models.GoogleCalendarEvent, sourceKey string) error {
+	query := `
+		INSERT INTO created_events (user_id, event_id, calendar_id, ical_uid, summary, description, location,
+			start_time, end_time, time_zone, all_day, recurrence, html_link, source_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NULLIF($14, ''))
+		ON CONFLICT (user_id, event_id) DO UPDATE
+		SET calendar_id = EXCLUDED.calendar_id,
+		    ical_uid = EXCLUDED.ical_uid,
+		    summary = EXCLUDED.summary,
+		    description = EXCLUDED.description,
+		    location = EXCLUDED.location,
+		    start_time = EXCLUDED.start_time,
+		    end_time = EXCLUDED.end_time,
+		    time_zone = EXCLUDED.time_zone,
+		    all_day = EXCLUDED.all_day,
+		    recurrence = EXCLUDED.recurrence,
+		    html_link = EXCLUDED.html_link,
+		    source_key = COALESCE(EXCLUDED.source_key, created_events.source_key),
+		    updated_at = NOW()
+	`
+
+	_, err := s.db.Pool.Exec(ctx, query,
+		userID, event.ID, event.CalendarID, event.ICalUID, event.Summary, event.Description, event.Location,
+		event.StartTime, event.EndTime, event.TimeZone, event.AllDay, event.Recurrence, event.HTMLLink, sourceKey,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record created event: %w", err)
+	}
+
+	return nil
+}
+
+// ForgetEvent drops an event that was deleted from the calendar
+func (s *CreatedEventService) ForgetEvent(ctx context.Context, userID uuid.UUID, eventID string) error {
+	query := `DELETE FROM created_events WHERE user_id = $1 AND event_id = $2`
+
+	if _, err := s.db.Pool.Exec(ctx, query, userID, eventID); err != nil {
+		return fmt.Errorf("failed to forget created event: %w", err)
+	}
+
+	return nil
+}
+
+// HasEvent reports whether swiftcal created the event
+func (s *CreatedEventService) HasEvent(ctx context.Context, userID uuid.UUID, eventID string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM created_events WHERE user_id = $1 AND event_id = $2)`
+
+	var exists bool
+	if err := s.db.Pool.QueryRow(ctx, query, userID, eventID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to look up created event: %w", err)
+	}
+
+	return exists, nil
+}
+
+// EventIDsForSource returns the IDs of the events created from a source key
+func (s *CreatedEventService) EventIDsForSource(ctx context.Context, userID uuid.UUID, sourceKey string) ([]string, error) {
+	query := `SELECT event_id FROM created_events WHERE user_id = $1 AND source_key = $2`
+
+	rows, err := s.db.Pool.Query(ctx, query, userID, sourceKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up created events: %w", err)
+	}
+
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan created event: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to look up created events: %w", err)
+	}
+
+	return ids, nil
+}
+
+// ListEvents returns a user's events in start order
+func (s *CreatedEventService) ListEvents(ctx context.Context, userID uuid.UUID) ([]*models.GoogleCalendarEvent, error) {
+	query := `
+		SELECT event_id, calendar_id, ical_uid, summary, COALESCE(description, ''), COALESCE(location, ''),
+			start_time, end_time, time_zone, all_day, recurrence, COALESCE(html_link, '')
+		FROM created_events
+		WHERE user_id = $1
+		ORDER BY start_time
+	`
+
+	rows, err := s.db.Pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list created events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*models.GoogleCalendarEvent
+	for rows.Next() {
+		event := &models.GoogleCalendarEvent{}
+		if err := rows.Scan(
+			&event.ID, &event.CalendarID, &event.ICalUID, &event.Summary, &event.Description, &event.Location,
+			&event.StartTime, &event.EndTime, &event.TimeZone, &event.AllDay, &event.Recurrence, &event.HTMLLink,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan created event: %w", err)
+		}
+
+		// All-day dates were stored as UTC midnights
+		if event.AllDay {
+			event.StartTime, event.EndTime = event.StartTime.UTC(), event.EndTime.UTC()
+		}
+
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list created events: %w", err)
+	}
+
+	return events, nil
+}
@@ -13,16 +13,18 @@ import (
 )
 
 type CronService struct {
-	db          *database.DB
-	config      *config.Config
-	authService *AuthService
+	db            *database.DB
+	config        *config.Config
+	authService   *AuthService
+	microsoftAuth *MicrosoftAuthService
 }
 
-func NewCronService(db *database.DB, cfg *config.Config, authService *AuthService) *CronService {
+func NewCronService(db *database.DB, cfg *config.Config, authService *AuthService, microsoftAuth *MicrosoftAuthService) *CronService {
 	return &CronService{
-		db:          db,
-		config:      cfg,
-		authService: authService,
+		db:            db,
+		config:        cfg,
+		authService:   authService,
+		microsoftAuth: microsoftAuth,
 	}
 }
 
@@ -43,6 +45,7 @@ func (s *CronService) runTokenRefreshJob(ctx context.Context) {
 
 	// Run immediately on startup
 	s.refreshExpiringTokens(ctx)
+	s.refreshExpiringMicrosoftTokens(ctx)
 
 	for {
 		select {
@@ -51,6 +54,7 @@ func (s *CronService) runTokenRefreshJob(ctx context.Context) {
 			return
 		case <-ticker.C:
 			s.refreshExpiringTokens(ctx)
+			s.refreshExpiringMicrosoftTokens(ctx)
 		}
 	}
 }
@@ -109,6 +113,41 @@ func (s *CronService) refreshExpiringTokens(ctx context.Context) {
 	)
 }
 
+// refreshExpiringMicrosoftTokens keeps Microsoft refresh tokens in use, since
+// they lapse after 90 days idle
+func (s *CronService) refreshExpiringMicrosoftTokens(ctx context.Context) {
+	if !s.config.MicrosoftEnabled() {
+		return
+	}
+
+	userIDs, err := s.microsoftAuth.FindUsersWithExpiringTokens(ctx)
+	if err != nil {
+		logger.GetLogger().Error("Failed to find users with expiring Microsoft tokens", zap.Error(err))
+		return
+	}
+
+	successCount := 0
+	for _, userID := range userIDs {
+		refreshCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+
+		if _, err := s.microsoftAuth.RefreshAccessToken(refreshCtx, userID); err != nil {
+			logger.GetLogger().Error("Failed to refresh Microsoft token", zap.Error(err), zap.String("user_id", userID.String()))
+		} else {
+			successCount++
+		}
+
+		cancel()
+	}
+
+	if len(userIDs) > 0 {
+		logger.GetLogger().Info("Microsoft token refresh completed",
+			zap.Int("total", len(userIDs)),
+			zap.Int("succeeded", successCount),
+			zap.Int("failed", len(userIDs)-successCount),
+		)
+	}
+}
+
 func (s *CronService) cleanupExpiredData(ctx context.Context) {
 	logger.GetLogger().Debug("Starting cleanup job")
 
@@ -126,4 +165,28 @@ func (s *CronService) cleanupExpiredData(ctx context.Context) {
 	} else {
 		logger.GetLogger().Debug("No expired pending email addresses to clean up")
 	}
+
+	// Processed inbound jobs only matter while their webhook might be redelivered
+	query = `DELETE FROM inbound_jobs WHERE status = 'done' AND updated_at < NOW() - INTERVAL '7 days'`
+	result, err = s.db.Pool.Exec(ctx, query)
+	if err != nil {
+		logger.GetLogger().Error("Failed to cleanup processed inbound jobs", zap.Error(err))
+		return
+	}
+
+	if rowsAffected := result.RowsAffected(); rowsAffected > 0 {
+		logger.GetLogger().Info("Cleaned up processed inbound jobs", zap.Int64("count", rowsAffected))
+	}
+
+	// Providers stop retrying within days, so a month of message history is plenty
+	query = `DELETE FROM processed_messages WHERE updated_at < NOW() - INTERVAL '30 days'`
+	result, err = s.db.Pool.Exec(ctx, query)
+	if err != nil {
+		logger.GetLogger().Error("Failed to cleanup processed messages", zap.Error(err))
+		return
+	}
+
+	if rowsAffected := result.RowsAffected(); rowsAffected > 0 {
+		logger.GetLogger().Info("Cleaned up processed messages", zap.Int64("count", rowsAffected))
+	}
 }
@@ -0,0 +1,214 @@
+// internal/services/duplicate_events.go
+package services
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/internal/models"
+)
+
+// duplicateThreshold is the score above which an existing event is taken to
+// be the one being added again
+const duplicateThreshold = 0.7
+
+// duplicateStartSlack is how far apart two starts can be and still count as
+// the same time, allowing for rounding in emails like "around 2pm"
+const duplicateStartSlack = 15 * time.Minute
+
+var (
+	duplicateWordRegex = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+	// Prefixes mail clients and reminder emails put before an event's name
+	duplicateSummaryPrefixRegex = regexp.MustCompile(`(?i)^\s*((updated\s+)?invitation|accepted|tentative|reminder|fwd?|re)\s*:\s*`)
+
+	duplicateStopWords = map[string]bool{
+		"a": true, "an": true, "and": true, "at": true, "for": true, "in": true,
+		"of": true, "on": true, "the": true, "to": true, "with": true,
+	}
+)
+
+// findDuplicateEvent returns the candidate most likely to be the same event,
+// or nil when none scores above duplicateThreshold
+func findDuplicateEvent(event *models.Event, candidates []models.GoogleCalendarEvent) *models.GoogleCalendarEvent {
+	var best *models.GoogleCalendarEvent
+	bestScore := duplicateThreshold
+
+	for i := range candidates {
+		if score := duplicateScore(event, &candidates[i]); score >= bestScore {
+			best, bestScore = &candidates[i], score
+		}
+	}
+
+	return best
+}
+
+// duplicateScore rates from 0 to 1 how likely an existing event is the one
+// being added. The same iCalendar UID settles it. Otherwise the two must
+// happen at the same time, and their names, locations and guests decide.
+func duplicateScore(event *models.Event, existing *models.GoogleCalendarEvent) float64 {
+	if event.UID != "" && strings.EqualFold(event.UID, existing.ICalUID) {
+		return 1
+	}
+
+	// Times without a zone are read the way the existing event's calendar would
+	times, err := resolveEventTimes(event, existing.TimeZone)
+	if err != nil {
+		return 0
+	}
+
+	timing := timeMatch(times, existing)
+	if timing == 0 {
+		return 0
+	}
+
+	// Location and guests only count when both events have them
+	similarity := 0.6 * summarySimilarity(event.Summary, existing.Summary)
+	weight := 0.6
+
+	if event.Location != nil && *event.Location != "" && existing.Location != "" {
+		similarity += 0.2 * wordOverlap(*event.Location, existing.Location)
+		weight += 0.2
+	}
+
+	if len(event.Attendees) > 0 && len(existing.Attendees) > 0 {
+		var emails []string
+		for _, attendee := range existing.Attendees {
+			emails = append(emails, attendee.Email)
+		}
+		similarity += 0.2 * emailOverlap(event.Attendees, emails)
+		weight += 0.2
+	}
+
+	return 0.3*timing + 0.7*similarity/weight
+}
+
+// timeMatch is 1 when two events start together, 0.5 when they only overlap
+// and 0 when they don't. An all-day event matches a timed one on its days.
+func timeMatch(times *eventTimes, existing *models.GoogleCalendarEvent) float64 {
+	if !overlaps(times.Start, times.End, existing.StartTime, existing.EndTime) {
+		if times.AllDay == existing.AllDay {
+			return 0
+		}
+	}
+
+	switch {
+	case times.AllDay && existing.AllDay:
+		if times.Start.Equal(existing.StartTime) {
+			return 1
+		}
+		return 0.5
+	case times.AllDay || existing.AllDay:
+		// All-day dates are UTC midnights; compare them with the other
+		// event's date where it happens
+		allDayStart, allDayEnd, timed := times.Start, times.End, existing.StartTime
+		if existing.AllDay {
+			allDayStart, allDayEnd, timed = existing.StartTime, existing.EndTime, times.Start
+		}
+		day := time.Date(timed.Year(), timed.Month(), timed.Day(), 0, 0, 0, 0, time.UTC)
+		if !day.Before(allDayStart) && day.Before(allDayEnd) {
+			return 0.5
+		}
+		return 0
+	default:
+		if diff := times.Start.Sub(existing.StartTime).Abs(); diff <= duplicateStartSlack {
+			return 1
+		}
+		return 0.5
+	}
+}
+
+func overlaps(start, end, otherStart, otherEnd time.Time) bool {
+	if !end.After(start) {
+		end = start.Add(time.Minute)
+	}
+	if !otherEnd.After(otherStart) {
+		otherEnd = otherStart.Add(time.Minute)
+	}
+	return start.Before(otherEnd) && otherStart.Before(end)
+}
+
+// cleanSummary drops the "Invitation:" style prefixes and the " @ date"
+// suffix Google adds to invitation subjects
+func cleanSummary(summary string) string {
+	for {
+		cleaned := duplicateSummaryPrefixRegex.ReplaceAllString(summary, "")
+		if cleaned == summary {
+			break
+		}
+		summary = cleaned
+	}
+
+	if at := strings.LastIndex(summary, " @ "); at > 0 {
+		summary = summary[:at]
+	}
+
+	return summary
+}
+
+// wordOverlap is the share of the shorter text's words found in the other,
+// so "12 Main St" matches "12 Main St, Springfield"
+func wordOverlap(a, b string) float64 {
+	shared, smaller, _ := sharedWords(a, b)
+	if smaller == 0 {
+		return 0
+	}
+	return float64(shared) / float64(smaller)
+}
+
+// summarySimilarity averages wordOverlap with the share of all words the
+// names have in common, so "Dentist" is close to "Dentist appointment" but
+// "Conference keynote" is further from "Conference"
+func summarySimilarity(a, b string) float64 {
+	shared, smaller, total := sharedWords(cleanSummary(a), cleanSummary(b))
+	if smaller == 0 {
+		return 0
+	}
+	return (float64(shared)/float64(smaller) + float64(shared)/float64(total)) / 2
+}
+
+// sharedWords counts the words two texts have in common, the words in the
+// shorter one and the distinct words in both
+func sharedWords(a, b string) (shared, smaller, total int) {
+	wordsA, wordsB := significantWords(a), significantWords(b)
+	for word := range wordsA {
+		if wordsB[word] {
+			shared++
+		}
+	}
+	return shared, min(len(wordsA), len(wordsB)), len(wordsA) + len(wordsB) - shared
+}
+
+func significantWords(text string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range duplicateWordRegex.FindAllString(strings.ToLower(text), -1) {
+		if !duplicateStopWords[word] {
+			words[word] = true
+		}
+	}
+	return words
+}
+
+// emailOverlap is the share of the smaller guest list found in the other
+func emailOverlap(a, b []string) float64 {
+	listA, listB := make(map[string]bool), make(map[string]bool)
+	for _, email := range a {
+		listA[strings.ToLower(strings.TrimSpace(email))] = true
+	}
+	for _, email := range b {
+		listB[strings.ToLower(strings.TrimSpace(email))] = true
+	}
+	if len(listA) == 0 || len(listB) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for email := range listA {
+		if listB[email] {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(min(len(listA), len(listB)))
+}
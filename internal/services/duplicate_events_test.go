@@ -0,0 +1,153 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/internal/models"
+)
+
+var london, _ = time.LoadLocation("Europe/London")
+
+// existingEvent is an event already in a London calendar
+func existingEvent(summary string, start time.Time, length time.Duration) models.GoogleCalendarEvent {
+	return models.GoogleCalendarEvent{
+		ID:        "existing",
+		Summary:   summary,
+		StartTime: start,
+		EndTime:   start.Add(length),
+		TimeZone:  "Europe/London",
+	}
+}
+
+// allDayEvent is an all-day event on the given dates, stored as UTC midnights
+func allDayEvent(summary string, first time.Time, days int) models.GoogleCalendarEvent {
+	start := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, time.UTC)
+	return models.GoogleCalendarEvent{
+		ID:        "existing",
+		Summary:   summary,
+		StartTime: start,
+		EndTime:   start.AddDate(0, 0, days),
+		TimeZone:  "UTC",
+		AllDay:    true,
+	}
+}
+
+func TestDuplicateScore(t *testing.T) {
+	end := "17:30"
+	tenAM := time.Date(2026, 10, 20, 10, 0, 0, 0, london)
+	fivePM := time.Date(2026, 10, 20, 17, 0, 0, 0, london)
+
+	invite := existingEvent("Launch sync", fivePM, 30*time.Minute)
+	invite.ICalUID = "4k2v8q0m1n5p@google.com"
+
+	tests := []struct {
+		name      string
+		event     models.Event
+		existing  models.GoogleCalendarEvent
+		duplicate bool
+	}{
+		{
+			name:      "same UID at another time",
+			event:     models.Event{UID: "4k2v8q0m1n5p@google.com", Summary: "Launch sync", Date: "27 October 2026", StartTime: "09:00"},
+			existing:  invite,
+			duplicate: true,
+		},
+		{
+			name:      "Google invitation subject",
+			event:     models.Event{Summary: "Launch sync", Date: "20 October 2026", StartTime: "17:00", EndTime: &end},
+			existing:  existingEvent("Invitation: Launch sync @ Tue 20 Oct 2026 5pm - 5:30pm (BST) (sam@example.org)", fivePM, 30*time.Minute),
+			duplicate: true,
+		},
+		{
+			name:      "reminder rounded to the quarter hour",
+			event:     models.Event{Summary: "Reminder: dentist appointment", Date: "20 October 2026", StartTime: "10:10"},
+			existing:  existingEvent("Dentist appointment", tenAM, time.Hour),
+			duplicate: true,
+		},
+		{
+			name:      "timed event on an all-day event's day",
+			event:     models.Event{Summary: "Dentist", Date: "20 October 2026", StartTime: "10:00"},
+			existing:  allDayEvent("Dentist", tenAM, 1),
+			duplicate: true,
+		},
+		{
+			name:     "session within an all-day conference",
+			event:    models.Event{Summary: "Conference keynote", Date: "20 October 2026", StartTime: "10:00"},
+			existing: allDayEvent("Conference", tenAM, 2),
+		},
+		{
+			name:     "different meetings at the same time",
+			event:    models.Event{Summary: "Design review", Date: "20 October 2026", StartTime: "17:00", EndTime: &end},
+			existing: existingEvent("1:1 with Priya", fivePM, 30*time.Minute),
+		},
+		{
+			name:     "same meeting on another day",
+			event:    models.Event{Summary: "Launch sync", Date: "21 October 2026", StartTime: "17:00"},
+			existing: existingEvent("Launch sync", fivePM, 30*time.Minute),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score := duplicateScore(&tt.event, &tt.existing)
+			if (score >= duplicateThreshold) != tt.duplicate {
+				t.Errorf("score = %.2f, duplicate = %v, want %v", score, score >= duplicateThreshold, tt.duplicate)
+			}
+		})
+	}
+}
+
+func TestTimeMatch(t *testing.T) {
+	nine := time.Date(2026, 10, 20, 9, 0, 0, 0, london)
+
+	tests := []struct {
+		name     string
+		event    models.Event
+		existing models.GoogleCalendarEvent
+		want     float64
+	}{
+		{"same start", models.Event{Date: "20 October 2026", StartTime: "09:00"}, existingEvent("", nine, time.Hour), 1},
+		{"start within the slack", models.Event{Date: "20 October 2026", StartTime: "09:10"}, existingEvent("", nine, time.Hour), 1},
+		{"overlapping", models.Event{Date: "20 October 2026", StartTime: "09:30"}, existingEvent("", nine, time.Hour), 0.5},
+		{"back to back", models.Event{Date: "20 October 2026", StartTime: "10:00"}, existingEvent("", nine, time.Hour), 0},
+		{"all-day and timed on the same day", models.Event{Date: "20 October 2026", AllDay: true}, existingEvent("", nine, time.Hour), 0.5},
+		{"timed on an all-day event's day", models.Event{Date: "20 October 2026", StartTime: "15:00"}, allDayEvent("", nine, 1), 0.5},
+		{"timed the day after an all-day event", models.Event{Date: "21 October 2026", StartTime: "09:00"}, allDayEvent("", nine, 1), 0},
+		{"all-day on the same day", models.Event{Date: "20 October 2026", AllDay: true}, allDayEvent("", nine, 1), 1},
+		{"all-day overlapping", models.Event{Date: "21 October 2026", AllDay: true}, allDayEvent("", nine, 3), 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			times, err := resolveEventTimes(&tt.event, "Europe/London")
+			if err != nil {
+				t.Fatalf("resolveEventTimes: %v", err)
+			}
+			if got := timeMatch(times, &tt.existing); got != tt.want {
+				t.Errorf("timeMatch = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarySimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"Launch sync", "Launch sync", 1},
+		{"Invitation: Launch sync @ Tue 20 Oct 2026 5pm - 5:30pm (BST) (sam@example.org)", "Launch sync", 1},
+		{"Updated invitation: Launch sync @ Tue 20 Oct 2026", "launch SYNC", 1},
+		{"Fwd: Re: The standup", "Standup", 1},
+		{"Dentist", "Dentist appointment", 0.75},
+		{"Design review", "1:1 with Priya", 0},
+		{"", "Launch sync", 0},
+	}
+
+	for _, tt := range tests {
+		if got := summarySimilarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("summarySimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
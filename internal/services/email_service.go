@@ -3,10 +3,16 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
+	"net/mail"
 	"net/url"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -20,15 +26,43 @@ import (
 	"go.uber.org/zap"
 )
 
+// Outcomes recorded for processed messages and reported on redelivery
+const (
+	outcomeUnverified    = "unverified_sender"
+	outcomeSupport       = "forwarded_to_support"
+	outcomeSignup        = "signup_invitation"
+	outcomeAddEmail      = "add_email_address"
+	outcomeRemoveEmail   = "remove_email_address"
+	outcomeDeleteAccount = "delete_account"
+	outcomeAddEvent      = "add_event"
+	outcomeGuestEvents   = "guest_events"
+	outcomeFeed          = "calendar_feed"
+	outcomeReminders     = "default_reminders"
+	outcomeCalDAV        = "caldav_account"
+	outcomeMicrosoft     = "microsoft_account"
+	outcomeRoutes        = "calendar_routes"
+)
+
+// plainTextMinRatio is how many times longer the HTML part's text must be than
+// the plain part before the plain part is considered unusable
+const plainTextMinRatio = 3
+
 type EmailService struct {
-	config          *config.Config
-	authService     *AuthService
-	calendarService *CalendarService
-	openaiService   *OpenAIService
-	emailProvider   EmailProvider
+	config            *config.Config
+	authService       *AuthService
+	calendarService   *CalendarService
+	openaiService     *OpenAIService
+	messageLog        *MessageLogService
+	importedEvents    *ImportedEventService
+	feedService       *FeedService
+	userSettings      *UserSettingsService
+	caldavAccounts    *CalDAVAccountService
+	calendarRoutes    *CalendarRouteService
+	emailProvider     EmailProvider
+	mailAuthenticator *MailAuthenticator
 }
 
-func NewEmailService(cfg *config.Config, authService *AuthService, calendarService *CalendarService, openaiService *OpenAIService) *EmailService {
+func NewEmailService(cfg *config.Config, authService *AuthService, calendarService *CalendarService, openaiService *OpenAIService, messageLog *MessageLogService, importedEvents *ImportedEventService, feedService *FeedService, userSettings *UserSettingsService, caldavAccounts *CalDAVAccountService, calendarRoutes *CalendarRouteService) *EmailService {
 	var emailProvider EmailProvider
 
 	if cfg.MailgunAPIKey != "" {
@@ -36,35 +70,102 @@ func NewEmailService(cfg *config.Config, authService *AuthService, calendarServi
 	}
 
 	return &EmailService{
-		config:          cfg,
-		authService:     authService,
-		calendarService: calendarService,
-		openaiService:   openaiService,
-		emailProvider:   emailProvider,
+		config:            cfg,
+		authService:       authService,
+		calendarService:   calendarService,
+		openaiService:     openaiService,
+		messageLog:        messageLog,
+		importedEvents:    importedEvents,
+		feedService:       feedService,
+		userSettings:      userSettings,
+		caldavAccounts:    caldavAccounts,
+		calendarRoutes:    calendarRoutes,
+		emailProvider:     emailProvider,
+		mailAuthenticator: NewMailAuthenticator(cfg),
 	}
 }
 
+// HandleWebhook processes an inbound message once. A redelivery of a message
+// that was already handled returns its original outcome without replying again.
 func (s *EmailService) HandleWebhook(ctx context.Context, webhook *models.EmailWebhook, files []models.EmailFile) error {
 	sender := s.getSenderFromEmail(webhook)
+	key := s.messageLog.MessageKey(sender, webhook)
+
+	existing, claimed, err := s.messageLog.Claim(ctx, key, sender)
+	if err != nil {
+		return err
+	}
+
+	if !claimed {
+		outcome := ""
+		if existing.Outcome != nil {
+			outcome = *existing.Outcome
+		}
+
+		logger.GetLogger().Info("Skipping already processed email",
+			zap.String("sender", sender),
+			zap.String("message_key", key),
+			zap.String("outcome", outcome),
+			zap.Time("processed_at", existing.UpdatedAt))
+		return nil
+	}
+
+	outcome, err := s.processWebhook(ctx, sender, webhook, files)
+	if err != nil {
+		if releaseErr := s.messageLog.Release(ctx, key); releaseErr != nil {
+			logger.GetLogger().Error("Failed to release message claim", zap.Error(releaseErr), zap.String("message_key", key))
+		}
+		return err
+	}
+
+	if err := s.messageLog.Complete(ctx, key, outcome); err != nil {
+		// The work is done; a stale claim only delays a redelivery until it expires
+		logger.GetLogger().Error("Failed to record processed email", zap.Error(err), zap.String("message_key", key))
+	}
+
+	return nil
+}
+
+func (s *EmailService) processWebhook(ctx context.Context, sender string, webhook *models.EmailWebhook, files []models.EmailFile) (string, error) {
 	logger.GetLogger().Info("Processing email webhook", zap.String("sender", sender))
 
 	// Verify email authenticity
 	if !s.verifyEmail(webhook) {
 		logger.GetLogger().Warn("Email failed verification")
-		return s.sendUnverifiedEmailResponse(ctx, sender, webhook)
+		return outcomeUnverified, s.sendUnverifiedEmailResponse(ctx, sender, webhook)
 	}
 
 	// Check if this is a support email
 	recipients := s.getRecipientsFromEmail(webhook)
 	if s.isSupportEmail(recipients, webhook.Subject) {
-		return s.forwardToSupport(ctx, sender, webhook)
+		return outcomeSupport, s.forwardToSupport(ctx, sender, webhook)
 	}
 
 	// Get user from email
 	user, err := s.authService.GetUserByEmail(ctx, sender)
 	if err != nil {
+		// A CalDAV or Microsoft calendar can be connected without a Google account
+		switch s.parseSubjectAction(webhook.Subject) {
+		case "connectCalDAV":
+			return outcomeCalDAV, s.handleConnectCalDAV(ctx, sender, nil, webhook)
+		case "connectMicrosoft":
+			return outcomeMicrosoft, s.handleConnectMicrosoft(ctx, sender, webhook)
+		}
+
+		if s.config.GuestModeEnabled {
+			allowed, err := s.allowGuest(ctx, sender, webhook)
+			if err != nil {
+				return "", err
+			}
+			if allowed {
+				logger.GetLogger().Info("User not found, replying in guest mode", zap.String("sender", sender))
+				return outcomeGuestEvents, s.handleGuestEvents(ctx, sender, webhook, files)
+			}
+			logger.GetLogger().Info("Guest limit reached", zap.String("sender", sender))
+		}
+
 		logger.GetLogger().Info("User not found, sending signup invitation", zap.String("sender", sender))
-		return s.sendSignupInvitation(ctx, sender, webhook)
+		return outcomeSignup, s.sendSignupInvitation(ctx, sender, webhook)
 	}
 
 	// Determine action from subject
@@ -75,19 +176,41 @@ func (s *EmailService) HandleWebhook(ctx context.Context, webhook *models.EmailW
 
 	switch action {
 	case "addUser":
-		return s.handleAddEmailAddress(ctx, user, webhook)
+		return outcomeAddEmail, s.handleAddEmailAddress(ctx, user, webhook)
 	case "removeEmail":
-		return s.handleRemoveEmailAddress(ctx, user, webhook)
+		return outcomeRemoveEmail, s.handleRemoveEmailAddress(ctx, user, webhook)
 	case "deleteAccount":
-		return s.handleDeleteAccount(ctx, user, webhook)
+		return outcomeDeleteAccount, s.handleDeleteAccount(ctx, user, webhook)
+	case "feed", "resetFeed", "stopFeed":
+		return outcomeFeed, s.handleFeed(ctx, user, webhook, action)
+	case "defaultReminders":
+		return outcomeReminders, s.handleDefaultReminders(ctx, user, webhook)
+	case "connectCalDAV":
+		return outcomeCalDAV, s.handleConnectCalDAV(ctx, sender, user, webhook)
+	case "disconnectCalDAV":
+		return outcomeCalDAV, s.handleDisconnectCalDAV(ctx, user, webhook)
+	case "connectMicrosoft":
+		return outcomeMicrosoft, s.handleConnectMicrosoft(ctx, sender, webhook)
+	case "listRoutes":
+		return outcomeRoutes, s.handleListRoutes(ctx, user, webhook)
+	case "addRoute":
+		return outcomeRoutes, s.handleAddRoute(ctx, user, webhook, files)
+	case "removeRoute":
+		return outcomeRoutes, s.handleRemoveRoute(ctx, user, webhook, files)
 	case "addEvent":
-		return s.handleAddEvent(ctx, user, webhook, files)
+		return outcomeAddEvent, s.handleAddEvent(ctx, user, webhook, files)
 	default:
-		return s.handleAddEvent(ctx, user, webhook, files)
+		return outcomeAddEvent, s.handleAddEvent(ctx, user, webhook, files)
 	}
 }
 
+// getSenderFromEmail returns the From header address, since that is the identity
+// DMARC alignment authenticates. The envelope sender is only a fallback.
 func (s *EmailService) getSenderFromEmail(webhook *models.EmailWebhook) string {
+	if from, err := mail.ParseAddress(webhook.From); err == nil {
+		return strings.ToLower(from.Address)
+	}
+
 	var envelope struct {
 		From string `json:"from"`
 	}
@@ -118,18 +241,20 @@ func (s *EmailService) getRecipientsFromEmail(webhook *models.EmailWebhook) []st
 	return recipients
 }
 
+// verifyEmail requires SPF or DKIM to pass for a domain aligned with the From
+// header before the sender is trusted to identify a user
 func (s *EmailService) verifyEmail(webhook *models.EmailWebhook) bool {
-	// Check SPF
-	if webhook.SPF != "pass" {
-		return false
-	}
+	result := s.mailAuthenticator.Evaluate(webhook)
 
-	// Check DKIM
-	if !strings.Contains(strings.ToLower(webhook.DKIM), "pass") {
-		return false
-	}
+	logger.GetLogger().Debug("Sender authentication evaluated",
+		zap.String("from_domain", result.FromDomain),
+		zap.String("spf", result.SPF),
+		zap.String("spf_domain", result.SPFDomain),
+		zap.Strings("dkim_domains", result.DKIMDomains),
+		zap.String("dmarc", result.DMARC),
+		zap.Bool("aligned", result.Aligned))
 
-	return true
+	return result.Aligned
 }
 
 func (s *EmailService) isSupportEmail(recipients []string, subject string) bool {
@@ -157,6 +282,28 @@ func (s *EmailService) parseSubjectAction(subject string) string {
 		return "removeEmail"
 	} else if strings.HasPrefix(subject, "delete account") {
 		return "deleteAccount"
+	} else if subject == "calendar feed" {
+		return "feed"
+	} else if subject == "reset calendar feed" {
+		return "resetFeed"
+	} else if subject == "stop calendar feed" {
+		return "stopFeed"
+	} else if strings.HasPrefix(subject, "default reminders") {
+		return "defaultReminders"
+	} else if strings.HasPrefix(subject, "connect caldav") {
+		return "connectCalDAV"
+	} else if strings.HasPrefix(subject, "disconnect caldav") {
+		return "disconnectCalDAV"
+	} else if subject == "connect microsoft" && s.config.MicrosoftEnabled() {
+		return "connectMicrosoft"
+	} else if subject == "calendar routes" {
+		return "listRoutes"
+	} else if _, _, calendarName, ok := parseRouteCommand(subject); ok {
+		// Anything else starting with "route" is an email about an event
+		if calendarName == "" {
+			return "removeRoute"
+		}
+		return "addRoute"
 	} else if strings.HasPrefix(subject, "fwd") {
 		return "addEvent"
 	}
@@ -184,6 +331,7 @@ func (s *EmailService) forwardToSupport(ctx context.Context, sender string, webh
 		webhook.Text,
 		content,
 		nil,
+		nil,
 	)
 }
 
@@ -252,59 +400,620 @@ func (s *EmailService) handleDeleteAccount(ctx context.Context, user *models.Use
 	return s.sendEmailResponse(ctx, user.Email, webhook, template, true)
 }
 
+// handleFeed sends the user their feed URL, after replacing or revoking the
+// token if they asked to
+func (s *EmailService) handleFeed(ctx context.Context, user *models.User, webhook *models.EmailWebhook, action string) error {
+	var token string
+	var err error
+
+	switch action {
+	case "stopFeed":
+		if err := s.feedService.RevokeToken(ctx, user.ID); err != nil {
+			return err
+		}
+		template := templates.GetFeedRevokedTemplate(s.config.EmailDomain)
+		return s.sendEmailResponse(ctx, user.Email, webhook, template, false)
+	case "resetFeed":
+		token, err = s.feedService.RegenerateToken(ctx, user.ID)
+	default:
+		token, err = s.feedService.GetOrCreateToken(ctx, user.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	template := templates.GetFeedTemplate(s.feedService.WebcalURL(token), s.feedService.FeedURL(token), s.config.EmailDomain)
+	return s.sendEmailResponse(ctx, user.Email, webhook, template, false)
+}
+
+// handleDefaultReminders sets the reminders listed in the subject, such as
+// "default reminders: 10 minutes, 1 day by email", or clears them on "reset"
+func (s *EmailService) handleDefaultReminders(ctx context.Context, user *models.User, webhook *models.EmailWebhook) error {
+	list := strings.TrimSpace(webhook.Subject)[len("default reminders"):]
+	list = strings.TrimSpace(strings.TrimLeft(list, ": "))
+
+	if strings.EqualFold(list, "reset") {
+		if err := s.userSettings.SetDefaultReminders(ctx, user.ID, nil); err != nil {
+			return err
+		}
+		template := templates.GetDefaultRemindersResetTemplate(s.config.EmailDomain)
+		return s.sendEmailResponse(ctx, user.Email, webhook, template, false)
+	}
+
+	reminders := utils.ParseReminders(list)
+	if len(reminders) == 0 {
+		template := templates.GetDefaultRemindersHelpTemplate(s.config.EmailDomain)
+		return s.sendEmailResponse(ctx, user.Email, webhook, template, false)
+	}
+
+	if err := s.userSettings.SetDefaultReminders(ctx, user.ID, reminders); err != nil {
+		return err
+	}
+
+	template := templates.GetDefaultRemindersTemplate(utils.DescribeReminders(reminders), s.config.EmailDomain)
+	return s.sendEmailResponse(ctx, user.Email, webhook, template, false)
+}
+
+// handleConnectCalDAV connects the CalDAV server described in the body,
+// creating the user when the sender has no account yet. Replies leave the
+// thread out so the password isn't sent back.
+func (s *EmailService) handleConnectCalDAV(ctx context.Context, sender string, user *models.User, webhook *models.EmailWebhook) error {
+	body := webhook.Text
+	if strings.TrimSpace(body) == "" {
+		body = utils.HTMLToText(webhook.HTML)
+	}
+	settings := parseCalDAVSettings(body)
+	redactCalDAVSettings(webhook)
+
+	if settings["server"] == "" || settings["username"] == "" || settings["password"] == "" {
+		template := templates.GetCalDAVHelpTemplate(s.config.EmailDomain)
+		return s.sendEmailResponse(ctx, sender, webhook, template, false)
+	}
+
+	account, calendars, err := s.caldavAccounts.DiscoverAccount(ctx, settings["server"], settings["username"], settings["password"], settings["calendar"])
+	if err != nil {
+		logger.GetLogger().Info("Failed to connect CalDAV account", zap.Error(err), zap.String("sender", sender))
+		template := templates.GetCalDAVConnectFailedTemplate(html.EscapeString(err.Error()), calendarNames(calendars), s.config.EmailDomain)
+		return s.sendEmailResponse(ctx, sender, webhook, template, false)
+	}
+
+	if user == nil {
+		user, err = s.authService.CreateProviderUser(ctx, sender, models.CalendarProviderCalDAV)
+		if err != nil {
+			return err
+		}
+
+		if err := s.authService.AddEmailAddress(ctx, user.ID, sender, true); err != nil {
+			logger.GetLogger().Error("Failed to add default email address", zap.Error(err))
+		}
+
+		logger.GetLogger().Info("New user created", zap.String("user_id", user.ID.String()), zap.String("provider", models.CalendarProviderCalDAV))
+	}
+
+	account.UserID = user.ID
+	if err := s.caldavAccounts.SaveAccount(ctx, account); err != nil {
+		return err
+	}
+	if err := s.authService.SetCalendarProvider(ctx, user.ID, models.CalendarProviderCalDAV); err != nil {
+		return fmt.Errorf("failed to set calendar provider: %w", err)
+	}
+
+	template := templates.GetCalDAVConnectedTemplate(html.EscapeString(account.CalendarName), calendarNames(calendars), s.config.EmailDomain)
+	return s.sendEmailResponse(ctx, user.Email, webhook, template, false)
+}
+
+// handleDisconnectCalDAV forgets the user's CalDAV account and sends their
+// events to Google again
+func (s *EmailService) handleDisconnectCalDAV(ctx context.Context, user *models.User, webhook *models.EmailWebhook) error {
+	if err := s.caldavAccounts.DeleteAccount(ctx, user.ID); err != nil {
+		return err
+	}
+
+	if user.CalendarProvider == models.CalendarProviderCalDAV {
+		if err := s.authService.SetCalendarProvider(ctx, user.ID, models.CalendarProviderGoogle); err != nil {
+			return fmt.Errorf("failed to set calendar provider: %w", err)
+		}
+	}
+
+	template := templates.GetCalDAVDisconnectedTemplate(s.config.EmailDomain)
+	return s.sendEmailResponse(ctx, user.Email, webhook, template, false)
+}
+
+// handleConnectMicrosoft replies with a link that links the Microsoft account
+// the sender signs in with to their address. The email authenticated the
+// sender, so only the owner of the address gets the link.
+func (s *EmailService) handleConnectMicrosoft(ctx context.Context, sender string, webhook *models.EmailWebhook) error {
+	template := templates.GetConnectMicrosoftTemplate(microsoftLinkURL(s.config, sender), s.config.EmailDomain)
+	return s.sendEmailResponse(ctx, sender, webhook, template, false)
+}
+
+// redactCalDAVSettings drops the body of a "connect caldav" email once it has
+// been read, so the app password isn't kept with the job. A retry finds no
+// settings and sends the help reply.
+func redactCalDAVSettings(webhook *models.EmailWebhook) {
+	webhook.Text = "[CalDAV settings removed]"
+	webhook.HTML = ""
+}
+
+// parseCalDAVSettings reads "server:", "username:", "password:" and
+// "calendar:" lines. The first of each wins, so quoted replies are ignored.
+func parseCalDAVSettings(body string) map[string]string {
+	aliases := map[string]string{
+		"server":   "server",
+		"url":      "server",
+		"username": "username",
+		"user":     "username",
+		"password": "password",
+		"calendar": "calendar",
+	}
+
+	settings := make(map[string]string)
+	for _, line := range strings.Split(body, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+
+		// Bold labels arrive as "*server:* value" in plain text
+		name, known := aliases[strings.ToLower(strings.Trim(key, " *"))]
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(strings.TrimSpace(key), "*") {
+			value = strings.TrimSpace(strings.TrimPrefix(value, "*"))
+		}
+		if !known || value == "" || settings[name] != "" {
+			continue
+		}
+
+		// Mail clients write links as "https://host <https://host>"
+		if name == "server" {
+			value = strings.Fields(value)[0]
+		}
+		settings[name] = value
+	}
+
+	return settings
+}
+
+func calendarNames(calendars []models.CalDAVCalendar) []string {
+	var names []string
+	for _, calendar := range calendars {
+		name := html.EscapeString(calendar.Name)
+		if !calendar.Writable {
+			name += " (read-only)"
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+var (
+	routeFromCommandRegex    = regexp.MustCompile(`(?i)^(route|unroute)\s+from\s+(\S+)(?:\s+to\s+(.+))?$`)
+	routeKeywordCommandRegex = regexp.MustCompile(`(?i)^(route|unroute)\s+keyword\s+(?:"([^"]+)"|(\S+))(?:\s+to\s+(.+))?$`)
+	routeAliasCommandRegex   = regexp.MustCompile(`(?i)^(route|unroute)\s+(\S+)(?:\s+to\s+(.+))?$`)
+	senderAddressRegex       = regexp.MustCompile(`[a-zA-Z0-9._%+-]+@([a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)+)`)
+)
+
+// parseRouteCommand reads "route family to Family", "route from united.com to
+// Travel" or "route keyword soccer to Kids", and the same after "unroute"
+// without a calendar. ok is false when the subject isn't one of these.
+func parseRouteCommand(subject string) (kind, pattern, calendarName string, ok bool) {
+	subject = strings.TrimSpace(subject)
+	removing := strings.HasPrefix(strings.ToLower(subject), "unroute")
+
+	var matches []string
+	if matches = routeFromCommandRegex.FindStringSubmatch(subject); matches != nil {
+		kind, pattern, calendarName = models.RouteKindSenderDomain, matches[2], matches[3]
+	} else if matches = routeKeywordCommandRegex.FindStringSubmatch(subject); matches != nil {
+		kind, pattern, calendarName = models.RouteKindKeyword, matches[2]+matches[3], matches[4]
+	} else if matches = routeAliasCommandRegex.FindStringSubmatch(subject); matches != nil {
+		kind, pattern, calendarName = models.RouteKindAlias, matches[2], matches[3]
+
+		// Accept the whole plus address as well as its tag
+		if local, _, found := strings.Cut(pattern, "@"); found {
+			_, pattern, _ = strings.Cut(local, "+")
+		}
+	} else {
+		return "", "", "", false
+	}
+
+	calendarName = strings.Trim(strings.TrimSpace(calendarName), `"`)
+	if removing != (calendarName == "") {
+		return "", "", "", false
+	}
+
+	return kind, pattern, calendarName, true
+}
+
+// describeRoute says which emails a route matches
+func (s *EmailService) describeRoute(kind, pattern string) string {
+	switch kind {
+	case models.RouteKindAlias:
+		local, domain, _ := strings.Cut(s.config.MainEmailAddress, "@")
+		return fmt.Sprintf("emails sent to %s+%s@%s", local, pattern, domain)
+	case models.RouteKindSenderDomain:
+		return "emails from " + pattern
+	default:
+		return fmt.Sprintf("emails mentioning \"%s\"", pattern)
+	}
+}
+
+// handleListRoutes sends the user their routes and the calendars they can
+// route to
+func (s *EmailService) handleListRoutes(ctx context.Context, user *models.User, webhook *models.EmailWebhook) error {
+	routes, err := s.calendarRoutes.ListRoutes(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	calendars, err := s.calendarService.ListCalendars(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list calendars: %w", err)
+	}
+
+	var descriptions []string
+	for _, route := range routes {
+		descriptions = append(descriptions, fmt.Sprintf("%s go to %s", html.EscapeString(s.describeRoute(route.Kind, route.Pattern)), html.EscapeString(route.CalendarName)))
+	}
+
+	local, domain, _ := strings.Cut(s.config.MainEmailAddress, "@")
+	template := templates.GetCalendarRoutesTemplate(descriptions, writableCalendarNames(calendars), local, domain, s.config.EmailDomain)
+	return s.sendEmailResponse(ctx, user.Email, webhook, template, false)
+}
+
+// handleAddRoute sends the events from emails matching the subject's rule to
+// the calendar it names, which must be one the user can add events to
+func (s *EmailService) handleAddRoute(ctx context.Context, user *models.User, webhook *models.EmailWebhook, files []models.EmailFile) error {
+	kind, pattern, calendarName, ok := parseRouteCommand(webhook.Subject)
+	if !ok {
+		logger.GetLogger().Warn("Invalid route format, treating as event")
+		return s.handleAddEvent(ctx, user, webhook, files)
+	}
+
+	normalized := NormalizeRoutePattern(kind, pattern)
+	if normalized == "" {
+		reason := fmt.Sprintf("%q can't be used to match emails", pattern)
+		template := templates.GetCalendarRouteFailedTemplate(html.EscapeString(reason), nil, s.config.EmailDomain)
+		return s.sendEmailResponse(ctx, user.Email, webhook, template, false)
+	}
+
+	calendars, err := s.calendarService.ListCalendars(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list calendars: %w", err)
+	}
+
+	var chosen *models.Calendar
+	for i, calendar := range calendars {
+		if strings.EqualFold(calendar.Name, calendarName) || calendar.ID == calendarName {
+			chosen = &calendars[i]
+			break
+		}
+	}
+
+	if chosen == nil || !chosen.Writable {
+		reason := fmt.Sprintf("you have no calendar named %q", calendarName)
+		if chosen != nil {
+			reason = fmt.Sprintf("%s is read-only, so events can't be added to it", chosen.Name)
+		}
+		template := templates.GetCalendarRouteFailedTemplate(html.EscapeString(reason), writableCalendarNames(calendars), s.config.EmailDomain)
+		return s.sendEmailResponse(ctx, user.Email, webhook, template, false)
+	}
+
+	route := &models.CalendarRoute{
+		UserID:       user.ID,
+		Kind:         kind,
+		Pattern:      normalized,
+		CalendarID:   chosen.ID,
+		CalendarName: chosen.Name,
+	}
+	if err := s.calendarRoutes.SaveRoute(ctx, route); err != nil {
+		return err
+	}
+
+	template := templates.GetCalendarRouteSavedTemplate(html.EscapeString(s.describeRoute(kind, normalized)), html.EscapeString(chosen.Name), s.config.EmailDomain)
+	return s.sendEmailResponse(ctx, user.Email, webhook, template, false)
+}
+
+func (s *EmailService) handleRemoveRoute(ctx context.Context, user *models.User, webhook *models.EmailWebhook, files []models.EmailFile) error {
+	kind, pattern, _, ok := parseRouteCommand(webhook.Subject)
+	if !ok {
+		logger.GetLogger().Warn("Invalid unroute format, treating as event")
+		return s.handleAddEvent(ctx, user, webhook, files)
+	}
+
+	normalized := NormalizeRoutePattern(kind, pattern)
+	removed := false
+	if normalized != "" {
+		var err error
+		if removed, err = s.calendarRoutes.DeleteRoute(ctx, user.ID, kind, normalized); err != nil {
+			return err
+		}
+	}
+
+	if !removed {
+		reason := fmt.Sprintf("there was no route for %s", s.describeRoute(kind, strings.ToLower(pattern)))
+		template := templates.GetCalendarRouteFailedTemplate(html.EscapeString(reason), nil, s.config.EmailDomain)
+		return s.sendEmailResponse(ctx, user.Email, webhook, template, false)
+	}
+
+	template := templates.GetCalendarRouteRemovedTemplate(html.EscapeString(s.describeRoute(kind, normalized)), s.config.EmailDomain)
+	return s.sendEmailResponse(ctx, user.Email, webhook, template, false)
+}
+
+// routeCalendar picks the calendar an email's events go to: the user's route
+// for its plus address, sender or keywords, then a calendar named like the
+// plus address. It returns "" for the default calendar.
+func (s *EmailService) routeCalendar(ctx context.Context, user *models.User, webhook *models.EmailWebhook) string {
+	alias := s.plusAddressTag(webhook)
+	text := webhook.Subject + "\n" + s.getBodyText(webhook)
+
+	route, err := s.calendarRoutes.MatchRoute(ctx, user.ID, alias, s.senderDomains(webhook, text), text)
+	if err != nil {
+		logger.GetLogger().Error("Failed to match calendar routes", zap.Error(err), zap.String("user_id", user.ID.String()))
+	}
+	if route != nil {
+		logger.GetLogger().Info("Routing events to calendar",
+			zap.String("user_id", user.ID.String()),
+			zap.String("kind", route.Kind),
+			zap.String("calendar_id", route.CalendarID))
+		return route.CalendarID
+	}
+
+	if alias == "" {
+		return ""
+	}
+
+	// swiftcal+team-x@ finds a calendar called "Team X" without a route
+	calendars, err := s.calendarService.ListCalendars(ctx, user.ID)
+	if err != nil {
+		logger.GetLogger().Error("Failed to list calendars", zap.Error(err), zap.String("user_id", user.ID.String()))
+		return ""
+	}
+	for _, calendar := range calendars {
+		if calendar.Writable && NormalizeRoutePattern(models.RouteKindAlias, calendarSlug(calendar.Name)) == alias {
+			return calendar.ID
+		}
+	}
+
+	logger.GetLogger().Info("No calendar matches plus address, using the default", zap.String("alias", alias))
+	return ""
+}
+
+// plusAddressTag returns "family" for mail sent to swiftcal+family@
+func (s *EmailService) plusAddressTag(webhook *models.EmailWebhook) string {
+	local, domain, _ := strings.Cut(strings.ToLower(s.config.MainEmailAddress), "@")
+
+	recipients := s.getRecipientsFromEmail(webhook)
+	if addresses, err := mail.ParseAddressList(webhook.To); err == nil {
+		for _, address := range addresses {
+			recipients = append(recipients, strings.ToLower(address.Address))
+		}
+	}
+
+	for _, recipient := range recipients {
+		recipientLocal, recipientDomain, _ := strings.Cut(recipient, "@")
+		if recipientDomain != domain && recipientDomain != strings.ToLower(s.config.EmailDomain) {
+			continue
+		}
+		if tag, found := strings.CutPrefix(recipientLocal, local+"+"); found {
+			if tag = NormalizeRoutePattern(models.RouteKindAlias, tag); tag != "" {
+				return tag
+			}
+		}
+	}
+
+	return ""
+}
+
+// senderDomains lists the domains an email came from: the sender's own and
+// those of the messages they forwarded
+func (s *EmailService) senderDomains(webhook *models.EmailWebhook, text string) []string {
+	var domains []string
+	seen := make(map[string]bool)
+
+	add := func(address string) {
+		if matches := senderAddressRegex.FindStringSubmatch(address); matches != nil {
+			domain := strings.ToLower(matches[1])
+			if !seen[domain] {
+				seen[domain] = true
+				domains = append(domains, domain)
+			}
+		}
+	}
+
+	add(webhook.From)
+	for _, message := range utils.SplitThread(text) {
+		add(message.From)
+	}
+
+	return domains
+}
+
+// calendarSlug turns "Team X" into "team-x", the form plus addresses use
+func calendarSlug(name string) string {
+	return strings.Trim(calendarSlugRegex.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+var calendarSlugRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+func writableCalendarNames(calendars []models.Calendar) []string {
+	var names []string
+	for _, calendar := range calendars {
+		if calendar.Writable {
+			names = append(names, html.EscapeString(calendar.Name))
+		}
+	}
+	return names
+}
+
 func (s *EmailService) handleAddEvent(ctx context.Context, user *models.User, webhook *models.EmailWebhook, files []models.EmailFile) error {
 	// Check for ICS attachments first
-	for _, file := range files {
-		if strings.HasSuffix(strings.ToLower(file.Filename), ".ics") {
-			return s.handleICSEvent(ctx, user, webhook, file)
-		}
+	if icsFiles := calendarAttachments(files); len(icsFiles) > 0 {
+		return s.handleICSEvents(ctx, user, webhook, icsFiles)
+	}
+
+	// Reservation markup gives exact times without asking the model
+	if events := utils.ExtractReservations(webhook.HTML); len(events) > 0 {
+		return s.handleReservationEvents(ctx, user, webhook, events)
 	}
 
 	// Process email with AI
 	return s.handleAIEvent(ctx, user, webhook)
 }
 
-func (s *EmailService) handleICSEvent(ctx context.Context, user *models.User, webhook *models.EmailWebhook, icsFile models.EmailFile) error {
-	// Parse ICS file using existing utility
-	event, err := utils.ParseICSFile(icsFile.Content)
-	if err != nil {
-		logger.GetLogger().Error("Failed to parse ICS file", zap.Error(err))
+// handleICSEvents adds every event from every calendar attachment in one pass
+func (s *EmailService) handleICSEvents(ctx context.Context, user *models.User, webhook *models.EmailWebhook, icsFiles []models.EmailFile) error {
+	events := parseICSAttachments(icsFiles)
+	if len(events) == 0 {
 		template := templates.GetUnableToParseTemplate(s.config.EmailDomain)
 		return s.sendEmailResponse(ctx, user.Email, webhook, template, true)
 	}
 
-	// Add to calendar using the parsed event directly
-	addedEvent, err := s.calendarService.AddEvent(ctx, user.ID, event)
-	if err != nil {
-		logger.GetLogger().Error("Failed to add ICS event to calendar", zap.Error(err))
-		template := templates.GetOAuthFailedTemplate(s.config.AppDomain, s.config.EmailDomain)
+	logger.GetLogger().Info("Adding events from ICS attachments",
+		zap.String("user_id", user.ID.String()),
+		zap.Int("files_count", len(icsFiles)),
+		zap.Int("events_count", len(events)))
+
+	// Invites for events imported before are updates or cancellations
+	var newEvents []models.Event
+	var updated []*models.GoogleCalendarEvent
+	var cancelled []models.Event
+	unmatchedCancellations := 0
+
+	for _, event := range events {
+		var imported *models.ImportedEvent
+		if event.UID != "" {
+			var err error
+			imported, err = s.importedEvents.GetImportedEvent(ctx, user.ID, event.UID, event.RecurrenceID)
+			if err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case event.Cancelled && imported == nil:
+			unmatchedCancellations++
+		case event.Cancelled:
+			if err := s.calendarService.DeleteEvent(ctx, user.ID, imported.CalendarID, imported.EventID); err != nil {
+				return err
+			}
+			if err := s.importedEvents.DeleteImportedEvent(ctx, imported.ID); err != nil {
+				return err
+			}
+			cancelled = append(cancelled, event)
+		case imported == nil:
+			newEvents = append(newEvents, event)
+		case event.Sequence <= imported.Sequence:
+			// An invite forwarded again, or one older than the copy in the calendar
+			logger.GetLogger().Info("Skipping ICS event that is not newer than the imported one",
+				zap.String("uid", event.UID),
+				zap.Int("sequence", event.Sequence),
+				zap.Int("imported_sequence", imported.Sequence))
+		default:
+			event.Attendees = s.filterValidEmails(event.Attendees)
+			calEvent, err := s.calendarService.UpdateEvent(ctx, user.ID, imported.CalendarID, imported.EventID, &event)
+			if errors.Is(err, ErrEventNotFound) {
+				// Deleted from the calendar since, so add it again
+				newEvents = append(newEvents, event)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := s.importedEvents.SaveImportedEvent(ctx, user.ID, event.UID, event.RecurrenceID, event.Sequence, calEvent.CalendarID, calEvent.ID); err != nil {
+				return err
+			}
+			updated = append(updated, calEvent)
+		}
+	}
+
+	if len(newEvents) > 0 {
+		if err := s.addEvents(ctx, user, webhook, newEvents); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case len(updated) == 1 && len(cancelled) == 0:
+		event := updated[0]
+		template := templates.GetEventUpdatedTemplate(html.EscapeString(event.Summary), event.HTMLLink, s.formatEventWhen(event), s.config.EmailDomain)
+		return s.sendEventsResponse(ctx, user.Email, webhook, template, true, updated)
+	case len(cancelled) == 1 && len(updated) == 0:
+		event := cancelled[0]
+		template := templates.GetEventCancelledTemplate(html.EscapeString(event.Summary), s.formatImportedEventDate(event), s.config.EmailDomain)
+		return s.sendEmailResponse(ctx, user.Email, webhook, template, true)
+	case len(updated) > 0 || len(cancelled) > 0:
+		return s.sendEventChangesResponse(ctx, user.Email, webhook, updated, cancelled)
+	case len(newEvents) == 0 && unmatchedCancellations > 0:
+		template := templates.GetCancelledEventNotFoundTemplate(s.config.EmailDomain)
+		return s.sendEmailResponse(ctx, user.Email, webhook, template, true)
+	case len(newEvents) == 0:
+		template := templates.GetEventUpToDateTemplate(s.config.EmailDomain)
 		return s.sendEmailResponse(ctx, user.Email, webhook, template, true)
 	}
 
-	// Send success response
-	template := templates.GetEventAddedTemplate(
-		addedEvent.HTMLLink,
-		s.formatEventDate(addedEvent.StartTime, addedEvent.TimeZone),
-		s.formatAttendees(addedEvent.Attendees),
-		s.config.EmailDomain,
-	)
-	return s.sendEmailResponse(ctx, user.Email, webhook, template, true)
+	return nil
 }
 
-func (s *EmailService) handleAIEvent(ctx context.Context, user *models.User, webhook *models.EmailWebhook) error {
-	// Extract headers
-	headers := s.parseEmailHeaders(webhook.Headers)
+// calendarAttachments picks out the calendar parts of a message
+func calendarAttachments(files []models.EmailFile) []models.EmailFile {
+	var icsFiles []models.EmailFile
+	for _, file := range files {
+		if utils.IsCalendarAttachment(file.Filename, file.MimeType) {
+			icsFiles = append(icsFiles, file)
+		}
+	}
+	return icsFiles
+}
 
-	// Process with OpenAI
-	eventsResponse, _, err := s.openaiService.ProcessEmail(
-		ctx,
-		webhook.Text,
-		webhook.Subject,
-		webhook.From,
-		headers["Date"],
-	)
+// parseICSAttachments reads the events from every calendar part. Gmail and
+// Outlook send the same invite as an inline text/calendar part and again as
+// an invite.ics attachment, so events are kept once per UID and occurrence,
+// in their highest SEQUENCE.
+func parseICSAttachments(icsFiles []models.EmailFile) []models.Event {
+	var events []models.Event
+	seen := make(map[[2]string]int)
+
+	for _, icsFile := range icsFiles {
+		parsed, err := utils.ParseICSFile(icsFile.Content)
+		if err != nil {
+			logger.GetLogger().Error("Failed to parse ICS file",
+				zap.Error(err),
+				zap.String("filename", icsFile.Filename))
+			continue
+		}
+
+		for _, event := range parsed {
+			if event.UID == "" {
+				events = append(events, event)
+				continue
+			}
+
+			key := [2]string{event.UID, event.RecurrenceID}
+			if i, ok := seen[key]; ok {
+				if event.Sequence > events[i].Sequence {
+					events[i] = event
+				}
+				continue
+			}
+			seen[key] = len(events)
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
 
+func (s *EmailService) handleAIEvent(ctx context.Context, user *models.User, webhook *models.EmailWebhook) error {
+	eventsResponse, err := s.extractAIEvents(ctx, webhook)
 	if err != nil {
+		if isTemporaryError(err) {
+			if canRetry(ctx) {
+				return fmt.Errorf("failed to extract events: %w", err)
+			}
+			template := templates.GetTemporaryFailureTemplate(s.config.EmailDomain)
+			return s.sendEmailResponse(ctx, user.Email, webhook, template, true)
+		}
+
 		logger.GetLogger().Error("OpenAI processing failed", zap.Error(err))
 		template := templates.GetUnableToParseTemplate(s.config.EmailDomain)
 		return s.sendEmailResponse(ctx, user.Email, webhook, template, true)
@@ -320,15 +1029,180 @@ func (s *EmailService) handleAIEvent(ctx context.Context, user *models.User, web
 		return s.sendEmailResponse(ctx, user.Email, webhook, template, true)
 	}
 
-	// Process events
+	return s.addEvents(ctx, user, webhook, eventsResponse.Events)
+}
+
+// extractAIEvents asks the model for the events in a message
+func (s *EmailService) extractAIEvents(ctx context.Context, webhook *models.EmailWebhook) (*models.EventsResponse, error) {
+	// Extract headers
+	headers := s.parseEmailHeaders(webhook.Headers)
+
+	// Send the model a compact thread rather than the raw body with its quoted
+	// history, signatures and disclaimers
+	thread := utils.SplitThread(s.getBodyText(webhook))
+	thread[0].From = webhook.From
+	thread[0].Date = headers["Date"]
+	thread[0].To = webhook.To
+	thread[0].Cc = utils.HeaderValue(webhook.Headers, "Cc")
+	thread[0].Subject = webhook.Subject
+
+	// Process with OpenAI
+	eventsResponse, _, err := s.openaiService.ProcessEmail(
+		ctx,
+		utils.FormatThread(thread),
+		webhook.Subject,
+		webhook.From,
+		headers["Date"],
+	)
+
+	return eventsResponse, err
+}
+
+// allowGuest reports whether a sender without an account may have another
+// message answered in guest mode, taking one of their slots if so before
+// anything is sent
+func (s *EmailService) allowGuest(ctx context.Context, sender string, webhook *models.EmailWebhook) (bool, error) {
+	key := s.messageLog.MessageKey(sender, webhook)
+	return s.messageLog.ReserveOutcome(ctx, key, sender, outcomeGuestEvents, time.Now().Add(-s.config.GuestRateWindow), s.config.GuestMaxPerSender)
+}
+
+// handleGuestEvents answers a sender without an account with the events found
+// in their message as .ics files and add-to-calendar links, since there is no
+// calendar to add them to
+func (s *EmailService) handleGuestEvents(ctx context.Context, sender string, webhook *models.EmailWebhook, files []models.EmailFile) error {
+	var events []*models.GoogleCalendarEvent
+	for _, event := range s.extractGuestEvents(ctx, webhook, files) {
+		preview, err := s.calendarService.PreviewEvent(&event)
+		if err != nil {
+			logger.GetLogger().Warn("Skipping guest event",
+				zap.Error(err),
+				zap.String("summary", event.Summary))
+			continue
+		}
+
+		preview.ICalUID = uuid.New().String() + "@" + s.config.EmailDomain
+		events = append(events, preview)
+	}
+
+	if len(events) == 0 {
+		return s.sendSignupInvitation(ctx, sender, webhook)
+	}
+
+	var eventsHTML string
+	for _, event := range events {
+		eventsHTML += fmt.Sprintf("<strong>%s</strong><br>", html.EscapeString(event.Summary))
+		eventsHTML += fmt.Sprintf("Date: %s<br>", s.formatEventWhen(event))
+		if event.Location != "" {
+			eventsHTML += fmt.Sprintf("Location: %s<br>", html.EscapeString(event.Location))
+		}
+		eventsHTML += fmt.Sprintf(`Add to: <a href="%s">Google</a> | <a href="%s">Outlook</a> | <a href="%s">Outlook (work or school)</a> | <a href="%s">Yahoo</a><br><br>`,
+			html.EscapeString(utils.GoogleCalendarURL(event)),
+			html.EscapeString(utils.OutlookCalendarURL(event, false)),
+			html.EscapeString(utils.OutlookCalendarURL(event, true)),
+			html.EscapeString(utils.YahooCalendarURL(event)))
+	}
+
+	template := templates.GetGuestEventsTemplate(eventsHTML, s.config.BaseDomain, s.config.EmailDomain)
+	return s.sendEventsResponse(ctx, sender, webhook, template, true, events)
+}
+
+// extractGuestEvents finds events the same way as for users: calendar
+// attachments, then reservation markup, then the model
+func (s *EmailService) extractGuestEvents(ctx context.Context, webhook *models.EmailWebhook, files []models.EmailFile) []models.Event {
+	var events []models.Event
+	for _, event := range parseICSAttachments(calendarAttachments(files)) {
+		if !event.Cancelled {
+			events = append(events, event)
+		}
+	}
+	if len(events) > 0 {
+		return events
+	}
+
+	if events := utils.ExtractReservations(webhook.HTML); len(events) > 0 {
+		return events
+	}
+
+	eventsResponse, err := s.extractAIEvents(ctx, webhook)
+	if err != nil {
+		logger.GetLogger().Error("OpenAI processing failed", zap.Error(err))
+		return nil
+	}
+
+	return eventsResponse.Events
+}
+
+// handleReservationEvents adds events read from schema.org reservation markup
+func (s *EmailService) handleReservationEvents(ctx context.Context, user *models.User, webhook *models.EmailWebhook, events []models.Event) error {
+	logger.GetLogger().Info("Adding events from schema.org reservations",
+		zap.String("user_id", user.ID.String()),
+		zap.Int("events_count", len(events)))
+
+	return s.addEvents(ctx, user, webhook, events)
+}
+
+// addEvents creates the events in the user's calendar and sends one confirmation
+func (s *EmailService) addEvents(ctx context.Context, user *models.User, webhook *models.EmailWebhook, events []models.Event) error {
 	var successfulEvents []*models.GoogleCalendarEvent
+	var duplicateEvents []duplicateEvent
 	var failedEvents []error
 
-	for _, event := range eventsResponse.Events {
+	// Events that don't ask for reminders get the user's defaults, if they set any
+	settings, err := s.userSettings.GetSettings(ctx, user.ID)
+	if err != nil {
+		logger.GetLogger().Error("Failed to get user settings",
+			zap.Error(err),
+			zap.String("user_id", user.ID.String()))
+		settings = &models.UserSettings{UserID: user.ID}
+	}
+
+	calendarID := s.routeCalendar(ctx, user, webhook)
+	messageKey := s.messageLog.MessageKey(s.getSenderFromEmail(webhook), webhook)
+
+	for _, event := range events {
 		// Validate and filter attendees
 		event.Attendees = s.filterValidEmails(event.Attendees)
+		event.SourceKey = eventSourceKey(messageKey, &event)
+
+		if len(event.Reminders) == 0 {
+			event.Reminders = settings.DefaultReminders
+		}
+
+		// An invite the user already accepted, or a reminder for an event
+		// already in their calendar, shouldn't add it twice
+		existing, err := s.calendarService.FindDuplicate(ctx, user.ID, calendarID, &event)
+		if err != nil {
+			logger.GetLogger().Warn("Failed to check for duplicate events",
+				zap.Error(err),
+				zap.String("summary", event.Summary))
+		}
+		if existing != nil {
+			logger.GetLogger().Info("Event is already in the calendar",
+				zap.String("user_id", user.ID.String()),
+				zap.String("event_id", existing.ID),
+				zap.String("summary", event.Summary))
+
+			created, invited, err := s.calendarService.MergeDuplicate(ctx, user.ID, existing, &event)
+			if err != nil {
+				logger.GetLogger().Error("Failed to merge duplicate event",
+					zap.Error(err),
+					zap.String("event_id", existing.ID))
+			}
+			duplicateEvents = append(duplicateEvents, duplicateEvent{Existing: existing, Invited: invited})
+
+			// An invite for an event swiftcal added from another email is
+			// remembered too, so its updates and cancellations reach that event
+			if created && event.UID != "" {
+				if err := s.importedEvents.SaveImportedEvent(ctx, user.ID, event.UID, event.RecurrenceID, event.Sequence, existing.CalendarID, existing.ID); err != nil {
+					logger.GetLogger().Error("Failed to record imported event",
+						zap.Error(err),
+						zap.String("uid", event.UID))
+				}
+			}
+			continue
+		}
 
-		calEvent, err := s.calendarService.AddEvent(ctx, user.ID, &event)
+		calEvent, err := s.calendarService.AddEvent(ctx, user.ID, calendarID, &event)
 		if err != nil {
 			logger.GetLogger().Error("Failed to add event",
 				zap.Error(err),
@@ -338,41 +1212,100 @@ func (s *EmailService) handleAIEvent(ctx context.Context, user *models.User, web
 		}
 
 		successfulEvents = append(successfulEvents, calEvent)
+
+		// Remember imported invites so later updates and cancellations find them
+		if event.UID != "" {
+			if err := s.importedEvents.SaveImportedEvent(ctx, user.ID, event.UID, event.RecurrenceID, event.Sequence, calEvent.CalendarID, calEvent.ID); err != nil {
+				logger.GetLogger().Error("Failed to record imported event",
+					zap.Error(err),
+					zap.String("uid", event.UID))
+			}
+		}
 	}
 
-	if len(successfulEvents) == 0 {
+	// Event IDs come from the source key, so a retry returns the events this
+	// attempt added instead of adding them twice
+	temporary := slices.ContainsFunc(failedEvents, isTemporaryError)
+	if temporary && canRetry(ctx) {
+		return fmt.Errorf("failed to add %d of %d events: %w", len(failedEvents), len(events), errors.Join(failedEvents...))
+	}
+
+	if len(successfulEvents) == 0 && len(duplicateEvents) == 0 {
 		template := templates.GetOAuthFailedTemplate(s.config.AppDomain, s.config.EmailDomain)
+		if temporary {
+			template = templates.GetTemporaryFailureTemplate(s.config.EmailDomain)
+		}
 		return s.sendEmailResponse(ctx, user.Email, webhook, template, true)
 	}
 
 	// Send success response
-	if len(successfulEvents) == 1 {
+	if len(duplicateEvents) > 0 {
+		return s.sendMultipleEventsResponse(ctx, user.Email, webhook, successfulEvents, duplicateEvents, failedEvents)
+	} else if len(successfulEvents) == 1 {
 		event := successfulEvents[0]
 		if len(event.Attendees) > 1 {
 			// Multiple attendees - show invite link
-			inviteLink := s.buildInviteLink(user.ID, event.ID, "primary", event.Attendees)
+			inviteLink := s.buildInviteLink(user.ID, event.ID, event.CalendarID, event.Attendees)
 			template := templates.GetEventAddedAttendeesTemplate(
 				event.HTMLLink,
-				s.formatEventDate(event.StartTime, event.TimeZone),
+				s.formatEventWhen(event),
 				inviteLink,
 				s.formatAttendees(event.Attendees),
 				s.config.EmailDomain,
 			)
-			return s.sendEmailResponse(ctx, user.Email, webhook, template, true)
+			return s.sendEventsResponse(ctx, user.Email, webhook, template, true, successfulEvents)
 		} else {
 			// Single attendee
 			template := templates.GetEventAddedTemplate(
 				event.HTMLLink,
-				s.formatEventDate(event.StartTime, event.TimeZone),
+				s.formatEventWhen(event),
 				s.formatAttendees(event.Attendees),
 				s.config.EmailDomain,
 			)
-			return s.sendEmailResponse(ctx, user.Email, webhook, template, true)
+			return s.sendEventsResponse(ctx, user.Email, webhook, template, true, successfulEvents)
 		}
 	} else {
 		// Multiple events - custom response
-		return s.sendMultipleEventsResponse(ctx, user.Email, webhook, successfulEvents, failedEvents)
+		return s.sendMultipleEventsResponse(ctx, user.Email, webhook, successfulEvents, nil, failedEvents)
+	}
+}
+
+// eventSourceKey identifies an event within the message it came from. It
+// depends on the event rather than its place in the list, which changes when
+// a retry skips the events an earlier attempt already added.
+func eventSourceKey(messageKey string, event *models.Event) string {
+	if event.UID != "" {
+		return fmt.Sprintf("%s#uid:%s/%s", messageKey, event.UID, event.RecurrenceID)
+	}
+
+	endTime := ""
+	if event.EndTime != nil {
+		endTime = *event.EndTime
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		strings.ToLower(strings.TrimSpace(event.Summary)), event.Date, event.StartTime, endTime,
+	}, "\x00")))
+
+	return fmt.Sprintf("%s#event:%s", messageKey, hex.EncodeToString(sum[:]))
+}
+
+// getBodyText returns the plain text part, or text converted from the HTML part
+// when the plain part is missing or a stub, as it often is in transactional mail
+func (s *EmailService) getBodyText(webhook *models.EmailWebhook) string {
+	if strings.TrimSpace(webhook.HTML) == "" {
+		return webhook.Text
+	}
+
+	plain := strings.TrimSpace(webhook.Text)
+	htmlText := utils.HTMLToText(webhook.HTML)
+	if plain == "" || len(plain)*plainTextMinRatio < len(htmlText) {
+		logger.GetLogger().Debug("Using text converted from HTML part",
+			zap.Int("plain_length", len(plain)),
+			zap.Int("html_text_length", len(htmlText)))
+		return htmlText
 	}
+
+	return webhook.Text
 }
 
 func (s *EmailService) filterValidEmails(emails []string) []string {
@@ -420,6 +1353,47 @@ func (s *EmailService) buildInviteLink(userID uuid.UUID, eventID, calendarID str
 	return fmt.Sprintf("%s/auth/inviteAdditionalAttendees?%s", s.config.APIURL, params.Encode())
 }
 
+// formatEventWhen describes when an event happens, including how it repeats
+func (s *EmailService) formatEventWhen(event *models.GoogleCalendarEvent) string {
+	when := s.formatEventDate(event.StartTime, event.TimeZone)
+	if event.AllDay {
+		// All-day dates carry no zone and Google's end date is exclusive
+		when = event.StartTime.Format("Monday, January 2")
+		if last := event.EndTime.AddDate(0, 0, -1); last.After(event.StartTime) {
+			when += " to " + last.Format("Monday, January 2")
+		}
+		when += " (all day)"
+	}
+
+	loc, err := time.LoadLocation(event.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	// Spell out the end of timed events that finish on another day
+	if !event.AllDay && !event.EndTime.IsZero() {
+		start, end := event.StartTime.In(loc), event.EndTime.In(loc)
+		if end.YearDay() != start.YearDay() || end.Year() != start.Year() {
+			when += " until " + end.Format("Monday, January 2 at 3:04 PM")
+		}
+	}
+
+	if recurrence := utils.DescribeRecurrence(event.Recurrence, loc); recurrence != "" {
+		when += ", repeating " + recurrence
+	}
+
+	return when
+}
+
+// formatImportedEventDate describes when a cancelled event was due to happen,
+// from the cancellation itself since the calendar copy is gone
+func (s *EmailService) formatImportedEventDate(event models.Event) string {
+	if event.AllDay || event.StartTime == "" {
+		return event.Date
+	}
+	return event.Date + " at " + event.StartTime
+}
+
 func (s *EmailService) formatEventDate(eventTime time.Time, timezone string) string {
 	loc, err := time.LoadLocation(timezone)
 	if err != nil {
@@ -438,28 +1412,93 @@ func (s *EmailService) formatAttendees(attendees []models.GoogleCalendarAttendee
 	return strings.Join(emails, ", ")
 }
 
-func (s *EmailService) sendMultipleEventsResponse(ctx context.Context, to string, webhook *models.EmailWebhook, events []*models.GoogleCalendarEvent, failures []error) error {
-	html := fmt.Sprintf("%d events added to your calendar.<br><br>", len(events))
+// duplicateEvent is an event found already in the calendar instead of being
+// added again, and the guests invited to it from the email
+type duplicateEvent struct {
+	Existing *models.GoogleCalendarEvent
+	Invited  []string
+}
+
+func (s *EmailService) sendMultipleEventsResponse(ctx context.Context, to string, webhook *models.EmailWebhook, events []*models.GoogleCalendarEvent, duplicates []duplicateEvent, failures []error) error {
+	body := ""
+	if len(events) == 1 {
+		body = "1 event added to your calendar.<br><br>"
+	} else if len(events) > 1 || len(duplicates) == 0 {
+		body = fmt.Sprintf("%d events added to your calendar.<br><br>", len(events))
+	}
 
 	for _, event := range events {
-		html += fmt.Sprintf("<strong>%s</strong><br>", event.Summary)
-		html += fmt.Sprintf("Date: %s<br>", s.formatEventDate(event.StartTime, event.TimeZone))
+		body += fmt.Sprintf("<strong>%s</strong><br>", html.EscapeString(event.Summary))
+		body += fmt.Sprintf("Date: %s<br>", s.formatEventWhen(event))
 		if event.Location != "" {
-			html += fmt.Sprintf("Location: %s<br>", event.Location)
+			body += fmt.Sprintf("Location: %s<br>", html.EscapeString(event.Location))
+		}
+		if event.HTMLLink != "" {
+			body += fmt.Sprintf(`<a href="%s" style="display:inline-block; padding:10px 20px; margin:5px 0; background-color:#3498db; color:white; text-align:center; text-decoration:none; font-weight:bold; border-radius:5px;">View Event</a><br>`, html.EscapeString(event.HTMLLink))
+		}
+		body += "<br>"
+	}
+
+	if len(duplicates) > 0 {
+		body += fmt.Sprintf("%d event(s) were already on your calendar, so we didn't add them again.<br><br>", len(duplicates))
+		for _, duplicate := range duplicates {
+			event := duplicate.Existing
+			body += fmt.Sprintf("<strong>%s</strong><br>", html.EscapeString(event.Summary))
+			body += fmt.Sprintf("Date: %s<br>", s.formatEventWhen(event))
+			if len(duplicate.Invited) > 0 {
+				body += fmt.Sprintf("We invited %s to it.<br>", html.EscapeString(strings.Join(duplicate.Invited, ", ")))
+			}
+			if event.HTMLLink != "" {
+				body += fmt.Sprintf(`<a href="%s" style="display:inline-block; padding:10px 20px; margin:5px 0; background-color:#3498db; color:white; text-align:center; text-decoration:none; font-weight:bold; border-radius:5px;">View Event</a><br>`, html.EscapeString(event.HTMLLink))
+			}
+			body += "<br>"
 		}
-		html += fmt.Sprintf(`<a href="%s" style="display:inline-block; padding:10px 20px; margin:5px 0; background-color:#3498db; color:white; text-align:center; text-decoration:none; font-weight:bold; border-radius:5px;">View Event</a><br><br>`, event.HTMLLink)
 	}
 
 	if len(failures) > 0 {
-		html += fmt.Sprintf("<p>Failed to add %d event(s). Please try again or contact support.</p>", len(failures))
+		body += fmt.Sprintf("<p>Failed to add %d event(s). Please try again or contact support.</p>", len(failures))
 	}
 
-	html += fmt.Sprintf(`<br><br>You can always ask for help: <a href="mailto:hey@%s">hey@%s</a><br>`, s.config.EmailDomain, s.config.EmailDomain)
+	body += fmt.Sprintf(`<br><br>You can always ask for help: <a href="mailto:hey@%s">hey@%s</a><br>`, s.config.EmailDomain, s.config.EmailDomain)
 
-	return s.emailProvider.SendEmail(ctx, to, s.config.MainEmailAddress, fmt.Sprintf("Re: %s", webhook.Subject), "", html, s.getThreadHeaders(webhook.Headers))
+	return s.emailProvider.SendEmail(ctx, to, s.config.MainEmailAddress, fmt.Sprintf("Re: %s", webhook.Subject), "", body, s.getThreadHeaders(webhook.Headers), s.buildICSAttachments(events))
+}
+
+// sendEventChangesResponse lists the events an invite updated and cancelled
+func (s *EmailService) sendEventChangesResponse(ctx context.Context, to string, webhook *models.EmailWebhook, updated []*models.GoogleCalendarEvent, cancelled []models.Event) error {
+	body := ""
+
+	if len(updated) > 0 {
+		body += fmt.Sprintf("%d event(s) updated in your calendar.<br><br>", len(updated))
+		for _, event := range updated {
+			body += fmt.Sprintf("<strong>%s</strong><br>", html.EscapeString(event.Summary))
+			body += fmt.Sprintf("Date: %s<br>", s.formatEventWhen(event))
+			if event.HTMLLink != "" {
+				body += fmt.Sprintf(`<a href="%s" style="display:inline-block; padding:10px 20px; margin:5px 0; background-color:#3498db; color:white; text-align:center; text-decoration:none; font-weight:bold; border-radius:5px;">View Event</a><br>`, html.EscapeString(event.HTMLLink))
+			}
+			body += "<br>"
+		}
+	}
+
+	if len(cancelled) > 0 {
+		body += fmt.Sprintf("%d event(s) cancelled and removed from your calendar.<br><br>", len(cancelled))
+		for _, event := range cancelled {
+			body += fmt.Sprintf("<strong>%s</strong><br>", html.EscapeString(event.Summary))
+			body += fmt.Sprintf("Date: %s<br><br>", s.formatImportedEventDate(event))
+		}
+	}
+
+	body += fmt.Sprintf(`<br><br>You can always ask for help: <a href="mailto:hey@%s">hey@%s</a><br>`, s.config.EmailDomain, s.config.EmailDomain)
+
+	return s.emailProvider.SendEmail(ctx, to, s.config.MainEmailAddress, fmt.Sprintf("Re: %s", webhook.Subject), "", body, s.getThreadHeaders(webhook.Headers), s.buildICSAttachments(updated))
 }
 
 func (s *EmailService) sendEmailResponse(ctx context.Context, to string, webhook *models.EmailWebhook, template templates.EmailTemplate, includeThread bool) error {
+	return s.sendEventsResponse(ctx, to, webhook, template, includeThread, nil)
+}
+
+// sendEventsResponse sends a confirmation with a .ics file for each event
+func (s *EmailService) sendEventsResponse(ctx context.Context, to string, webhook *models.EmailWebhook, template templates.EmailTemplate, includeThread bool, events []*models.GoogleCalendarEvent) error {
 	html := template.HTML
 	subject := webhook.Subject
 
@@ -473,7 +1512,37 @@ func (s *EmailService) sendEmailResponse(ctx context.Context, to string, webhook
 
 	headers := s.getThreadHeaders(webhook.Headers)
 
-	return s.emailProvider.SendEmail(ctx, to, s.config.MainEmailAddress, subject, "", html, headers)
+	return s.emailProvider.SendEmail(ctx, to, s.config.MainEmailAddress, subject, "", html, headers, s.buildICSAttachments(events))
+}
+
+// buildICSAttachments generates a calendar file per event. An event that
+// can't be written is left out rather than holding up the confirmation.
+func (s *EmailService) buildICSAttachments(events []*models.GoogleCalendarEvent) []models.EmailFile {
+	var attachments []models.EmailFile
+	used := make(map[string]int)
+
+	for _, event := range events {
+		content, err := utils.GenerateICSFile(event)
+		if err != nil {
+			logger.GetLogger().Warn("Failed to generate ICS attachment",
+				zap.Error(err),
+				zap.String("event_id", event.ID))
+			continue
+		}
+
+		filename := utils.ICSFilename(event.Summary)
+		if used[filename]++; used[filename] > 1 {
+			filename = fmt.Sprintf("%s-%d.ics", strings.TrimSuffix(filename, ".ics"), used[filename])
+		}
+
+		attachments = append(attachments, models.EmailFile{
+			Filename: filename,
+			Content:  content,
+			MimeType: "text/calendar",
+		})
+	}
+
+	return attachments
 }
 
 func (s *EmailService) threadEmailHTML(original *models.EmailWebhook, responseHTML string) string {
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/models"
+	"github.com/wizenheimer/swiftcal/internal/utils"
+)
+
+func TestParseICSAttachmentsGmailInvite(t *testing.T) {
+	raw, err := os.ReadFile("testdata/gmail_invite.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := utils.ParseEmailMessage(raw)
+	if err != nil {
+		t.Fatalf("ParseEmailMessage: %v", err)
+	}
+
+	icsFiles := calendarAttachments(parsed.Attachments)
+	if len(icsFiles) != 2 {
+		t.Fatalf("found %d calendar parts, want the inline one and invite.ics", len(icsFiles))
+	}
+
+	events := parseICSAttachments(icsFiles)
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1: %+v", len(events), events)
+	}
+	if events[0].UID != "4k2v8q0m1n5p7r9t3s6u2w4y8a@google.com" || events[0].Summary != "Launch sync" {
+		t.Errorf("event = %q (%s), want Launch sync", events[0].Summary, events[0].UID)
+	}
+
+	// Guests get the same single event, not one per copy of the invite
+	guestEvents := (&EmailService{}).extractGuestEvents(context.Background(), &models.EmailWebhook{HTML: parsed.HTML}, parsed.Attachments)
+	if len(guestEvents) != 1 || guestEvents[0].UID != events[0].UID {
+		t.Errorf("guest events = %+v, want Launch sync once", guestEvents)
+	}
+}
+
+func TestParseICSAttachmentsKeepsLatestSequence(t *testing.T) {
+	invite := func(uid, recurrenceID string, sequence, summary string) models.EmailFile {
+		lines := []string{
+			"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//Test//EN", "METHOD:REQUEST",
+			"BEGIN:VEVENT", "UID:" + uid, "DTSTAMP:20261014T091523Z",
+			"DTSTART:20261020T160000Z", "DTEND:20261020T163000Z",
+			"SEQUENCE:" + sequence, "SUMMARY:" + summary,
+		}
+		if recurrenceID != "" {
+			lines = append(lines, "RECURRENCE-ID:"+recurrenceID)
+		}
+		lines = append(lines, "END:VEVENT", "END:VCALENDAR", "")
+		return models.EmailFile{Filename: "invite.ics", MimeType: "text/calendar", Content: []byte(strings.Join(lines, "\r\n"))}
+	}
+
+	events := parseICSAttachments([]models.EmailFile{
+		invite("sync@example.com", "", "2", "Sync (moved)"),
+		invite("sync@example.com", "", "1", "Sync"),
+		invite("sync@example.com", "20261027T160000Z", "0", "Sync on the 27th"),
+		invite("other@example.com", "", "0", "Other"),
+		invite("other@example.com", "", "3", "Other (renamed)"),
+	})
+
+	var summaries []string
+	for _, event := range events {
+		summaries = append(summaries, event.Summary)
+	}
+
+	want := "Sync (moved)|Sync on the 27th|Other (renamed)"
+	if got := strings.Join(summaries, "|"); got != want {
+		t.Errorf("events = %s, want %s", got, want)
+	}
+}
+
+func TestRedactCalDAVSettings(t *testing.T) {
+	webhook := &models.EmailWebhook{
+		Subject: "connect caldav",
+		Text:    "server: https://caldav.fastmail.com\nusername: sam@fastmail.com\npassword: abcd-efgh-ijkl-mnop\n",
+		HTML:    "<p><b>server:</b> https://caldav.fastmail.com<br><b>password:</b> abcd-efgh-ijkl-mnop</p>",
+		From:    "sam@fastmail.com",
+	}
+
+	settings := parseCalDAVSettings(webhook.Text)
+	redactCalDAVSettings(webhook)
+
+	if settings["password"] != "abcd-efgh-ijkl-mnop" {
+		t.Fatalf("password = %q, want it read before the body is removed", settings["password"])
+	}
+	if strings.Contains(webhook.Text+webhook.HTML, "abcd") {
+		t.Errorf("webhook still holds the password: %+v", webhook)
+	}
+	if webhook.From != "sam@fastmail.com" || webhook.Subject != "connect caldav" {
+		t.Errorf("webhook = %+v, want the sender and subject kept", webhook)
+	}
+}
+
+func TestParseSubjectActionRoutes(t *testing.T) {
+	s := &EmailService{config: &config.Config{}}
+
+	tests := []struct {
+		subject string
+		want    string
+	}{
+		{subject: "route family to Family", want: "addRoute"},
+		{subject: "Route from united.com to Travel", want: "addRoute"},
+		{subject: `route keyword "soccer practice" to Kids`, want: "addRoute"},
+		{subject: "unroute keyword soccer", want: "removeRoute"},
+		{subject: "unroute family", want: "removeRoute"},
+		{subject: "calendar routes", want: "listRoutes"},
+		// Subjects that only start like a command are emails about events
+		{subject: "Route 66 road trip, Saturday 9am", want: "addEvent"},
+		{subject: "route review", want: "addEvent"},
+		{subject: "Unroute the delivery van on Friday to the depot", want: "addEvent"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subject, func(t *testing.T) {
+			if got := s.parseSubjectAction(tt.subject); got != tt.want {
+				t.Errorf("parseSubjectAction(%q) = %q, want %q", tt.subject, got, tt.want)
+			}
+		})
+	}
+}
+
+// recordingEmailProvider keeps the HTML of every message sent through it
+type recordingEmailProvider struct {
+	sent []string
+}
+
+func (p *recordingEmailProvider) SendEmail(ctx context.Context, to, from, subject, textContent, htmlContent string, headers map[string]string, attachments []models.EmailFile) error {
+	p.sent = append(p.sent, htmlContent)
+	return nil
+}
+
+func TestSendMultipleEventsResponseEscapesEvents(t *testing.T) {
+	provider := &recordingEmailProvider{}
+	s := &EmailService{config: &config.Config{EmailDomain: "swiftcal.example.com"}, emailProvider: provider}
+
+	start := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+	event := func(summary string) *models.GoogleCalendarEvent {
+		return &models.GoogleCalendarEvent{
+			ID:        "event-1",
+			Summary:   summary,
+			Location:  `Room <4> & "annex"`,
+			StartTime: start,
+			EndTime:   start.Add(time.Hour),
+			TimeZone:  "UTC",
+			HTMLLink:  `https://calendar.example.com/event?id=1&x="><script>`,
+		}
+	}
+	duplicates := []duplicateEvent{{
+		Existing: event("<b>Standup</b>"),
+		Invited:  []string{"<sam@example.org>"},
+	}}
+
+	err := s.sendMultipleEventsResponse(context.Background(), "priya@example.com", &models.EmailWebhook{Subject: "Plans"},
+		[]*models.GoogleCalendarEvent{event(`<img src=x onerror=alert(1)>`), event("Lunch")}, duplicates, nil)
+	if err != nil {
+		t.Fatalf("sendMultipleEventsResponse: %v", err)
+	}
+	if len(provider.sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(provider.sent))
+	}
+
+	body := provider.sent[0]
+	for _, raw := range []string{"<img", "<b>Standup", "<4>", `"annex"`, `"><script>`, "<sam@"} {
+		if strings.Contains(body, raw) {
+			t.Errorf("reply contains %q unescaped:\n%s", raw, body)
+		}
+	}
+	for _, escaped := range []string{"&lt;img src=x onerror=alert(1)&gt;", "&lt;b&gt;Standup&lt;/b&gt;", "Room &lt;4&gt; &amp; &#34;annex&#34;", "&lt;sam@example.org&gt;"} {
+		if !strings.Contains(body, escaped) {
+			t.Errorf("reply is missing %q:\n%s", escaped, body)
+		}
+	}
+}
+
+func TestSendEventChangesResponseEscapesEvents(t *testing.T) {
+	provider := &recordingEmailProvider{}
+	s := &EmailService{config: &config.Config{EmailDomain: "swiftcal.example.com"}, emailProvider: provider}
+
+	start := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+	updated := []*models.GoogleCalendarEvent{{
+		ID:        "event-1",
+		Summary:   `<img src=x onerror=alert(1)>`,
+		StartTime: start,
+		EndTime:   start.Add(time.Hour),
+		TimeZone:  "UTC",
+	}}
+	cancelled := []models.Event{{Summary: "<b>Standup</b>", Date: "21 October 2026", StartTime: "10:00"}}
+
+	if err := s.sendEventChangesResponse(context.Background(), "priya@example.com", &models.EmailWebhook{Subject: "Updated invitation"}, updated, cancelled); err != nil {
+		t.Fatalf("sendEventChangesResponse: %v", err)
+	}
+	if len(provider.sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(provider.sent))
+	}
+
+	body := provider.sent[0]
+	if strings.Contains(body, "<img") || strings.Contains(body, "<b>") {
+		t.Errorf("reply contains an unescaped summary:\n%s", body)
+	}
+	if !strings.Contains(body, "&lt;img src=x onerror=alert(1)&gt;") || !strings.Contains(body, "&lt;b&gt;Standup&lt;/b&gt;") {
+		t.Errorf("reply is missing the escaped summaries:\n%s", body)
+	}
+}
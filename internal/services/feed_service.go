@@ -0,0 +1,136 @@
+// internal/services/feed_service.go
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/database"
+	"github.com/wizenheimer/swiftcal/internal/utils"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// feedTokenBytes gives feed tokens 256 bits, since the token alone grants access
+const feedTokenBytes = 32
+
+// ErrFeedNotFound means no feed uses the token, or it was revoked
+var ErrFeedNotFound = errors.New("calendar feed not found")
+
+// FeedService manages the secret URLs users subscribe to for an iCalendar
+// feed of the events swiftcal created for them
+type FeedService struct {
+	db            *database.DB
+	config        *config.Config
+	createdEvents *CreatedEventService
+}
+
+func NewFeedService(db *database.DB, cfg *config.Config, createdEvents *CreatedEventService) *FeedService {
+	return &FeedService{
+		db:            db,
+		config:        cfg,
+		createdEvents: createdEvents,
+	}
+}
+
+// GetOrCreateToken returns the user's feed token, creating one if they have none
+func (s *FeedService) GetOrCreateToken(ctx context.Context, userID uuid.UUID) (string, error) {
+	token, err := newFeedToken()
+	if err != nil {
+		return "", err
+	}
+
+	// The no-op update makes RETURNING yield the existing token on conflict
+	query := `
+		INSERT INTO calendar_feeds (user_id, token)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+		RETURNING token
+	`
+
+	if err := s.db.Pool.QueryRow(ctx, query, userID, token).Scan(&token); err != nil {
+		return "", fmt.Errorf("failed to get feed token: %w", err)
+	}
+
+	return token, nil
+}
+
+// RegenerateToken replaces the user's feed token, so the old URL stops working
+func (s *FeedService) RegenerateToken(ctx context.Context, userID uuid.UUID) (string, error) {
+	token, err := newFeedToken()
+	if err != nil {
+		return "", err
+	}
+
+	query := `
+		INSERT INTO calendar_feeds (user_id, token)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET token = EXCLUDED.token, created_at = NOW()
+	`
+
+	if _, err := s.db.Pool.Exec(ctx, query, userID, token); err != nil {
+		return "", fmt.Errorf("failed to regenerate feed token: %w", err)
+	}
+
+	return token, nil
+}
+
+// RevokeToken turns the user's feed off
+func (s *FeedService) RevokeToken(ctx context.Context, userID uuid.UUID) error {
+	if _, err := s.db.Pool.Exec(ctx, `DELETE FROM calendar_feeds WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to revoke feed token: %w", err)
+	}
+
+	return nil
+}
+
+// FeedURL returns the subscription URL for a token
+func (s *FeedService) FeedURL(token string) string {
+	return strings.TrimRight(s.config.APIURL, "/") + "/feeds/" + token + ".ics"
+}
+
+// WebcalURL returns the feed URL with the webcal scheme, which calendar apps
+// open as a subscription
+func (s *FeedService) WebcalURL(token string) string {
+	feedURL := s.FeedURL(token)
+	if rest, ok := strings.CutPrefix(feedURL, "https://"); ok {
+		return "webcal://" + rest
+	}
+	if rest, ok := strings.CutPrefix(feedURL, "http://"); ok {
+		return "webcal://" + rest
+	}
+	return feedURL
+}
+
+// RenderFeed builds the calendar served at a token's URL
+func (s *FeedService) RenderFeed(ctx context.Context, token string) ([]byte, error) {
+	var userID uuid.UUID
+	err := s.db.Pool.QueryRow(ctx, `SELECT user_id FROM calendar_feeds WHERE token = $1`, token).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrFeedNotFound
+		}
+		return nil, fmt.Errorf("failed to look up feed: %w", err)
+	}
+
+	events, err := s.createdEvents.ListEvents(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return utils.GenerateICSFeed("swiftcal", events)
+}
+
+func newFeedToken() (string, error) {
+	buf := make([]byte, feedTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate feed token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,562 @@
+// internal/services/google_calendar_provider.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/models"
+	"github.com/wizenheimer/swiftcal/internal/utils"
+	"github.com/wizenheimer/swiftcal/pkg/logger"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// GoogleCalendarProvider adds events to Google Calendar
+type GoogleCalendarProvider struct {
+	config      *config.Config
+	authService OAuthClientSource
+}
+
+func NewGoogleCalendarProvider(cfg *config.Config, authService OAuthClientSource) *GoogleCalendarProvider {
+	return &GoogleCalendarProvider{
+		config:      cfg,
+		authService: authService,
+	}
+}
+
+func (s *GoogleCalendarProvider) AddEvent(ctx context.Context, userID uuid.UUID, calendarID string, event *models.Event) (*models.GoogleCalendarEvent, error) {
+	// Get OAuth client for the user
+	client, err := s.authService.GetOAuthClient(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OAuth client: %w", err)
+	}
+
+	// Create calendar service
+	calendarService, err := calendar.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create calendar service: %w", err)
+	}
+
+	// Find the calendar, whose zone applies to times given without one
+	calendarList, err := calendarService.CalendarList.List().Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get calendar list: %w", err)
+	}
+
+	var targetCalendar *calendar.CalendarListEntry
+	for _, cal := range calendarList.Items {
+		if (calendarID == "" && cal.Primary) || (calendarID != "" && cal.Id == calendarID) {
+			targetCalendar = cal
+			break
+		}
+	}
+
+	if targetCalendar == nil {
+		if calendarID != "" {
+			return nil, fmt.Errorf("calendar %s: %w", calendarID, ErrCalendarNotWritable)
+		}
+		return nil, fmt.Errorf("primary calendar not found")
+	}
+	if !isWritableAccessRole(targetCalendar.AccessRole) {
+		return nil, fmt.Errorf("calendar %s: %w", targetCalendar.Summary, ErrCalendarNotWritable)
+	}
+
+	// Convert event to Google Calendar format
+	googleEvent, err := s.convertToGoogleEvent(event, targetCalendar.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert event: %w", err)
+	}
+
+	s.addDescriptionFooter(googleEvent)
+
+	// Events read from a message get an ID of their own, so inserting one
+	// again when the message is retried finds the first copy
+	if event.SourceKey != "" {
+		googleEvent.Id = sourceEventID(event.SourceKey)
+	}
+
+	// Create the event
+	createdEvent, err := s.insertEvent(calendarService, targetCalendar.Id, googleEvent)
+	if err != nil && googleEvent.Id != "" && isConflictError(err) {
+		existing, getErr := s.GetEvent(ctx, userID, targetCalendar.Id, googleEvent.Id)
+		if getErr == nil {
+			logger.GetLogger().Info("Calendar event was already created",
+				zap.String("user_id", userID.String()),
+				zap.String("event_id", existing.ID))
+			return existing, nil
+		}
+		if !errors.Is(getErr, ErrEventNotFound) {
+			return nil, fmt.Errorf("failed to get existing calendar event: %w", getErr)
+		}
+
+		// The user deleted the first copy, and Google keeps its ID
+		logger.GetLogger().Warn("Calendar event with this ID was deleted, creating a new one",
+			zap.String("event_id", googleEvent.Id))
+		googleEvent.Id = ""
+		createdEvent, err = s.insertEvent(calendarService, targetCalendar.Id, googleEvent)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create calendar event: %w", err)
+	}
+
+	result := s.toCalendarEvent(createdEvent, targetCalendar.Id)
+
+	logger.GetLogger().Info("Calendar event created",
+		zap.String("user_id", userID.String()),
+		zap.String("event_id", result.ID),
+		zap.String("summary", result.Summary))
+
+	return result, nil
+}
+
+// ListEvents returns the events overlapping the given times, with recurring
+// events expanded into their occurrences
+func (s *GoogleCalendarProvider) ListEvents(ctx context.Context, userID uuid.UUID, calendarID string, from, to time.Time) ([]models.GoogleCalendarEvent, error) {
+	// Get OAuth client for the user
+	client, err := s.authService.GetOAuthClient(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OAuth client: %w", err)
+	}
+
+	// Create calendar service
+	calendarService, err := calendar.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create calendar service: %w", err)
+	}
+
+	if calendarID == "" {
+		calendarID = "primary"
+	}
+
+	var events []models.GoogleCalendarEvent
+	err = calendarService.Events.List(calendarID).
+		TimeMin(from.Format(time.RFC3339)).
+		TimeMax(to.Format(time.RFC3339)).
+		SingleEvents(true).
+		MaxResults(250).
+		Pages(ctx, func(page *calendar.Events) error {
+			for _, item := range page.Items {
+				if item.Status == "cancelled" {
+					continue
+				}
+
+				event := s.toCalendarEvent(item, calendarID)
+				// Times without a zone of their own are in the calendar's
+				if !event.AllDay && event.TimeZone == "" {
+					event.TimeZone = page.TimeZone
+				}
+				events = append(events, *event)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	return events, nil
+}
+
+// GetEvent returns an event, or ErrEventNotFound when it has been deleted
+func (s *GoogleCalendarProvider) GetEvent(ctx context.Context, userID uuid.UUID, calendarID, eventID string) (*models.GoogleCalendarEvent, error) {
+	// Get OAuth client for the user
+	client, err := s.authService.GetOAuthClient(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OAuth client: %w", err)
+	}
+
+	// Create calendar service
+	calendarService, err := calendar.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create calendar service: %w", err)
+	}
+
+	event, err := calendarService.Events.Get(calendarID, eventID).Do()
+	if err != nil {
+		if isGoneError(err) {
+			return nil, ErrEventNotFound
+		}
+		return nil, fmt.Errorf("failed to get event: %w", err)
+	}
+	if event.Status == "cancelled" {
+		return nil, ErrEventNotFound
+	}
+
+	return s.toCalendarEvent(event, calendarID), nil
+}
+
+// UpdateEvent rewrites an event swiftcal created earlier with new details,
+// keeping guests that were invited to it since. It returns ErrEventNotFound
+// when the event has been deleted from the calendar.
+func (s *GoogleCalendarProvider) UpdateEvent(ctx context.Context, userID uuid.UUID, calendarID, eventID string, event *models.Event) (*models.GoogleCalendarEvent, error) {
+	// Get OAuth client for the user
+	client, err := s.authService.GetOAuthClient(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OAuth client: %w", err)
+	}
+
+	// Create calendar service
+	calendarService, err := calendar.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create calendar service: %w", err)
+	}
+
+	existing, err := calendarService.Events.Get(calendarID, eventID).Do()
+	if err != nil {
+		if isGoneError(err) {
+			return nil, ErrEventNotFound
+		}
+		return nil, fmt.Errorf("failed to get event: %w", err)
+	}
+	if existing.Status == "cancelled" {
+		return nil, ErrEventNotFound
+	}
+
+	calendarEntry, err := calendarService.CalendarList.Get(calendarID).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get calendar: %w", err)
+	}
+
+	googleEvent, err := s.convertToGoogleEvent(event, calendarEntry.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert event: %w", err)
+	}
+	s.addDescriptionFooter(googleEvent)
+
+	// Keep guests added to the event after it was imported
+	seen := make(map[string]bool)
+	for _, attendee := range googleEvent.Attendees {
+		seen[strings.ToLower(attendee.Email)] = true
+	}
+	for _, attendee := range existing.Attendees {
+		if !seen[strings.ToLower(attendee.Email)] {
+			googleEvent.Attendees = append(googleEvent.Attendees, attendee)
+		}
+	}
+
+	// A patch merges into the stored times, so clear the form not being used
+	for _, when := range []*calendar.EventDateTime{googleEvent.Start, googleEvent.End} {
+		if when.Date != "" {
+			when.NullFields = append(when.NullFields, "DateTime", "TimeZone")
+		} else {
+			when.NullFields = append(when.NullFields, "Date")
+		}
+	}
+
+	// Clear recurrence explicitly when a series became a single event
+	if len(googleEvent.Recurrence) == 0 && len(existing.Recurrence) > 0 {
+		googleEvent.NullFields = append(googleEvent.NullFields, "Recurrence")
+	}
+
+	updatedEvent, err := calendarService.Events.Patch(calendarID, eventID, googleEvent).
+		ConferenceDataVersion(1).
+		SendUpdates("all").
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to update calendar event: %w", err)
+	}
+
+	result := s.toCalendarEvent(updatedEvent, calendarID)
+
+	logger.GetLogger().Info("Calendar event updated",
+		zap.String("user_id", userID.String()),
+		zap.String("event_id", result.ID),
+		zap.String("summary", result.Summary))
+
+	return result, nil
+}
+
+// DeleteEvent removes an event swiftcal created earlier. An event the user
+// already deleted counts as removed.
+func (s *GoogleCalendarProvider) DeleteEvent(ctx context.Context, userID uuid.UUID, calendarID, eventID string) error {
+	// Get OAuth client for the user
+	client, err := s.authService.GetOAuthClient(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get OAuth client: %w", err)
+	}
+
+	// Create calendar service
+	calendarService, err := calendar.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return fmt.Errorf("failed to create calendar service: %w", err)
+	}
+
+	if err := calendarService.Events.Delete(calendarID, eventID).SendUpdates("all").Do(); err != nil && !isGoneError(err) {
+		return fmt.Errorf("failed to delete calendar event: %w", err)
+	}
+
+	logger.GetLogger().Info("Calendar event deleted",
+		zap.String("user_id", userID.String()),
+		zap.String("event_id", eventID))
+
+	return nil
+}
+
+func (s *GoogleCalendarProvider) addDescriptionFooter(googleEvent *calendar.Event) {
+	googleEvent.Description = withDescriptionFooter(s.config, googleEvent.Description)
+}
+
+// toCalendarEvent converts an event returned by the Google API back to our model
+func (s *GoogleCalendarProvider) toCalendarEvent(createdEvent *calendar.Event, calendarID string) *models.GoogleCalendarEvent {
+	result := &models.GoogleCalendarEvent{
+		ID:          createdEvent.Id,
+		CalendarID:  calendarID,
+		ICalUID:     createdEvent.ICalUID,
+		Summary:     createdEvent.Summary,
+		Description: createdEvent.Description,
+		Location:    createdEvent.Location,
+		HTMLLink:    createdEvent.HtmlLink,
+		Recurrence:  createdEvent.Recurrence,
+	}
+
+	if createdEvent.Start != nil {
+		if createdEvent.Start.DateTime != "" {
+			if startTime, err := time.Parse(time.RFC3339, createdEvent.Start.DateTime); err == nil {
+				result.StartTime = startTime
+				result.TimeZone = createdEvent.Start.TimeZone
+			}
+		} else if createdEvent.Start.Date != "" {
+			if startDate, err := time.Parse("2006-01-02", createdEvent.Start.Date); err == nil {
+				result.StartTime = startDate
+				result.TimeZone = "UTC"
+				result.AllDay = true
+			}
+		}
+	}
+
+	if createdEvent.End != nil {
+		if createdEvent.End.DateTime != "" {
+			if endTime, err := time.Parse(time.RFC3339, createdEvent.End.DateTime); err == nil {
+				result.EndTime = endTime
+			}
+		} else if createdEvent.End.Date != "" {
+			if endDate, err := time.Parse("2006-01-02", createdEvent.End.Date); err == nil {
+				result.EndTime = endDate
+			}
+		}
+	}
+
+	if createdEvent.Reminders != nil {
+		for _, reminder := range createdEvent.Reminders.Overrides {
+			result.Reminders = append(result.Reminders, models.Reminder{Method: reminder.Method, Minutes: int(reminder.Minutes)})
+		}
+	}
+
+	// Convert attendees
+	for _, attendee := range createdEvent.Attendees {
+		result.Attendees = append(result.Attendees, models.GoogleCalendarAttendee{
+			Email:       attendee.Email,
+			DisplayName: attendee.DisplayName,
+			Organizer:   attendee.Organizer,
+		})
+	}
+
+	return result
+}
+
+func (s *GoogleCalendarProvider) convertToGoogleEvent(event *models.Event, defaultTimezone string) (*calendar.Event, error) {
+	times, err := resolveEventTimes(event, defaultTimezone)
+	if err != nil {
+		return nil, err
+	}
+
+	googleEvent := &calendar.Event{
+		Summary:                 event.Summary,
+		Status:                  "confirmed",
+		GuestsCanInviteOthers:   &[]bool{true}[0],
+		GuestsCanModify:         true,
+		GuestsCanSeeOtherGuests: &[]bool{true}[0],
+	}
+
+	if times.AllDay {
+		googleEvent.Start = &calendar.EventDateTime{Date: times.Start.Format("2006-01-02")}
+		googleEvent.End = &calendar.EventDateTime{Date: times.End.Format("2006-01-02")}
+	} else {
+		googleEvent.Start = &calendar.EventDateTime{
+			DateTime: times.Start.Format(time.RFC3339),
+			TimeZone: times.TimeZone,
+		}
+		googleEvent.End = &calendar.EventDateTime{
+			DateTime: times.End.Format(time.RFC3339),
+			TimeZone: times.TimeZone,
+		}
+	}
+
+	if event.Description != nil {
+		googleEvent.Description = *event.Description
+	}
+
+	if event.Location != nil {
+		googleEvent.Location = *event.Location
+	}
+
+	if len(event.Recurrence) > 0 {
+		googleEvent.Recurrence = event.Recurrence
+	}
+
+	// Deadlines show as free so they don't block meetings being scheduled
+	if event.Deadline {
+		googleEvent.Transparency = "transparent"
+	}
+
+	// Requested reminders replace the calendar's defaults; without any the
+	// calendar's own apply
+	if reminders := utils.NormalizeReminders(event.Reminders); len(reminders) > 0 {
+		googleEvent.Reminders = &calendar.EventReminders{
+			UseDefault:      false,
+			ForceSendFields: []string{"UseDefault"},
+		}
+		for _, reminder := range reminders {
+			googleEvent.Reminders.Overrides = append(googleEvent.Reminders.Overrides, &calendar.EventReminder{
+				Method:          reminder.Method,
+				Minutes:         int64(reminder.Minutes),
+				ForceSendFields: []string{"Minutes"},
+			})
+		}
+	}
+
+	// Add attendees (filter out invalid emails)
+	var validAttendees []*calendar.EventAttendee
+	for _, email := range event.Attendees {
+		if isValidEmail(email) {
+			validAttendees = append(validAttendees, &calendar.EventAttendee{
+				Email: email,
+			})
+		} else {
+			logger.GetLogger().Warn("Skipping invalid email address",
+				zap.String("email", email))
+		}
+	}
+	googleEvent.Attendees = validAttendees
+
+	return googleEvent, nil
+}
+
+// insertEvent creates an event and emails its guests
+func (s *GoogleCalendarProvider) insertEvent(calendarService *calendar.Service, calendarID string, googleEvent *calendar.Event) (*calendar.Event, error) {
+	return calendarService.Events.Insert(calendarID, googleEvent).
+		ConferenceDataVersion(1).
+		SendNotifications(true).
+		SendUpdates("all").
+		Do()
+}
+
+// isConflictError means an event with the requested ID already exists
+func isConflictError(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict
+}
+
+// isGoneError reports whether the API says an event no longer exists
+func isGoneError(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && (apiErr.Code == http.StatusNotFound || apiErr.Code == http.StatusGone)
+}
+
+func (s *GoogleCalendarProvider) InviteAttendees(ctx context.Context, userID uuid.UUID, eventID, calendarID string, attendees []string) error {
+	// Get OAuth client for the user
+	client, err := s.authService.GetOAuthClient(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get OAuth client: %w", err)
+	}
+
+	// Create calendar service
+	calendarService, err := calendar.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return fmt.Errorf("failed to create calendar service: %w", err)
+	}
+
+	// Get the existing event
+	event, err := calendarService.Events.Get(calendarID, eventID).Do()
+	if err != nil {
+		return fmt.Errorf("failed to get event: %w", err)
+	}
+
+	// Add new attendees
+	for _, email := range attendees {
+		if isValidEmail(email) {
+			event.Attendees = append(event.Attendees, &calendar.EventAttendee{
+				Email: email,
+			})
+		}
+	}
+
+	// Update the event
+	_, err = calendarService.Events.Update(calendarID, eventID, event).
+		SendNotifications(true).
+		SendUpdates("all").
+		ConferenceDataVersion(1).
+		Do()
+
+	if err != nil {
+		return fmt.Errorf("failed to update event: %w", err)
+	}
+
+	logger.GetLogger().Info("Additional attendees invited",
+		zap.String("user_id", userID.String()),
+		zap.String("event_id", eventID),
+		zap.Strings("attendees", attendees))
+
+	return nil
+}
+
+func (s *GoogleCalendarProvider) GetUserCalendars(ctx context.Context, userID uuid.UUID) ([]*calendar.CalendarListEntry, error) {
+	// Get OAuth client for the user
+	client, err := s.authService.GetOAuthClient(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OAuth client: %w", err)
+	}
+
+	// Create calendar service
+	calendarService, err := calendar.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create calendar service: %w", err)
+	}
+
+	// Get calendar list
+	calendarList, err := calendarService.CalendarList.List().Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get calendar list: %w", err)
+	}
+
+	return calendarList.Items, nil
+}
+
+// ListCalendars returns the calendars in the user's calendar list
+func (s *GoogleCalendarProvider) ListCalendars(ctx context.Context, userID uuid.UUID) ([]models.Calendar, error) {
+	entries, err := s.GetUserCalendars(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var calendars []models.Calendar
+	for _, entry := range entries {
+		name := entry.SummaryOverride
+		if name == "" {
+			name = entry.Summary
+		}
+		calendars = append(calendars, models.Calendar{
+			ID:       entry.Id,
+			Name:     name,
+			Primary:  entry.Primary,
+			Writable: isWritableAccessRole(entry.AccessRole),
+		})
+	}
+
+	return calendars, nil
+}
+
+// isWritableAccessRole reports whether a calendar list access role lets the
+// user add events; freeBusyReader and reader calendars are read-only
+func isWritableAccessRole(role string) bool {
+	return role == "owner" || role == "writer"
+}
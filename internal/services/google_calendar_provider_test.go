@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/models"
+
+	"github.com/google/uuid"
+	"google.golang.org/api/calendar/v3"
+)
+
+// fakeGoogleCalendar serves the parts of the Calendar API AddEvent uses,
+// holding events in memory and refusing IDs it has already seen
+type fakeGoogleCalendar struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	events   map[string]*calendar.Event
+	inserts  int
+	failOnce map[string]bool
+}
+
+func newFakeGoogleCalendar(t *testing.T) *fakeGoogleCalendar {
+	fake := &fakeGoogleCalendar{
+		events:   make(map[string]*calendar.Event),
+		failOnce: make(map[string]bool),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /calendar/v3/users/me/calendarList", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(calendar.CalendarList{Items: []*calendar.CalendarListEntry{
+			{Id: "me@example.com", Summary: "Me", Primary: true, AccessRole: "owner", TimeZone: "Europe/London"},
+		}})
+	})
+	mux.HandleFunc("POST /calendar/v3/calendars/{calendar}/events", func(w http.ResponseWriter, r *http.Request) {
+		var event calendar.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+
+		if fake.failOnce[event.Summary] {
+			delete(fake.failOnce, event.Summary)
+			writeGoogleError(w, http.StatusServiceUnavailable, "backendError")
+			return
+		}
+		if event.Id == "" {
+			event.Id = strings.ReplaceAll(uuid.NewString(), "-", "")
+		}
+		if _, exists := fake.events[event.Id]; exists {
+			writeGoogleError(w, http.StatusConflict, "duplicate")
+			return
+		}
+
+		event.HtmlLink = "https://calendar.google.com/event?eid=" + event.Id
+		fake.events[event.Id] = &event
+		fake.inserts++
+		json.NewEncoder(w).Encode(&event)
+	})
+	mux.HandleFunc("GET /calendar/v3/calendars/{calendar}/events/{event}", func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+
+		event, ok := fake.events[r.PathValue("event")]
+		if !ok {
+			writeGoogleError(w, http.StatusNotFound, "notFound")
+			return
+		}
+		json.NewEncoder(w).Encode(event)
+	})
+
+	fake.server = httptest.NewServer(mux)
+	t.Cleanup(fake.server.Close)
+
+	return fake
+}
+
+func writeGoogleError(w http.ResponseWriter, status int, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{"code": status, "message": reason, "errors": []map[string]string{{"reason": reason}}},
+	})
+}
+
+// GetOAuthClient returns a client that sends Google API requests to the fake
+func (f *fakeGoogleCalendar) GetOAuthClient(ctx context.Context, userID uuid.UUID) (*http.Client, error) {
+	target, _ := url.Parse(f.server.URL)
+	return &http.Client{Transport: rewriteTransport{target: target}}, nil
+}
+
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = t.target.Scheme, t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestGoogleAddEventRetryAfterPartialSuccess(t *testing.T) {
+	fake := newFakeGoogleCalendar(t)
+	provider := NewGoogleCalendarProvider(&config.Config{MainEmailAddress: "swiftcal@swiftcal.test"}, fake)
+	ctx := context.Background()
+	userID := uuid.New()
+	messageKey := "mid:invite@example.com"
+
+	standup := models.Event{Summary: "Standup", Date: "20 October 2026", StartTime: "09:00"}
+	retro := models.Event{Summary: "Retro", Date: "20 October 2026", StartTime: "16:00"}
+	fake.failOnce["Retro"] = true
+
+	add := func(event models.Event) (*models.GoogleCalendarEvent, error) {
+		event.SourceKey = eventSourceKey(messageKey, &event)
+		return provider.AddEvent(ctx, userID, "", &event)
+	}
+
+	// The first attempt adds the standup but not the retro
+	first, err := add(standup)
+	if err != nil {
+		t.Fatalf("adding standup: %v", err)
+	}
+	if _, err := add(retro); err == nil {
+		t.Fatal("expected the retro to fail on the first attempt")
+	}
+
+	// The retry only has the retro left, now first in the list
+	added, err := add(retro)
+	if err != nil {
+		t.Fatalf("retrying retro: %v", err)
+	}
+	if added.Summary != "Retro" || added.ID == first.ID {
+		t.Fatalf("retry returned %q (%s), want a new Retro event", added.Summary, added.ID)
+	}
+
+	// Retrying the whole message again finds both events rather than adding them
+	for _, event := range []models.Event{retro, standup} {
+		again, err := add(event)
+		if err != nil {
+			t.Fatalf("retrying %s: %v", event.Summary, err)
+		}
+		if again.Summary != event.Summary {
+			t.Errorf("retrying %s returned %q", event.Summary, again.Summary)
+		}
+	}
+
+	if fake.inserts != 2 || len(fake.events) != 2 {
+		t.Errorf("calendar has %d events from %d inserts, want 2", len(fake.events), fake.inserts)
+	}
+}
+
+func TestEventSourceKey(t *testing.T) {
+	ten := "10:00"
+	tests := []struct {
+		name string
+		a, b models.Event
+		same bool
+	}{
+		{
+			name: "same invite",
+			a:    models.Event{UID: "abc@google.com", Summary: "Sync"},
+			b:    models.Event{UID: "abc@google.com", Summary: "Sync (updated)"},
+			same: true,
+		},
+		{
+			name: "different occurrences of a series",
+			a:    models.Event{UID: "abc@google.com", RecurrenceID: "20261020T090000Z"},
+			b:    models.Event{UID: "abc@google.com", RecurrenceID: "20261027T090000Z"},
+		},
+		{
+			name: "same extracted event",
+			a:    models.Event{Summary: "Dentist", Date: "20 October 2026", StartTime: "09:00", EndTime: &ten},
+			b:    models.Event{Summary: " dentist", Date: "20 October 2026", StartTime: "09:00", EndTime: &ten},
+			same: true,
+		},
+		{
+			name: "different start",
+			a:    models.Event{Summary: "Dentist", Date: "20 October 2026", StartTime: "09:00"},
+			b:    models.Event{Summary: "Dentist", Date: "20 October 2026", StartTime: "11:00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := eventSourceKey("mid:x", &tt.a), eventSourceKey("mid:x", &tt.b)
+			if (a == b) != tt.same {
+				t.Errorf("keys %q and %q: same = %v, want %v", a, b, a == b, tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// internal/services/imported_event_service.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/database"
+	"github.com/wizenheimer/swiftcal/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ImportedEventService remembers which Google event each imported iCalendar
+// event became, so a re-sent invite updates or cancels it instead of adding
+// another copy.
+type ImportedEventService struct {
+	db     *database.DB
+	config *config.Config
+}
+
+func NewImportedEventService(db *database.DB, cfg *config.Config) *ImportedEventService {
+	return &ImportedEventService{
+		db:     db,
+		config: cfg,
+	}
+}
+
+// GetImportedEvent returns the tracked event, or nil when the UID and
+// RECURRENCE-ID haven't been imported for the user
+func (s *ImportedEventService) GetImportedEvent(ctx context.Context, userID uuid.UUID, uid, recurrenceID string) (*models.ImportedEvent, error) {
+	query := `
+		SELECT id, user_id, ical_uid, recurrence_id, sequence, calendar_id, event_id, created_at, updated_at
+		FROM imported_events
+		WHERE user_id = $1 AND ical_uid = $2 AND recurrence_id = $3
+	`
+
+	imported := &models.ImportedEvent{}
+	err := s.db.Pool.QueryRow(ctx, query, userID, uid, recurrenceID).Scan(
+		&imported.ID, &imported.UserID, &imported.ICalUID, &imported.RecurrenceID, &imported.Sequence,
+		&imported.CalendarID, &imported.EventID, &imported.CreatedAt, &imported.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get imported event: %w", err)
+	}
+
+	return imported, nil
+}
+
+// SaveImportedEvent records the Google event for a UID, replacing any earlier one
+func (s *ImportedEventService) SaveImportedEvent(ctx context.Context, userID uuid.UUID, uid, recurrenceID string, sequence int, calendarID, eventID string) error {
+	query := `
+		INSERT INTO imported_events (user_id, ical_uid, recurrence_id, sequence, calendar_id, event_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, ical_uid, recurrence_id) DO UPDATE
+		SET sequence = EXCLUDED.sequence,
+		    calendar_id = EXCLUDED.calendar_id,
+		    event_id = EXCLUDED.event_id,
+		    updated_at = NOW()
+	`
+
+	if _, err := s.db.Pool.Exec(ctx, query, userID, uid, recurrenceID, sequence, calendarID, eventID); err != nil {
+		return fmt.Errorf("failed to save imported event: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteImportedEvent forgets a tracked event once it has been cancelled
+func (s *ImportedEventService) DeleteImportedEvent(ctx context.Context, id uuid.UUID) error {
+	if _, err := s.db.Pool.Exec(ctx, `DELETE FROM imported_events WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete imported event: %w", err)
+	}
+
+	return nil
+}
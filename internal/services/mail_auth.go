@@ -0,0 +1,335 @@
+// internal/services/mail_auth.go
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/models"
+	"github.com/wizenheimer/swiftcal/internal/utils"
+	"github.com/wizenheimer/swiftcal/pkg/logger"
+
+	"blitiri.com.ar/go/spf"
+	"github.com/emersion/go-msgauth/authres"
+	"github.com/emersion/go-msgauth/dkim"
+	"go.uber.org/zap"
+	"golang.org/x/net/publicsuffix"
+)
+
+// dkimResultPattern matches the "{@domain : result}" entries in a DKIM summary
+var dkimResultPattern = regexp.MustCompile(`\{@([^\s:}]+)\s*:\s*([a-zA-Z]+)\}`)
+
+// arcInstancePattern matches the "i=N;" prefix of an ARC-Authentication-Results value
+var arcInstancePattern = regexp.MustCompile(`^\s*i\s*=\s*(\d+)\s*;`)
+
+// signatureDomainPattern matches the d= tag of a DKIM-Signature header
+var signatureDomainPattern = regexp.MustCompile(`(?:^|;)\s*d\s*=\s*([^;\s]+)`)
+
+// AuthResult is the outcome of evaluating a message's sender authentication
+type AuthResult struct {
+	FromDomain  string
+	SPF         string
+	SPFDomain   string
+	DKIMDomains []string
+	DMARC       string
+
+	// Aligned is true when SPF or DKIM passed for a domain aligned with the From
+	// header, which is what makes the From address trustworthy
+	Aligned bool
+}
+
+// dkimCheck is one DKIM signature result
+type dkimCheck struct {
+	domain string
+	result string
+}
+
+// MailAuthenticator evaluates sender authentication for mail we receive ourselves
+// rather than through a provider that has already done the checks.
+type MailAuthenticator struct {
+	config *config.Config
+}
+
+func NewMailAuthenticator(cfg *config.Config) *MailAuthenticator {
+	return &MailAuthenticator{
+		config: cfg,
+	}
+}
+
+// CheckSPF evaluates the sender's SPF policy for the connecting IP. An empty
+// sender (a bounce) is checked against the HELO name instead.
+func (a *MailAuthenticator) CheckSPF(ip net.IP, helo, sender string) string {
+	result, err := spf.CheckHostWithSender(ip, helo, sender)
+	if err != nil {
+		logger.GetLogger().Debug("SPF check returned an error",
+			zap.String("ip", ip.String()),
+			zap.String("sender", sender),
+			zap.Error(err))
+	}
+
+	return string(result)
+}
+
+// VerifyDKIM checks every DKIM signature on a raw message. The result uses the
+// "{@domain : result}" form SendGrid reports, so it can be read the same way.
+func (a *MailAuthenticator) VerifyDKIM(raw []byte) string {
+	verifications, err := dkim.Verify(bytes.NewReader(raw))
+	if err != nil {
+		logger.GetLogger().Debug("DKIM verification failed", zap.Error(err))
+		return "temperror"
+	}
+
+	if len(verifications) == 0 {
+		return "none"
+	}
+
+	var results []string
+	for _, verification := range verifications {
+		result := "pass"
+		if verification.Err != nil {
+			result = "fail"
+			if dkim.IsTempFail(verification.Err) {
+				result = "temperror"
+			}
+		}
+		results = append(results, fmt.Sprintf("{@%s : %s}", verification.Domain, result))
+	}
+
+	return strings.Join(results, ", ")
+}
+
+// Evaluate works out SPF, DKIM and DMARC for a normalized webhook. Results from
+// trusted Authentication-Results or ARC-Authentication-Results headers take
+// precedence over a trusted Received-SPF header, which takes precedence over
+// the transport-level SPF and DKIM fields.
+func (a *MailAuthenticator) Evaluate(webhook *models.EmailWebhook) *AuthResult {
+	result := &AuthResult{
+		SPF:   strings.ToLower(strings.TrimSpace(webhook.SPF)),
+		DMARC: "none",
+	}
+
+	if from, err := mail.ParseAddress(webhook.From); err == nil {
+		result.FromDomain = domainOf(from.Address)
+	}
+
+	var envelope struct {
+		From string `json:"from"`
+	}
+	if err := json.Unmarshal([]byte(webhook.Envelope), &envelope); err == nil {
+		result.SPFDomain = domainOf(envelope.From)
+	}
+
+	// Without the envelope sender there is no telling which domain SPF
+	// checked, so the transport's result can't vouch for the From address
+	if result.SPFDomain == "" || result.SPF == "" {
+		result.SPF = "none"
+	}
+
+	if spf, ok := a.trustedReceivedSPF(webhook.Headers); ok {
+		result.SPF, result.SPFDomain = spf.Result, spf.Domain
+	}
+
+	dkimChecks := parseDKIMSummary(webhook.DKIM)
+	if len(dkimChecks) == 0 && strings.Contains(strings.ToLower(webhook.DKIM), "pass") {
+		// A bare "pass" doesn't say which domain signed; only attribute it when there is a single signature
+		if domains := signatureDomains(webhook.Headers); len(domains) == 1 {
+			dkimChecks = append(dkimChecks, dkimCheck{domain: domains[0], result: "pass"})
+		}
+	}
+
+	if results := a.trustedAuthResults(webhook.Headers); len(results) > 0 {
+		dkimChecks = nil
+		for _, r := range results {
+			switch r := r.(type) {
+			case *authres.SPFResult:
+				result.SPF = string(r.Value)
+				if r.From != "" {
+					result.SPFDomain = domainOf(r.From)
+				} else if r.Helo != "" {
+					result.SPFDomain = strings.ToLower(r.Helo)
+				}
+			case *authres.DKIMResult:
+				domain := r.Domain
+				if domain == "" {
+					domain = domainOf(r.Identifier)
+				}
+				dkimChecks = append(dkimChecks, dkimCheck{domain: strings.ToLower(domain), result: string(r.Value)})
+			case *authres.DMARCResult:
+				if r.From == "" || strings.EqualFold(r.From, result.FromDomain) {
+					result.DMARC = string(r.Value)
+				}
+			}
+		}
+	}
+
+	for _, check := range dkimChecks {
+		if check.result == "pass" {
+			result.DKIMDomains = append(result.DKIMDomains, check.domain)
+		}
+	}
+
+	result.Aligned = a.isAligned(result)
+	return result
+}
+
+func (a *MailAuthenticator) isAligned(result *AuthResult) bool {
+	if result.FromDomain == "" {
+		return false
+	}
+
+	// A receiver that already evaluated DMARC has the final word
+	switch result.DMARC {
+	case "pass":
+		return true
+	case "fail":
+		return false
+	}
+
+	if result.SPF == "pass" && sameOrganization(result.SPFDomain, result.FromDomain) {
+		return true
+	}
+
+	for _, domain := range result.DKIMDomains {
+		if sameOrganization(domain, result.FromDomain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// trustedAuthResults collects results from Authentication-Results headers added
+// by a configured authserv-id, falling back to the newest trusted ARC instance.
+// Headers from any other server may have been written by the sender.
+func (a *MailAuthenticator) trustedAuthResults(headers string) []authres.Result {
+	if len(a.config.TrustedAuthservIDs) == 0 {
+		return nil
+	}
+
+	var direct []authres.Result
+	var arc []authres.Result
+	arcInstance := 0
+
+	for _, line := range strings.Split(headers, "\n") {
+		colon := strings.Index(line, ":")
+		if colon <= 0 {
+			continue
+		}
+		key := strings.TrimSpace(line[:colon])
+		value := strings.TrimSpace(line[colon+1:])
+
+		instance := 0
+		switch {
+		case strings.EqualFold(key, "Authentication-Results"):
+		case strings.EqualFold(key, "ARC-Authentication-Results"):
+			match := arcInstancePattern.FindStringSubmatch(value)
+			if match == nil {
+				continue
+			}
+			instance, _ = strconv.Atoi(match[1])
+			value = value[len(match[0]):]
+		default:
+			continue
+		}
+
+		identity, results, err := authres.Parse(value)
+		if err != nil || !a.isTrustedAuthserv(identity) {
+			continue
+		}
+
+		if instance == 0 {
+			direct = append(direct, results...)
+		} else if instance > arcInstance {
+			arc = results
+			arcInstance = instance
+		}
+	}
+
+	if len(direct) > 0 {
+		return direct
+	}
+	return arc
+}
+
+// trustedReceivedSPF returns the topmost Received-SPF header written by a
+// configured authserv-id. Any other may have been written by the sender.
+func (a *MailAuthenticator) trustedReceivedSPF(headers string) (utils.ReceivedSPF, bool) {
+	for _, line := range strings.Split(headers, "\n") {
+		colon := strings.Index(line, ":")
+		if colon <= 0 || !strings.EqualFold(strings.TrimSpace(line[:colon]), "Received-SPF") {
+			continue
+		}
+
+		spf := utils.ParseReceivedSPF(line[colon+1:])
+		if spf.Receiver != "" && a.isTrustedAuthserv(spf.Receiver) {
+			return spf, true
+		}
+	}
+
+	return utils.ReceivedSPF{}, false
+}
+
+func (a *MailAuthenticator) isTrustedAuthserv(identity string) bool {
+	for _, trusted := range a.config.TrustedAuthservIDs {
+		if strings.EqualFold(identity, trusted) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseDKIMSummary(summary string) []dkimCheck {
+	var checks []dkimCheck
+	for _, match := range dkimResultPattern.FindAllStringSubmatch(summary, -1) {
+		checks = append(checks, dkimCheck{
+			domain: strings.ToLower(match[1]),
+			result: strings.ToLower(match[2]),
+		})
+	}
+	return checks
+}
+
+// signatureDomains returns the d= domain of each DKIM-Signature header
+func signatureDomains(headers string) []string {
+	var domains []string
+	for _, line := range strings.Split(headers, "\n") {
+		colon := strings.Index(line, ":")
+		if colon <= 0 || !strings.EqualFold(strings.TrimSpace(line[:colon]), "DKIM-Signature") {
+			continue
+		}
+		if match := signatureDomainPattern.FindStringSubmatch(line[colon+1:]); match != nil {
+			domains = append(domains, strings.ToLower(match[1]))
+		}
+	}
+	return domains
+}
+
+func domainOf(address string) string {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return strings.ToLower(strings.TrimSpace(address))
+	}
+	return strings.ToLower(strings.TrimSpace(address[at+1:]))
+}
+
+// sameOrganization implements DMARC relaxed alignment by comparing organizational domains
+func sameOrganization(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+
+	orgA, errA := publicsuffix.EffectiveTLDPlusOne(a)
+	orgB, errB := publicsuffix.EffectiveTLDPlusOne(b)
+	if errA != nil || errB != nil {
+		return strings.EqualFold(a, b)
+	}
+
+	return strings.EqualFold(orgA, orgB)
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/models"
+)
+
+func TestEvaluateSPFTrust(t *testing.T) {
+	authenticator := NewMailAuthenticator(&config.Config{TrustedAuthservIDs: []string{"mx.swiftcal.test"}})
+
+	tests := []struct {
+		name    string
+		webhook models.EmailWebhook
+		wantSPF string
+		aligned bool
+	}{
+		{
+			name: "forged provider header without envelope sender",
+			webhook: models.EmailWebhook{
+				From:     "Alice <alice@example.com>",
+				Headers:  "X-Mailgun-Spf: pass\nReceived-SPF: pass (mx.evil.test: forged)\n",
+				SPF:      "pass",
+				Envelope: `{"from":"","to":["swiftcal@swiftcal.test"]}`,
+			},
+			wantSPF: "none",
+		},
+		{
+			name: "Received-SPF from an untrusted receiver",
+			webhook: models.EmailWebhook{
+				From:     "alice@example.com",
+				Headers:  "Received-SPF: pass (mx.evil.test: domain of alice@example.com designates 192.0.2.1 as permitted sender) envelope-from=alice@example.com; receiver=mx.evil.test\n",
+				Envelope: `{"from":"","to":[]}`,
+			},
+			wantSPF: "none",
+		},
+		{
+			name: "Received-SPF from the trusted relay",
+			webhook: models.EmailWebhook{
+				From:     "alice@example.com",
+				Headers:  "Received-SPF: pass (mx.swiftcal.test: domain of bounce@mail.example.com designates 192.0.2.1 as permitted sender) client-ip=192.0.2.1; envelope-from=bounce@mail.example.com; receiver=mx.swiftcal.test\n",
+				Envelope: `{"from":"","to":[]}`,
+			},
+			wantSPF: "pass",
+			aligned: true,
+		},
+		{
+			name: "trusted relay checked an unrelated domain",
+			webhook: models.EmailWebhook{
+				From:     "alice@example.com",
+				Headers:  "Received-SPF: pass (mx.swiftcal.test: domain of x@evil.test designates 192.0.2.1 as permitted sender) envelope-from=x@evil.test; receiver=mx.swiftcal.test\n",
+				Envelope: `{"from":"","to":[]}`,
+			},
+			wantSPF: "pass",
+		},
+		{
+			name: "transport result for the envelope sender",
+			webhook: models.EmailWebhook{
+				From:     "alice@example.com",
+				SPF:      "pass",
+				Envelope: `{"from":"alice@example.com","to":[]}`,
+			},
+			wantSPF: "pass",
+			aligned: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := authenticator.Evaluate(&tt.webhook)
+			if result.SPF != tt.wantSPF {
+				t.Errorf("SPF = %q, want %q", result.SPF, tt.wantSPF)
+			}
+			if result.Aligned != tt.aligned {
+				t.Errorf("Aligned = %v, want %v", result.Aligned, tt.aligned)
+			}
+		})
+	}
+}
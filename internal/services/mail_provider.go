@@ -6,14 +6,18 @@ import (
 	"fmt"
 
 	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/models"
+	"github.com/wizenheimer/swiftcal/internal/utils"
 	"github.com/wizenheimer/swiftcal/pkg/logger"
 
 	"github.com/mailgun/mailgun-go/v4"
 	"go.uber.org/zap"
 )
 
+// EmailProvider sends a message with optional text and HTML alternatives and
+// file attachments
 type EmailProvider interface {
-	SendEmail(ctx context.Context, to, from, subject, textContent, htmlContent string, headers map[string]string) error
+	SendEmail(ctx context.Context, to, from, subject, textContent, htmlContent string, headers map[string]string, attachments []models.EmailFile) error
 }
 
 type MailgunProvider struct {
@@ -29,7 +33,7 @@ func NewMailgunProvider(cfg *config.Config) *MailgunProvider {
 	}
 }
 
-func (p *MailgunProvider) SendEmail(ctx context.Context, to, from, subject, textContent, htmlContent string, headers map[string]string) error {
+func (p *MailgunProvider) SendEmail(ctx context.Context, to, from, subject, textContent, htmlContent string, headers map[string]string, attachments []models.EmailFile) error {
 	// if !p.config.IsProduction() {
 	// 	logger.GetLogger().Info("Email not sent (development mode)",
 	// 		zap.String("to", to),
@@ -39,6 +43,11 @@ func (p *MailgunProvider) SendEmail(ctx context.Context, to, from, subject, text
 	// 	return nil
 	// }
 
+	// Send a text alternative too, so the message is multipart/alternative
+	if textContent == "" && htmlContent != "" {
+		textContent = utils.HTMLToText(htmlContent)
+	}
+
 	message := mailgun.NewMessage(from, subject, textContent, to)
 
 	if htmlContent != "" {
@@ -50,6 +59,10 @@ func (p *MailgunProvider) SendEmail(ctx context.Context, to, from, subject, text
 		message.AddHeader(key, value)
 	}
 
+	for _, attachment := range attachments {
+		message.AddBufferAttachment(attachment.Filename, attachment.Content)
+	}
+
 	_, id, err := p.client.Send(ctx, message)
 	if err != nil {
 		return fmt.Errorf("failed to send email via Mailgun: %w", err)
@@ -59,7 +72,28 @@ func (p *MailgunProvider) SendEmail(ctx context.Context, to, from, subject, text
 		zap.String("message_id", id),
 		zap.String("to", to),
 		zap.String("subject", subject),
+		zap.Int("attachments", len(attachments)),
 	)
 
 	return nil
 }
+
+// GetStoredAttachment downloads an attachment kept by Mailgun's store() route action
+func (p *MailgunProvider) GetStoredAttachment(ctx context.Context, url string) ([]byte, error) {
+	content, err := p.client.GetStoredAttachment(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch stored attachment from Mailgun: %w", err)
+	}
+
+	return content, nil
+}
+
+// GetStoredMessageRaw downloads the full MIME source of a message kept by Mailgun's store() route action
+func (p *MailgunProvider) GetStoredMessageRaw(ctx context.Context, url string) (string, error) {
+	stored, err := p.client.GetStoredMessageRaw(ctx, url)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch stored message from Mailgun: %w", err)
+	}
+
+	return stored.BodyMime, nil
+}
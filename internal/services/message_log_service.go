@@ -0,0 +1,210 @@
+// internal/services/message_log_service.go
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/database"
+	"github.com/wizenheimer/swiftcal/internal/models"
+	"github.com/wizenheimer/swiftcal/internal/utils"
+	"github.com/wizenheimer/swiftcal/pkg/logger"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// messageClaimTTL is how long a processing claim is honoured before another
+// worker may assume its holder died and take the message over
+const messageClaimTTL = 10 * time.Minute
+
+// maxMessageIDLength keeps keys, sender and Message-Id, within the message_key column
+const maxMessageIDLength = 500
+
+// ErrMessageInProgress means another worker is handling the same message
+var ErrMessageInProgress = errors.New("message is already being processed")
+
+// MessageLogService remembers which inbound messages were handled, so provider
+// retries and repeated deliveries don't create events or replies twice.
+type MessageLogService struct {
+	db     *database.DB
+	config *config.Config
+}
+
+func NewMessageLogService(db *database.DB, cfg *config.Config) *MessageLogService {
+	return &MessageLogService{
+		db:     db,
+		config: cfg,
+	}
+}
+
+// MessageKey identifies a message by its sender and Message-Id. Anyone can
+// reuse someone else's Message-Id, so it only counts for the same sender.
+// Without one, it hashes the fields that stay the same across redeliveries of
+// the same message.
+func (s *MessageLogService) MessageKey(sender string, webhook *models.EmailWebhook) string {
+	if messageID := strings.Trim(utils.HeaderValue(webhook.Headers, "Message-Id"), "<> "); messageID != "" {
+		scoped := strings.ToLower(sender + ":" + messageID)
+		if len(scoped) > maxMessageIDLength {
+			sum := sha256.Sum256([]byte(scoped))
+			return "mid-sha256:" + hex.EncodeToString(sum[:])
+		}
+		return "mid:" + scoped
+	}
+
+	hash := sha256.New()
+	for _, field := range []string{
+		sender,
+		webhook.From,
+		webhook.To,
+		webhook.Subject,
+		utils.HeaderValue(webhook.Headers, "Date"),
+		webhook.Text,
+		webhook.HTML,
+	} {
+		hash.Write([]byte(field))
+		hash.Write([]byte{0})
+	}
+
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// Claim marks a message as being processed. When the message was already
+// handled it returns the earlier record and claimed is false.
+func (s *MessageLogService) Claim(ctx context.Context, key, sender string) (*models.ProcessedMessage, bool, error) {
+	insert := `
+		INSERT INTO processed_messages (message_key, sender, status, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		ON CONFLICT (message_key) DO NOTHING
+	`
+
+	result, err := s.db.Pool.Exec(ctx, insert, key, sender, models.MessageStatusProcessing)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to claim message: %w", err)
+	}
+	if result.RowsAffected() == 1 {
+		return nil, true, nil
+	}
+
+	// Take over claims whose worker stopped without finishing or releasing
+	takeover := `
+		UPDATE processed_messages
+		SET sender = $2, updated_at = NOW()
+		WHERE message_key = $1 AND status = $3 AND updated_at < $4
+	`
+
+	result, err = s.db.Pool.Exec(ctx, takeover, key, sender, models.MessageStatusProcessing, time.Now().Add(-messageClaimTTL))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to claim message: %w", err)
+	}
+	if result.RowsAffected() == 1 {
+		return nil, true, nil
+	}
+
+	existing, err := s.GetMessage(ctx, key)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Released between our insert and lookup; let the caller retry
+			return nil, false, ErrMessageInProgress
+		}
+		return nil, false, err
+	}
+
+	if existing.Status == models.MessageStatusProcessing {
+		return existing, false, ErrMessageInProgress
+	}
+
+	return existing, false, nil
+}
+
+// Complete records the outcome of a message that was handled successfully
+func (s *MessageLogService) Complete(ctx context.Context, key, outcome string) error {
+	query := `
+		UPDATE processed_messages
+		SET status = $2, outcome = $3, updated_at = NOW()
+		WHERE message_key = $1
+	`
+
+	if _, err := s.db.Pool.Exec(ctx, query, key, models.MessageStatusDone, outcome); err != nil {
+		return fmt.Errorf("failed to complete message: %w", err)
+	}
+
+	return nil
+}
+
+// Release drops a claim after a failed attempt so a retry can process the message
+func (s *MessageLogService) Release(ctx context.Context, key string) error {
+	query := `DELETE FROM processed_messages WHERE message_key = $1 AND status = $2`
+
+	if _, err := s.db.Pool.Exec(ctx, query, key, models.MessageStatusProcessing); err != nil {
+		return fmt.Errorf("failed to release message: %w", err)
+	}
+
+	return nil
+}
+
+// ReserveOutcome records the outcome on a claimed message if the sender has
+// fewer than limit messages with it since a time, reporting whether it did.
+// Reservations for one sender take turns, so concurrent messages can't all
+// see the same free slot, and a released claim gives its slot back.
+func (s *MessageLogService) ReserveOutcome(ctx context.Context, key, sender, outcome string, since time.Time, limit int) (bool, error) {
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			logger.GetLogger().Error("Failed to rollback transaction", zap.Error(rollbackErr))
+		}
+	}()
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "outcome:"+sender); err != nil {
+		return false, fmt.Errorf("failed to lock sender: %w", err)
+	}
+
+	query := `
+		UPDATE processed_messages
+		SET outcome = $3, updated_at = NOW()
+		WHERE message_key = $1 AND (
+			SELECT COUNT(*)
+			FROM processed_messages
+			WHERE sender = $2 AND outcome = $3 AND created_at >= $4 AND message_key <> $1
+		) < $5
+	`
+
+	result, err := tx.Exec(ctx, query, key, sender, outcome, since, limit)
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve outcome: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to reserve outcome: %w", err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+func (s *MessageLogService) GetMessage(ctx context.Context, key string) (*models.ProcessedMessage, error) {
+	query := `
+		SELECT message_key, sender, status, outcome, created_at, updated_at
+		FROM processed_messages
+		WHERE message_key = $1
+	`
+
+	message := &models.ProcessedMessage{}
+	err := s.db.Pool.QueryRow(ctx, query, key).Scan(
+		&message.MessageKey, &message.Sender, &message.Status, &message.Outcome,
+		&message.CreatedAt, &message.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wizenheimer/swiftcal/internal/models"
+)
+
+func TestMessageKey(t *testing.T) {
+	s := NewMessageLogService(nil, nil)
+	message := func(messageID string) *models.EmailWebhook {
+		return &models.EmailWebhook{
+			From:    "Priya Shah <priya@example.com>",
+			Subject: "Design review Thursday 3pm",
+			Headers: "Message-ID: <" + messageID + ">\nDate: Tue, 13 Oct 2026 16:12:00 +0100\n",
+			Text:    "Design review on Thursday at 3pm in Room 4.",
+		}
+	}
+
+	key := s.MessageKey("priya@example.com", message("CAF=1234@mail.example.com"))
+	if key != "mid:priya@example.com:caf=1234@mail.example.com" {
+		t.Errorf("MessageKey = %q", key)
+	}
+
+	// Someone who copies a Message-Id must not mark another sender's message
+	// as handled
+	if other := s.MessageKey("sam@example.org", message("CAF=1234@mail.example.com")); other == key {
+		t.Errorf("MessageKey for another sender = %q, want it to differ", other)
+	}
+
+	if again := s.MessageKey("priya@example.com", message("caf=1234@MAIL.example.com")); again != key {
+		t.Errorf("MessageKey for a redelivery = %q, want %q", again, key)
+	}
+
+	long := s.MessageKey("priya@example.com", message(strings.Repeat("a", 600)+"@mail.example.com"))
+	if !strings.HasPrefix(long, "mid-sha256:") || len(long) > 512 {
+		t.Errorf("MessageKey for a long Message-Id = %q", long)
+	}
+
+	withoutID := &models.EmailWebhook{From: "priya@example.com", Text: "Lunch on Friday?"}
+	if s.MessageKey("priya@example.com", withoutID) == s.MessageKey("sam@example.org", withoutID) {
+		t.Error("MessageKey without a Message-Id ignores the sender")
+	}
+}
@@ -0,0 +1,407 @@
+// internal/services/microsoft_auth_service.go
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/database"
+	"github.com/wizenheimer/swiftcal/internal/models"
+	"github.com/wizenheimer/swiftcal/internal/utils"
+	"github.com/wizenheimer/swiftcal/pkg/logger"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+// MicrosoftAuthService connects Microsoft 365 and Outlook.com calendars through
+// the Microsoft identity platform, keeping tokens apart from the Google ones
+// on the users table
+type MicrosoftAuthService struct {
+	db          *database.DB
+	config      *config.Config
+	authService *AuthService
+	oauthConfig *oauth2.Config
+}
+
+func NewMicrosoftAuthService(db *database.DB, cfg *config.Config, authService *AuthService) *MicrosoftAuthService {
+	// Built by hand rather than with the microsoft package so a fake login
+	// server can stand in during tests
+	loginURL := strings.TrimRight(cfg.MicrosoftLoginURL, "/") + "/" + cfg.MicrosoftTenant + "/oauth2/v2.0"
+
+	oauthConfig := &oauth2.Config{
+		ClientID:     cfg.MicrosoftClientID,
+		ClientSecret: cfg.MicrosoftClientSecret,
+		RedirectURL:  cfg.MicrosoftRedirectURL,
+		Scopes: []string{
+			"openid",
+			"email",
+			"profile",
+			"offline_access",
+			"User.Read",
+			"MailboxSettings.Read",
+			"Calendars.ReadWrite",
+		},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   loginURL + "/authorize",
+			TokenURL:  loginURL + "/token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+
+	return &MicrosoftAuthService{
+		db:          db,
+		config:      cfg,
+		authService: authService,
+		oauthConfig: oauthConfig,
+	}
+}
+
+// ErrMicrosoftAccountNotLinked means a Microsoft sign-in matched no swiftcal
+// user. Accounts are only linked through a link from a "connect microsoft"
+// email, never by the address Graph reports, which a tenant admin can set to
+// anything.
+var ErrMicrosoftAccountNotLinked = errors.New("microsoft account is not linked to a swiftcal user")
+
+// ErrMicrosoftAccountInUse means the Microsoft account is linked to another user
+var ErrMicrosoftAccountInUse = errors.New("microsoft account is linked to another swiftcal user")
+
+// ErrInvalidState means an OAuth callback doesn't belong to a sign-in this browser started
+var ErrInvalidState = errors.New("oauth state does not match")
+
+const (
+	microsoftLinkPurpose  = "microsoft-link"
+	microsoftStatePurpose = "microsoft-oauth-state"
+)
+
+// microsoftLinkURL returns a link, valid for an hour, that connects the
+// Microsoft account signed in with to the swiftcal user with this address.
+// It is only sent to addresses that authenticated a "connect microsoft" email.
+func microsoftLinkURL(cfg *config.Config, email string) string {
+	token := utils.SignValue(cfg.JWTSecret, microsoftLinkPurpose, email, time.Now().Add(time.Hour))
+	return cfg.GetAppURL("/connect/microsoft?token=" + url.QueryEscape(token))
+}
+
+// VerifyLinkToken returns the address a connect link was sent to
+func (s *MicrosoftAuthService) VerifyLinkToken(token string) (string, error) {
+	return utils.VerifySignedValue(s.config.JWTSecret, microsoftLinkPurpose, token, time.Now())
+}
+
+// NewState starts a sign-in: it returns a random OAuth state and a signed
+// value for a cookie that binds the state, and any address being linked, to
+// this browser, so a callback started elsewhere is refused
+func (s *MicrosoftAuthService) NewState(linkEmail string) (state, cookie string, err error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", fmt.Errorf("failed to generate state: %w", err)
+	}
+
+	state = base64.RawURLEncoding.EncodeToString(nonce)
+	cookie = utils.SignValue(s.config.JWTSecret, microsoftStatePurpose, state+" "+linkEmail, time.Now().Add(15*time.Minute))
+	return state, cookie, nil
+}
+
+// VerifyState checks a callback's state against the cookie set by NewState
+// and returns the address being linked, if any
+func (s *MicrosoftAuthService) VerifyState(state, cookie string) (string, error) {
+	value, err := utils.VerifySignedValue(s.config.JWTSecret, microsoftStatePurpose, cookie, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	nonce, linkEmail, _ := strings.Cut(value, " ")
+	if state == "" || subtle.ConstantTimeCompare([]byte(nonce), []byte(state)) != 1 {
+		return "", ErrInvalidState
+	}
+
+	return linkEmail, nil
+}
+
+func (s *MicrosoftAuthService) GetAuthURL(state string) string {
+	return s.oauthConfig.AuthCodeURL(state, oauth2.SetAuthURLParam("prompt", "select_account"))
+}
+
+// HandleCallback signs the user in with their Microsoft account and makes
+// Microsoft the calendar their events go to. With linkEmail, the address a
+// connect link was sent to, the account is linked to that user, who is
+// created if needed; without it the account must already be linked.
+func (s *MicrosoftAuthService) HandleCallback(ctx context.Context, code, linkEmail string) (*models.User, error) {
+	token, err := s.oauthConfig.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code for token: %w", err)
+	}
+
+	tenantID, objectID, err := s.accountIdentity(token)
+	if err != nil {
+		return nil, err
+	}
+
+	linkedUserID, err := s.linkedUserID(ctx, tenantID, objectID)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *models.User
+	switch {
+	case linkEmail != "":
+		user, err = s.authService.GetUserByEmail(ctx, linkEmail)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("failed to check existing user: %w", err)
+		}
+		if linkedUserID != uuid.Nil && (user == nil || user.ID != linkedUserID) {
+			return nil, ErrMicrosoftAccountInUse
+		}
+
+		if user == nil {
+			// The address authenticated the connect email, as with CalDAV
+			user, err = s.authService.CreateProviderUser(ctx, linkEmail, models.CalendarProviderMicrosoft)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := s.authService.AddEmailAddress(ctx, user.ID, linkEmail, true); err != nil {
+				logger.GetLogger().Error("Failed to add default email address", zap.Error(err))
+			}
+
+			logger.GetLogger().Info("New user created", zap.String("user_id", user.ID.String()), zap.String("provider", models.CalendarProviderMicrosoft))
+		}
+	case linkedUserID != uuid.Nil:
+		user, err = s.authService.GetUserByID(ctx, linkedUserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get linked user: %w", err)
+		}
+	default:
+		return nil, ErrMicrosoftAccountNotLinked
+	}
+
+	if err := s.saveAccount(ctx, user.ID, tenantID, objectID, token); err != nil {
+		return nil, err
+	}
+
+	if err := s.authService.SetCalendarProvider(ctx, user.ID, models.CalendarProviderMicrosoft); err != nil {
+		return nil, fmt.Errorf("failed to set calendar provider: %w", err)
+	}
+	user.CalendarProvider = models.CalendarProviderMicrosoft
+
+	return user, nil
+}
+
+// accountIdentity reads the tenant and object IDs from the ID token, which
+// identify the account for good, unlike its addresses. The token came straight
+// from the token endpoint over TLS, so its signature needn't be checked
+// (OpenID Connect Core 3.1.3.7).
+func (s *MicrosoftAuthService) accountIdentity(token *oauth2.Token) (tenantID, objectID string, err error) {
+	idToken, _ := token.Extra("id_token").(string)
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return "", "", fmt.Errorf("microsoft token response has no ID token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode ID token: %w", err)
+	}
+
+	var claims struct {
+		Audience string `json:"aud"`
+		TenantID string `json:"tid"`
+		ObjectID string `json:"oid"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", "", fmt.Errorf("failed to decode ID token: %w", err)
+	}
+
+	if claims.Audience != s.oauthConfig.ClientID {
+		return "", "", fmt.Errorf("ID token was issued to another application")
+	}
+	if claims.TenantID == "" || claims.ObjectID == "" {
+		return "", "", fmt.Errorf("ID token has no tenant or object ID")
+	}
+
+	return claims.TenantID, claims.ObjectID, nil
+}
+
+// linkedUserID returns the user a Microsoft account is linked to, or uuid.Nil
+func (s *MicrosoftAuthService) linkedUserID(ctx context.Context, tenantID, objectID string) (uuid.UUID, error) {
+	query := `SELECT user_id FROM microsoft_tokens WHERE tenant_id = $1 AND object_id = $2`
+
+	var userID uuid.UUID
+	if err := s.db.Pool.QueryRow(ctx, query, tenantID, objectID).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, nil
+		}
+		return uuid.Nil, fmt.Errorf("failed to look up microsoft account: %w", err)
+	}
+
+	return userID, nil
+}
+
+// saveAccount links a Microsoft account to the user with its first token,
+// replacing any account they linked before
+func (s *MicrosoftAuthService) saveAccount(ctx context.Context, userID uuid.UUID, tenantID, objectID string, token *oauth2.Token) error {
+	var refreshToken, scope *string
+	if token.RefreshToken != "" {
+		refreshToken = &token.RefreshToken
+	}
+	if value, ok := token.Extra("scope").(string); ok && value != "" {
+		scope = &value
+	}
+
+	query := `
+		INSERT INTO microsoft_tokens (user_id, tenant_id, object_id, access_token, refresh_token, expiry_date, token_scope)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id) DO UPDATE
+		SET tenant_id = EXCLUDED.tenant_id,
+		    object_id = EXCLUDED.object_id,
+		    access_token = EXCLUDED.access_token,
+		    refresh_token = EXCLUDED.refresh_token,
+		    expiry_date = EXCLUDED.expiry_date,
+		    token_scope = EXCLUDED.token_scope,
+		    updated_at = NOW()
+	`
+
+	if _, err := s.db.Pool.Exec(ctx, query, userID, tenantID, objectID, token.AccessToken, refreshToken, token.Expiry, scope); err != nil {
+		return fmt.Errorf("failed to save microsoft account: %w", err)
+	}
+
+	return nil
+}
+
+// SaveToken stores a refreshed token, keeping the old refresh token when
+// the refresh didn't return a new one
+func (s *MicrosoftAuthService) SaveToken(ctx context.Context, userID uuid.UUID, token *oauth2.Token) error {
+	var refreshToken, scope *string
+	if token.RefreshToken != "" {
+		refreshToken = &token.RefreshToken
+	}
+	if value, ok := token.Extra("scope").(string); ok && value != "" {
+		scope = &value
+	}
+
+	query := `
+		UPDATE microsoft_tokens
+		SET access_token = $2,
+		    refresh_token = COALESCE($3, refresh_token),
+		    expiry_date = $4,
+		    token_scope = COALESCE($5, token_scope),
+		    updated_at = NOW()
+		WHERE user_id = $1
+	`
+
+	if _, err := s.db.Pool.Exec(ctx, query, userID, token.AccessToken, refreshToken, token.Expiry, scope); err != nil {
+		return fmt.Errorf("failed to save microsoft token: %w", err)
+	}
+
+	return nil
+}
+
+func (s *MicrosoftAuthService) GetToken(ctx context.Context, userID uuid.UUID) (*models.MicrosoftToken, error) {
+	query := `
+		SELECT user_id, access_token, refresh_token, expiry_date, token_scope, created_at, updated_at
+		FROM microsoft_tokens
+		WHERE user_id = $1
+	`
+
+	token := &models.MicrosoftToken{}
+	err := s.db.Pool.QueryRow(ctx, query, userID).Scan(
+		&token.UserID, &token.AccessToken, &token.RefreshToken, &token.ExpiryDate,
+		&token.TokenScope, &token.CreatedAt, &token.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("no Microsoft calendar connected")
+		}
+		return nil, fmt.Errorf("failed to get microsoft token: %w", err)
+	}
+
+	return token, nil
+}
+
+func (s *MicrosoftAuthService) RefreshAccessToken(ctx context.Context, userID uuid.UUID) (*oauth2.Token, error) {
+	stored, err := s.GetToken(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.RefreshToken == nil {
+		return nil, fmt.Errorf("no refresh token available")
+	}
+
+	// An expired token makes the source refresh it
+	newToken, err := s.oauthConfig.TokenSource(ctx, &oauth2.Token{RefreshToken: *stored.RefreshToken}).Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+
+	if err := s.SaveToken(ctx, userID, newToken); err != nil {
+		return nil, fmt.Errorf("failed to update tokens in database: %w", err)
+	}
+
+	logger.GetLogger().Info("Microsoft access token refreshed", zap.String("user_id", userID.String()))
+	return newToken, nil
+}
+
+func (s *MicrosoftAuthService) GetOAuthClient(ctx context.Context, userID uuid.UUID) (*http.Client, error) {
+	stored, err := s.GetToken(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &oauth2.Token{AccessToken: stored.AccessToken}
+	if stored.RefreshToken != nil {
+		token.RefreshToken = *stored.RefreshToken
+	}
+	if stored.ExpiryDate != nil {
+		token.Expiry = *stored.ExpiryDate
+	}
+
+	// Check if token needs refresh
+	if token.Expiry.Before(time.Now().Add(5 * time.Minute)) {
+		refreshedToken, err := s.RefreshAccessToken(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to refresh token: %w", err)
+		}
+		token = refreshedToken
+	}
+
+	return s.oauthConfig.Client(ctx, token), nil
+}
+
+// FindUsersWithExpiringTokens returns the users whose Microsoft token expires
+// within two hours
+func (s *MicrosoftAuthService) FindUsersWithExpiringTokens(ctx context.Context) ([]uuid.UUID, error) {
+	query := `
+		SELECT user_id
+		FROM microsoft_tokens
+		WHERE expiry_date <= $1 AND refresh_token IS NOT NULL
+	`
+
+	rows, err := s.db.Pool.Query(ctx, query, time.Now().Add(2*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []uuid.UUID
+	for rows.Next() {
+		var userID uuid.UUID
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, rows.Err()
+}
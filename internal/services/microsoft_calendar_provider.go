@@ -0,0 +1,763 @@
+// internal/services/microsoft_calendar_provider.go
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/models"
+	"github.com/wizenheimer/swiftcal/internal/utils"
+	"github.com/wizenheimer/swiftcal/pkg/logger"
+
+	"github.com/google/uuid"
+	"github.com/teambition/rrule-go"
+	"go.uber.org/zap"
+)
+
+// graphDateTimeLayout is how Graph writes times, in the zone named beside them
+const graphDateTimeLayout = "2006-01-02T15:04:05.9999999"
+
+var graphWeekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+var graphWeekIndexes = map[int]string{1: "first", 2: "second", 3: "third", 4: "fourth", -1: "last"}
+
+// OAuthClientSource hands out HTTP clients authorized as a user. Tests can
+// supply plain clients pointed at a fake Graph server.
+type OAuthClientSource interface {
+	GetOAuthClient(ctx context.Context, userID uuid.UUID) (*http.Client, error)
+}
+
+// MicrosoftCalendarProvider adds events to Microsoft 365 and Outlook.com
+// calendars through Microsoft Graph
+type MicrosoftCalendarProvider struct {
+	config      *config.Config
+	authService OAuthClientSource
+	graphURL    string
+}
+
+func NewMicrosoftCalendarProvider(cfg *config.Config, authService OAuthClientSource) *MicrosoftCalendarProvider {
+	return &MicrosoftCalendarProvider{
+		config:      cfg,
+		authService: authService,
+		graphURL:    strings.TrimRight(cfg.MicrosoftGraphURL, "/"),
+	}
+}
+
+type graphEvent struct {
+	ID                         string           `json:"id,omitempty"`
+	ICalUID                    string           `json:"iCalUId,omitempty"`
+	WebLink                    string           `json:"webLink,omitempty"`
+	TransactionID              string           `json:"transactionId,omitempty"`
+	Subject                    string           `json:"subject"`
+	Body                       *graphItemBody   `json:"body,omitempty"`
+	Start                      *graphDateTime   `json:"start,omitempty"`
+	End                        *graphDateTime   `json:"end,omitempty"`
+	OriginalStartTimeZone      string           `json:"originalStartTimeZone,omitempty"`
+	IsAllDay                   bool             `json:"isAllDay"`
+	IsCancelled                bool             `json:"isCancelled,omitempty"`
+	IsOnlineMeeting            bool             `json:"isOnlineMeeting,omitempty"`
+	ShowAs                     string           `json:"showAs,omitempty"`
+	Location                   *graphLocation   `json:"location,omitempty"`
+	Attendees                  []graphAttendee  `json:"attendees"`
+	IsReminderOn               *bool            `json:"isReminderOn,omitempty"`
+	ReminderMinutesBeforeStart *int             `json:"reminderMinutesBeforeStart,omitempty"`
+	Recurrence                 *graphRecurrence `json:"recurrence"`
+}
+
+type graphCalendar struct {
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	CanEdit           bool   `json:"canEdit"`
+	IsDefaultCalendar bool   `json:"isDefaultCalendar"`
+}
+
+type graphItemBody struct {
+	ContentType string `json:"contentType"`
+	Content     string `json:"content"`
+}
+
+type graphDateTime struct {
+	DateTime string `json:"dateTime"`
+	TimeZone string `json:"timeZone"`
+}
+
+type graphLocation struct {
+	DisplayName string `json:"displayName"`
+}
+
+type graphAttendee struct {
+	EmailAddress graphEmailAddress `json:"emailAddress"`
+	Type         string            `json:"type,omitempty"`
+}
+
+type graphEmailAddress struct {
+	Address string `json:"address"`
+	Name    string `json:"name,omitempty"`
+}
+
+type graphRecurrence struct {
+	Pattern graphRecurrencePattern `json:"pattern"`
+	Range   graphRecurrenceRange   `json:"range"`
+}
+
+type graphRecurrencePattern struct {
+	Type           string   `json:"type"`
+	Interval       int      `json:"interval"`
+	DaysOfWeek     []string `json:"daysOfWeek,omitempty"`
+	DayOfMonth     int      `json:"dayOfMonth,omitempty"`
+	Month          int      `json:"month,omitempty"`
+	Index          string   `json:"index,omitempty"`
+	FirstDayOfWeek string   `json:"firstDayOfWeek,omitempty"`
+}
+
+type graphRecurrenceRange struct {
+	Type                string `json:"type"`
+	StartDate           string `json:"startDate"`
+	EndDate             string `json:"endDate,omitempty"`
+	NumberOfOccurrences int    `json:"numberOfOccurrences,omitempty"`
+	RecurrenceTimeZone  string `json:"recurrenceTimeZone,omitempty"`
+}
+
+// graphError is an error response from Microsoft Graph
+type graphError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *graphError) Error() string {
+	return fmt.Sprintf("graph API returned %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// isGraphGoneError reports whether Graph says an event no longer exists
+func isGraphGoneError(err error) bool {
+	var apiErr *graphError
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusGone)
+}
+
+func (s *MicrosoftCalendarProvider) AddEvent(ctx context.Context, userID uuid.UUID, calendarID string, event *models.Event) (*models.GoogleCalendarEvent, error) {
+	client, err := s.authService.GetOAuthClient(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OAuth client: %w", err)
+	}
+
+	calendarPath := "/me/calendar"
+	if calendarID != "" {
+		calendarPath = "/me/calendars/" + url.PathEscape(calendarID)
+	}
+
+	var targetCalendar graphCalendar
+	if err := s.do(ctx, client, http.MethodGet, calendarPath, nil, &targetCalendar); err != nil {
+		if calendarID != "" && isGraphGoneError(err) {
+			return nil, fmt.Errorf("calendar %s: %w", calendarID, ErrCalendarNotWritable)
+		}
+		return nil, fmt.Errorf("failed to get calendar: %w", err)
+	}
+	if !targetCalendar.CanEdit {
+		return nil, fmt.Errorf("calendar %s: %w", targetCalendar.Name, ErrCalendarNotWritable)
+	}
+
+	var mailboxSettings struct {
+		TimeZone string `json:"timeZone"`
+	}
+	if err := s.do(ctx, client, http.MethodGet, "/me/mailboxSettings", nil, &mailboxSettings); err != nil {
+		return nil, fmt.Errorf("failed to get mailbox settings: %w", err)
+	}
+
+	draft, err := s.convertToGraphEvent(event, mailboxSettings.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert event: %w", err)
+	}
+
+	// Graph won't create a second event with the same transactionId, so a
+	// retry of the same message can't add it twice
+	if event.SourceKey != "" {
+		draft.TransactionID = sourceEventID(event.SourceKey)
+	}
+
+	var created graphEvent
+	path := "/me/calendars/" + url.PathEscape(targetCalendar.ID) + "/events"
+	if err := s.do(ctx, client, http.MethodPost, path, draft, &created); err != nil {
+		return nil, fmt.Errorf("failed to create calendar event: %w", err)
+	}
+
+	result := s.toCalendarEvent(&created, targetCalendar.ID)
+	if created.Recurrence != nil {
+		result.Recurrence = graphStoredRules(event.Recurrence)
+	}
+
+	logger.GetLogger().Info("Calendar event created",
+		zap.String("user_id", userID.String()),
+		zap.String("provider", models.CalendarProviderMicrosoft),
+		zap.String("event_id", result.ID),
+		zap.String("summary", result.Summary))
+
+	return result, nil
+}
+
+// ListCalendars returns the calendars in the user's mailbox
+func (s *MicrosoftCalendarProvider) ListCalendars(ctx context.Context, userID uuid.UUID) ([]models.Calendar, error) {
+	client, err := s.authService.GetOAuthClient(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OAuth client: %w", err)
+	}
+
+	var calendars []models.Calendar
+	for next := "/me/calendars?$top=100"; next != ""; {
+		var page struct {
+			Value    []graphCalendar `json:"value"`
+			NextLink string          `json:"@odata.nextLink"`
+		}
+		if err := s.do(ctx, client, http.MethodGet, next, nil, &page); err != nil {
+			return nil, fmt.Errorf("failed to get calendar list: %w", err)
+		}
+
+		for _, calendar := range page.Value {
+			calendars = append(calendars, models.Calendar{
+				ID:       calendar.ID,
+				Name:     calendar.Name,
+				Primary:  calendar.IsDefaultCalendar,
+				Writable: calendar.CanEdit,
+			})
+		}
+
+		if next, err = s.nextPage(page.NextLink); err != nil {
+			return nil, fmt.Errorf("failed to get calendar list: %w", err)
+		}
+	}
+
+	return calendars, nil
+}
+
+// ListEvents returns the events overlapping the given times, with recurring
+// events expanded into their occurrences
+func (s *MicrosoftCalendarProvider) ListEvents(ctx context.Context, userID uuid.UUID, calendarID string, from, to time.Time) ([]models.GoogleCalendarEvent, error) {
+	client, err := s.authService.GetOAuthClient(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OAuth client: %w", err)
+	}
+
+	path := "/me/calendar/calendarView"
+	if calendarID != "" {
+		path = "/me/calendars/" + url.PathEscape(calendarID) + "/calendarView"
+	}
+	params := url.Values{}
+	params.Set("startDateTime", from.UTC().Format(time.RFC3339))
+	params.Set("endDateTime", to.UTC().Format(time.RFC3339))
+	params.Set("$top", "250")
+
+	var events []models.GoogleCalendarEvent
+	for next := path + "?" + params.Encode(); next != ""; {
+		var page struct {
+			Value    []graphEvent `json:"value"`
+			NextLink string       `json:"@odata.nextLink"`
+		}
+		if err := s.do(ctx, client, http.MethodGet, next, nil, &page); err != nil {
+			return nil, fmt.Errorf("failed to list events: %w", err)
+		}
+
+		for i := range page.Value {
+			if !page.Value[i].IsCancelled {
+				events = append(events, *s.toCalendarEvent(&page.Value[i], calendarID))
+			}
+		}
+
+		if next, err = s.nextPage(page.NextLink); err != nil {
+			return nil, fmt.Errorf("failed to list events: %w", err)
+		}
+	}
+
+	return events, nil
+}
+
+// GetEvent returns an event, or ErrEventNotFound when it has been deleted.
+// Graph event IDs are unique within a mailbox, so the calendar isn't needed
+// to find one.
+func (s *MicrosoftCalendarProvider) GetEvent(ctx context.Context, userID uuid.UUID, calendarID, eventID string) (*models.GoogleCalendarEvent, error) {
+	client, err := s.authService.GetOAuthClient(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OAuth client: %w", err)
+	}
+
+	existing, err := s.getEvent(ctx, client, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toCalendarEvent(existing, calendarID), nil
+}
+
+// UpdateEvent rewrites an event, keeping guests that were invited to it since
+func (s *MicrosoftCalendarProvider) UpdateEvent(ctx context.Context, userID uuid.UUID, calendarID, eventID string, event *models.Event) (*models.GoogleCalendarEvent, error) {
+	client, err := s.authService.GetOAuthClient(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OAuth client: %w", err)
+	}
+
+	existing, err := s.getEvent(ctx, client, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The event's own zone is the best default for times given without one
+	draft, err := s.convertToGraphEvent(event, existing.OriginalStartTimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert event: %w", err)
+	}
+
+	// Keep guests added to the event after it was imported
+	seen := make(map[string]bool)
+	for _, attendee := range draft.Attendees {
+		seen[strings.ToLower(attendee.EmailAddress.Address)] = true
+	}
+	for _, attendee := range existing.Attendees {
+		if !seen[strings.ToLower(attendee.EmailAddress.Address)] {
+			draft.Attendees = append(draft.Attendees, attendee)
+		}
+	}
+
+	var updated graphEvent
+	if err := s.do(ctx, client, http.MethodPatch, "/me/events/"+url.PathEscape(eventID), draft, &updated); err != nil {
+		if isGraphGoneError(err) {
+			return nil, ErrEventNotFound
+		}
+		return nil, fmt.Errorf("failed to update calendar event: %w", err)
+	}
+
+	result := s.toCalendarEvent(&updated, calendarID)
+	if updated.Recurrence != nil {
+		result.Recurrence = graphStoredRules(event.Recurrence)
+	}
+
+	logger.GetLogger().Info("Calendar event updated",
+		zap.String("user_id", userID.String()),
+		zap.String("provider", models.CalendarProviderMicrosoft),
+		zap.String("event_id", result.ID),
+		zap.String("summary", result.Summary))
+
+	return result, nil
+}
+
+// DeleteEvent removes an event. An event the user already deleted counts as removed.
+func (s *MicrosoftCalendarProvider) DeleteEvent(ctx context.Context, userID uuid.UUID, calendarID, eventID string) error {
+	client, err := s.authService.GetOAuthClient(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get OAuth client: %w", err)
+	}
+
+	if err := s.do(ctx, client, http.MethodDelete, "/me/events/"+url.PathEscape(eventID), nil, nil); err != nil && !isGraphGoneError(err) {
+		return fmt.Errorf("failed to delete calendar event: %w", err)
+	}
+
+	logger.GetLogger().Info("Calendar event deleted",
+		zap.String("user_id", userID.String()),
+		zap.String("provider", models.CalendarProviderMicrosoft),
+		zap.String("event_id", eventID))
+
+	return nil
+}
+
+func (s *MicrosoftCalendarProvider) InviteAttendees(ctx context.Context, userID uuid.UUID, eventID, calendarID string, attendees []string) error {
+	client, err := s.authService.GetOAuthClient(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get OAuth client: %w", err)
+	}
+
+	existing, err := s.getEvent(ctx, client, eventID)
+	if err != nil {
+		return err
+	}
+
+	// Graph replaces the whole list, and sends invitations to the new guests
+	patch := struct {
+		Attendees []graphAttendee `json:"attendees"`
+	}{Attendees: existing.Attendees}
+	for _, email := range attendees {
+		if isValidEmail(email) {
+			patch.Attendees = append(patch.Attendees, graphAttendee{
+				EmailAddress: graphEmailAddress{Address: email},
+				Type:         "required",
+			})
+		}
+	}
+
+	if err := s.do(ctx, client, http.MethodPatch, "/me/events/"+url.PathEscape(eventID), patch, nil); err != nil {
+		return fmt.Errorf("failed to update event: %w", err)
+	}
+
+	logger.GetLogger().Info("Additional attendees invited",
+		zap.String("user_id", userID.String()),
+		zap.String("provider", models.CalendarProviderMicrosoft),
+		zap.String("event_id", eventID),
+		zap.Strings("attendees", attendees))
+
+	return nil
+}
+
+func (s *MicrosoftCalendarProvider) getEvent(ctx context.Context, client *http.Client, eventID string) (*graphEvent, error) {
+	var existing graphEvent
+	if err := s.do(ctx, client, http.MethodGet, "/me/events/"+url.PathEscape(eventID), nil, &existing); err != nil {
+		if isGraphGoneError(err) {
+			return nil, ErrEventNotFound
+		}
+		return nil, fmt.Errorf("failed to get event: %w", err)
+	}
+	if existing.IsCancelled {
+		return nil, ErrEventNotFound
+	}
+
+	return &existing, nil
+}
+
+// nextPage turns the @odata.nextLink of a collection into a path for do, or
+// returns "" on the last page. Graph writes the link as a full URL; one that
+// points anywhere else isn't followed, so the user's token stays with Graph.
+func (s *MicrosoftCalendarProvider) nextPage(link string) (string, error) {
+	if link == "" {
+		return "", nil
+	}
+
+	path, ok := strings.CutPrefix(link, s.graphURL+"/")
+	if !ok {
+		return "", fmt.Errorf("next page link %q is outside %s", link, s.graphURL)
+	}
+
+	return "/" + path, nil
+}
+
+// do sends a Graph request, encoding body and decoding the response into
+// result when they aren't nil
+func (s *MicrosoftCalendarProvider) do(ctx context.Context, client *http.Client, method, path string, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.graphURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &graphError{StatusCode: resp.StatusCode}
+		var payload struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&payload); err == nil {
+			apiErr.Code, apiErr.Message = payload.Error.Code, payload.Error.Message
+		}
+		return apiErr
+	}
+
+	if result == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+func (s *MicrosoftCalendarProvider) convertToGraphEvent(event *models.Event, defaultTimezone string) (*graphEvent, error) {
+	times, err := resolveEventTimes(event, defaultTimezone)
+	if err != nil {
+		return nil, err
+	}
+
+	description := ""
+	if event.Description != nil {
+		description = *event.Description
+	}
+
+	draft := &graphEvent{
+		Subject:         event.Summary,
+		Body:            &graphItemBody{ContentType: "text", Content: withDescriptionFooter(s.config, description)},
+		IsAllDay:        times.AllDay,
+		IsOnlineMeeting: event.ConferenceCall,
+		ShowAs:          "busy",
+		Attendees:       []graphAttendee{},
+	}
+
+	// All-day events run from midnight to midnight in the calendar's zone
+	layout := "2006-01-02T15:04:05"
+	if times.AllDay {
+		layout = "2006-01-02T00:00:00"
+	}
+	draft.Start = &graphDateTime{DateTime: times.Start.Format(layout), TimeZone: times.TimeZone}
+	draft.End = &graphDateTime{DateTime: times.End.Format(layout), TimeZone: times.TimeZone}
+
+	if event.Location != nil && *event.Location != "" {
+		draft.Location = &graphLocation{DisplayName: *event.Location}
+	}
+
+	if len(event.Recurrence) > 0 {
+		recurrence, err := graphRecurrenceFromRules(event.Recurrence, times)
+		if err != nil {
+			// Better one occurrence in the calendar than none at all
+			logger.GetLogger().Warn("Adding recurring event as a single event",
+				zap.Error(err),
+				zap.Strings("recurrence", event.Recurrence))
+		}
+		draft.Recurrence = recurrence
+	}
+
+	// Deadlines show as free so they don't block meetings being scheduled
+	if event.Deadline {
+		draft.ShowAs = "free"
+	}
+
+	// Outlook has a single reminder, so the first one requested wins
+	if reminders := utils.NormalizeReminders(event.Reminders); len(reminders) > 0 {
+		on, minutes := true, reminders[0].Minutes
+		draft.IsReminderOn = &on
+		draft.ReminderMinutesBeforeStart = &minutes
+	}
+
+	for _, email := range event.Attendees {
+		if isValidEmail(email) {
+			draft.Attendees = append(draft.Attendees, graphAttendee{
+				EmailAddress: graphEmailAddress{Address: email},
+				Type:         "required",
+			})
+		} else {
+			logger.GetLogger().Warn("Skipping invalid email address",
+				zap.String("email", email))
+		}
+	}
+
+	return draft, nil
+}
+
+// graphRecurrenceFromRules turns an RRULE into Graph's recurrence pattern.
+// Graph has no exception or extra dates, so EXDATE and RDATE lines are dropped.
+func graphRecurrenceFromRules(lines []string, times *eventTimes) (*graphRecurrence, error) {
+	var rule string
+	for _, line := range lines {
+		name, value, _ := strings.Cut(line, ":")
+		name, _, _ = strings.Cut(name, ";")
+
+		switch strings.ToUpper(name) {
+		case "RRULE":
+			rule = value
+		case "EXDATE", "RDATE":
+			logger.GetLogger().Warn("Dropping recurrence dates Outlook can't store", zap.String("line", line))
+		}
+	}
+	if rule == "" {
+		return nil, fmt.Errorf("no recurrence rule")
+	}
+
+	loc := times.Start.Location()
+	option, err := rrule.StrToROptionInLocation(rule, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recurrence rule: %w", err)
+	}
+
+	if len(option.Byyearday) > 0 || len(option.Byweekno) > 0 || len(option.Byhour) > 0 || len(option.Byminute) > 0 || len(option.Bymonthday) > 1 || len(option.Bymonth) > 1 || len(option.Bysetpos) > 1 {
+		return nil, fmt.Errorf("recurrence rule %q has no Outlook equivalent", rule)
+	}
+
+	start := times.Start
+	pattern := graphRecurrencePattern{
+		Interval:       max(option.Interval, 1),
+		FirstDayOfWeek: graphWeekdays[option.Wkst.Day()],
+	}
+
+	for _, weekday := range option.Byweekday {
+		pattern.DaysOfWeek = append(pattern.DaysOfWeek, graphWeekdays[weekday.Day()])
+	}
+
+	// Monthly and yearly rules on "the second Tuesday" are relative, others absolute
+	index := 0
+	if len(option.Bysetpos) == 1 {
+		index = option.Bysetpos[0]
+	}
+	for _, weekday := range option.Byweekday {
+		if n := weekday.N(); n != 0 {
+			if index != 0 && index != n {
+				return nil, fmt.Errorf("recurrence rule %q has no Outlook equivalent", rule)
+			}
+			index = n
+		}
+	}
+
+	switch option.Freq {
+	case rrule.DAILY:
+		pattern.Type = "daily"
+		pattern.DaysOfWeek = nil
+	case rrule.WEEKLY:
+		pattern.Type = "weekly"
+		if len(pattern.DaysOfWeek) == 0 {
+			pattern.DaysOfWeek = []string{graphWeekdays[(int(start.Weekday())+6)%7]}
+		}
+	case rrule.MONTHLY, rrule.YEARLY:
+		relative := len(option.Byweekday) > 0
+		if relative {
+			name, ok := graphWeekIndexes[index]
+			if !ok {
+				return nil, fmt.Errorf("recurrence rule %q has no Outlook equivalent", rule)
+			}
+			pattern.Index = name
+		} else {
+			pattern.DayOfMonth = start.Day()
+			if len(option.Bymonthday) == 1 {
+				pattern.DayOfMonth = option.Bymonthday[0]
+			}
+		}
+
+		if option.Freq == rrule.MONTHLY {
+			pattern.Type = map[bool]string{true: "relativeMonthly", false: "absoluteMonthly"}[relative]
+		} else {
+			pattern.Type = map[bool]string{true: "relativeYearly", false: "absoluteYearly"}[relative]
+			pattern.Month = int(start.Month())
+			if len(option.Bymonth) == 1 {
+				pattern.Month = option.Bymonth[0]
+			}
+		}
+	default:
+		return nil, fmt.Errorf("recurrence rule %q has no Outlook equivalent", rule)
+	}
+
+	rangeSpec := graphRecurrenceRange{
+		Type:               "noEnd",
+		StartDate:          start.Format("2006-01-02"),
+		RecurrenceTimeZone: times.TimeZone,
+	}
+	switch {
+	case option.Count > 0:
+		rangeSpec.Type = "numbered"
+		rangeSpec.NumberOfOccurrences = option.Count
+	case !option.Until.IsZero():
+		rangeSpec.Type = "endDate"
+		rangeSpec.EndDate = option.Until.In(loc).Format("2006-01-02")
+	}
+
+	return &graphRecurrence{Pattern: pattern, Range: rangeSpec}, nil
+}
+
+// graphStoredRules keeps the RRULE lines Graph stored, without the dates it dropped
+func graphStoredRules(lines []string) []string {
+	var rules []string
+	for _, line := range lines {
+		if strings.HasPrefix(strings.ToUpper(line), "RRULE") {
+			rules = append(rules, line)
+		}
+	}
+	return rules
+}
+
+// toCalendarEvent converts an event returned by Graph to our model
+func (s *MicrosoftCalendarProvider) toCalendarEvent(event *graphEvent, calendarID string) *models.GoogleCalendarEvent {
+	result := &models.GoogleCalendarEvent{
+		ID:         event.ID,
+		CalendarID: calendarID,
+		ICalUID:    event.ICalUID,
+		Summary:    event.Subject,
+		HTMLLink:   event.WebLink,
+		AllDay:     event.IsAllDay,
+	}
+
+	if event.Body != nil {
+		result.Description = event.Body.Content
+		if strings.EqualFold(event.Body.ContentType, "html") {
+			result.Description = utils.HTMLToText(event.Body.Content)
+		}
+	}
+	if event.Location != nil {
+		result.Location = event.Location.DisplayName
+	}
+
+	// Times come back in the zone Graph names beside them, usually UTC;
+	// report them in the zone the event was created in
+	_, zone, ok := utils.ResolveTimeZone(event.OriginalStartTimeZone)
+	if !ok && event.Start != nil {
+		_, zone, ok = utils.ResolveTimeZone(event.Start.TimeZone)
+	}
+	if !ok {
+		zone = "UTC"
+	}
+	loc, _, _ := utils.ResolveTimeZone(zone)
+
+	start, startOK := parseGraphDateTime(event.Start)
+	end, endOK := parseGraphDateTime(event.End)
+
+	if event.IsAllDay {
+		// Dates are kept as UTC midnights
+		if startOK {
+			start = start.In(loc)
+			result.StartTime = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+		}
+		if endOK {
+			end = end.In(loc)
+			result.EndTime = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+		}
+		result.TimeZone = "UTC"
+	} else {
+		if startOK {
+			result.StartTime = start.In(loc)
+		}
+		if endOK {
+			result.EndTime = end.In(loc)
+		}
+		result.TimeZone = zone
+	}
+
+	if event.IsReminderOn != nil && *event.IsReminderOn && event.ReminderMinutesBeforeStart != nil {
+		result.Reminders = []models.Reminder{{Method: models.ReminderPopup, Minutes: *event.ReminderMinutesBeforeStart}}
+	}
+
+	for _, attendee := range event.Attendees {
+		result.Attendees = append(result.Attendees, models.GoogleCalendarAttendee{
+			Email:       attendee.EmailAddress.Address,
+			DisplayName: attendee.EmailAddress.Name,
+		})
+	}
+
+	return result
+}
+
+func parseGraphDateTime(value *graphDateTime) (time.Time, bool) {
+	if value == nil || value.DateTime == "" {
+		return time.Time{}, false
+	}
+
+	loc := time.UTC
+	if zone, _, ok := utils.ResolveTimeZone(value.TimeZone); ok {
+		loc = zone
+	}
+
+	t, err := time.ParseInLocation(graphDateTimeLayout, value.DateTime, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
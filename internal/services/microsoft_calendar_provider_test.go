@@ -0,0 +1,416 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/models"
+	"github.com/wizenheimer/swiftcal/internal/utils"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+// fakeMicrosoft serves the identity platform's token endpoint and the parts
+// of Graph the provider uses. Graph only accepts the refreshed access token.
+type fakeMicrosoft struct {
+	server *httptest.Server
+
+	mu           sync.Mutex
+	events       map[string]map[string]any
+	transactions map[string]string
+	refreshes    int
+	patches      int
+}
+
+func newFakeMicrosoft(t *testing.T) *fakeMicrosoft {
+	fake := &fakeMicrosoft{events: make(map[string]map[string]any), transactions: make(map[string]string)}
+
+	graph := http.NewServeMux()
+	graph.HandleFunc("GET /me/calendar", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(graphCalendar{ID: "AAMkADdefault", Name: "Calendar", CanEdit: true, IsDefaultCalendar: true})
+	})
+	graph.HandleFunc("GET /me/mailboxSettings", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"timeZone": "GMT Standard Time"})
+	})
+	// Collections come one item to a page, so listing them has to follow
+	// @odata.nextLink
+	graph.HandleFunc("GET /me/calendars", func(w http.ResponseWriter, r *http.Request) {
+		fake.writePage(w, r, []any{
+			graphCalendar{ID: "AAMkADdefault", Name: "Calendar", CanEdit: true, IsDefaultCalendar: true},
+			graphCalendar{ID: "AAMkADfamily", Name: "Family", CanEdit: true},
+			graphCalendar{ID: "AAMkADholidays", Name: "United States holidays"},
+		})
+	})
+	graph.HandleFunc("GET /me/calendars/{calendar}/calendarView", func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		var events []any
+		for _, id := range slices.Sorted(maps.Keys(fake.events)) {
+			events = append(events, fake.events[id])
+		}
+		fake.mu.Unlock()
+
+		fake.writePage(w, r, events)
+	})
+	graph.HandleFunc("POST /me/calendars/{calendar}/events", func(w http.ResponseWriter, r *http.Request) {
+		var event map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			writeGraphError(w, http.StatusBadRequest, "RequestBodyRead")
+			return
+		}
+
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+
+		// A repeated transactionId gets the event it created the first time
+		transactionID, _ := event["transactionId"].(string)
+		if id, ok := fake.transactions[transactionID]; ok {
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(fake.events[id])
+			return
+		}
+
+		id := "AAMkAD" + uuid.NewString()
+		event["id"] = id
+		event["iCalUId"] = "040000008200E00074C5B7101A82E008" + id
+		event["webLink"] = "https://outlook.live.com/owa/?itemid=" + id
+		if start, ok := event["start"].(map[string]any); ok {
+			event["originalStartTimeZone"] = start["timeZone"]
+		}
+		fake.events[id] = event
+		if transactionID != "" {
+			fake.transactions[transactionID] = id
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(event)
+	})
+	graph.HandleFunc("/me/events/{event}", func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+
+		id := r.PathValue("event")
+		event, ok := fake.events[id]
+		if !ok {
+			writeGraphError(w, http.StatusNotFound, "ErrorItemNotFound")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(event)
+		case http.MethodPatch:
+			// Graph changes only the properties sent
+			var patch map[string]any
+			if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+				writeGraphError(w, http.StatusBadRequest, "RequestBodyRead")
+				return
+			}
+			for key, value := range patch {
+				event[key] = value
+			}
+			fake.patches++
+			json.NewEncoder(w).Encode(event)
+		case http.MethodDelete:
+			delete(fake.events, id)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeGraphError(w, http.StatusMethodNotAllowed, "ErrorInvalidRequest")
+		}
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /login/common/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "refresh-1" ||
+			r.FormValue("client_id") != "client-id" || r.FormValue("client_secret") != "client-secret" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		fake.mu.Lock()
+		fake.refreshes++
+		fake.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"token_type":    "Bearer",
+			"access_token":  "fresh-access",
+			"refresh_token": "refresh-2",
+			"expires_in":    3600,
+		})
+	})
+	mux.Handle("/v1.0/", http.StripPrefix("/v1.0", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fresh-access" {
+			writeGraphError(w, http.StatusUnauthorized, "InvalidAuthenticationToken")
+			return
+		}
+		graph.ServeHTTP(w, r)
+	})))
+
+	fake.server = httptest.NewServer(mux)
+	t.Cleanup(fake.server.Close)
+
+	return fake
+}
+
+// writePage serves the item $skip points at, with a link to the next one
+func (f *fakeMicrosoft) writePage(w http.ResponseWriter, r *http.Request, items []any) {
+	skip, _ := strconv.Atoi(r.URL.Query().Get("$skip"))
+	page := map[string]any{"value": items[min(skip, len(items)):min(skip+1, len(items))]}
+	if skip+1 < len(items) {
+		query := r.URL.Query()
+		query.Set("$skip", strconv.Itoa(skip+1))
+		page["@odata.nextLink"] = f.server.URL + "/v1.0" + r.URL.Path + "?" + query.Encode()
+	}
+	json.NewEncoder(w).Encode(page)
+}
+
+func writeGraphError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"code": code, "message": code}})
+}
+
+// expiredMicrosoftToken signs requests with a token that expired an hour
+// ago, as GetOAuthClient does when the refresh has to happen mid-request
+type expiredMicrosoftToken struct {
+	auth *MicrosoftAuthService
+}
+
+func (s expiredMicrosoftToken) GetOAuthClient(ctx context.Context, userID uuid.UUID) (*http.Client, error) {
+	return s.auth.oauthConfig.Client(ctx, &oauth2.Token{
+		AccessToken:  "stale-access",
+		RefreshToken: "refresh-1",
+		Expiry:       time.Now().Add(-time.Hour),
+	}), nil
+}
+
+func TestMicrosoftCalendarProvider(t *testing.T) {
+	fake := newFakeMicrosoft(t)
+	cfg := &config.Config{
+		MicrosoftClientID:     "client-id",
+		MicrosoftClientSecret: "client-secret",
+		MicrosoftTenant:       "common",
+		MicrosoftLoginURL:     fake.server.URL + "/login",
+		MicrosoftGraphURL:     fake.server.URL + "/v1.0",
+	}
+	auth := NewMicrosoftAuthService(nil, cfg, nil)
+	provider := NewMicrosoftCalendarProvider(cfg, expiredMicrosoftToken{auth: auth})
+	ctx := context.Background()
+	userID := uuid.New()
+
+	location := "Room 4"
+	event := &models.Event{
+		Summary:   "Design review",
+		Date:      "20 October 2026",
+		StartTime: "09:00",
+		Location:  &location,
+		Attendees: []string{"priya@example.com"},
+		SourceKey: "mid:priya@example.com:caf=1234@mail.example.com#event:abc",
+	}
+	created, err := provider.AddEvent(ctx, userID, "", event)
+	if err != nil {
+		t.Fatalf("AddEvent: %v", err)
+	}
+	if fake.refreshes == 0 {
+		t.Error("the expired token was never refreshed")
+	}
+
+	// A retry of the same message sends the same transactionId
+	retried, err := provider.AddEvent(ctx, userID, "", event)
+	if err != nil || retried.ID != created.ID || len(fake.events) != 1 {
+		t.Errorf("retried AddEvent = %+v, %v with %d events, want the first event again", retried, err, len(fake.events))
+	}
+
+	// Times without a zone take the mailbox's, given as a Windows name
+	wantStart := time.Date(2026, 10, 20, 8, 0, 0, 0, time.UTC)
+	if created.Summary != "Design review" || created.CalendarID != "AAMkADdefault" || created.HTMLLink == "" {
+		t.Errorf("created = %+v", created)
+	}
+	if !created.StartTime.Equal(wantStart) || created.TimeZone != "Europe/London" {
+		t.Errorf("created at %s in %s, want %s in Europe/London", created.StartTime, created.TimeZone, wantStart)
+	}
+
+	got, err := provider.GetEvent(ctx, userID, created.CalendarID, created.ID)
+	if err != nil || got.ID != created.ID || got.Location != "Room 4" {
+		t.Fatalf("GetEvent = %+v, %v", got, err)
+	}
+
+	// A guest the user invited in Outlook since must survive the update
+	fake.mu.Lock()
+	fake.events[created.ID]["attendees"] = append(fake.events[created.ID]["attendees"].([]any),
+		map[string]any{"emailAddress": map[string]any{"address": "lee@example.com"}, "type": "optional"})
+	fake.mu.Unlock()
+
+	updated, err := provider.UpdateEvent(ctx, userID, created.CalendarID, created.ID, &models.Event{
+		Summary:   "Design review (moved)",
+		Date:      "20 October 2026",
+		StartTime: "11:00",
+		Attendees: []string{"priya@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("UpdateEvent: %v", err)
+	}
+	if fake.patches != 1 {
+		t.Errorf("sent %d PATCH requests, want 1", fake.patches)
+	}
+	if updated.Summary != "Design review (moved)" || !updated.StartTime.Equal(wantStart.Add(2*time.Hour)) {
+		t.Errorf("updated = %q at %s", updated.Summary, updated.StartTime)
+	}
+	if len(updated.Attendees) != 2 {
+		t.Errorf("updated attendees = %+v, want priya and lee", updated.Attendees)
+	}
+
+	if err := provider.DeleteEvent(ctx, userID, created.CalendarID, created.ID); err != nil {
+		t.Fatalf("DeleteEvent: %v", err)
+	}
+
+	// Once deleted, Graph's 404 is reported as ErrEventNotFound, and deleting
+	// again is not an error
+	if _, err := provider.GetEvent(ctx, userID, created.CalendarID, created.ID); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("GetEvent after delete: err = %v, want ErrEventNotFound", err)
+	}
+	if _, err := provider.UpdateEvent(ctx, userID, created.CalendarID, created.ID, &models.Event{Summary: "x", Date: "20 October 2026", StartTime: "09:00"}); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("UpdateEvent after delete: err = %v, want ErrEventNotFound", err)
+	}
+	if err := provider.DeleteEvent(ctx, userID, created.CalendarID, created.ID); err != nil {
+		t.Errorf("deleting again: %v", err)
+	}
+}
+
+func TestMicrosoftAccountIdentity(t *testing.T) {
+	auth := NewMicrosoftAuthService(nil, &config.Config{MicrosoftClientID: "client-id", MicrosoftTenant: "common"}, nil)
+
+	idToken := func(claims map[string]any) string {
+		payload, _ := json.Marshal(claims)
+		return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(payload) + ".c2lnbmF0dXJl"
+	}
+
+	tests := []struct {
+		name    string
+		idToken any
+		tenant  string
+		object  string
+	}{
+		{
+			// mail is whatever the tenant admin set, so only tid and oid count
+			name:    "work account",
+			idToken: idToken(map[string]any{"aud": "client-id", "tid": "72f988bf-86f1-41af-91ab-2d7cd011db47", "oid": "00000000-0000-0000-66f3-3332eca7ea81", "email": "ceo@victim.example"}),
+			tenant:  "72f988bf-86f1-41af-91ab-2d7cd011db47",
+			object:  "00000000-0000-0000-66f3-3332eca7ea81",
+		},
+		{
+			name:    "personal account",
+			idToken: idToken(map[string]any{"aud": "client-id", "tid": "9188040d-6c67-4c5b-b112-36a304b66dad", "oid": "00000000-0000-0000-4a3e-2c1d0e9f8b7a"}),
+			tenant:  "9188040d-6c67-4c5b-b112-36a304b66dad",
+			object:  "00000000-0000-0000-4a3e-2c1d0e9f8b7a",
+		},
+		{name: "issued to another app", idToken: idToken(map[string]any{"aud": "other-app", "tid": "t", "oid": "o"})},
+		{name: "no object ID", idToken: idToken(map[string]any{"aud": "client-id", "tid": "t"})},
+		{name: "no ID token"},
+		{name: "not a JWT", idToken: "opaque"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]any{"id_token": tt.idToken})
+			tenant, object, err := auth.accountIdentity(token)
+			if tt.tenant == "" {
+				if err == nil {
+					t.Errorf("accountIdentity = %q, %q, want an error", tenant, object)
+				}
+				return
+			}
+			if err != nil || tenant != tt.tenant || object != tt.object {
+				t.Errorf("accountIdentity = %q, %q, %v, want %q, %q", tenant, object, err, tt.tenant, tt.object)
+			}
+		})
+	}
+}
+
+func TestMicrosoftOAuthState(t *testing.T) {
+	auth := NewMicrosoftAuthService(nil, &config.Config{JWTSecret: "secret", MicrosoftTenant: "common"}, nil)
+
+	state, cookie, err := auth.NewState("sam@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linkEmail, err := auth.VerifyState(state, cookie); err != nil || linkEmail != "sam@example.org" {
+		t.Errorf("VerifyState = %q, %v, want the address being linked", linkEmail, err)
+	}
+
+	signIn, signInCookie, _ := auth.NewState("")
+	if linkEmail, err := auth.VerifyState(signIn, signInCookie); err != nil || linkEmail != "" {
+		t.Errorf("VerifyState for a sign-in = %q, %v", linkEmail, err)
+	}
+
+	// A callback is refused unless it carries this browser's state
+	linkToken := utils.SignValue("secret", microsoftLinkPurpose, state+" sam@example.org", time.Now().Add(time.Hour))
+	for name, tc := range map[string][2]string{
+		"another sign-in's state": {signIn, cookie},
+		"no state":                {"", cookie},
+		"no cookie":               {state, ""},
+		"literal state":           {"state", cookie},
+		"link token as cookie":    {state, linkToken},
+	} {
+		if _, err := auth.VerifyState(tc[0], tc[1]); err == nil {
+			t.Errorf("%s: VerifyState accepted it", name)
+		}
+	}
+}
+
+func TestMicrosoftListsFollowNextLink(t *testing.T) {
+	fake := newFakeMicrosoft(t)
+	cfg := &config.Config{
+		MicrosoftClientID:     "client-id",
+		MicrosoftClientSecret: "client-secret",
+		MicrosoftTenant:       "common",
+		MicrosoftLoginURL:     fake.server.URL + "/login",
+		MicrosoftGraphURL:     fake.server.URL + "/v1.0",
+	}
+	provider := NewMicrosoftCalendarProvider(cfg, expiredMicrosoftToken{auth: NewMicrosoftAuthService(nil, cfg, nil)})
+	ctx := context.Background()
+	userID := uuid.New()
+
+	calendars, err := provider.ListCalendars(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListCalendars: %v", err)
+	}
+	if len(calendars) != 3 || calendars[2].Name != "United States holidays" || calendars[2].Writable {
+		t.Errorf("ListCalendars = %+v, want all three pages", calendars)
+	}
+
+	for _, summary := range []string{"Design review", "Standup", "Lunch"} {
+		event := &models.Event{Summary: summary, Date: "20 October 2026", StartTime: "09:00"}
+		if _, err := provider.AddEvent(ctx, userID, "", event); err != nil {
+			t.Fatalf("AddEvent(%s): %v", summary, err)
+		}
+	}
+
+	from := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	events, err := provider.ListEvents(ctx, userID, "AAMkADdefault", from, from.AddDate(0, 0, 3))
+	if err != nil {
+		t.Fatalf("ListEvents: %v", err)
+	}
+	if len(events) != 3 {
+		t.Errorf("ListEvents returned %d events, want all three pages", len(events))
+	}
+
+	// The access token only goes to Graph
+	if _, err := provider.nextPage("https://graph.example.net/v1.0/me/calendars?$skip=1"); err == nil {
+		t.Error("nextPage followed a link away from Graph")
+	}
+}
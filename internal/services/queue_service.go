@@ -0,0 +1,350 @@
+// internal/services/queue_service.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/database"
+	"github.com/wizenheimer/swiftcal/internal/models"
+	"github.com/wizenheimer/swiftcal/pkg/logger"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	// jobTimeout bounds one attempt at the pipeline (LLM, calendar and reply)
+	jobTimeout = 5 * time.Minute
+
+	// staleJobAfter is how long a job may stay claimed before it is assumed
+	// orphaned by a crashed worker and handed out again
+	staleJobAfter = 2 * jobTimeout
+
+	backoffBase = 30 * time.Second
+	backoffMax  = time.Hour
+)
+
+// QueueService persists inbound email so webhooks can be acknowledged at once,
+// and runs the email pipeline from worker goroutines with retries.
+type QueueService struct {
+	db           *database.DB
+	config       *config.Config
+	emailService *EmailService
+	wg           sync.WaitGroup
+}
+
+func NewQueueService(db *database.DB, cfg *config.Config, emailService *EmailService) *QueueService {
+	return &QueueService{
+		db:           db,
+		config:       cfg,
+		emailService: emailService,
+	}
+}
+
+// Enqueue stores an inbound email for processing and returns its job ID
+func (s *QueueService) Enqueue(ctx context.Context, webhook *models.EmailWebhook, files []models.EmailFile) (uuid.UUID, error) {
+	webhookJSON, err := json.Marshal(webhook)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to encode webhook: %w", err)
+	}
+
+	filesJSON, err := json.Marshal(files)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to encode files: %w", err)
+	}
+
+	query := `
+		INSERT INTO inbound_jobs (id, webhook, files, status, attempts, max_attempts, run_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, 0, $5, NOW(), NOW(), NOW())
+	`
+
+	id := uuid.New()
+	if _, err := s.db.Pool.Exec(ctx, query, id, webhookJSON, filesJSON, models.JobStatusPending, s.config.QueueMaxAttempts); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to enqueue inbound email: %w", err)
+	}
+
+	logger.GetLogger().Info("Inbound email queued", zap.String("job_id", id.String()))
+	return id, nil
+}
+
+// Start launches the workers and the stale job reaper
+func (s *QueueService) Start(ctx context.Context) {
+	for i := 0; i < s.config.QueueWorkers; i++ {
+		s.wg.Add(1)
+		go s.runWorker(ctx, i)
+	}
+
+	s.wg.Add(1)
+	go s.runReaper(ctx)
+
+	logger.GetLogger().Info("Inbound queue workers started", zap.Int("workers", s.config.QueueWorkers))
+}
+
+// Shutdown waits for in-flight jobs to finish or for ctx to expire
+func (s *QueueService) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *QueueService) runWorker(ctx context.Context, worker int) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.config.QueuePollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain everything that is runnable before waiting for the next tick
+		for ctx.Err() == nil && s.processNext(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.GetLogger().Debug("Inbound queue worker stopped", zap.Int("worker", worker))
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processNext claims and runs one job, reporting whether one was available
+func (s *QueueService) processNext(ctx context.Context) bool {
+	job, err := s.claim(ctx)
+	if err != nil {
+		if err != pgx.ErrNoRows && ctx.Err() == nil {
+			logger.GetLogger().Error("Failed to claim inbound job", zap.Error(err))
+		}
+		return false
+	}
+
+	// Detach from the worker context so shutdown lets the attempt finish
+	jobCtx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+	if job.Attempts < job.MaxAttempts {
+		jobCtx = withRetriesLeft(jobCtx)
+	}
+
+	original := job.Webhook
+	err = s.emailService.HandleWebhook(jobCtx, &job.Webhook, job.Files)
+
+	// Handlers redact credentials from the webhook once they have read them
+	if job.Webhook != original {
+		s.saveWebhook(jobCtx, job)
+	}
+
+	if err == nil {
+		s.complete(jobCtx, job)
+		return true
+	}
+
+	s.fail(jobCtx, job, err)
+	return true
+}
+
+func (s *QueueService) claim(ctx context.Context) (*models.InboundJob, error) {
+	query := `
+		UPDATE inbound_jobs
+		SET status = $1, attempts = attempts + 1, locked_at = NOW(), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM inbound_jobs
+			WHERE status = $2 AND run_at <= NOW()
+			ORDER BY run_at
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING id, webhook, files, attempts, max_attempts
+	`
+
+	job := &models.InboundJob{}
+	err := s.db.Pool.QueryRow(ctx, query, models.JobStatusProcessing, models.JobStatusPending).Scan(
+		&job.ID, &job.Webhook, &job.Files, &job.Attempts, &job.MaxAttempts,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (s *QueueService) saveWebhook(ctx context.Context, job *models.InboundJob) {
+	webhookJSON, err := json.Marshal(job.Webhook)
+	if err != nil {
+		logger.GetLogger().Error("Failed to encode redacted webhook", zap.Error(err), zap.String("job_id", job.ID.String()))
+		return
+	}
+
+	query := `UPDATE inbound_jobs SET webhook = $1, updated_at = NOW() WHERE id = $2`
+	if _, err := s.db.Pool.Exec(ctx, query, webhookJSON, job.ID); err != nil {
+		logger.GetLogger().Error("Failed to save redacted webhook", zap.Error(err), zap.String("job_id", job.ID.String()))
+	}
+}
+
+func (s *QueueService) complete(ctx context.Context, job *models.InboundJob) {
+	query := `
+		UPDATE inbound_jobs
+		SET status = $1, locked_at = NULL, last_error = NULL, updated_at = NOW()
+		WHERE id = $2
+	`
+
+	if _, err := s.db.Pool.Exec(ctx, query, models.JobStatusDone, job.ID); err != nil {
+		logger.GetLogger().Error("Failed to mark inbound job done", zap.Error(err), zap.String("job_id", job.ID.String()))
+		return
+	}
+
+	logger.GetLogger().Info("Inbound job processed",
+		zap.String("job_id", job.ID.String()),
+		zap.Int("attempts", job.Attempts))
+}
+
+func (s *QueueService) fail(ctx context.Context, job *models.InboundJob, jobErr error) {
+	status := models.JobStatusPending
+	runAt := time.Now().Add(backoff(job.Attempts))
+	if job.Attempts >= job.MaxAttempts {
+		status = models.JobStatusDead
+	}
+
+	query := `
+		UPDATE inbound_jobs
+		SET status = $1, run_at = $2, last_error = $3, locked_at = NULL, updated_at = NOW()
+		WHERE id = $4
+	`
+
+	if _, err := s.db.Pool.Exec(ctx, query, status, runAt, jobErr.Error(), job.ID); err != nil {
+		logger.GetLogger().Error("Failed to record inbound job failure", zap.Error(err), zap.String("job_id", job.ID.String()))
+		return
+	}
+
+	if status == models.JobStatusDead {
+		logger.GetLogger().Error("Inbound job moved to dead letter",
+			zap.Error(jobErr),
+			zap.String("job_id", job.ID.String()),
+			zap.Int("attempts", job.Attempts))
+		return
+	}
+
+	logger.GetLogger().Warn("Inbound job failed, will retry",
+		zap.Error(jobErr),
+		zap.String("job_id", job.ID.String()),
+		zap.Int("attempts", job.Attempts),
+		zap.Time("retry_at", runAt))
+}
+
+// backoff doubles the delay with each attempt, capped and with jitter so a
+// burst of failures doesn't retry in lockstep
+func backoff(attempts int) time.Duration {
+	delay := backoffBase
+	for i := 1; i < attempts && delay < backoffMax; i++ {
+		delay *= 2
+	}
+	if delay > backoffMax {
+		delay = backoffMax
+	}
+
+	return delay + time.Duration(rand.Int63n(int64(delay/4)+1))
+}
+
+func (s *QueueService) runReaper(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.requeueStaleJobs(ctx)
+		}
+	}
+}
+
+func (s *QueueService) requeueStaleJobs(ctx context.Context) {
+	query := `
+		UPDATE inbound_jobs
+		SET status = CASE WHEN attempts >= max_attempts THEN $1 ELSE $2 END,
+			last_error = 'worker stopped before finishing', locked_at = NULL, updated_at = NOW()
+		WHERE status = $3 AND locked_at < $4
+	`
+
+	result, err := s.db.Pool.Exec(ctx, query,
+		models.JobStatusDead, models.JobStatusPending, models.JobStatusProcessing, time.Now().Add(-staleJobAfter),
+	)
+	if err != nil {
+		logger.GetLogger().Error("Failed to requeue stale inbound jobs", zap.Error(err))
+		return
+	}
+
+	if result.RowsAffected() > 0 {
+		logger.GetLogger().Warn("Requeued stale inbound jobs", zap.Int64("count", result.RowsAffected()))
+	}
+}
+
+// ListJobs returns the most recent jobs in the given state, newest first.
+// Only the sender, recipient and subject of each email are read, never its body.
+func (s *QueueService) ListJobs(ctx context.Context, status string, limit int) ([]*models.InboundJob, error) {
+	query := `
+		SELECT id, webhook->>'from', webhook->>'to', webhook->>'subject', status, attempts, max_attempts, last_error, run_at, locked_at, created_at, updated_at
+		FROM inbound_jobs
+		WHERE status = $1
+		ORDER BY updated_at DESC
+		LIMIT $2
+	`
+
+	rows, err := s.db.Pool.Query(ctx, query, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*models.InboundJob
+	for rows.Next() {
+		job := &models.InboundJob{}
+		err := rows.Scan(
+			&job.ID, &job.From, &job.To, &job.Subject, &job.Status, &job.Attempts, &job.MaxAttempts,
+			&job.LastError, &job.RunAt, &job.LockedAt, &job.CreatedAt, &job.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// RetryJob puts a dead job back in the queue with a fresh set of attempts
+func (s *QueueService) RetryJob(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE inbound_jobs
+		SET status = $1, attempts = 0, run_at = NOW(), locked_at = NULL, updated_at = NOW()
+		WHERE id = $2 AND status = $3
+	`
+
+	result, err := s.db.Pool.Exec(ctx, query, models.JobStatusPending, id, models.JobStatusDead)
+	if err != nil {
+		return fmt.Errorf("failed to retry job: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
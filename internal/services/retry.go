@@ -0,0 +1,86 @@
+// internal/services/retry.go
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/openai/openai-go"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+// retriesLeftKey marks the context of a job attempt the queue will retry if
+// it fails
+type retriesLeftKey struct{}
+
+func withRetriesLeft(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retriesLeftKey{}, true)
+}
+
+// canRetry reports whether a temporary failure can be left to the queue.
+// Without retries the user is told about it instead.
+func canRetry(ctx context.Context) bool {
+	retry, _ := ctx.Value(retriesLeftKey{}).(bool)
+	return retry
+}
+
+// isTemporaryError reports whether a call failed in a way that trying again
+// later may fix: a timeout, a network error, rate limiting or a server error.
+// Rejected credentials and bad requests are permanent.
+func isTemporaryError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	// A refresh the token endpoint answered with invalid_grant needs the user
+	// to sign in again, and a private CalDAV address stays private
+	var tokenErr *oauth2.RetrieveError
+	if errors.As(err, &tokenErr) {
+		return tokenErr.Response != nil && isTemporaryStatus(tokenErr.Response.StatusCode)
+	}
+	if errors.Is(err, errCalDAVAddressNotAllowed) {
+		return false
+	}
+
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) {
+		for _, item := range googleErr.Errors {
+			if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+				return true
+			}
+		}
+		return isTemporaryStatus(googleErr.Code)
+	}
+
+	var apiErr *graphError
+	if errors.As(err, &apiErr) {
+		return isTemporaryStatus(apiErr.StatusCode)
+	}
+
+	var davErr *caldavError
+	if errors.As(err, &davErr) {
+		return isTemporaryStatus(davErr.StatusCode)
+	}
+
+	var openaiErr *openai.Error
+	if errors.As(err, &openaiErr) {
+		return isTemporaryStatus(openaiErr.StatusCode)
+	}
+
+	// Checked after the errors above, which can arrive inside a *url.Error.
+	// Any other failure to reach the server at all is worth another try.
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func isTemporaryStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+func TestIsTemporaryError(t *testing.T) {
+	refused := &url.Error{Op: "Post", URL: "https://www.googleapis.com/calendar/v3/calendars/primary/events", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+	openaiError := func(status int) *openai.Error {
+		req, _ := http.NewRequest(http.MethodPost, "https://api.openai.com/v1/chat/completions", nil)
+		return &openai.Error{StatusCode: status, Request: req, Response: &http.Response{StatusCode: status}}
+	}
+	invalidGrant := &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusBadRequest}, ErrorCode: "invalid_grant"}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "Google server error", err: fmt.Errorf("failed to create event: %w", &googleapi.Error{Code: http.StatusServiceUnavailable}), want: true},
+		{name: "Google rate limit", err: &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}, want: true},
+		{name: "Google forbidden", err: &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}}},
+		{name: "Graph throttling", err: &graphError{StatusCode: http.StatusTooManyRequests, Code: "ApplicationThrottled"}, want: true},
+		{name: "Graph bad request", err: &graphError{StatusCode: http.StatusBadRequest, Code: "ErrorInvalidRequest"}},
+		{name: "CalDAV server error", err: &caldavError{Method: http.MethodPut, StatusCode: http.StatusBadGateway}, want: true},
+		{name: "CalDAV forbidden", err: &caldavError{Method: http.MethodPut, StatusCode: http.StatusForbidden}},
+		{name: "OpenAI rate limit", err: fmt.Errorf("OpenAI API error: %w", openaiError(http.StatusTooManyRequests)), want: true},
+		{name: "OpenAI bad request", err: openaiError(http.StatusBadRequest)},
+		{name: "timeout", err: fmt.Errorf("OpenAI API error: %w", context.DeadlineExceeded), want: true},
+		{name: "connection refused", err: refused, want: true},
+		{name: "revoked refresh token", err: &url.Error{Op: "Post", URL: "https://www.googleapis.com/calendar/v3/calendars/primary/events", Err: invalidGrant}},
+		{name: "token endpoint outage", err: &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusInternalServerError}}, want: true},
+		{name: "private CalDAV address", err: &url.Error{Op: "Put", URL: "http://10.0.0.2/cal/", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errCalDAVAddressNotAllowed}}},
+		{name: "read-only calendar", err: fmt.Errorf("calendar Holidays: %w", ErrCalendarNotWritable)},
+		{name: "unparseable response", err: errors.New("failed to parse OpenAI response: unexpected end of JSON input")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTemporaryError(tt.err); got != tt.want {
+				t.Errorf("isTemporaryError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanRetry(t *testing.T) {
+	if canRetry(context.Background()) {
+		t.Error("canRetry outside the queue = true, want failures reported to the user")
+	}
+	if !canRetry(withRetriesLeft(context.Background())) {
+		t.Error("canRetry with attempts left = false")
+	}
+}
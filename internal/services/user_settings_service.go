@@ -0,0 +1,66 @@
+// internal/services/user_settings_service.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+	"github.com/wizenheimer/swiftcal/internal/database"
+	"github.com/wizenheimer/swiftcal/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// UserSettingsService stores per-user preferences
+type UserSettingsService struct {
+	db     *database.DB
+	config *config.Config
+}
+
+func NewUserSettingsService(db *database.DB, cfg *config.Config) *UserSettingsService {
+	return &UserSettingsService{
+		db:     db,
+		config: cfg,
+	}
+}
+
+// GetSettings returns the user's settings, or the defaults if they never changed any
+func (s *UserSettingsService) GetSettings(ctx context.Context, userID uuid.UUID) (*models.UserSettings, error) {
+	query := `SELECT user_id, default_reminders, updated_at FROM user_settings WHERE user_id = $1`
+
+	settings := &models.UserSettings{}
+	err := s.db.Pool.QueryRow(ctx, query, userID).Scan(&settings.UserID, &settings.DefaultReminders, &settings.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &models.UserSettings{UserID: userID}, nil
+		}
+		return nil, fmt.Errorf("failed to get user settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+// SetDefaultReminders sets the reminders added to events that don't ask for
+// their own. Nil goes back to the calendar's own defaults.
+func (s *UserSettingsService) SetDefaultReminders(ctx context.Context, userID uuid.UUID, reminders []models.Reminder) error {
+	query := `
+		INSERT INTO user_settings (user_id, default_reminders)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET default_reminders = EXCLUDED.default_reminders, updated_at = NOW()
+	`
+
+	var value any
+	if reminders != nil {
+		value = reminders
+	}
+
+	if _, err := s.db.Pool.Exec(ctx, query, userID, value); err != nil {
+		return fmt.Errorf("failed to set default reminders: %w", err)
+	}
+
+	return nil
+}
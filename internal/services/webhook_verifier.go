@@ -0,0 +1,122 @@
+// internal/services/webhook_verifier.go
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/internal/config"
+)
+
+var (
+	ErrMissingSignature = errors.New("missing webhook signature fields")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrStaleTimestamp   = errors.New("webhook timestamp outside allowed window")
+	ErrReplayedToken    = errors.New("webhook token already used")
+)
+
+// MailgunVerifier checks the HMAC-SHA256 signature Mailgun attaches to every
+// webhook and remembers recently seen tokens so a captured request can't be replayed.
+type MailgunVerifier struct {
+	signingKeys [][]byte
+	maxAge      time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+func NewMailgunVerifier(cfg *config.Config) *MailgunVerifier {
+	keys := make([][]byte, 0, len(cfg.MailgunWebhookSigningKeys))
+	for _, key := range cfg.MailgunWebhookSigningKeys {
+		keys = append(keys, []byte(key))
+	}
+
+	return &MailgunVerifier{
+		signingKeys: keys,
+		maxAge:      cfg.MailgunWebhookMaxAge,
+		seen:        make(map[string]time.Time),
+	}
+}
+
+// Verify validates the timestamp, token and signature fields of a Mailgun
+// webhook. Any configured signing key may match, which allows key rotation.
+func (v *MailgunVerifier) Verify(timestamp, token, signature string) error {
+	if timestamp == "" || token == "" || signature == "" {
+		return ErrMissingSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: malformed timestamp", ErrInvalidSignature)
+	}
+
+	now := time.Now()
+	sentAt := time.Unix(seconds, 0)
+	if now.Sub(sentAt) > v.maxAge || sentAt.Sub(now) > v.maxAge {
+		return ErrStaleTimestamp
+	}
+
+	if !v.matchesAnyKey(timestamp, token, signature) {
+		return ErrInvalidSignature
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.pruneLocked(now)
+
+	if _, exists := v.seen[token]; exists {
+		return ErrReplayedToken
+	}
+
+	// A token only needs to be remembered until its timestamp falls out of the window
+	v.seen[token] = sentAt.Add(v.maxAge)
+
+	return nil
+}
+
+// Release forgets a token so that Mailgun's retry of a request we failed to
+// process is not rejected as a replay.
+func (v *MailgunVerifier) Release(token string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	delete(v.seen, token)
+}
+
+func (v *MailgunVerifier) matchesAnyKey(timestamp, token, signature string) bool {
+	provided, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	for _, key := range v.signingKeys {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(timestamp + token))
+		if hmac.Equal(mac.Sum(nil), provided) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *MailgunVerifier) pruneLocked(now time.Time) {
+	if now.Sub(v.lastPrune) < time.Minute {
+		return
+	}
+
+	for token, expiresAt := range v.seen {
+		if now.After(expiresAt) {
+			delete(v.seen, token)
+		}
+	}
+	v.lastPrune = now
+}
@@ -0,0 +1,51 @@
+// internal/utils/attachments.go
+package utils
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// calendarMimeTypes are the attachment types the event pipeline knows how to import
+var calendarMimeTypes = map[string]bool{
+	"text/calendar":     true,
+	"application/ics":   true,
+	"text/x-vcalendar":  true,
+	"application/x-ics": true,
+}
+
+// calendarExtensions are accepted when the sender only labelled the part generically
+var calendarExtensions = map[string]bool{
+	".ics":  true,
+	".ical": true,
+	".vcs":  true,
+}
+
+// NormalizeMimeType strips parameters such as charset or method and lowercases the type
+func NormalizeMimeType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	return mediaType
+}
+
+// IsCalendarAttachment reports whether an attachment looks like an iCalendar file
+func IsCalendarAttachment(filename, contentType string) bool {
+	mediaType := NormalizeMimeType(contentType)
+	if calendarMimeTypes[mediaType] {
+		return true
+	}
+
+	if !calendarExtensions[strings.ToLower(filepath.Ext(filename))] {
+		return false
+	}
+
+	switch mediaType {
+	case "", "application/octet-stream", "text/plain":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,112 @@
+// internal/utils/calendar_links.go
+package utils
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/internal/models"
+)
+
+const (
+	googleCalendarBaseURL = "https://calendar.google.com/calendar/render"
+	outlookLiveBaseURL    = "https://outlook.live.com/calendar/0/action/compose"
+	outlookOfficeBaseURL  = "https://outlook.office.com/calendar/0/action/compose"
+	yahooCalendarBaseURL  = "https://calendar.yahoo.com/"
+)
+
+// GoogleCalendarURL opens Google Calendar's new event form filled in with the event
+func GoogleCalendarURL(event *models.GoogleCalendarEvent) string {
+	params := url.Values{}
+	params.Set("action", "TEMPLATE")
+	params.Set("text", event.Summary)
+
+	if event.AllDay {
+		params.Set("dates", event.StartTime.Format(icsDateLayout)+"/"+event.EndTime.Format(icsDateLayout))
+	} else {
+		params.Set("dates", utcStamp(event.StartTime)+"/"+utcStamp(event.EndTime))
+		if event.TimeZone != "" {
+			params.Set("ctz", event.TimeZone)
+		}
+	}
+
+	if event.Description != "" {
+		params.Set("details", event.Description)
+	}
+	if event.Location != "" {
+		params.Set("location", event.Location)
+	}
+
+	// Google reads one recurrence rule from the form
+	for _, line := range event.Recurrence {
+		if strings.HasPrefix(strings.ToUpper(line), "RRULE:") {
+			params.Set("recur", line)
+			break
+		}
+	}
+
+	return googleCalendarBaseURL + "?" + params.Encode()
+}
+
+// OutlookCalendarURL opens Outlook on the web's compose form, on outlook.com
+// for personal accounts or on Microsoft 365 for work and school accounts
+func OutlookCalendarURL(event *models.GoogleCalendarEvent, work bool) string {
+	params := url.Values{}
+	params.Set("rru", "addevent")
+	params.Set("subject", event.Summary)
+
+	if event.AllDay {
+		params.Set("startdt", event.StartTime.Format("2006-01-02"))
+		params.Set("enddt", event.EndTime.Format("2006-01-02"))
+		params.Set("allday", "true")
+	} else {
+		params.Set("startdt", event.StartTime.UTC().Format(time.RFC3339))
+		params.Set("enddt", event.EndTime.UTC().Format(time.RFC3339))
+		params.Set("allday", "false")
+	}
+
+	if event.Description != "" {
+		params.Set("body", event.Description)
+	}
+	if event.Location != "" {
+		params.Set("location", event.Location)
+	}
+
+	base := outlookLiveBaseURL
+	if work {
+		base = outlookOfficeBaseURL
+	}
+
+	return base + "?" + params.Encode()
+}
+
+// YahooCalendarURL opens Yahoo Calendar's new event form filled in with the event
+func YahooCalendarURL(event *models.GoogleCalendarEvent) string {
+	params := url.Values{}
+	params.Set("v", "60")
+	params.Set("title", event.Summary)
+
+	if event.AllDay {
+		params.Set("st", event.StartTime.Format(icsDateLayout))
+		// Yahoo's all-day end date is inclusive
+		params.Set("et", event.EndTime.AddDate(0, 0, -1).Format(icsDateLayout))
+		params.Set("dur", "allday")
+	} else {
+		params.Set("st", utcStamp(event.StartTime))
+		params.Set("et", utcStamp(event.EndTime))
+	}
+
+	if event.Description != "" {
+		params.Set("desc", event.Description)
+	}
+	if event.Location != "" {
+		params.Set("in_loc", event.Location)
+	}
+
+	return yahooCalendarBaseURL + "?" + params.Encode()
+}
+
+func utcStamp(t time.Time) string {
+	return t.UTC().Format(icsDateTimeLayout) + "Z"
+}
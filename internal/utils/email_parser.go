@@ -3,8 +3,12 @@ package utils
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,69 +16,143 @@ import (
 
 	"github.com/emersion/go-ical"
 	"github.com/emersion/go-message"
+	_ "github.com/emersion/go-message/charset"
 	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
 )
 
-func ParseICSFile(content []byte) (*models.Event, error) {
+// ParseICSFile returns every VEVENT in a calendar file. Events that can't be
+// read are skipped; an error is returned only when none could be.
+func ParseICSFile(content []byte) ([]models.Event, error) {
 	reader := strings.NewReader(string(content))
 	cal, err := ical.NewDecoder(reader).Decode()
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode ICS: %w", err)
 	}
 
-	// Find the first event using the Events() method
-	events := cal.Events()
-	if len(events) == 0 {
+	icsEvents := cal.Events()
+	if len(icsEvents) == 0 {
 		return nil, fmt.Errorf("no event found in ICS file")
 	}
 
-	event := events[0]
+	// METHOD:CANCEL withdraws every event in the file
+	cancelled := false
+	if method := cal.Props.Get(ical.PropMethod); method != nil {
+		cancelled = strings.EqualFold(strings.TrimSpace(method.Value), "CANCEL")
+	}
+
+	var events []models.Event
+	var firstErr error
+
+	// Parse series masters before overrides so each override can be cut out
+	// of its series, whatever order the file lists them in
+	zones := newICSTimeZones(cal)
+	masters := make(map[string]int)
+	for _, overrides := range []bool{false, true} {
+		for _, icsEvent := range icsEvents {
+			recurrenceID := icsEvent.Props.Get(ical.PropRecurrenceID)
+			if (recurrenceID != nil) != overrides {
+				continue
+			}
+
+			event, err := parseICSEvent(icsEvent, zones)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+
+			uid := ""
+			if prop := icsEvent.Props.Get(ical.PropUID); prop != nil {
+				uid = prop.Value
+			}
+
+			event.UID = uid
+			if prop := icsEvent.Props.Get(ical.PropSequence); prop != nil {
+				if sequence, err := prop.Int(); err == nil {
+					event.Sequence = sequence
+				}
+			}
+			if prop := icsEvent.Props.Get(ical.PropStatus); prop != nil && strings.EqualFold(prop.Value, "CANCELLED") {
+				event.Cancelled = true
+			}
+			event.Cancelled = event.Cancelled || cancelled
+
+			if recurrenceID != nil {
+				if parsed, err := zones.parse(recurrenceID); err == nil {
+					event.RecurrenceID = icsRecurrenceKey(parsed)
+				}
+			}
+
+			if recurrenceID == nil {
+				if uid != "" && len(event.Recurrence) > 0 {
+					masters[uid] = len(events)
+				}
+			} else if index, ok := masters[uid]; ok {
+				// The override is added as its own event in place of that occurrence
+				masterZone := ""
+				if events[index].TimeZone != nil {
+					masterZone = *events[index].TimeZone
+				}
+				events[index].Recurrence = append(events[index].Recurrence, zones.recurrenceLine(ical.PropExceptionDates, recurrenceID, masterZone))
+			}
+
+			events = append(events, *event)
+		}
+	}
+
+	if len(events) == 0 {
+		return nil, firstErr
+	}
 
+	return events, nil
+}
+
+func parseICSEvent(event ical.Event, zones *icsTimeZones) (*models.Event, error) {
 	// Extract event details
 	summary := ""
 	if prop := event.Props.Get("SUMMARY"); prop != nil {
-		summary = prop.Value
+		summary = icsText(prop)
 	}
 
 	description := ""
 	if prop := event.Props.Get("DESCRIPTION"); prop != nil {
-		description = prop.Value
+		description = icsText(prop)
 	}
 
 	location := ""
 	if prop := event.Props.Get("LOCATION"); prop != nil {
-		location = prop.Value
+		location = icsText(prop)
 	}
 
-	// Parse start time
-	startProp := event.Props.Get("DTSTART")
+	// Resolve start and end against their own zones
+	startProp := event.Props.Get(ical.PropDateTimeStart)
 	if startProp == nil {
 		return nil, fmt.Errorf("no start time found")
 	}
 
-	startTime, err := time.Parse("20060102T150405Z", startProp.Value)
+	start, err := zones.parse(startProp)
 	if err != nil {
-		// Try without timezone
-		startTime, err = time.Parse("20060102T150405", startProp.Value)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse start time: %w", err)
-		}
+		return nil, fmt.Errorf("failed to parse start time: %w", err)
 	}
 
-	// Parse end time
-	var endTime *time.Time
-	if endProp := event.Props.Get("DTEND"); endProp != nil {
-		if et, err := time.Parse("20060102T150405Z", endProp.Value); err == nil {
-			endTime = &et
-		} else if et, err := time.Parse("20060102T150405", endProp.Value); err == nil {
-			endTime = &et
+	var end *time.Time
+	if endProp := event.Props.Get(ical.PropDateTimeEnd); endProp != nil {
+		if parsed, err := zones.parse(endProp); err == nil {
+			// Express the end in the start's zone, so "10:00 New York to
+			// 16:00 London" becomes one wall clock range
+			endTime := parsed.Time
+			if start.Zone != "" && parsed.Zone != "" {
+				endTime = endTime.In(start.Time.Location())
+			}
+			end = &endTime
+		}
+	} else if durationProp := event.Props.Get(ical.PropDuration); durationProp != nil {
+		if duration, err := durationProp.Duration(); err == nil {
+			endTime := start.Time.Add(duration)
+			end = &endTime
 		}
-	}
-
-	// Get timezone
-	timezone := "UTC"
-	if tzParam := startProp.Params.Get("TZID"); tzParam != "" {
-		timezone = tzParam
 	}
 
 	// Extract attendees
@@ -95,70 +173,406 @@ func ParseICSFile(content []byte) (*models.Event, error) {
 		Summary:     summary,
 		Description: &description,
 		Location:    &location,
-		Date:        startTime.Format("2 January 2006"),
-		StartTime:   startTime.Format("15:04"),
-		TimeZone:    &timezone,
+		Date:        start.Time.Format("2 January 2006"),
+		AllDay:      start.AllDay,
 		Attendees:   attendees,
 	}
 
-	if endTime != nil {
-		endTimeStr := endTime.Format("15:04")
-		modelEvent.EndTime = &endTimeStr
+	// Floating and date-only events keep no zone, so the calendar's own applies
+	if start.Zone != "" {
+		modelEvent.TimeZone = &start.Zone
+	}
+
+	if start.AllDay {
+		// DTEND is exclusive for dates, so a one-day event ends the next day
+		if end != nil && end.After(start.Time.AddDate(0, 0, 1)) {
+			endDate := end.AddDate(0, 0, -1).Format("2 January 2006")
+			modelEvent.EndDate = &endDate
+		}
+	} else {
+		modelEvent.StartTime = start.Time.Format("15:04")
+
+		if end != nil && end.After(start.Time) {
+			endTimeStr := end.Format("15:04")
+			modelEvent.EndTime = &endTimeStr
+
+			if end.Format("2006-01-02") != start.Time.Format("2006-01-02") {
+				endDate := end.Format("2 January 2006")
+				modelEvent.EndDate = &endDate
+			}
+		}
+	}
+
+	// Recurrence rules pass through as written; dates are rewritten into zones
+	// the calendar understands
+	for _, prop := range event.Props.Values(ical.PropRecurrenceRule) {
+		modelEvent.Recurrence = append(modelEvent.Recurrence, icsPropertyLine(ical.PropRecurrenceRule, &prop))
+	}
+	for _, name := range []string{ical.PropExceptionDates, ical.PropRecurrenceDates} {
+		for _, prop := range event.Props.Values(name) {
+			modelEvent.Recurrence = append(modelEvent.Recurrence, zones.recurrenceLine(name, &prop, start.Zone))
+		}
 	}
 
+	modelEvent.Reminders = icsReminders(event.Component, start, end, zones)
+
 	return modelEvent, nil
 }
 
-func ParseEmailMessage(raw []byte) (*message.Header, string, string, error) {
-	reader := strings.NewReader(string(raw))
-	entity, err := message.Read(reader)
+// icsReminders turns an event's VALARMs into reminders, counted in minutes
+// before the start. Email alarms stay email; display and audio alarms become
+// popups. Alarms that would fire after the event starts are dropped.
+func icsReminders(event *ical.Component, start icsTime, end *time.Time, zones *icsTimeZones) []models.Reminder {
+	var reminders []models.Reminder
+
+	for _, alarm := range event.Children {
+		if alarm.Name != ical.CompAlarm {
+			continue
+		}
+
+		trigger := alarm.Props.Get(ical.PropTrigger)
+		if trigger == nil {
+			continue
+		}
+
+		var before time.Duration
+		if trigger.ValueType() == ical.ValueDateTime {
+			at, err := zones.parse(trigger)
+			if err != nil {
+				continue
+			}
+			before = start.Time.Sub(at.Time)
+		} else {
+			offset, err := trigger.Duration()
+			if err != nil {
+				continue
+			}
+			// RELATED=END counts from the end, so it is further from the start
+			if strings.EqualFold(trigger.Params.Get(ical.ParamRelated), "END") && end != nil {
+				offset += end.Sub(start.Time)
+			}
+			before = -offset
+		}
+
+		if before < 0 {
+			continue
+		}
+
+		method := models.ReminderPopup
+		if action := alarm.Props.Get(ical.PropAction); action != nil && strings.EqualFold(action.Value, "EMAIL") {
+			method = models.ReminderEmail
+		}
+
+		reminders = append(reminders, models.Reminder{Method: method, Minutes: int(before / time.Minute)})
+	}
+
+	return NormalizeReminders(reminders)
+}
+
+// icsText unescapes a TEXT value such as "Lunch\, then talks", keeping the
+// raw value if it isn't valid escaped text
+func icsText(prop *ical.Prop) string {
+	if text, err := prop.Text(); err == nil {
+		return text
+	}
+	return prop.Value
+}
+
+// icsRecurrenceKey names an occurrence the same way whichever zone the
+// RECURRENCE-ID was written in
+func icsRecurrenceKey(t icsTime) string {
+	if t.AllDay {
+		return t.Time.Format(icsDateLayout)
+	}
+	return t.Time.UTC().Format(icsDateTimeLayout) + "Z"
+}
+
+// icsPropertyLine renders a property as an unfolded content line such as
+// "EXDATE;TZID=Europe/Berlin:20240604T090000", the form Google's recurrence expects
+func icsPropertyLine(name string, prop *ical.Prop) string {
+	keys := make([]string, 0, len(prop.Params))
+	for key := range prop.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	builder.WriteString(name)
+	for _, key := range keys {
+		builder.WriteString(";" + key + "=" + strings.Join(prop.Params[key], ","))
+	}
+	builder.WriteString(":" + prop.Value)
+
+	return builder.String()
+}
+
+// maxMIMEDepth bounds recursion through nested multiparts and attached messages
+const maxMIMEDepth = 10
+
+// ParsedEmail is the content recovered from walking a message's MIME tree
+type ParsedEmail struct {
+	Header      mail.Header
+	Text        string
+	HTML        string
+	Attachments []models.EmailFile
+}
+
+func ParseEmailMessage(raw []byte) (*ParsedEmail, error) {
+	entity, err := message.Read(bytes.NewReader(raw))
+	if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+		return nil, fmt.Errorf("failed to parse email: %w", err)
+	}
+
+	parsed := &ParsedEmail{Header: mail.Header{Header: entity.Header}}
+
+	var text, html []string
+	if err := walkEntity(entity, parsed, &text, &html, 0); err != nil {
+		return nil, err
+	}
+
+	parsed.Text = strings.Join(text, "\n\n")
+	parsed.HTML = strings.Join(html, "\n")
+
+	return parsed, nil
+}
+
+func walkEntity(entity *message.Entity, parsed *ParsedEmail, text, html *[]string, depth int) error {
+	if depth > maxMIMEDepth {
+		return fmt.Errorf("email nesting exceeds %d levels", maxMIMEDepth)
+	}
+
+	if mr := entity.MultipartReader(); mr != nil {
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+				return fmt.Errorf("failed to read mail part: %w", err)
+			}
+
+			if err := walkEntity(part, parsed, text, html, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	mediaType, typeParams, _ := entity.Header.ContentType()
+	disposition, dispositionParams, _ := entity.Header.ContentDisposition()
+
+	filename := dispositionParams["filename"]
+	if filename == "" {
+		filename = typeParams["name"]
+	}
+
+	body, err := io.ReadAll(entity.Body)
 	if err != nil {
-		return nil, "", "", fmt.Errorf("failed to parse email: %w", err)
+		return fmt.Errorf("failed to read mail body: %w", err)
 	}
 
-	// Create mail reader
-	mailReader := mail.NewReader(entity)
+	switch {
+	case mediaType == "message/rfc822":
+		// Forwarded-as-attachment messages carry the real content, so inline them
+		// the same way a client renders an inline forward
+		inner, err := message.Read(bytes.NewReader(body))
+		if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+			return fmt.Errorf("failed to parse attached message: %w", err)
+		}
+		*text = append(*text, forwardedHeaderBlock(mail.Header{Header: inner.Header}))
+		return walkEntity(inner, parsed, text, html, depth+1)
+
+	case IsCalendarAttachment(filename, mediaType):
+		// Outlook sends invites as an inline text/calendar alternative with no filename
+		if filename == "" {
+			filename = "invite.ics"
+		}
+		parsed.Attachments = append(parsed.Attachments, models.EmailFile{
+			Filename: filename,
+			Content:  body,
+			MimeType: mediaType,
+		})
+
+	case disposition == "attachment" || (filename != "" && !strings.HasPrefix(mediaType, "text/")):
+		parsed.Attachments = append(parsed.Attachments, models.EmailFile{
+			Filename: filename,
+			Content:  body,
+			MimeType: mediaType,
+		})
+
+	case mediaType == "text/html":
+		*html = append(*html, string(body))
 
-	// Read the first part (should be the main message)
-	part, err := mailReader.NextPart()
-	if err != nil && err != io.EOF {
-		return nil, "", "", fmt.Errorf("failed to read mail part: %w", err)
+	case mediaType == "text/plain" || mediaType == "":
+		*text = append(*text, string(body))
 	}
 
-	var textBody, htmlBody string
+	return nil
+}
 
-	// Read all parts to find text and HTML content
-	for part != nil {
-		switch h := part.Header.(type) {
-		case *mail.InlineHeader:
-			contentType := h.Get("Content-Type")
-			if strings.Contains(contentType, "text/plain") {
-				scanner := bufio.NewScanner(part.Body)
-				var lines []string
-				for scanner.Scan() {
-					lines = append(lines, scanner.Text())
-				}
-				textBody = strings.Join(lines, "\n")
-			} else if strings.Contains(contentType, "text/html") {
-				scanner := bufio.NewScanner(part.Body)
-				var lines []string
-				for scanner.Scan() {
-					lines = append(lines, scanner.Text())
-				}
-				htmlBody = strings.Join(lines, "\n")
+func forwardedHeaderBlock(header mail.Header) string {
+	lines := []string{"---------- Forwarded message ---------"}
+	for _, key := range []string{"From", "Date", "Subject", "To", "Cc"} {
+		if value, err := header.Text(key); err == nil && value != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", key, value))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ParseHeaderBlock splits a raw RFC 5322 header section into ordered, decoded pairs
+func ParseHeaderBlock(raw string) ([][2]string, error) {
+	raw = strings.TrimRight(raw, "\r\n") + "\r\n\r\n"
+	header, err := textproto.ReadHeader(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse headers: %w", err)
+	}
+
+	return headerPairs(mail.Header{Header: message.Header{Header: header}}), nil
+}
+
+func headerPairs(header mail.Header) [][2]string {
+	var pairs [][2]string
+	fields := header.Fields()
+	for fields.Next() {
+		value, err := fields.Text()
+		if err != nil {
+			value = fields.Value()
+		}
+		pairs = append(pairs, [2]string{fields.Key(), value})
+	}
+	return pairs
+}
+
+// HeaderValue returns the first value of key in a "Key: value" header string
+func HeaderValue(headers, key string) string {
+	for _, line := range strings.Split(headers, "\n") {
+		colon := strings.Index(line, ":")
+		if colon > 0 && strings.EqualFold(strings.TrimSpace(line[:colon]), key) {
+			return strings.TrimSpace(line[colon+1:])
+		}
+	}
+	return ""
+}
+
+// ReceivedSPF is a Received-SPF header (RFC 7208 section 9.1)
+type ReceivedSPF struct {
+	Result string
+	// Receiver is the receiver= key, or the host the comment starts with
+	Receiver string
+	// Domain is the one SPF was checked for: the envelope sender's, or the
+	// HELO name's for bounces
+	Domain string
+}
+
+// ParseReceivedSPF reads a Received-SPF value such as "pass (mx.example.com:
+// domain of bob@example.org designates 192.0.2.1 as permitted sender)
+// client-ip=192.0.2.1; envelope-from=bob@example.org; receiver=mx.example.com"
+func ParseReceivedSPF(value string) ReceivedSPF {
+	var spf ReceivedSPF
+
+	value = strings.TrimSpace(value)
+	result, rest, _ := strings.Cut(value, " ")
+	spf.Result = strings.ToLower(strings.TrimSpace(result))
+
+	rest = strings.TrimSpace(rest)
+	if strings.HasPrefix(rest, "(") {
+		comment, after, found := strings.Cut(rest[1:], ")")
+		if found {
+			if host, _, ok := strings.Cut(comment, ":"); ok && !strings.ContainsAny(strings.TrimSpace(host), " \t") {
+				spf.Receiver = strings.ToLower(strings.TrimSpace(host))
 			}
+			rest = after
+		}
+	}
+
+	params := make(map[string]string)
+	for _, part := range strings.Split(rest, ";") {
+		if key, val, ok := strings.Cut(part, "="); ok {
+			params[strings.ToLower(strings.TrimSpace(key))] = strings.Trim(strings.TrimSpace(val), `"<>`)
+		}
+	}
+
+	if receiver := params["receiver"]; receiver != "" {
+		spf.Receiver = strings.ToLower(receiver)
+	}
+
+	if from := params["envelope-from"]; from != "" && params["identity"] != "helo" {
+		if at := strings.LastIndex(from, "@"); at >= 0 {
+			from = from[at+1:]
+		}
+		spf.Domain = strings.ToLower(from)
+	} else if params["identity"] == "helo" {
+		spf.Domain = strings.ToLower(params["helo"])
+	}
+
+	return spf
+}
+
+// FormatHeaders renders header pairs in the "Key: value" line format the email
+// service reads, adding In-Reply-To and References so replies thread correctly.
+func FormatHeaders(pairs [][2]string) string {
+	var builder strings.Builder
+	var messageID, existingReferences string
+
+	for _, pair := range pairs {
+		builder.WriteString(fmt.Sprintf("%s: %s\n", pair[0], pair[1]))
+
+		if strings.EqualFold(pair[0], "Message-Id") {
+			messageID = pair[1]
+		}
+		if strings.EqualFold(pair[0], "References") {
+			existingReferences = pair[1]
+		}
+	}
+
+	// Add threading headers for responses
+	if messageID != "" {
+		builder.WriteString(fmt.Sprintf("In-Reply-To: %s\n", messageID))
+
+		if existingReferences != "" {
+			builder.WriteString(fmt.Sprintf("References: %s %s\n", existingReferences, messageID))
+		} else {
+			builder.WriteString(fmt.Sprintf("References: %s\n", messageID))
 		}
+	}
+
+	return builder.String()
+}
+
+// BuildEmailWebhook converts a parsed message into the provider-neutral webhook
+// model. The envelope recipients fall back to the To header. The envelope
+// sender is left empty when unknown: the From header is the sender's to choose,
+// so it can't stand in for the address SPF checked.
+func BuildEmailWebhook(parsed *ParsedEmail, sender string, recipients []string) *models.EmailWebhook {
+	webhook := &models.EmailWebhook{
+		Text: parsed.Text,
+		HTML: parsed.HTML,
+	}
 
-		part, err = mailReader.NextPart()
-		if err != nil && err != io.EOF {
-			return nil, "", "", fmt.Errorf("failed to read next mail part: %w", err)
+	webhook.Subject, _ = parsed.Header.Subject()
+	webhook.From, _ = parsed.Header.Text("From")
+
+	if len(recipients) == 0 {
+		if to, err := parsed.Header.AddressList("To"); err == nil {
+			for _, address := range to {
+				recipients = append(recipients, address.Address)
+			}
 		}
 	}
+	webhook.To = strings.Join(recipients, ", ")
+
+	if date, err := parsed.Header.Date(); err == nil {
+		webhook.Timestamp = strconv.FormatInt(date.Unix(), 10)
+	}
+
+	webhook.Headers = FormatHeaders(headerPairs(parsed.Header))
 
-	// If no HTML body found, use text body
-	if htmlBody == "" {
-		htmlBody = textBody
+	envelope := map[string]interface{}{
+		"from": sender,
+		"to":   recipients,
 	}
+	envelopeBytes, _ := json.Marshal(envelope)
+	webhook.Envelope = string(envelopeBytes)
 
-	return &entity.Header, textBody, htmlBody, nil
+	return webhook
 }
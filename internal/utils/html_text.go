@@ -0,0 +1,194 @@
+// internal/utils/html_text.go
+package utils
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	htmlWhitespaceRegex = regexp.MustCompile(`\s+`)
+	blankLinesRegex     = regexp.MustCompile(`\n{3,}`)
+)
+
+// Elements that start and end on their own line
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true, atom.Blockquote: true,
+	atom.Center: true, atom.Dd: true, atom.Div: true, atom.Dl: true, atom.Dt: true,
+	atom.Fieldset: true, atom.Figcaption: true, atom.Figure: true, atom.Footer: true,
+	atom.Form: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true,
+	atom.H5: true, atom.H6: true, atom.Header: true, atom.Hr: true, atom.Main: true,
+	atom.Nav: true, atom.Ol: true, atom.P: true, atom.Pre: true, atom.Section: true,
+	atom.Table: true, atom.Tbody: true, atom.Thead: true, atom.Tfoot: true, atom.Ul: true,
+}
+
+// Elements whose content is never shown
+var hiddenElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Title: true,
+	atom.Noscript: true, atom.Template: true,
+}
+
+// HTMLToText renders an HTML email body as plain text for extraction. It keeps
+// line structure, writes table rows as " | " separated cells and keeps link
+// targets next to their text.
+func HTMLToText(content string) string {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return ""
+	}
+
+	var builder strings.Builder
+	renderHTMLNode(&builder, doc, false)
+
+	lines := strings.Split(builder.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+
+	return strings.TrimSpace(blankLinesRegex.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+func renderHTMLNode(builder *strings.Builder, node *html.Node, preformatted bool) {
+	switch node.Type {
+	case html.TextNode:
+		text := node.Data
+		if !preformatted {
+			text = htmlWhitespaceRegex.ReplaceAllString(text, " ")
+			// Don't start a line with the space left over from source indentation
+			if endsWithNewline(builder) {
+				text = strings.TrimLeft(text, " ")
+			}
+		}
+		builder.WriteString(text)
+		return
+	case html.CommentNode, html.DoctypeNode:
+		return
+	case html.ElementNode:
+		if hiddenElements[node.DataAtom] || isHiddenElement(node) {
+			return
+		}
+	}
+
+	switch node.DataAtom {
+	case atom.Br:
+		builder.WriteString("\n")
+		return
+	case atom.Img:
+		// Image-only emails often put the meaningful text in alt
+		if alt := strings.TrimSpace(htmlAttr(node, "alt")); alt != "" {
+			builder.WriteString(alt + " ")
+		}
+		return
+	case atom.Tr:
+		renderTableRow(builder, node)
+		return
+	case atom.Li:
+		newline(builder)
+		builder.WriteString("- ")
+	case atom.A:
+		renderLink(builder, node, preformatted)
+		return
+	}
+
+	block := node.Type == html.ElementNode && blockElements[node.DataAtom]
+	if block {
+		newline(builder)
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		renderHTMLNode(builder, child, preformatted || node.DataAtom == atom.Pre)
+	}
+
+	if block || node.DataAtom == atom.Li {
+		newline(builder)
+	}
+}
+
+// renderTableRow writes a row on one line. Layout tables, common in marketing
+// mail, nest whole sections inside a cell; those are rendered as blocks instead.
+func renderTableRow(builder *strings.Builder, row *html.Node) {
+	var cells []string
+	for cell := row.FirstChild; cell != nil; cell = cell.NextSibling {
+		if cell.Type != html.ElementNode || (cell.DataAtom != atom.Td && cell.DataAtom != atom.Th) {
+			continue
+		}
+
+		var cellBuilder strings.Builder
+		renderHTMLNode(&cellBuilder, cell, false)
+		text := strings.TrimSpace(cellBuilder.String())
+
+		if strings.Contains(text, "\n") {
+			newline(builder)
+			for _, c := range cells {
+				builder.WriteString(c + "\n")
+			}
+			builder.WriteString(text)
+			newline(builder)
+			cells = nil
+			continue
+		}
+
+		if text != "" {
+			cells = append(cells, text)
+		}
+	}
+
+	if len(cells) > 0 {
+		newline(builder)
+		builder.WriteString(strings.Join(cells, " | "))
+		newline(builder)
+	}
+}
+
+func renderLink(builder *strings.Builder, link *html.Node, preformatted bool) {
+	var textBuilder strings.Builder
+	for child := link.FirstChild; child != nil; child = child.NextSibling {
+		renderHTMLNode(&textBuilder, child, preformatted)
+	}
+	text := strings.TrimSpace(textBuilder.String())
+
+	href := strings.TrimSpace(htmlAttr(link, "href"))
+	if !strings.HasPrefix(href, "http://") && !strings.HasPrefix(href, "https://") {
+		builder.WriteString(text)
+		return
+	}
+
+	switch {
+	case text == "":
+		builder.WriteString(href)
+	case text == href || strings.Contains(text, "\n"):
+		builder.WriteString(text)
+	default:
+		builder.WriteString(text + " (" + href + ")")
+	}
+}
+
+// isHiddenElement catches the preheader text and tracking blocks mail
+// templates hide with inline styles
+func isHiddenElement(node *html.Node) bool {
+	style := strings.ToLower(strings.ReplaceAll(htmlAttr(node, "style"), " ", ""))
+	return strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden")
+}
+
+func htmlAttr(node *html.Node, key string) string {
+	for _, attr := range node.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func newline(builder *strings.Builder) {
+	if builder.Len() > 0 && !endsWithNewline(builder) {
+		builder.WriteString("\n")
+	}
+}
+
+func endsWithNewline(builder *strings.Builder) bool {
+	s := builder.String()
+	return len(s) == 0 || s[len(s)-1] == '\n'
+}
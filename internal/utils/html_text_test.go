@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"os"
+	"testing"
+)
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "hidden preheader and tracking pixel",
+			html: `<body><div style="display: none; max-height: 0">Your booking is confirmed</div>` +
+				`<p>Table for 4 at Dishoom, Saturday 24 October, 19:30.</p>` +
+				`<img src="https://t.example.com/o.gif" width="1" height="1"></body>`,
+			want: "Table for 4 at Dishoom, Saturday 24 October, 19:30.",
+		},
+		{
+			name: "image-only heading keeps its alt text",
+			html: `<p><img src="https://cdn.example.com/h.png" alt="Your appointment is confirmed"></p><p>Wed 21 Oct, 14:15</p>`,
+			want: "Your appointment is confirmed\nWed 21 Oct, 14:15",
+		},
+		{
+			name: "links keep their targets",
+			html: `<p><a href="https://meet.google.com/abc-defg-hij">Join with Google Meet</a> or ` +
+				`<a href="https://example.com/x">https://example.com/x</a> or <a href="mailto:sam@example.org">email Sam</a></p>`,
+			want: "Join with Google Meet (https://meet.google.com/abc-defg-hij) or https://example.com/x or email Sam",
+		},
+		{
+			name: "list items",
+			html: `<ul><li>Check-in: 15:00</li><li>Check-out: 12:00</li></ul>`,
+			want: "- Check-in: 15:00\n- Check-out: 12:00",
+		},
+		{
+			name: "layout table renders its cells as blocks",
+			html: `<table><tr><td><p>Departure</p><p>SFO 19:40</p></td><td>Gate G93</td></tr></table>`,
+			want: "Departure\nSFO 19:40\nGate G93",
+		},
+		{
+			name: "preformatted text keeps its spacing",
+			html: `<pre>Date:   20 Oct
+Time:   09:00</pre>`,
+			want: "Date:   20 Oct\nTime:   09:00",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTMLToText(tt.html); got != tt.want {
+				t.Errorf("HTMLToText =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+// An Outlook reply has no text/plain part: Word's HTML, a bordered div for
+// the quoted headers and tables built from MsoNormal paragraphs
+func TestHTMLToTextOutlookReply(t *testing.T) {
+	body, err := os.ReadFile("testdata/outlook_reply.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Hi Priya,\n\n" +
+		"Thursday 22 October at 15:00 works. I’ve booked the Thames room.\n\n" +
+		"Sam\n\n" +
+		"From: Priya Shah <priya@example.com>\n" +
+		"Sent: Tuesday, October 13, 2026 4:12 PM\n" +
+		"To: Sam Lee <sam@example.org>\n" +
+		"Subject: Design review\n\n" +
+		"Could we meet this week to go through the mocks?\n" +
+		"Option | When\n" +
+		"A | Wed 21 Oct, 10:00\n" +
+		"B | Thu 22 Oct, 15:00\n" +
+		"Join the meeting now (https://teams.microsoft.com/l/meetup-join/19%3ameeting_NjQ5)"
+	text := HTMLToText(string(body))
+	if text != want {
+		t.Fatalf("HTMLToText =\n%s\nwant\n%s", text, want)
+	}
+
+	// The text must still split into the reply and the quoted message
+	messages := SplitThread(text)
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, want 2:\n%s", len(messages), FormatThread(messages))
+	}
+	if messages[1].From != "Priya Shah <priya@example.com>" || messages[1].Subject != "Design review" {
+		t.Errorf("quoted message = %+v", messages[1])
+	}
+}
@@ -0,0 +1,362 @@
+// internal/utils/ics_time.go
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/pkg/logger"
+
+	"github.com/emersion/go-ical"
+	"github.com/teambition/rrule-go"
+	"go.uber.org/zap"
+)
+
+const (
+	icsDateLayout     = "20060102"
+	icsDateTimeLayout = "20060102T150405"
+)
+
+// icsTime is a DATE or DATE-TIME value resolved against its time zone
+type icsTime struct {
+	// Time holds the wall clock in the event's zone, or in UTC for floating and
+	// date-only values
+	Time time.Time
+	// Zone is the IANA name, empty for floating and date-only values
+	Zone   string
+	AllDay bool
+}
+
+// icsTimeZones resolves TZIDs for one calendar file, falling back to the
+// VTIMEZONE definitions it embeds when a TZID isn't a known zone name
+type icsTimeZones struct {
+	definitions map[string]*ical.Component
+	// matched caches the IANA zone found for each unnamed definition, empty
+	// when none keeps the same rules
+	matched map[string]string
+}
+
+func newICSTimeZones(cal *ical.Calendar) *icsTimeZones {
+	zones := &icsTimeZones{
+		definitions: make(map[string]*ical.Component),
+		matched:     make(map[string]string),
+	}
+
+	for _, child := range cal.Children {
+		if child.Name != ical.CompTimezone {
+			continue
+		}
+		if tzid := child.Props.Get(ical.PropTimezoneID); tzid != nil {
+			zones.definitions[tzid.Value] = child
+		}
+	}
+
+	return zones
+}
+
+// location finds the IANA zone for a TZID, directly, through the
+// X-LIC-LOCATION hint some producers add to VTIMEZONE, or by finding a zone
+// whose offsets follow the same STANDARD and DAYLIGHT rules
+func (z *icsTimeZones) location(tzid string) (*time.Location, string, bool) {
+	if loc, name, ok := ResolveTimeZone(tzid); ok {
+		return loc, name, true
+	}
+
+	definition, ok := z.definitions[tzid]
+	if !ok {
+		return nil, "", false
+	}
+
+	if hint := definition.Props.Get("X-LIC-LOCATION"); hint != nil {
+		if loc, name, ok := ResolveTimeZone(hint.Value); ok {
+			return loc, name, true
+		}
+	}
+
+	name, ok := z.matched[tzid]
+	if !ok {
+		name = matchVTimezone(definition, time.Now().Year())
+		z.matched[tzid] = name
+		if name == "" {
+			logger.GetLogger().Warn("Reading times in an unrecognised VTIMEZONE in the calendar's zone",
+				zap.String("tzid", tzid))
+		}
+	}
+	if name == "" {
+		return nil, "", false
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, "", false
+	}
+	return loc, name, true
+}
+
+// matchVTimezone finds a zone among those Windows zones map to whose offset
+// agrees with the definition at noon on every day of the year, so Outlook's
+// "Customized Time Zone" keeps switching to summer time with the zone it
+// copied. It returns "" when none does.
+func matchVTimezone(definition *ical.Component, year int) string {
+	var days []time.Time
+	var offsets []int
+	for day := time.Date(year, 1, 1, 12, 0, 0, 0, time.UTC); day.Year() == year; day = day.AddDate(0, 0, 1) {
+		offset, err := vtimezoneOffset(definition, day)
+		if err != nil {
+			return ""
+		}
+		days, offsets = append(days, day), append(offsets, offset)
+	}
+
+	candidates := make([]string, 0, len(windowsZones))
+	seen := make(map[string]bool)
+	for _, name := range windowsZones {
+		if !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+
+	for _, name := range candidates {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			continue
+		}
+
+		matches := true
+		for i, day := range days {
+			wall := time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, loc)
+			if _, offset := wall.Zone(); offset != offsets[i] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// parse reads a DTSTART, DTEND, RECURRENCE-ID or similar property
+func (z *icsTimeZones) parse(prop *ical.Prop) (icsTime, error) {
+	value := strings.TrimSpace(prop.Value)
+
+	if prop.ValueType() == ical.ValueDate || len(value) == len(icsDateLayout) {
+		t, err := time.Parse(icsDateLayout, value)
+		if err != nil {
+			return icsTime{}, fmt.Errorf("invalid date %q: %w", value, err)
+		}
+		return icsTime{Time: t, AllDay: true}, nil
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(icsDateTimeLayout, strings.TrimSuffix(value, "Z"))
+		if err != nil {
+			return icsTime{}, fmt.Errorf("invalid UTC time %q: %w", value, err)
+		}
+		return icsTime{Time: t, Zone: "UTC"}, nil
+	}
+
+	tzid := prop.Params.Get(ical.ParamTimezoneID)
+	if tzid == "" {
+		// Floating time: the same wall clock wherever the reader is
+		t, err := time.Parse(icsDateTimeLayout, value)
+		if err != nil {
+			return icsTime{}, fmt.Errorf("invalid floating time %q: %w", value, err)
+		}
+		return icsTime{Time: t}, nil
+	}
+
+	if loc, name, ok := z.location(tzid); ok {
+		t, err := time.ParseInLocation(icsDateTimeLayout, value, loc)
+		if err != nil {
+			return icsTime{}, fmt.Errorf("invalid time %q: %w", value, err)
+		}
+		return icsTime{Time: t, Zone: name}, nil
+	}
+
+	if _, ok := z.definitions[tzid]; !ok {
+		return icsTime{}, fmt.Errorf("unknown time zone %q", tzid)
+	}
+
+	// A custom zone no known one follows. A fixed offset would drift an hour
+	// at each change to or from summer time, so the wall clock is kept and
+	// read in the calendar's own zone, like a floating time.
+	wall, err := time.Parse(icsDateTimeLayout, value)
+	if err != nil {
+		return icsTime{}, fmt.Errorf("invalid time %q: %w", value, err)
+	}
+
+	return icsTime{Time: wall}, nil
+}
+
+// vtimezoneOffset returns the UTC offset in seconds that a VTIMEZONE gives a
+// wall clock time, taken from the observance with the latest onset before it
+func vtimezoneOffset(definition *ical.Component, wall time.Time) (int, error) {
+	var latest time.Time
+	var offset int
+	var earliest *ical.Component
+	var earliestStart time.Time
+	found := false
+
+	for _, observance := range definition.Children {
+		if observance.Name != ical.CompTimezoneStandard && observance.Name != ical.CompTimezoneDaylight {
+			continue
+		}
+
+		startProp := observance.Props.Get(ical.PropDateTimeStart)
+		toProp := observance.Props.Get(ical.PropTimezoneOffsetTo)
+		if startProp == nil || toProp == nil {
+			continue
+		}
+
+		start, err := time.Parse(icsDateTimeLayout, strings.TrimSuffix(startProp.Value, "Z"))
+		if err != nil {
+			continue
+		}
+
+		if earliest == nil || start.Before(earliestStart) {
+			earliest, earliestStart = observance, start
+		}
+
+		onset, ok := latestOnset(observance, start, wall)
+		if !ok || (found && !onset.After(latest)) {
+			continue
+		}
+
+		to, err := parseUTCOffset(toProp.Value)
+		if err != nil {
+			continue
+		}
+		latest, offset, found = onset, to, true
+	}
+
+	if found {
+		return offset, nil
+	}
+
+	// Before every onset the zone keeps the offset it had before the first one
+	if earliest != nil {
+		if from := earliest.Props.Get(ical.PropTimezoneOffsetFrom); from != nil {
+			return parseUTCOffset(from.Value)
+		}
+	}
+
+	return 0, fmt.Errorf("no usable STANDARD or DAYLIGHT rules")
+}
+
+// latestOnset returns the last time an observance started at or before wall
+func latestOnset(observance *ical.Component, start, wall time.Time) (time.Time, bool) {
+	var latest time.Time
+	found := false
+
+	consider := func(onset time.Time) {
+		if !onset.After(wall) && (!found || onset.After(latest)) {
+			latest, found = onset, true
+		}
+	}
+
+	consider(start)
+
+	for _, prop := range observance.Props.Values(ical.PropRecurrenceDates) {
+		for _, value := range strings.Split(prop.Value, ",") {
+			if onset, err := time.Parse(icsDateTimeLayout, strings.TrimSuffix(value, "Z")); err == nil {
+				consider(onset)
+			}
+		}
+	}
+
+	if ruleProp := observance.Props.Get(ical.PropRecurrenceRule); ruleProp != nil {
+		if option, err := rrule.StrToROption(ruleProp.Value); err == nil {
+			// Outlook starts rules in 1601, beyond what rrule-go iterates, so
+			// begin near the target; yearly rules repeat identically anyway
+			option.Dtstart = start
+			if option.Count == 0 && wall.Year()-start.Year() > 2 {
+				option.Dtstart = start.AddDate(wall.Year()-2-start.Year(), 0, 0)
+			}
+			if rule, err := rrule.NewRRule(*option); err == nil {
+				if onset := rule.Before(wall, true); !onset.IsZero() {
+					consider(onset)
+				}
+			}
+		}
+	}
+
+	return latest, found
+}
+
+// parseUTCOffset reads "+0100", "-0800" or "+053000" as seconds east of UTC
+func parseUTCOffset(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if len(value) != 5 && len(value) != 7 {
+		return 0, fmt.Errorf("invalid UTC offset %q", value)
+	}
+
+	sign := 1
+	switch value[0] {
+	case '+':
+	case '-':
+		sign = -1
+	default:
+		return 0, fmt.Errorf("invalid UTC offset %q", value)
+	}
+
+	hours, err := strconv.Atoi(value[1:3])
+	if err != nil {
+		return 0, fmt.Errorf("invalid UTC offset %q", value)
+	}
+	minutes, err := strconv.Atoi(value[3:5])
+	if err != nil {
+		return 0, fmt.Errorf("invalid UTC offset %q", value)
+	}
+
+	seconds := 0
+	if len(value) == 7 {
+		if seconds, err = strconv.Atoi(value[5:7]); err != nil {
+			return 0, fmt.Errorf("invalid UTC offset %q", value)
+		}
+	}
+
+	return sign * (hours*3600 + minutes*60 + seconds), nil
+}
+
+// recurrenceLine renders an EXDATE or RDATE so Google can read it: TZIDs are
+// rewritten to IANA names, values in unrecognised zones float like the event
+// start, and floating values take the event's own zone
+func (z *icsTimeZones) recurrenceLine(name string, prop *ical.Prop, eventZone string) string {
+	if prop.ValueType() == ical.ValueDate || prop.ValueType() == ical.ValuePeriod {
+		return icsPropertyLine(name, prop)
+	}
+
+	tzid := prop.Params.Get(ical.ParamTimezoneID)
+	if tzid == "" {
+		if eventZone == "" || eventZone == "UTC" || strings.HasSuffix(prop.Value, "Z") {
+			return icsPropertyLine(name, prop)
+		}
+
+		zoned := *prop
+		zoned.Params = ical.Params{}
+		zoned.Params.Set(ical.ParamTimezoneID, eventZone)
+		return icsPropertyLine(name, &zoned)
+	}
+
+	if _, iana, ok := z.location(tzid); ok {
+		zoned := *prop
+		zoned.Params = ical.Params{}
+		for key, values := range prop.Params {
+			zoned.Params[key] = values
+		}
+		zoned.Params.Set(ical.ParamTimezoneID, iana)
+		return icsPropertyLine(name, &zoned)
+	}
+
+	floating := *prop
+	floating.Params = ical.Params{}
+	return icsPropertyLine(name, &floating)
+}
@@ -0,0 +1,255 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// customZoneInvite is how Outlook writes a zone it has no name for: the rules
+// of Central European Time under a made-up TZID
+const customZoneInvite = `BEGIN:VCALENDAR
+METHOD:REQUEST
+PRODID:Microsoft Exchange Server 2010
+VERSION:2.0
+BEGIN:VTIMEZONE
+TZID:Customized Time Zone
+BEGIN:STANDARD
+DTSTART:16010101T030000
+TZOFFSETFROM:+0200
+TZOFFSETTO:+0100
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=10
+END:STANDARD
+BEGIN:DAYLIGHT
+DTSTART:16010101T020000
+TZOFFSETFROM:+0100
+TZOFFSETTO:+0200
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=3
+END:DAYLIGHT
+END:VTIMEZONE
+BEGIN:VTIMEZONE
+TZID:Mars Base Time
+BEGIN:STANDARD
+DTSTART:16010101T000000
+TZOFFSETFROM:+0317
+TZOFFSETTO:+0317
+END:STANDARD
+END:VTIMEZONE
+BEGIN:VEVENT
+UID:040000008200E00074C5B7101A82E0080000000010F1A3D4
+SUMMARY:Planning
+DTSTART;TZID=Customized Time Zone:20261020T100000
+DTEND;TZID=Customized Time Zone:20261020T110000
+RRULE:FREQ=WEEKLY;BYDAY=TU
+EXDATE;TZID=Customized Time Zone:20261103T100000
+DTSTAMP:20261014T091523Z
+END:VEVENT
+BEGIN:VEVENT
+UID:mars-standup
+SUMMARY:Standup
+DTSTART;TZID=Mars Base Time:20261020T093000
+DTEND;TZID=Mars Base Time:20261020T094500
+DTSTAMP:20261014T091523Z
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestParseICSCustomTimeZones(t *testing.T) {
+	events, err := ParseICSFile([]byte(strings.ReplaceAll(customZoneInvite, "\n", "\r\n")))
+	if err != nil {
+		t.Fatalf("ParseICSFile: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+
+	planning := events[0]
+	if planning.TimeZone == nil {
+		t.Fatal("planning has no time zone, want one following the CET rules")
+	}
+	if planning.StartTime != "10:00" || planning.EndTime == nil || *planning.EndTime != "11:00" {
+		t.Errorf("planning runs %s-%v, want 10:00-11:00", planning.StartTime, planning.EndTime)
+	}
+
+	// The weekly series must stay at 10:00 after the clocks change on 25 October
+	loc, _, ok := ResolveTimeZone(*planning.TimeZone)
+	if !ok {
+		t.Fatalf("zone %q doesn't load", *planning.TimeZone)
+	}
+	for month, want := range map[time.Month]int{time.January: 3600, time.July: 7200} {
+		if _, offset := time.Date(2027, month, 15, 12, 0, 0, 0, loc).Zone(); offset != want {
+			t.Errorf("%s offset in %s = %d, want %d", *planning.TimeZone, month, offset, want)
+		}
+	}
+	wantExdate := "EXDATE;TZID=" + *planning.TimeZone + ":20261103T100000"
+	if len(planning.Recurrence) != 2 || planning.Recurrence[1] != wantExdate {
+		t.Errorf("recurrence = %q, want the EXDATE as %q", planning.Recurrence, wantExdate)
+	}
+
+	// No zone keeps +03:17, so the time floats in the calendar's zone
+	standup := events[1]
+	if standup.TimeZone != nil {
+		t.Errorf("standup zone = %q, want none", *standup.TimeZone)
+	}
+	if standup.StartTime != "09:30" || standup.EndTime == nil || *standup.EndTime != "09:45" {
+		t.Errorf("standup runs %s-%v, want 09:30-09:45", standup.StartTime, standup.EndTime)
+	}
+}
+
+// outlookZones are the VTIMEZONEs Exchange sends, named by Windows zone ID
+const outlookZones = `BEGIN:VTIMEZONE
+TZID:Pacific Standard Time
+BEGIN:STANDARD
+DTSTART:16010101T020000
+TZOFFSETFROM:-0700
+TZOFFSETTO:-0800
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=1SU;BYMONTH=11
+END:STANDARD
+BEGIN:DAYLIGHT
+DTSTART:16010101T020000
+TZOFFSETFROM:-0800
+TZOFFSETTO:-0700
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=2SU;BYMONTH=3
+END:DAYLIGHT
+END:VTIMEZONE
+BEGIN:VTIMEZONE
+TZID:W. Europe Standard Time
+BEGIN:STANDARD
+DTSTART:16010101T030000
+TZOFFSETFROM:+0200
+TZOFFSETTO:+0100
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=10
+END:STANDARD
+BEGIN:DAYLIGHT
+DTSTART:16010101T020000
+TZOFFSETFROM:+0100
+TZOFFSETTO:+0200
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=3
+END:DAYLIGHT
+END:VTIMEZONE
+`
+
+func TestParseICSTimes(t *testing.T) {
+	tests := []struct {
+		name       string
+		vevent     string
+		date       string
+		start      string
+		end        string
+		endDate    string
+		zone       string
+		allDay     bool
+		recurrence []string
+	}{
+		{
+			name: "Outlook Windows zone",
+			vevent: `DTSTART;TZID=Pacific Standard Time:20261020T090000
+DTEND;TZID=Pacific Standard Time:20261020T093000`,
+			date:  "20 October 2026",
+			start: "09:00",
+			end:   "09:30",
+			zone:  "America/Los_Angeles",
+		},
+		{
+			name: "Windows zones at each end",
+			vevent: `DTSTART;TZID=Pacific Standard Time:20261020T080000
+DTEND;TZID=W. Europe Standard Time:20261020T180000`,
+			date:  "20 October 2026",
+			start: "08:00",
+			end:   "09:00",
+			zone:  "America/Los_Angeles",
+		},
+		{
+			name: "Windows zone exceptions become IANA",
+			vevent: `DTSTART;TZID=W. Europe Standard Time:20261019T100000
+DTEND;TZID=W. Europe Standard Time:20261019T103000
+RRULE:FREQ=WEEKLY;BYDAY=MO;COUNT=6
+EXDATE;TZID=W. Europe Standard Time:20261102T100000`,
+			date:       "19 October 2026",
+			start:      "10:00",
+			end:        "10:30",
+			zone:       "Europe/Berlin",
+			recurrence: []string{"RRULE:FREQ=WEEKLY;BYDAY=MO;COUNT=6", "EXDATE;TZID=Europe/Berlin:20261102T100000"},
+		},
+		{
+			name: "one all-day date",
+			vevent: `DTSTART;VALUE=DATE:20261225
+DTEND;VALUE=DATE:20261226`,
+			date:   "25 December 2026",
+			allDay: true,
+		},
+		{
+			name: "all-day dates end the day before DTEND",
+			vevent: `DTSTART;VALUE=DATE:20261102
+DTEND;VALUE=DATE:20261105`,
+			date:    "2 November 2026",
+			endDate: "4 November 2026",
+			allDay:  true,
+		},
+		{
+			name: "floating time keeps its wall clock",
+			vevent: `DTSTART:20261020T090000
+DURATION:PT45M`,
+			date:  "20 October 2026",
+			start: "09:00",
+			end:   "09:45",
+		},
+		{
+			name: "UTC",
+			vevent: `DTSTART:20261020T223000Z
+DTEND:20261021T003000Z
+RRULE:FREQ=DAILY;COUNT=3
+EXDATE:20261021T223000Z`,
+			date:       "20 October 2026",
+			start:      "22:30",
+			end:        "00:30",
+			endDate:    "21 October 2026",
+			zone:       "UTC",
+			recurrence: []string{"RRULE:FREQ=DAILY;COUNT=3", "EXDATE:20261021T223000Z"},
+		},
+		{
+			name: "floating exception takes the event's zone",
+			vevent: `DTSTART;TZID=Europe/London:20261020T170000
+DTEND;TZID=Europe/London:20261020T173000
+RRULE:FREQ=DAILY;COUNT=5
+EXDATE:20261022T170000`,
+			date:       "20 October 2026",
+			start:      "17:00",
+			end:        "17:30",
+			zone:       "Europe/London",
+			recurrence: []string{"RRULE:FREQ=DAILY;COUNT=5", "EXDATE;TZID=Europe/London:20261022T170000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ics := "BEGIN:VCALENDAR\nVERSION:2.0\nPRODID:Microsoft Exchange Server 2010\n" + outlookZones +
+				"BEGIN:VEVENT\nUID:event-1\nSUMMARY:Review\nDTSTAMP:20261014T091523Z\n" + tt.vevent + "\nEND:VEVENT\nEND:VCALENDAR\n"
+			events, err := ParseICSFile([]byte(strings.ReplaceAll(ics, "\n", "\r\n")))
+			if err != nil {
+				t.Fatalf("ParseICSFile: %v", err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("got %d events, want 1", len(events))
+			}
+
+			event := events[0]
+			if event.Date != tt.date || event.StartTime != tt.start || event.AllDay != tt.allDay {
+				t.Errorf("event on %s at %q (all day %v), want %s at %q (all day %v)",
+					event.Date, event.StartTime, event.AllDay, tt.date, tt.start, tt.allDay)
+			}
+			if got := deref(event.EndTime); got != tt.end {
+				t.Errorf("end time = %q, want %q", got, tt.end)
+			}
+			if got := deref(event.EndDate); got != tt.endDate {
+				t.Errorf("end date = %q, want %q", got, tt.endDate)
+			}
+			if got := deref(event.TimeZone); got != tt.zone {
+				t.Errorf("zone = %q, want %q", got, tt.zone)
+			}
+			if strings.Join(event.Recurrence, "\n") != strings.Join(tt.recurrence, "\n") {
+				t.Errorf("recurrence = %q, want %q", event.Recurrence, tt.recurrence)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+// internal/utils/ics_writer.go
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/internal/models"
+
+	"github.com/emersion/go-ical"
+)
+
+const icsProductID = "-//swiftcal//swiftcal//EN"
+
+var icsFilenameRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// GenerateICSFile writes a created calendar event as an RFC 5545 calendar
+// with METHOD:PUBLISH, which other calendars import as a copy rather than
+// treat as an invitation to answer. The UID matches Google's, so importing an
+// updated file replaces the earlier copy.
+func GenerateICSFile(event *models.GoogleCalendarEvent) ([]byte, error) {
+	cal := newPublishedCalendar()
+	cal.Children = append(cal.Children, buildICSEvent(event))
+
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+		return nil, fmt.Errorf("failed to encode ICS: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GenerateICSFeed writes events as a calendar for clients to subscribe to,
+// asking them to check back hourly
+func GenerateICSFeed(name string, events []*models.GoogleCalendarEvent) ([]byte, error) {
+	cal := newPublishedCalendar()
+	for propName, value := range map[string]string{"X-WR-CALNAME": name, "X-PUBLISHED-TTL": "PT1H", ical.PropRefreshInterval: "PT1H"} {
+		prop := ical.NewProp(propName)
+		prop.Value = value
+		cal.Props.Set(prop)
+	}
+	// RFC 7986 requires the value type to be named
+	cal.Props.Get(ical.PropRefreshInterval).Params.Set(ical.ParamValue, string(ical.ValueDuration))
+
+	for _, event := range events {
+		cal.Children = append(cal.Children, buildICSEvent(event))
+	}
+
+	// The encoder refuses a calendar without components, but an empty feed
+	// is still valid and clients should keep subscribing to it
+	if len(events) == 0 {
+		lines := []string{"BEGIN:VCALENDAR"}
+		for _, propName := range []string{ical.PropVersion, ical.PropProductID, ical.PropMethod, "X-WR-CALNAME", "X-PUBLISHED-TTL", ical.PropRefreshInterval} {
+			if prop := cal.Props.Get(propName); prop != nil {
+				lines = append(lines, icsPropertyLine(propName, prop))
+			}
+		}
+		lines = append(lines, "END:VCALENDAR", "")
+		return []byte(strings.Join(lines, "\r\n")), nil
+	}
+
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+		return nil, fmt.Errorf("failed to encode ICS: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GenerateCalendarObject writes an event as the calendar object a CalDAV
+// server stores. It has no METHOD, and the user is the organizer of any
+// attendees. Transparent events don't block the user's free/busy time.
+func GenerateCalendarObject(event *models.GoogleCalendarEvent, organizer string, sequence int, transparent bool) ([]byte, error) {
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Props.SetText(ical.PropProductID, icsProductID)
+
+	vevent := buildICSEvent(event)
+	setICSSequence(vevent, sequence)
+	if transparent {
+		vevent.Props.SetText(ical.PropTransparency, "TRANSPARENT")
+	} else {
+		vevent.Props.SetText(ical.PropTransparency, "OPAQUE")
+	}
+
+	var emails []string
+	for _, attendee := range event.Attendees {
+		if !strings.EqualFold(attendee.Email, organizer) {
+			emails = append(emails, attendee.Email)
+		}
+	}
+	if len(emails) > 0 && organizer != "" {
+		prop := ical.NewProp(ical.PropOrganizer)
+		prop.Value = "mailto:" + organizer
+		vevent.Props.Set(prop)
+		addICSAttendees(vevent, emails)
+	}
+
+	cal.Children = append(cal.Children, vevent)
+
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+		return nil, fmt.Errorf("failed to encode ICS: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// AddCalendarObjectAttendees adds attendees to every event in a calendar
+// object, leaving those already invited as they are, and raises the sequence
+// so their calendars take the change. Attendees need an organizer, so events
+// without one only get the new sequence.
+func AddCalendarObjectAttendees(content []byte, attendees []string) ([]byte, error) {
+	cal, err := ical.NewDecoder(bytes.NewReader(content)).Decode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ICS: %w", err)
+	}
+
+	for _, event := range cal.Events() {
+		sequence := 0
+		if prop := event.Props.Get(ical.PropSequence); prop != nil {
+			sequence, _ = prop.Int()
+		}
+		setICSSequence(event.Component, sequence+1)
+
+		if event.Props.Get(ical.PropOrganizer) == nil {
+			continue
+		}
+		addICSAttendees(event.Component, attendees)
+	}
+
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+		return nil, fmt.Errorf("failed to encode ICS: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// setICSSequence sets SEQUENCE, which is an integer and so written without
+// the VALUE=TEXT parameter SetText would add
+func setICSSequence(event *ical.Component, sequence int) {
+	prop := ical.NewProp(ical.PropSequence)
+	prop.Value = strconv.Itoa(sequence)
+	event.Props.Set(prop)
+}
+
+// addICSAttendees invites each address the event doesn't already list
+func addICSAttendees(event *ical.Component, emails []string) {
+	invited := make(map[string]bool)
+	for _, prop := range event.Props.Values(ical.PropAttendee) {
+		invited[strings.ToLower(strings.TrimPrefix(strings.ToLower(prop.Value), "mailto:"))] = true
+	}
+	if organizer := event.Props.Get(ical.PropOrganizer); organizer != nil {
+		invited[strings.ToLower(strings.TrimPrefix(strings.ToLower(organizer.Value), "mailto:"))] = true
+	}
+
+	for _, email := range emails {
+		if email == "" || invited[strings.ToLower(email)] {
+			continue
+		}
+		invited[strings.ToLower(email)] = true
+
+		prop := ical.NewProp(ical.PropAttendee)
+		prop.Value = "mailto:" + email
+		prop.Params.Set(ical.ParamRole, "REQ-PARTICIPANT")
+		prop.Params.Set(ical.ParamParticipationStatus, "NEEDS-ACTION")
+		prop.Params.Set(ical.ParamRSVP, "TRUE")
+		event.Props.Add(prop)
+	}
+}
+
+func newPublishedCalendar() *ical.Calendar {
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Props.SetText(ical.PropProductID, icsProductID)
+	cal.Props.SetText(ical.PropMethod, "PUBLISH")
+	return cal
+}
+
+func buildICSEvent(event *models.GoogleCalendarEvent) *ical.Component {
+	vevent := ical.NewEvent()
+	uid := event.ICalUID
+	if uid == "" {
+		uid = event.ID + "@google.com"
+	}
+	vevent.Props.SetText(ical.PropUID, uid)
+	vevent.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+	vevent.Props.SetText(ical.PropSummary, event.Summary)
+
+	if event.AllDay {
+		vevent.Props.SetDate(ical.PropDateTimeStart, event.StartTime)
+		if !event.EndTime.IsZero() {
+			vevent.Props.SetDate(ical.PropDateTimeEnd, event.EndTime)
+		}
+	} else {
+		// UTC needs no VTIMEZONE; a series keeps its zone so it follows
+		// daylight saving time the way the original does
+		loc := time.UTC
+		if len(event.Recurrence) > 0 {
+			if zone, _, ok := ResolveTimeZone(event.TimeZone); ok {
+				loc = zone
+			}
+		}
+
+		vevent.Props.SetDateTime(ical.PropDateTimeStart, event.StartTime.In(loc))
+		if !event.EndTime.IsZero() {
+			vevent.Props.SetDateTime(ical.PropDateTimeEnd, event.EndTime.In(loc))
+		}
+	}
+
+	if event.Description != "" {
+		vevent.Props.SetText(ical.PropDescription, event.Description)
+	}
+	if event.Location != "" {
+		vevent.Props.SetText(ical.PropLocation, event.Location)
+	}
+	if event.HTMLLink != "" {
+		if link, err := url.Parse(event.HTMLLink); err == nil {
+			vevent.Props.SetURI(ical.PropURL, link)
+		}
+	}
+
+	for _, line := range event.Recurrence {
+		if prop := parseICSContentLine(line); prop != nil {
+			vevent.Props.Add(prop)
+		}
+	}
+
+	// Email alarms need an attendee to mail, which a published copy lacks,
+	// so every reminder is written as a display alarm
+	for _, reminder := range event.Reminders {
+		alarm := ical.NewComponent(ical.CompAlarm)
+		alarm.Props.SetText(ical.PropAction, "DISPLAY")
+		alarm.Props.SetText(ical.PropDescription, event.Summary)
+		trigger := ical.NewProp(ical.PropTrigger)
+		trigger.SetDuration(-time.Duration(reminder.Minutes) * time.Minute)
+		alarm.Props.Set(trigger)
+		vevent.Children = append(vevent.Children, alarm)
+	}
+
+	return vevent.Component
+}
+
+// ICSFilename names an event's calendar file after its summary
+func ICSFilename(summary string) string {
+	name := strings.Trim(icsFilenameRegex.ReplaceAllString(strings.ToLower(summary), "-"), "-")
+	if len(name) > 60 {
+		name = strings.TrimRight(name[:60], "-")
+	}
+	if name == "" {
+		name = "event"
+	}
+	return name + ".ics"
+}
+
+// parseICSContentLine reads a line such as "EXDATE;TZID=Europe/Berlin:20240604T090000"
+// back into a property, the reverse of icsPropertyLine
+func parseICSContentLine(line string) *ical.Prop {
+	head, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return nil
+	}
+
+	parts := strings.Split(head, ";")
+	prop := ical.NewProp(strings.ToUpper(parts[0]))
+	prop.Value = value
+	for _, param := range parts[1:] {
+		if key, paramValue, ok := strings.Cut(param, "="); ok {
+			prop.Params.Set(strings.ToUpper(key), strings.Trim(paramValue, `"`))
+		}
+	}
+
+	return prop
+}
@@ -0,0 +1,180 @@
+// internal/utils/recurrence.go
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/teambition/rrule-go"
+)
+
+var weekdayNames = []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+
+var ordinalNames = map[int]string{1: "first", 2: "second", 3: "third", 4: "fourth", 5: "fifth", -1: "last", -2: "second to last"}
+
+// DescribeRecurrence turns RRULE, EXDATE and RDATE lines into a short phrase
+// such as "every Tuesday until June 3". It returns "" when there is no rule
+// it can read.
+func DescribeRecurrence(recurrence []string, loc *time.Location) string {
+	var rule string
+	var exceptions, additions int
+
+	for _, line := range recurrence {
+		name, value, _ := strings.Cut(line, ":")
+		name, _, _ = strings.Cut(name, ";")
+
+		switch strings.ToUpper(name) {
+		case "RRULE":
+			rule = value
+		case "EXDATE":
+			exceptions += len(strings.Split(value, ","))
+		case "RDATE":
+			additions += len(strings.Split(value, ","))
+		}
+	}
+
+	if rule == "" {
+		return ""
+	}
+
+	option, err := rrule.StrToROptionInLocation(rule, loc)
+	if err != nil {
+		return ""
+	}
+
+	parts := []string{describeFrequency(option)}
+
+	switch {
+	case option.Count > 0:
+		parts = append(parts, fmt.Sprintf("for %d occurrences", option.Count))
+	case !option.Until.IsZero():
+		until := option.Until.In(loc)
+		layout := "January 2"
+		if until.Year() != time.Now().In(loc).Year() {
+			layout = "January 2, 2006"
+		}
+		parts = append(parts, "until "+until.Format(layout))
+	}
+
+	description := strings.Join(parts, " ")
+	if exceptions > 0 {
+		description += fmt.Sprintf(", skipping %d %s", exceptions, plural(exceptions, "date", "dates"))
+	}
+	if additions > 0 {
+		description += fmt.Sprintf(", plus %d extra %s", additions, plural(additions, "date", "dates"))
+	}
+
+	return description
+}
+
+func describeFrequency(option *rrule.ROption) string {
+	interval := option.Interval
+	if interval < 1 {
+		interval = 1
+	}
+
+	every := func(singular, pluralUnit string) string {
+		if interval == 1 {
+			return "every " + singular
+		}
+		return fmt.Sprintf("every %d %s", interval, pluralUnit)
+	}
+
+	switch option.Freq {
+	case rrule.DAILY:
+		return every("day", "days")
+	case rrule.WEEKLY:
+		days := describeWeekdays(option.Byweekday)
+		if days == "" {
+			return every("week", "weeks")
+		}
+		if interval == 1 {
+			return "every " + days
+		}
+		if days == "weekday" {
+			days = "weekdays"
+		}
+		return fmt.Sprintf("every %d weeks on %s", interval, days)
+	case rrule.MONTHLY:
+		base := every("month", "months")
+		if len(option.Bymonthday) > 0 {
+			return base + " on the " + ordinalDay(option.Bymonthday[0])
+		}
+		if len(option.Byweekday) > 0 {
+			weekday := option.Byweekday[0]
+			n := weekday.N()
+			if n == 0 && len(option.Bysetpos) > 0 {
+				n = option.Bysetpos[0]
+			}
+			if name, ok := ordinalNames[n]; ok {
+				return base + " on the " + name + " " + weekdayNames[weekday.Day()]
+			}
+		}
+		return base
+	case rrule.YEARLY:
+		base := every("year", "years")
+		if len(option.Bymonth) > 0 && len(option.Bymonthday) > 0 && option.Bymonthday[0] > 0 {
+			return base + " on " + time.Month(option.Bymonth[0]).String() + " " + fmt.Sprint(option.Bymonthday[0])
+		}
+		return base
+	case rrule.HOURLY:
+		return every("hour", "hours")
+	case rrule.MINUTELY:
+		return every("minute", "minutes")
+	default:
+		return every("second", "seconds")
+	}
+}
+
+// describeWeekdays lists BYDAY values, naming the Monday to Friday set "weekday"
+func describeWeekdays(weekdays []rrule.Weekday) string {
+	var names []string
+	seen := make(map[int]bool)
+	for _, weekday := range weekdays {
+		seen[weekday.Day()] = true
+		names = append(names, weekdayNames[weekday.Day()])
+	}
+
+	if len(seen) == 5 && !seen[5] && !seen[6] {
+		return "weekday"
+	}
+
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0]
+	default:
+		return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+	}
+}
+
+func ordinalDay(day int) string {
+	if day < 0 {
+		if day == -1 {
+			return "last day"
+		}
+		return fmt.Sprintf("%s last day", ordinalDay(-day))
+	}
+
+	suffix := "th"
+	if day%100 < 11 || day%100 > 13 {
+		switch day % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return fmt.Sprintf("%d%s", day, suffix)
+}
+
+func plural(n int, singular, pluralForm string) string {
+	if n == 1 {
+		return singular
+	}
+	return pluralForm
+}
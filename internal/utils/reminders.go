@@ -0,0 +1,110 @@
+// internal/utils/reminders.go
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/wizenheimer/swiftcal/internal/models"
+)
+
+// maxReminderMinutes is the furthest ahead Google Calendar allows, four weeks
+const maxReminderMinutes = 40320
+
+var reminderRegex = regexp.MustCompile(`(?i)\b(\d+|an?|one)\s*(minutes?|mins?|m|hours?|hrs?|h|days?|d|weeks?|w)\b`)
+
+var reminderSplitRegex = regexp.MustCompile(`(?i)\s*(?:,|;|\band\b)\s*`)
+
+// ParseReminders reads a list such as "10 minutes, 1 day by email". Each item
+// is a popup unless it mentions email.
+func ParseReminders(text string) []models.Reminder {
+	var reminders []models.Reminder
+	for _, item := range reminderSplitRegex.Split(text, -1) {
+		match := reminderRegex.FindStringSubmatch(item)
+		if match == nil {
+			continue
+		}
+
+		count := 1
+		if n, err := strconv.Atoi(match[1]); err == nil {
+			count = n
+		}
+
+		unit := strings.ToLower(match[2])
+		minutes := count
+		switch {
+		case strings.HasPrefix(unit, "w"):
+			minutes = count * 7 * 24 * 60
+		case strings.HasPrefix(unit, "d"):
+			minutes = count * 24 * 60
+		case strings.HasPrefix(unit, "h"):
+			minutes = count * 60
+		}
+
+		method := models.ReminderPopup
+		if strings.Contains(strings.ToLower(item), "email") {
+			method = models.ReminderEmail
+		}
+
+		reminders = append(reminders, models.Reminder{Method: method, Minutes: minutes})
+	}
+
+	return NormalizeReminders(reminders)
+}
+
+// NormalizeReminders fits reminders to what Google Calendar accepts: email or
+// popup, up to four weeks ahead, at most five and no duplicates
+func NormalizeReminders(reminders []models.Reminder) []models.Reminder {
+	var normalized []models.Reminder
+	seen := make(map[models.Reminder]bool)
+
+	for _, reminder := range reminders {
+		reminder.Method = strings.ToLower(strings.TrimSpace(reminder.Method))
+		if reminder.Method != models.ReminderEmail {
+			reminder.Method = models.ReminderPopup
+		}
+		if reminder.Minutes < 0 || reminder.Minutes > maxReminderMinutes {
+			continue
+		}
+		if seen[reminder] {
+			continue
+		}
+
+		seen[reminder] = true
+		normalized = append(normalized, reminder)
+		if len(normalized) == 5 {
+			break
+		}
+	}
+
+	return normalized
+}
+
+// DescribeReminders lists reminders as "1 day before by email, 10 minutes before"
+func DescribeReminders(reminders []models.Reminder) string {
+	var parts []string
+	for _, reminder := range reminders {
+		var amount string
+		switch minutes := reminder.Minutes; {
+		case minutes == 0:
+			amount = "at the start"
+		case minutes%(7*24*60) == 0:
+			amount = fmt.Sprintf("%d %s before", minutes/(7*24*60), plural(minutes/(7*24*60), "week", "weeks"))
+		case minutes%(24*60) == 0:
+			amount = fmt.Sprintf("%d %s before", minutes/(24*60), plural(minutes/(24*60), "day", "days"))
+		case minutes%60 == 0:
+			amount = fmt.Sprintf("%d %s before", minutes/60, plural(minutes/60, "hour", "hours"))
+		default:
+			amount = fmt.Sprintf("%d %s before", minutes, plural(minutes, "minute", "minutes"))
+		}
+
+		if reminder.Method == models.ReminderEmail {
+			amount += " by email"
+		}
+		parts = append(parts, amount)
+	}
+
+	return strings.Join(parts, ", ")
+}
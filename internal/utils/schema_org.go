@@ -0,0 +1,593 @@
+// internal/utils/schema_org.go
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wizenheimer/swiftcal/internal/models"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// schemaItem is a schema.org entity decoded from JSON-LD or read from microdata
+type schemaItem map[string]any
+
+// ExtractReservations reads schema.org FlightReservation, LodgingReservation,
+// FoodEstablishmentReservation and EventReservation markup from an HTML email,
+// in either JSON-LD or microdata form. Cancelled reservations are skipped.
+func ExtractReservations(content string) []models.Event {
+	if !strings.Contains(content, "schema.org") {
+		return nil
+	}
+
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return nil
+	}
+
+	var items []schemaItem
+	collectSchemaItems(doc, &items)
+
+	var events []models.Event
+	seen := make(map[string]bool)
+	for _, item := range items {
+		if strings.HasSuffix(item.str("reservationStatus"), "ReservationCancelled") {
+			continue
+		}
+
+		var extracted []models.Event
+		switch item.schemaType() {
+		case "FlightReservation":
+			extracted = flightReservationEvents(item)
+		case "LodgingReservation":
+			extracted = lodgingReservationEvents(item)
+		case "FoodEstablishmentReservation":
+			extracted = foodReservationEvents(item)
+		case "EventReservation":
+			extracted = eventReservationEvents(item)
+		}
+
+		// Senders often include the same reservation as JSON-LD and microdata
+		for _, event := range extracted {
+			key := event.Summary + "|" + event.Date + "|" + event.StartTime
+			if !seen[key] {
+				seen[key] = true
+				events = append(events, event)
+			}
+		}
+	}
+
+	return events
+}
+
+func flightReservationEvents(reservation schemaItem) []models.Event {
+	var events []models.Event
+
+	// Multi-leg bookings repeat reservationFor or list one reservation per leg
+	for _, flight := range reservation.items("reservationFor") {
+		departure, departureZone, err := parseSchemaTime(flight.str("departureTime"))
+		if err != nil {
+			continue
+		}
+
+		airline := flight.item("airline")
+		flightNumber := airline.str("iataCode") + flight.str("flightNumber")
+		if airline.str("iataCode") != "" && strings.HasPrefix(flight.str("flightNumber"), airline.str("iataCode")) {
+			flightNumber = flight.str("flightNumber")
+		}
+
+		from := flight.item("departureAirport")
+		to := flight.item("arrivalAirport")
+
+		summary := strings.TrimSpace("Flight " + flightNumber)
+		if from.str("iataCode") != "" && to.str("iataCode") != "" {
+			summary += fmt.Sprintf(" %s → %s", from.str("iataCode"), to.str("iataCode"))
+		}
+
+		event := newReservationEvent(summary, departure, departureZone, reservation)
+		if arrival, _, err := parseSchemaTime(flight.str("arrivalTime")); err == nil {
+			setEndTime(&event, departure, arrival)
+		}
+
+		location := firstNonEmpty(from.str("name"), from.str("iataCode"))
+		if location != "" {
+			event.Location = &location
+		}
+
+		details := []string{
+			labelled("Airline", airline.str("name")),
+			labelled("From", joinNonEmpty(", ", from.str("name"), from.str("iataCode"))),
+			labelled("To", joinNonEmpty(", ", to.str("name"), to.str("iataCode"))),
+			labelled("Seat", reservation.item("reservedTicket").item("ticketedSeat").str("seatNumber")),
+			labelled("Boarding group", reservation.str("boardingGroup")),
+		}
+		addDetails(&event, reservation, details)
+
+		events = append(events, event)
+	}
+
+	return events
+}
+
+// lodgingReservationEvents returns the stay as one all-day event from the
+// check-in date to the check-out date, with the times in its description
+func lodgingReservationEvents(reservation schemaItem) []models.Event {
+	lodging := reservation.item("reservationFor")
+	name := firstNonEmpty(lodging.str("name"), "hotel")
+	address := formatSchemaAddress(lodging.value("address"))
+
+	checkin, _, checkinErr := parseSchemaTime(reservation.str("checkinTime"))
+	checkout, _, checkoutErr := parseSchemaTime(reservation.str("checkoutTime"))
+	switch {
+	case checkinErr != nil && checkoutErr != nil:
+		return nil
+	case checkinErr != nil:
+		checkin = checkout
+	}
+
+	event := models.Event{
+		Summary: "Stay at " + name,
+		Date:    checkin.Format("2 January 2006"),
+		AllDay:  true,
+	}
+	if checkoutErr == nil && checkout.Format("2006-01-02") > checkin.Format("2006-01-02") {
+		endDate := checkout.Format("2 January 2006")
+		event.EndDate = &endDate
+	}
+
+	if email := reservation.item("underName").str("email"); email != "" {
+		event.Attendees = []string{strings.TrimPrefix(email, "mailto:")}
+	}
+	if location := joinNonEmpty(", ", lodging.str("name"), address); location != "" {
+		event.Location = &location
+	}
+
+	addDetails(&event, reservation, []string{
+		labelled("Check-in", schemaTimeLabel(reservation.str("checkinTime"), checkin, checkinErr)),
+		labelled("Check-out", schemaTimeLabel(reservation.str("checkoutTime"), checkout, checkoutErr)),
+		labelled("Phone", lodging.str("telephone")),
+	})
+
+	return []models.Event{event}
+}
+
+// schemaTimeLabel describes a parsed time for an event's description,
+// leaving out a time of day the markup didn't give
+func schemaTimeLabel(value string, t time.Time, err error) string {
+	if err != nil {
+		return ""
+	}
+	if !strings.ContainsAny(value, "T ") {
+		return t.Format("Mon 2 January")
+	}
+	return t.Format("Mon 2 January, 15:04")
+}
+
+func foodReservationEvents(reservation schemaItem) []models.Event {
+	restaurant := reservation.item("reservationFor")
+
+	start, zone, err := parseSchemaTime(reservation.str("startTime"))
+	if err != nil {
+		return nil
+	}
+
+	event := newReservationEvent("Reservation at "+firstNonEmpty(restaurant.str("name"), "restaurant"), start, zone, reservation)
+	if end, _, err := parseSchemaTime(reservation.str("endTime")); err == nil {
+		setEndTime(&event, start, end)
+	}
+
+	if location := joinNonEmpty(", ", restaurant.str("name"), formatSchemaAddress(restaurant.value("address"))); location != "" {
+		event.Location = &location
+	}
+
+	addDetails(&event, reservation, []string{
+		labelled("Party size", reservation.str("partySize")),
+		labelled("Phone", restaurant.str("telephone")),
+	})
+
+	return []models.Event{event}
+}
+
+func eventReservationEvents(reservation schemaItem) []models.Event {
+	var events []models.Event
+
+	for _, target := range reservation.items("reservationFor") {
+		start, zone, err := parseSchemaTime(target.str("startDate"))
+		if err != nil {
+			continue
+		}
+
+		event := newReservationEvent(firstNonEmpty(target.str("name"), "Event"), start, zone, reservation)
+		if end, _, err := parseSchemaTime(target.str("endDate")); err == nil {
+			setEndTime(&event, start, end)
+		}
+
+		place := target.item("location")
+		if location := joinNonEmpty(", ", place.str("name"), formatSchemaAddress(place.value("address"))); location != "" {
+			event.Location = &location
+		}
+
+		ticket := reservation.item("reservedTicket")
+		addDetails(&event, reservation, []string{
+			labelled("Seat", joinNonEmpty(" ",
+				ticket.item("ticketedSeat").str("seatSection"),
+				ticket.item("ticketedSeat").str("seatRow"),
+				ticket.item("ticketedSeat").str("seatNumber"))),
+			labelled("Ticket", ticket.str("ticketNumber")),
+		})
+
+		events = append(events, event)
+	}
+
+	return events
+}
+
+// newReservationEvent builds an event at the given local time. Without a zone
+// the time is floating and the calendar's own timezone applies.
+func newReservationEvent(summary string, start time.Time, zone string, reservation schemaItem) models.Event {
+	event := models.Event{
+		Summary:   summary,
+		Date:      start.Format("2 January 2006"),
+		StartTime: start.Format("15:04"),
+	}
+
+	if zone != "" {
+		event.TimeZone = &zone
+	}
+
+	if email := reservation.item("underName").str("email"); email != "" {
+		event.Attendees = []string{strings.TrimPrefix(email, "mailto:")}
+	}
+
+	return event
+}
+
+// setEndTime records the end in the start's zone, with an end date when it
+// falls on a later day, as an overnight flight's arrival does
+func setEndTime(event *models.Event, start, end time.Time) {
+	end = end.In(start.Location())
+	if !end.After(start) {
+		return
+	}
+
+	endTime := end.Format("15:04")
+	event.EndTime = &endTime
+
+	if end.Format("2006-01-02") != start.Format("2006-01-02") {
+		endDate := end.Format("2 January 2006")
+		event.EndDate = &endDate
+	}
+}
+
+func addDetails(event *models.Event, reservation schemaItem, details []string) {
+	details = append([]string{
+		labelled("Confirmation", reservation.str("reservationNumber")),
+		labelled("Name", reservation.item("underName").str("name")),
+	}, details...)
+
+	if url := firstNonEmpty(reservation.str("modifyReservationUrl"), reservation.str("url")); url != "" {
+		details = append(details, labelled("Manage", url))
+	}
+
+	if description := joinNonEmpty("\n", details...); description != "" {
+		event.Description = &description
+	}
+}
+
+// parseSchemaTime parses an ISO 8601 date-time. An explicit offset becomes a
+// fixed-offset IANA zone; a time without one is returned with an empty zone.
+func parseSchemaTime(value string) (time.Time, string, error) {
+	value = strings.TrimSpace(value)
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return offsetZoneTime(t)
+		}
+	}
+
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, "", nil
+		}
+	}
+
+	return time.Time{}, "", fmt.Errorf("unrecognised schema.org time %q", value)
+}
+
+// offsetZoneTime maps a whole-hour UTC offset to its Etc/GMT zone, whose sign
+// is inverted by convention. Other offsets fall back to UTC.
+func offsetZoneTime(t time.Time) (time.Time, string, error) {
+	_, offset := t.Zone()
+	if offset == 0 {
+		return t.UTC(), "UTC", nil
+	}
+
+	if offset%3600 == 0 {
+		name := fmt.Sprintf("Etc/GMT%+d", -offset/3600)
+		if loc, err := time.LoadLocation(name); err == nil {
+			return t.In(loc), name, nil
+		}
+	}
+
+	return t.UTC(), "UTC", nil
+}
+
+func formatSchemaAddress(value any) string {
+	switch address := value.(type) {
+	case string:
+		return strings.TrimSpace(address)
+	case schemaItem:
+		return joinNonEmpty(", ",
+			address.str("streetAddress"),
+			address.str("addressLocality"),
+			address.str("addressRegion"),
+			address.str("postalCode"),
+			address.str("addressCountry"))
+	}
+	return ""
+}
+
+// collectSchemaItems gathers entities from JSON-LD scripts and top-level
+// microdata items anywhere in the document
+func collectSchemaItems(node *html.Node, items *[]schemaItem) {
+	if node.Type == html.ElementNode {
+		if node.DataAtom == atom.Script && strings.EqualFold(htmlAttr(node, "type"), "application/ld+json") {
+			if node.FirstChild != nil {
+				*items = append(*items, decodeJSONLD(node.FirstChild.Data)...)
+			}
+			return
+		}
+
+		if hasAttr(node, "itemscope") && !hasAttr(node, "itemprop") {
+			*items = append(*items, readMicrodataItem(node))
+			return
+		}
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		collectSchemaItems(child, items)
+	}
+}
+
+func decodeJSONLD(data string) []schemaItem {
+	var decoded any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &decoded); err != nil {
+		return nil
+	}
+
+	var items []schemaItem
+	var walk func(value any)
+	walk = func(value any) {
+		switch v := value.(type) {
+		case []any:
+			for _, element := range v {
+				walk(element)
+			}
+		case map[string]any:
+			item := toSchemaItem(v)
+			if graph, ok := item["@graph"]; ok {
+				walk(graph)
+				return
+			}
+			items = append(items, item)
+		}
+	}
+	walk(decoded)
+
+	return items
+}
+
+// toSchemaItem converts decoded JSON objects so nested entities share a type
+func toSchemaItem(value map[string]any) schemaItem {
+	item := schemaItem{}
+	for key, v := range value {
+		item[key] = convertSchemaValue(v)
+	}
+	return item
+}
+
+func convertSchemaValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		return toSchemaItem(v)
+	case []any:
+		converted := make([]any, len(v))
+		for i, element := range v {
+			converted[i] = convertSchemaValue(element)
+		}
+		return converted
+	}
+	return value
+}
+
+func readMicrodataItem(node *html.Node) schemaItem {
+	item := schemaItem{"@type": htmlAttr(node, "itemtype")}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		readMicrodataProperties(child, item)
+	}
+	return item
+}
+
+func readMicrodataProperties(node *html.Node, item schemaItem) {
+	if node.Type != html.ElementNode {
+		return
+	}
+
+	if props := strings.Fields(htmlAttr(node, "itemprop")); len(props) > 0 {
+		var value any
+		if hasAttr(node, "itemscope") {
+			value = readMicrodataItem(node)
+		} else {
+			value = microdataValue(node)
+		}
+
+		for _, prop := range props {
+			item.add(prop, value)
+		}
+
+		// A nested item's properties belong to it, not to us
+		if hasAttr(node, "itemscope") {
+			return
+		}
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		readMicrodataProperties(child, item)
+	}
+}
+
+func microdataValue(node *html.Node) string {
+	switch node.DataAtom {
+	case atom.Meta:
+		return htmlAttr(node, "content")
+	case atom.A, atom.Link, atom.Area:
+		return htmlAttr(node, "href")
+	case atom.Img, atom.Source, atom.Iframe, atom.Embed, atom.Audio, atom.Video:
+		return htmlAttr(node, "src")
+	case atom.Time:
+		if datetime := htmlAttr(node, "datetime"); datetime != "" {
+			return datetime
+		}
+	case atom.Data, atom.Meter:
+		return htmlAttr(node, "value")
+	}
+
+	if content := htmlAttr(node, "content"); content != "" {
+		return content
+	}
+
+	var builder strings.Builder
+	renderHTMLNode(&builder, node, false)
+	return strings.TrimSpace(htmlWhitespaceRegex.ReplaceAllString(builder.String(), " "))
+}
+
+func hasAttr(node *html.Node, key string) bool {
+	for _, attr := range node.Attr {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// add appends a repeated property rather than overwriting it
+func (item schemaItem) add(key string, value any) {
+	existing, ok := item[key]
+	if !ok {
+		item[key] = value
+		return
+	}
+
+	if list, ok := existing.([]any); ok {
+		item[key] = append(list, value)
+		return
+	}
+	item[key] = []any{existing, value}
+}
+
+// schemaType returns the short type name, accepting full schema.org URLs
+func (item schemaItem) schemaType() string {
+	value := item["@type"]
+	if list, ok := value.([]any); ok && len(list) > 0 {
+		value = list[0]
+	}
+
+	name, _ := value.(string)
+	name = strings.TrimSuffix(name, "/")
+	if slash := strings.LastIndex(name, "/"); slash >= 0 {
+		name = name[slash+1:]
+	}
+	return name
+}
+
+// value returns a property, taking the first of repeated values
+func (item schemaItem) value(key string) any {
+	if item == nil {
+		return nil
+	}
+
+	value := item[key]
+	if list, ok := value.([]any); ok {
+		if len(list) == 0 {
+			return nil
+		}
+		return list[0]
+	}
+	return value
+}
+
+func (item schemaItem) str(key string) string {
+	switch v := item.value(key).(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return fmt.Sprintf("%g", v)
+	case schemaItem:
+		// Some senders give an entity where text is expected, or the reverse
+		return firstNonEmpty(v.str("name"), v.str("@id"))
+	}
+	return ""
+}
+
+func (item schemaItem) item(key string) schemaItem {
+	switch v := item.value(key).(type) {
+	case schemaItem:
+		return v
+	case string:
+		return schemaItem{"name": v}
+	}
+	return nil
+}
+
+// items returns every entity under a property, for repeated properties
+func (item schemaItem) items(key string) []schemaItem {
+	if item == nil {
+		return nil
+	}
+
+	values, ok := item[key].([]any)
+	if !ok {
+		if single := item.item(key); single != nil {
+			return []schemaItem{single}
+		}
+		return nil
+	}
+
+	var items []schemaItem
+	for _, value := range values {
+		if entity, ok := value.(schemaItem); ok {
+			items = append(items, entity)
+		}
+	}
+	return items
+}
+
+func labelled(label, value string) string {
+	if value == "" {
+		return ""
+	}
+	return label + ": " + value
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func joinNonEmpty(separator string, values ...string) string {
+	var parts []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			parts = append(parts, value)
+		}
+	}
+	return strings.Join(parts, separator)
+}
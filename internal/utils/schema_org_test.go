@@ -0,0 +1,251 @@
+package utils
+
+import "testing"
+
+// reservation is the part of an extracted event the fixtures check
+type reservation struct {
+	summary, date, start, zone, location string
+}
+
+func TestExtractReservations(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want []reservation
+	}{
+		{
+			name: "Google's event reservation example",
+			html: `<html><body><script type="application/ld+json">
+			{
+				"@context": "http://schema.org",
+				"@type": "EventReservation",
+				"reservationNumber": "E123456789",
+				"reservationStatus": "http://schema.org/Confirmed",
+				"underName": {"@type": "Person", "name": "John Smith"},
+				"reservationFor": {
+					"@type": "Event",
+					"name": "Foo Fighters Concert",
+					"startDate": "2027-03-06T19:30:00-08:00",
+					"location": {
+						"@type": "Place",
+						"name": "AT&T Park",
+						"address": {"@type": "PostalAddress", "streetAddress": "24 Willie Mays Plaza", "addressLocality": "San Francisco", "addressRegion": "CA", "postalCode": "94107", "addressCountry": "US"}
+					}
+				}
+			}
+			</script><p>Dear John, thanks for booking your Google I/O ticket with us.</p></body></html>`,
+			want: []reservation{{
+				summary:  "Foo Fighters Concert",
+				date:     "6 March 2027",
+				start:    "19:30",
+				zone:     "Etc/GMT+8",
+				location: "AT&T Park, 24 Willie Mays Plaza, San Francisco, CA, 94107, US",
+			}},
+		},
+		{
+			name: "OpenTable restaurant booking in microdata",
+			html: `<div itemscope itemtype="http://schema.org/FoodEstablishmentReservation">
+				<meta itemprop="reservationNumber" content="OT12345"/>
+				<link itemprop="reservationStatus" href="http://schema.org/Confirmed"/>
+				<div itemprop="underName" itemscope itemtype="http://schema.org/Person">
+					<meta itemprop="name" content="John Smith"/>
+					<meta itemprop="email" content="john@mail.com"/>
+				</div>
+				<div itemprop="reservationFor" itemscope itemtype="http://schema.org/FoodEstablishment">
+					<meta itemprop="name" content="Wagamama"/>
+					<div itemprop="address" itemscope itemtype="http://schema.org/PostalAddress">
+						<meta itemprop="streetAddress" content="1 Tavistock Street"/>
+						<meta itemprop="addressLocality" content="London"/>
+						<meta itemprop="postalCode" content="WC2E 7PG"/>
+						<meta itemprop="addressCountry" content="United Kingdom"/>
+					</div>
+				</div>
+				<meta itemprop="startTime" content="2027-04-10T08:00:00+01:00"/>
+				<meta itemprop="partySize" content="2"/>
+			</div>`,
+			want: []reservation{{
+				summary:  "Reservation at Wagamama",
+				date:     "10 April 2027",
+				start:    "08:00",
+				zone:     "Etc/GMT-1",
+				location: "Wagamama, 1 Tavistock Street, London, WC2E 7PG, United Kingdom",
+			}},
+		},
+		{
+			name: "airline itinerary with a connection",
+			html: `<script type="application/ld+json">[
+				{
+					"@context": "http://schema.org",
+					"@type": "FlightReservation",
+					"reservationNumber": "KX9Z2B",
+					"reservationStatus": "http://schema.org/ReservationConfirmed",
+					"underName": {"@type": "Person", "name": "Sam Lee", "email": "sam@example.org"},
+					"reservationFor": {
+						"@type": "Flight",
+						"flightNumber": "UA110",
+						"airline": {"@type": "Airline", "name": "United", "iataCode": "UA"},
+						"departureAirport": {"@type": "Airport", "name": "Denver International Airport", "iataCode": "DEN"},
+						"departureTime": "2026-11-03T07:15:00-07:00",
+						"arrivalAirport": {"@type": "Airport", "name": "San Francisco International Airport", "iataCode": "SFO"},
+						"arrivalTime": "2026-11-03T09:05:00-08:00"
+					},
+					"reservedTicket": {"@type": "Ticket", "ticketedSeat": {"@type": "Seat", "seatNumber": "14C"}}
+				},
+				{
+					"@context": "http://schema.org",
+					"@type": "FlightReservation",
+					"reservationNumber": "KX9Z2B",
+					"underName": {"@type": "Person", "name": "Sam Lee", "email": "sam@example.org"},
+					"reservationFor": {
+						"@type": "Flight",
+						"flightNumber": "837",
+						"airline": {"@type": "Airline", "name": "United", "iataCode": "UA"},
+						"departureAirport": {"@type": "Airport", "name": "San Francisco International Airport", "iataCode": "SFO"},
+						"departureTime": "2026-11-03T11:10:00-08:00",
+						"arrivalAirport": {"@type": "Airport", "name": "Narita International Airport", "iataCode": "NRT"},
+						"arrivalTime": "2026-11-04T15:00:00+09:00"
+					}
+				}
+			]</script>`,
+			want: []reservation{
+				{summary: "Flight UA110 DEN → SFO", date: "3 November 2026", start: "07:15", zone: "Etc/GMT+7", location: "Denver International Airport"},
+				{summary: "Flight UA837 SFO → NRT", date: "3 November 2026", start: "11:10", zone: "Etc/GMT+8", location: "San Francisco International Airport"},
+			},
+		},
+		{
+			name: "same booking in JSON-LD and microdata",
+			html: `<script type="application/ld+json">{
+				"@context": "https://schema.org",
+				"@type": "FoodEstablishmentReservation",
+				"reservationFor": {"@type": "Restaurant", "name": "Dishoom"},
+				"startTime": "2026-10-24T19:30:00"
+			}</script>
+			<div itemscope itemtype="https://schema.org/FoodEstablishmentReservation">
+				<div itemprop="reservationFor" itemscope itemtype="https://schema.org/Restaurant"><span itemprop="name">Dishoom</span></div>
+				<time itemprop="startTime" datetime="2026-10-24T19:30:00">Saturday 24 October, 7:30pm</time>
+			</div>`,
+			want: []reservation{{summary: "Reservation at Dishoom", date: "24 October 2026", start: "19:30", location: "Dishoom"}},
+		},
+		{
+			name: "cancelled booking",
+			html: `<script type="application/ld+json">{
+				"@context": "http://schema.org",
+				"@type": "LodgingReservation",
+				"reservationStatus": "http://schema.org/ReservationCancelled",
+				"reservationFor": {"@type": "LodgingBusiness", "name": "Hotel Arts"},
+				"checkinTime": "2026-12-01T15:00:00+01:00",
+				"checkoutTime": "2026-12-03T12:00:00+01:00"
+			}</script>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []reservation
+			for _, event := range ExtractReservations(tt.html) {
+				got = append(got, reservation{
+					summary:  event.Summary,
+					date:     event.Date,
+					start:    event.StartTime,
+					zone:     deref(event.TimeZone),
+					location: deref(event.Location),
+				})
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d events, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("event %d:\n got %+v\nwant %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExtractReservationsEndDates(t *testing.T) {
+	tests := []struct {
+		name    string
+		html    string
+		summary string
+		date    string
+		start   string
+		end     string
+		endDate string
+		allDay  bool
+	}{
+		{
+			name: "overnight flight keeps its arrival",
+			html: `<script type="application/ld+json">{
+				"@context": "http://schema.org",
+				"@type": "FlightReservation",
+				"reservationNumber": "RXJ34P",
+				"reservationFor": {
+					"@type": "Flight",
+					"flightNumber": "16",
+					"airline": {"@type": "Airline", "name": "British Airways", "iataCode": "BA"},
+					"departureAirport": {"@type": "Airport", "name": "San Francisco International", "iataCode": "SFO"},
+					"departureTime": "2026-10-20T19:40:00-07:00",
+					"arrivalAirport": {"@type": "Airport", "name": "London Heathrow", "iataCode": "LHR"},
+					"arrivalTime": "2026-10-21T14:05:00+01:00"
+				}
+			}</script>`,
+			summary: "Flight BA16 SFO → LHR",
+			date:    "20 October 2026",
+			start:   "19:40",
+			end:     "06:05",
+			endDate: "21 October 2026",
+		},
+		{
+			name: "hotel stay is one event",
+			html: `<script type="application/ld+json">{
+				"@context": "http://schema.org",
+				"@type": "LodgingReservation",
+				"reservationNumber": "8823141",
+				"reservationStatus": "http://schema.org/ReservationConfirmed",
+				"underName": {"@type": "Person", "name": "Sam Lee", "email": "sam@example.org"},
+				"reservationFor": {
+					"@type": "LodgingBusiness",
+					"name": "The Hoxton, Holborn",
+					"address": {"@type": "PostalAddress", "streetAddress": "199-206 High Holborn", "addressLocality": "London", "postalCode": "WC1V 7BD", "addressCountry": "GB"},
+					"telephone": "+44 20 7661 3000"
+				},
+				"checkinTime": "2026-10-21T15:00:00+01:00",
+				"checkoutTime": "2026-10-24T12:00:00+01:00"
+			}</script>`,
+			summary: "Stay at The Hoxton, Holborn",
+			date:    "21 October 2026",
+			endDate: "24 October 2026",
+			allDay:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := ExtractReservations(tt.html)
+			if len(events) != 1 {
+				t.Fatalf("got %d events, want 1: %+v", len(events), events)
+			}
+
+			event := events[0]
+			if event.Summary != tt.summary || event.Date != tt.date || event.StartTime != tt.start || event.AllDay != tt.allDay {
+				t.Errorf("event = %q on %s at %q (all day %v), want %q on %s at %q (all day %v)",
+					event.Summary, event.Date, event.StartTime, event.AllDay, tt.summary, tt.date, tt.start, tt.allDay)
+			}
+			if got := deref(event.EndTime); got != tt.end {
+				t.Errorf("end time = %q, want %q", got, tt.end)
+			}
+			if got := deref(event.EndDate); got != tt.endDate {
+				t.Errorf("end date = %q, want %q", got, tt.endDate)
+			}
+		})
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,136 @@
+// internal/utils/secrets.go
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// secretPrefix marks values sealed by EncryptSecret, so the format can change later
+const secretPrefix = "v1:"
+
+// ErrNotEncrypted means a stored value was written before it was encrypted
+var ErrNotEncrypted = errors.New("value is not encrypted")
+
+// ErrInvalidSignature means a signed value was altered, signed for another
+// purpose or has expired
+var ErrInvalidSignature = errors.New("invalid or expired signature")
+
+// ParseSecretKey reads a base64-encoded 32-byte AES-256 key
+func ParseSecretKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("key is not valid base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// EncryptSecret seals a value with AES-256-GCM for storage
+func EncryptSecret(key []byte, plaintext string) (string, error) {
+	gcm, err := newSecretCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret opens a value sealed by EncryptSecret. Values stored before
+// encryption return ErrNotEncrypted.
+func DecryptSecret(key []byte, stored string) (string, error) {
+	encoded, ok := strings.CutPrefix(stored, secretPrefix)
+	if !ok {
+		return "", ErrNotEncrypted
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode secret: %w", err)
+	}
+
+	gcm, err := newSecretCipher(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("secret is too short")
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+func newSecretCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// SignValue returns value with an expiry and an HMAC-SHA256 signature, for
+// links and cookies that must come back unchanged. The purpose is signed too,
+// so a value signed for one use isn't accepted for another.
+func SignValue(secret, purpose, value string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(value)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + signPayload(secret, purpose, payload)
+}
+
+// VerifySignedValue checks a value from SignValue and returns it
+func VerifySignedValue(secret, purpose, signed string, now time.Time) (string, error) {
+	payload, signature, ok := cutLast(signed, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(signPayload(secret, purpose, payload))) {
+		return "", ErrInvalidSignature
+	}
+
+	encoded, expiry, ok := cutLast(payload, ".")
+	if !ok {
+		return "", ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || now.Unix() > expires {
+		return "", ErrInvalidSignature
+	}
+
+	value, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	return string(value), nil
+}
+
+func signPayload(secret, purpose, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose + "\x00" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func cutLast(s, separator string) (before, after string, ok bool) {
+	i := strings.LastIndex(s, separator)
+	if i < 0 {
+		return "", "", false
+	}
+	return s[:i], s[i+len(separator):], true
+}
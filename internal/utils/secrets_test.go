@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecretRoundTrip(t *testing.T) {
+	key, err := ParseSecretKey(base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")))
+	if err != nil {
+		t.Fatalf("ParseSecretKey: %v", err)
+	}
+
+	stored, err := EncryptSecret(key, "app-password")
+	if err != nil {
+		t.Fatalf("EncryptSecret: %v", err)
+	}
+	if strings.Contains(stored, "app-password") {
+		t.Fatalf("stored value %q contains the plaintext", stored)
+	}
+
+	plaintext, err := DecryptSecret(key, stored)
+	if err != nil || plaintext != "app-password" {
+		t.Fatalf("DecryptSecret = %q, %v", plaintext, err)
+	}
+
+	other := []byte("fedcba9876543210fedcba9876543210")
+	if _, err := DecryptSecret(other, stored); err == nil {
+		t.Error("decrypting with another key succeeded")
+	}
+
+	if _, err := DecryptSecret(key, "app-password"); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("plaintext value: err = %v, want ErrNotEncrypted", err)
+	}
+}
+
+func TestParseSecretKey(t *testing.T) {
+	for _, encoded := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := ParseSecretKey(encoded); err == nil {
+			t.Errorf("ParseSecretKey(%q) succeeded", encoded)
+		}
+	}
+}
+
+func TestSignedValues(t *testing.T) {
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	signed := SignValue("jwt-secret", "microsoft-link", "sam@example.org", now.Add(time.Hour))
+
+	if value, err := VerifySignedValue("jwt-secret", "microsoft-link", signed, now); err != nil || value != "sam@example.org" {
+		t.Fatalf("VerifySignedValue = %q, %v", value, err)
+	}
+
+	tampered := base64.RawURLEncoding.EncodeToString([]byte("mallory@example.org")) + signed[strings.Index(signed, "."):]
+	tests := []struct {
+		name    string
+		secret  string
+		purpose string
+		signed  string
+		now     time.Time
+	}{
+		{"expired", "jwt-secret", "microsoft-link", signed, now.Add(2 * time.Hour)},
+		{"another secret", "other-secret", "microsoft-link", signed, now},
+		{"another purpose", "jwt-secret", "oauth-state", signed, now},
+		{"altered value", "jwt-secret", "microsoft-link", tampered, now},
+		{"not signed", "jwt-secret", "microsoft-link", "sam@example.org", now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := VerifySignedValue(tt.secret, tt.purpose, tt.signed, tt.now); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("err = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
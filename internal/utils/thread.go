@@ -0,0 +1,343 @@
+// internal/utils/thread.go
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ThreadMessage is one message recovered from a forwarded or replied-to thread
+type ThreadMessage struct {
+	From    string
+	Date    string
+	To      string
+	Cc      string
+	Subject string
+	Body    string
+}
+
+var (
+	// Lines that open a forwarded or original message followed by a header block
+	threadSeparatorRegex = regexp.MustCompile(`(?i)^(-{2,}\s*(forwarded message|original message)\s*-{2,}|begin forwarded message:|_{10,})$`)
+
+	// Header lines inside a quoted header block, optionally bolded by HTML-to-text conversion
+	threadHeaderRegex = regexp.MustCompile(`(?i)^\*?(from|sent|date|to|cc|subject):\*?\s*(.*)$`)
+
+	// "On <date> <author> wrote:" (Gmail) and "On <date>, at <time>, <author> wrote:" (Apple Mail)
+	attributionRegex = regexp.MustCompile(`(?i)^on\s+(.+?)\s+wrote:$`)
+
+	// The time that ends the date part of an attribution line
+	attributionTimeRegex = regexp.MustCompile(`(?i)\d{1,2}:\d{2}(:\d{2})?(\s?[ap]\.?m\.?)?`)
+
+	// Lines added by mail clients that carry no content
+	boilerplateLineRegex = regexp.MustCompile(`(?i)^(sent from my \w+.*|sent from (mail|outlook|yahoo mail|gmail)\b.*|get outlook for \w+.*|sent via .*|please consider the environment before printing.*)$`)
+
+	// Opening words of legal disclaimers and confidentiality notices
+	disclaimerRegex = regexp.MustCompile(`(?i)^(confidentiality notice|disclaimer|this (e-?mail|message|communication)( and any (files|attachments)[^.]*)? (is|are|may be|contains?) (confidential|intended)|the information (contained )?in this (e-?mail|message)|if you (are not|have received this) .*(intended recipient|in error))`)
+
+	// Sign-offs after which only a signature block follows
+	valedictionRegex = regexp.MustCompile(`(?i)^(best|kind|warm)?\s*(regards|wishes|thanks|thank you|cheers|sincerely|best)[,.!]?$`)
+)
+
+// maxSignatureLines is how many lines after a sign-off are assumed to be a signature
+const maxSignatureLines = 6
+
+// SplitThread breaks a plain-text email into its messages, most recent first.
+// It recognises Gmail, Outlook and Apple Mail forward and reply markers and
+// strips signatures and boilerplate from every message. The first message
+// has no headers of its own; callers fill them in from the envelope.
+func SplitThread(text string) []ThreadMessage {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	var messages []ThreadMessage
+	current := ThreadMessage{}
+	var body []string
+
+	flush := func() {
+		current.Body = cleanMessageBody(body)
+		messages = append(messages, current)
+		current = ThreadMessage{}
+		body = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+
+		// Forward or original message separator, followed by a header block
+		if threadSeparatorRegex.MatchString(line) {
+			flush()
+			i = parseHeaderBlock(lines, i+1, &current) - 1
+			continue
+		}
+
+		// Outlook replies often have no separator, just a From/Sent block
+		if isInlineHeaderBlock(lines, i) {
+			flush()
+			i = parseHeaderBlock(lines, i, &current) - 1
+			continue
+		}
+
+		// Reply attribution, which may be wrapped over two lines
+		if attribution, next, ok := matchAttribution(lines, i); ok {
+			quoted, end := collectQuoted(lines, next)
+			if len(quoted) > 0 {
+				flush()
+				earlier := SplitThread(strings.Join(quoted, "\n"))
+				earlier[0].From, earlier[0].Date = splitAttribution(attribution)
+				messages = append(messages, earlier...)
+				i = end - 1
+				continue
+			}
+		}
+
+		// Quoted text without an attribution still belongs to an earlier message
+		if strings.HasPrefix(line, ">") {
+			quoted, end := collectQuoted(lines, i)
+			flush()
+			messages = append(messages, SplitThread(strings.Join(quoted, "\n"))...)
+			i = end - 1
+			continue
+		}
+
+		body = append(body, lines[i])
+	}
+	flush()
+
+	// Drop messages that ended up empty, such as a bare "Fwd:" with no comment,
+	// but always keep the first so callers can attach the envelope headers
+	compact := messages[:1]
+	for _, message := range messages[1:] {
+		if message.Body != "" || message.From != "" {
+			compact = append(compact, message)
+		}
+	}
+
+	return compact
+}
+
+// FormatThread renders messages as a compact, labelled thread for extraction
+func FormatThread(messages []ThreadMessage) string {
+	var builder strings.Builder
+
+	for i, message := range messages {
+		label := fmt.Sprintf("[Message %d of %d", i+1, len(messages))
+		if i == 0 {
+			label += ", most recent"
+		}
+		builder.WriteString(label + "]\n")
+
+		for _, field := range [][2]string{
+			{"From", message.From},
+			{"Date", message.Date},
+			{"To", message.To},
+			{"Cc", message.Cc},
+			{"Subject", message.Subject},
+		} {
+			if field[1] != "" {
+				builder.WriteString(fmt.Sprintf("%s: %s\n", field[0], field[1]))
+			}
+		}
+
+		if message.Body != "" {
+			builder.WriteString("\n" + message.Body + "\n")
+		}
+		builder.WriteString("\n")
+	}
+
+	return strings.TrimSpace(builder.String())
+}
+
+// parseHeaderBlock reads From/Sent/Date/To/Cc/Subject lines starting at
+// index start, skipping leading blank lines, and returns the first index after it
+func parseHeaderBlock(lines []string, start int, message *ThreadMessage) int {
+	i := start
+	for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+
+	for ; i < len(lines); i++ {
+		matches := threadHeaderRegex.FindStringSubmatch(strings.TrimSpace(lines[i]))
+		if matches == nil {
+			break
+		}
+
+		value := strings.TrimSpace(matches[2])
+		switch strings.ToLower(matches[1]) {
+		case "from":
+			message.From = value
+		case "sent", "date":
+			message.Date = value
+		case "to":
+			message.To = value
+		case "cc":
+			message.Cc = value
+		case "subject":
+			message.Subject = value
+		}
+	}
+
+	return i
+}
+
+// isInlineHeaderBlock reports whether a From: line starts a quoted header block,
+// which needs a Sent or Date line within the next few lines
+func isInlineHeaderBlock(lines []string, i int) bool {
+	matches := threadHeaderRegex.FindStringSubmatch(strings.TrimSpace(lines[i]))
+	if matches == nil || !strings.EqualFold(matches[1], "from") {
+		return false
+	}
+
+	for j := i + 1; j < len(lines) && j <= i+4; j++ {
+		next := threadHeaderRegex.FindStringSubmatch(strings.TrimSpace(lines[j]))
+		if next == nil {
+			return false
+		}
+		if field := strings.ToLower(next[1]); field == "sent" || field == "date" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchAttribution recognises a reply attribution line at i, joining it with the
+// following line when a client wrapped it. It returns the attribution text and
+// the index of the first line after it.
+func matchAttribution(lines []string, i int) (string, int, bool) {
+	line := strings.TrimSpace(lines[i])
+	if !strings.HasPrefix(strings.ToLower(line), "on ") {
+		return "", 0, false
+	}
+
+	if matches := attributionRegex.FindStringSubmatch(line); matches != nil {
+		return matches[1], i + 1, true
+	}
+
+	if i+1 < len(lines) {
+		separator := " "
+		if strings.HasSuffix(line, "<") {
+			separator = ""
+		}
+
+		joined := line + separator + strings.TrimSpace(lines[i+1])
+		if matches := attributionRegex.FindStringSubmatch(joined); matches != nil {
+			return matches[1], i + 2, true
+		}
+	}
+
+	return "", 0, false
+}
+
+// splitAttribution separates the date from the author in an attribution such
+// as "Tue, Mar 26, 2024 at 11:04 AM Timmy <timmy@gmail.com>"
+func splitAttribution(attribution string) (from, date string) {
+	if loc := lastIndex(attributionTimeRegex, attribution); loc != nil {
+		date = strings.TrimSpace(attribution[:loc[1]])
+		from = strings.Trim(attribution[loc[1]:], " ,")
+		return from, date
+	}
+
+	if comma := strings.LastIndex(attribution, ","); comma > 0 {
+		return strings.TrimSpace(attribution[comma+1:]), strings.TrimSpace(attribution[:comma])
+	}
+
+	return attribution, ""
+}
+
+func lastIndex(re *regexp.Regexp, s string) []int {
+	matches := re.FindAllStringIndex(s, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+	return matches[len(matches)-1]
+}
+
+// collectQuoted gathers the ">" quoted lines starting at start, with one level
+// of quoting removed, and returns the first index after the quote
+func collectQuoted(lines []string, start int) ([]string, int) {
+	i := start
+	for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+
+	var quoted []string
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(line, ">") {
+			break
+		}
+
+		line = strings.TrimPrefix(line, ">")
+		quoted = append(quoted, strings.TrimPrefix(line, " "))
+	}
+
+	if len(quoted) == 0 {
+		return nil, start
+	}
+	return quoted, i
+}
+
+// cleanMessageBody removes signatures, client boilerplate and disclaimers, and
+// collapses runs of blank lines
+func cleanMessageBody(lines []string) string {
+	var kept []string
+	skipParagraph := false
+
+	for _, raw := range lines {
+		line := strings.TrimRight(raw, " \t")
+		trimmed := strings.TrimSpace(line)
+
+		// Everything after the RFC 3676 delimiter is signature
+		if line == "--" || line == "-- " {
+			break
+		}
+
+		if trimmed == "" {
+			skipParagraph = false
+			kept = append(kept, "")
+			continue
+		}
+
+		if skipParagraph || boilerplateLineRegex.MatchString(trimmed) {
+			continue
+		}
+
+		if disclaimerRegex.MatchString(trimmed) {
+			skipParagraph = true
+			continue
+		}
+
+		kept = append(kept, line)
+	}
+
+	kept = trimSignature(kept)
+
+	// Collapse blank runs and trim the ends
+	var compact []string
+	for _, line := range kept {
+		if line == "" && (len(compact) == 0 || compact[len(compact)-1] == "") {
+			continue
+		}
+		compact = append(compact, line)
+	}
+
+	return strings.TrimSpace(strings.Join(compact, "\n"))
+}
+
+// trimSignature drops the short block of name, title and phone lines that
+// follows a closing sign-off at the end of a message
+func trimSignature(lines []string) []string {
+	end := len(lines)
+	for end > 0 && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+
+	for i := end - 1; i >= 0 && i >= end-maxSignatureLines-1; i-- {
+		if valedictionRegex.MatchString(strings.TrimSpace(lines[i])) {
+			return lines[:i+1]
+		}
+	}
+
+	return lines[:end]
+}
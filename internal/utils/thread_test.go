@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitThread(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []ThreadMessage
+	}{
+		{
+			name: "Gmail reply",
+			text: `Thursday at 3 works for me, see you in Room 4.
+
+Sent from my iPhone
+
+On Tue, Oct 13, 2026 at 4:12 PM Priya Shah <priya@example.com> wrote:
+
+> Hi Sam,
+>
+> Could we move the design review to Thursday at 3pm?
+>
+> Thanks,
+> Priya
+> Product Manager | Example Inc.
+> +1 415 555 0100
+`,
+			want: []ThreadMessage{
+				{Body: "Thursday at 3 works for me, see you in Room 4."},
+				{
+					From: "Priya Shah <priya@example.com>",
+					Date: "Tue, Oct 13, 2026 at 4:12 PM",
+					Body: "Hi Sam,\n\nCould we move the design review to Thursday at 3pm?\n\nThanks,",
+				},
+			},
+		},
+		{
+			name: "Gmail attribution wrapped at the address",
+			text: "Sounds good.\r\n\r\nOn Tue, Oct 13, 2026 at 4:12 PM Priya Shah <\r\npriya@example.com> wrote:\r\n\r\n> Lunch on Friday at 12:30?\r\n",
+			want: []ThreadMessage{
+				{Body: "Sounds good."},
+				{From: "Priya Shah <priya@example.com>", Date: "Tue, Oct 13, 2026 at 4:12 PM", Body: "Lunch on Friday at 12:30?"},
+			},
+		},
+		{
+			name: "Outlook reply below a rule",
+			text: `Accepted, thanks.
+
+Kind regards,
+Sam Lee
+Operations
+
+________________________________
+From: Priya Shah <priya@example.com>
+Sent: Tuesday, October 13, 2026 4:12 PM
+To: Sam Lee <sam@example.org>
+Cc: Ops <ops@example.org>
+Subject: Quarterly planning
+
+Quarterly planning is on 20 October from 10:00 to 12:00 in the Thames room.
+
+CONFIDENTIALITY NOTICE: This email and any attachments are confidential and
+intended only for the named recipient.
+`,
+			want: []ThreadMessage{
+				{Body: "Accepted, thanks.\n\nKind regards,"},
+				{
+					From:    "Priya Shah <priya@example.com>",
+					Date:    "Tuesday, October 13, 2026 4:12 PM",
+					To:      "Sam Lee <sam@example.org>",
+					Cc:      "Ops <ops@example.org>",
+					Subject: "Quarterly planning",
+					Body:    "Quarterly planning is on 20 October from 10:00 to 12:00 in the Thames room.",
+				},
+			},
+		},
+		{
+			name: "Outlook reply converted from HTML",
+			text: `Adding Lee.
+
+*From:* Priya Shah <priya@example.com>
+*Sent:* Tuesday, October 13, 2026 4:12 PM
+*To:* Sam Lee <sam@example.org>
+*Subject:* Offsite
+
+The offsite runs 3-4 November.
+`,
+			want: []ThreadMessage{
+				{Body: "Adding Lee."},
+				{
+					From:    "Priya Shah <priya@example.com>",
+					Date:    "Tuesday, October 13, 2026 4:12 PM",
+					To:      "Sam Lee <sam@example.org>",
+					Subject: "Offsite",
+					Body:    "The offsite runs 3-4 November.",
+				},
+			},
+		},
+		{
+			name: "Gmail forward",
+			text: `---------- Forwarded message ---------
+From: Dr Amal Rahman's Office <appointments@clinic.example>
+Date: Mon, 12 Oct 2026 at 09:30
+Subject: Your appointment
+To: <sam@example.org>
+
+
+Your appointment is confirmed for Wednesday 21 October at 14:15.
+`,
+			want: []ThreadMessage{
+				{},
+				{
+					From:    "Dr Amal Rahman's Office <appointments@clinic.example>",
+					Date:    "Mon, 12 Oct 2026 at 09:30",
+					To:      "<sam@example.org>",
+					Subject: "Your appointment",
+					Body:    "Your appointment is confirmed for Wednesday 21 October at 14:15.",
+				},
+			},
+		},
+		{
+			name: "signature after the RFC 3676 delimiter",
+			text: "Dinner at 7 on Saturday?\n\n-- \nSam Lee\nhttps://example.org\n",
+			want: []ThreadMessage{{Body: "Dinner at 7 on Saturday?"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitThread(tt.text)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d messages, want %d:\n%s", len(got), len(tt.want), FormatThread(got))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("message %d:\n got %#v\nwant %#v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFormatThread(t *testing.T) {
+	formatted := FormatThread([]ThreadMessage{
+		{Body: "Works for me."},
+		{From: "Priya Shah <priya@example.com>", Date: "Tue, Oct 13, 2026 at 4:12 PM", Body: "Thursday at 3pm?"},
+	})
+
+	want := strings.Join([]string{
+		"[Message 1 of 2, most recent]",
+		"",
+		"Works for me.",
+		"",
+		"[Message 2 of 2]",
+		"From: Priya Shah <priya@example.com>",
+		"Date: Tue, Oct 13, 2026 at 4:12 PM",
+		"",
+		"Thursday at 3pm?",
+	}, "\n")
+	if formatted != want {
+		t.Errorf("FormatThread =\n%s\nwant\n%s", formatted, want)
+	}
+}
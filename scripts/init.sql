@@ -9,6 +9,7 @@ CREATE TABLE IF NOT EXISTS users (
     refresh_token TEXT,
     expiry_date TIMESTAMP WITH TIME ZONE,
     token_scope TEXT,
+    calendar_provider VARCHAR(20) NOT NULL DEFAULT 'google',
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
@@ -31,6 +32,119 @@ CREATE TABLE IF NOT EXISTS pending_email_addresses (
     expires_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() + INTERVAL '24 hours')
 );
 
+-- Create inbound_jobs table
+CREATE TABLE IF NOT EXISTS inbound_jobs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    webhook JSONB NOT NULL,
+    files JSONB,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL,
+    last_error TEXT,
+    run_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    locked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Create processed_messages table
+CREATE TABLE IF NOT EXISTS processed_messages (
+    message_key VARCHAR(512) PRIMARY KEY,
+    sender VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    outcome VARCHAR(50),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Create imported_events table
+CREATE TABLE IF NOT EXISTS imported_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ical_uid VARCHAR(512) NOT NULL,
+    recurrence_id VARCHAR(32) NOT NULL DEFAULT '',
+    sequence INT NOT NULL DEFAULT 0,
+    calendar_id VARCHAR(255) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (user_id, ical_uid, recurrence_id)
+);
+
+-- Create created_events table
+CREATE TABLE IF NOT EXISTS created_events (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_id VARCHAR(255) NOT NULL,
+    calendar_id VARCHAR(255) NOT NULL,
+    ical_uid VARCHAR(512) NOT NULL,
+    summary TEXT NOT NULL,
+    description TEXT,
+    location TEXT,
+    start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    time_zone VARCHAR(64) NOT NULL,
+    all_day BOOLEAN NOT NULL DEFAULT FALSE,
+    recurrence TEXT[],
+    html_link TEXT,
+    source_key TEXT, -- the message and event it was read from
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (user_id, event_id)
+);
+
+-- Create calendar_feeds table
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Create user_settings table
+CREATE TABLE IF NOT EXISTS user_settings (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    default_reminders JSONB,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Create microsoft_tokens table
+CREATE TABLE IF NOT EXISTS microsoft_tokens (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    tenant_id VARCHAR(64) NOT NULL, -- tid and oid from the ID token
+    object_id VARCHAR(64) NOT NULL,
+    access_token TEXT NOT NULL,
+    refresh_token TEXT,
+    expiry_date TIMESTAMP WITH TIME ZONE,
+    token_scope TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (tenant_id, object_id)
+);
+
+-- Create caldav_accounts table
+CREATE TABLE IF NOT EXISTS caldav_accounts (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    server_url TEXT NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    password TEXT NOT NULL, -- AES-256-GCM with CALDAV_ENCRYPTION_KEY
+    calendar_url TEXT NOT NULL,
+    calendar_name VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Create calendar_routes table
+CREATE TABLE IF NOT EXISTS calendar_routes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    pattern VARCHAR(255) NOT NULL,
+    calendar_id TEXT NOT NULL,
+    calendar_name VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (user_id, kind, pattern)
+);
+
 -- Create indexes
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
 CREATE INDEX IF NOT EXISTS idx_users_expiry_date ON users(expiry_date);
@@ -38,3 +152,9 @@ CREATE INDEX IF NOT EXISTS idx_email_addresses_user_id ON email_addresses(user_i
 CREATE INDEX IF NOT EXISTS idx_email_addresses_default ON email_addresses(is_default) WHERE is_default = TRUE;
 CREATE INDEX IF NOT EXISTS idx_pending_emails_verification_code ON pending_email_addresses(verification_code);
 CREATE INDEX IF NOT EXISTS idx_pending_emails_expires_at ON pending_email_addresses(expires_at);
+CREATE INDEX IF NOT EXISTS idx_inbound_jobs_runnable ON inbound_jobs(run_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_inbound_jobs_status ON inbound_jobs(status, updated_at);
+CREATE INDEX IF NOT EXISTS idx_processed_messages_updated_at ON processed_messages(updated_at);
+CREATE INDEX IF NOT EXISTS idx_processed_messages_sender ON processed_messages(sender, outcome, created_at);
+CREATE INDEX IF NOT EXISTS idx_microsoft_tokens_expiry_date ON microsoft_tokens(expiry_date);
+CREATE INDEX IF NOT EXISTS idx_created_events_source_key ON created_events(user_id, source_key) WHERE source_key IS NOT NULL;
@@ -11,6 +11,15 @@ type EmailTemplate struct {
 	Subject string
 }
 
+// viewEventButton links to the event in the user's calendar. Calendars
+// without a web view of their events, such as CalDAV servers, get no button.
+func viewEventButton(eventLink string) string {
+	if eventLink == "" {
+		return ""
+	}
+	return fmt.Sprintf(`<br><a href="%s" style="display:inline-block; padding:10px 20px; margin:5px 0; background-color:#3498db; color:white; text-align:center; text-decoration:none; font-weight:bold; border-radius:5px; border:none; cursor:pointer;">View Event</a>`, eventLink)
+}
+
 func GetNoUserFoundTemplate(fromEmail, baseDomain, appDomain, emailDomain string) EmailTemplate {
 	html := fmt.Sprintf(`Welcome to swiftcal!<br><br>
 We're excited to help you manage your calendar more efficiently. To get started, please click the link below to sign up.<br><br>
@@ -43,6 +52,14 @@ Please ensure you complete the checkbox to allow swiftcal to access your calenda
 	return EmailTemplate{HTML: html}
 }
 
+func GetTemporaryFailureTemplate(emailDomain string) EmailTemplate {
+	html := fmt.Sprintf(`We couldn't reach your calendar or our event reader just now, and gave up after trying several times. Nothing was added. Please forward your email thread again in a little while.
+
+<br><br>If this keeps happening, please let us know: <a href="mailto:hey@%s">hey@%s</a><br>`, emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html}
+}
+
 func GetUnableToParseTemplate(emailDomain string) EmailTemplate {
 	html := fmt.Sprintf(`We weren't able to identify a date in your email. Please forward the thread again and include some additional context to help us understand the event details better.
 
@@ -64,9 +81,9 @@ func GetEventAddedTemplate(eventLink, eventDate, eventAttendees, emailDomain str
 	html := fmt.Sprintf(`Great news! Your event has been successfully added to your calendar.
 <br>Date: %s
 <br>Attendees: %s
-<br><a href="%s" style="display:inline-block; padding:10px 20px; margin:5px 0; background-color:#3498db; color:white; text-align:center; text-decoration:none; font-weight:bold; border-radius:5px; border:none; cursor:pointer;">View Event</a>
+%s
 
-<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, eventDate, eventAttendees, eventLink, emailDomain, emailDomain)
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, eventDate, eventAttendees, viewEventButton(eventLink), emailDomain, emailDomain)
 
 	return EmailTemplate{HTML: html}
 }
@@ -76,21 +93,21 @@ func GetEventAddedAttendeesTemplate(eventLink, eventDate, inviteLink, eventAtten
 
 	html := fmt.Sprintf(`Great news! Your event has been successfully added to your calendar.
 <br>Date: %s
-<br> <a href="%s" style="display:inline-block; padding:10px 20px; margin:5px 0; background-color:#3498db; color:white; text-align:center; text-decoration:none; font-weight:bold; border-radius:5px; border:none; cursor:pointer;">View Event</a>
+%s
 <br> You may want to invite these attendees:
 <br>- %s
 <br><a href="%s" style="display:inline-block; padding:10px 20px; margin:5px 0; background-color:#3498db; color:white; text-align:center; text-decoration:none; font-weight:bold; border-radius:5px; border:none; cursor:pointer;">Invite Guests</a>
 
-<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, eventDate, eventLink, attendeesList, inviteLink, emailDomain, emailDomain)
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, eventDate, viewEventButton(eventLink), attendeesList, inviteLink, emailDomain, emailDomain)
 
 	return EmailTemplate{HTML: html}
 }
 
 func GetICSEventTemplate(eventLink, emailDomain string) EmailTemplate {
 	html := fmt.Sprintf(`Perfect! We found an ICS file in your forwarded email and have successfully added this event to your calendar:
-<br><a href="%s" style="display:inline-block; padding:10px 20px; margin:5px 0; background-color:#3498db; color:white; text-align:center; text-decoration:none; font-weight:bold; border-radius:5px; border:none; cursor:pointer;">View Event</a>
+%s
 
-<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, eventLink, emailDomain, emailDomain)
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, viewEventButton(eventLink), emailDomain, emailDomain)
 
 	return EmailTemplate{HTML: html}
 }
@@ -150,3 +167,217 @@ You may want to disconnect swiftcal from your Google account <a href="https://my
 
 	return EmailTemplate{HTML: html}
 }
+
+func GetEventUpdatedTemplate(eventSummary, eventLink, eventDate, emailDomain string) EmailTemplate {
+	html := fmt.Sprintf(`The organizer changed this invite, so we've updated %s in your calendar.
+<br>Date: %s
+%s
+
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, eventSummary, eventDate, viewEventButton(eventLink), emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html}
+}
+
+func GetEventCancelledTemplate(eventSummary, eventDate, emailDomain string) EmailTemplate {
+	html := fmt.Sprintf(`The organizer cancelled %s on %s, so we've removed it from your calendar.
+
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, eventSummary, eventDate, emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html}
+}
+
+func GetCancelledEventNotFoundTemplate(emailDomain string) EmailTemplate {
+	html := fmt.Sprintf(`This email cancels an event, but we couldn't find it among the events swiftcal added to your calendar. If you added it yourself, please remove it from your calendar directly.
+
+<br><br>If you need assistance, please don't hesitate to reach out: <a href="mailto:hey@%s">hey@%s</a><br>`, emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html}
+}
+
+func GetEventUpToDateTemplate(emailDomain string) EmailTemplate {
+	html := fmt.Sprintf(`This invite is already in your calendar and nothing in it has changed since, so there was nothing to update.
+
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html}
+}
+
+func GetGuestEventsTemplate(eventsHTML, baseDomain, emailDomain string) EmailTemplate {
+	html := fmt.Sprintf(`Here's what we found in your email. Open the attached .ics file, or use a link below to add each event to your calendar.<br><br>
+%s
+Want events added for you automatically? <a href="https://www.%s/signup-consent">Sign up for swiftcal</a> and forwarded emails will go straight into your calendar.
+
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, eventsHTML, baseDomain, emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html}
+}
+
+func GetFeedTemplate(webcalURL, feedURL, emailDomain string) EmailTemplate {
+	html := fmt.Sprintf(`Here's your private calendar feed with every event swiftcal has added for you.
+<br><a href="%s" style="display:inline-block; padding:10px 20px; margin:5px 0; background-color:#3498db; color:white; text-align:center; text-decoration:none; font-weight:bold; border-radius:5px; border:none; cursor:pointer;">Subscribe</a>
+<br>Apple Calendar, Outlook and Thunderbird can also subscribe to this address:
+<br>%s
+
+<br><br>Anyone with this link can see your events. To replace it, send an email with the subject "reset calendar feed"; to turn the feed off, use "stop calendar feed".
+
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, webcalURL, feedURL, emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html, Subject: "Your swiftcal calendar feed"}
+}
+
+func GetFeedRevokedTemplate(emailDomain string) EmailTemplate {
+	html := fmt.Sprintf(`Your calendar feed has been turned off, and its link no longer works. Send an email with the subject "calendar feed" whenever you'd like a new one.
+
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html}
+}
+
+func GetDefaultRemindersTemplate(reminders, emailDomain string) EmailTemplate {
+	html := fmt.Sprintf(`Events you send from now on will remind you %s, unless the email asks for reminders of its own.
+
+<br><br>To go back to your calendar's own reminders, send an email with the subject "default reminders reset".
+
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, reminders, emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html}
+}
+
+func GetDefaultRemindersResetTemplate(emailDomain string) EmailTemplate {
+	html := fmt.Sprintf(`Events you send from now on will use your calendar's own reminders, unless the email asks for reminders of its own.
+
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html}
+}
+
+func GetDefaultRemindersHelpTemplate(emailDomain string) EmailTemplate {
+	html := fmt.Sprintf(`We couldn't read any reminders in that subject. List them after "default reminders", for example:
+
+<br><br><strong>default reminders: 10 minutes, 1 day by email</strong>
+
+<br><br>Reminders are popups unless they say "by email", and can be up to 4 weeks before an event. Send "default reminders reset" to go back to your calendar's own reminders.
+
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html}
+}
+
+func GetCalDAVConnectedTemplate(calendarName string, calendarNames []string, emailDomain string) EmailTemplate {
+	html := fmt.Sprintf(`Your CalDAV calendar is connected. From now on, events you forward will be added to <strong>%s</strong>.
+<br><br>Calendars we found on your server:
+<br>- %s
+
+<br><br>To use another one, send "connect caldav" again with a calendar: line naming it. To go back to Google Calendar, send an email with the subject "disconnect caldav".
+
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, calendarName, strings.Join(calendarNames, "<br>- "), emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html, Subject: "Your CalDAV calendar is connected"}
+}
+
+func GetCalDAVConnectFailedTemplate(reason string, calendarNames []string, emailDomain string) EmailTemplate {
+	found := ""
+	if len(calendarNames) > 0 {
+		found = fmt.Sprintf("<br><br>Calendars we found on your server:<br>- %s", strings.Join(calendarNames, "<br>- "))
+	}
+
+	html := fmt.Sprintf(`We couldn't connect your CalDAV calendar: %s.%s
+
+<br><br>Please check the server address and use an app password rather than your account password; most providers create these in their security settings. Your calendar hasn't been changed.
+
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, reason, found, emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html, Subject: "We couldn't connect your CalDAV calendar"}
+}
+
+func GetCalDAVHelpTemplate(emailDomain string) EmailTemplate {
+	html := fmt.Sprintf(`To add events to a CalDAV calendar such as iCloud, Fastmail or Nextcloud, send an email with the subject "connect caldav" and these lines in the body:
+
+<br><br><strong>server: https://caldav.example.com
+<br>username: you@example.com
+<br>password: your app password</strong>
+
+<br><br>You can add a "calendar:" line naming the calendar to use; otherwise we'll use the first one we find. Please use an app password rather than your account password, so you can revoke it at any time.
+
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html}
+}
+
+func GetCalDAVDisconnectedTemplate(emailDomain string) EmailTemplate {
+	html := fmt.Sprintf(`Your CalDAV calendar has been disconnected and we've deleted the password you gave us. You may also want to revoke the app password with your provider.
+
+<br><br>Events you forward will go to Google Calendar again once you've connected it.
+
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html}
+}
+
+func GetConnectMicrosoftTemplate(linkURL, emailDomain string) EmailTemplate {
+	html := fmt.Sprintf(`To add events to your Microsoft 365 or Outlook.com calendar, <a href="%s">click here and sign in with Microsoft</a>. The link works for an hour and connects the calendar to this email address.
+
+<br><br>If you didn't ask to connect a Microsoft calendar, you can ignore this email.
+
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, linkURL, emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html, Subject: "Connect your Microsoft calendar"}
+}
+
+func GetCalendarRoutesTemplate(routes, calendarNames []string, mainLocal, mainDomain, emailDomain string) EmailTemplate {
+	current := "You don't have any calendar routes yet, so events go to your default calendar."
+	if len(routes) > 0 {
+		current = fmt.Sprintf("Your calendar routes:<br>- %s", strings.Join(routes, "<br>- "))
+	}
+
+	calendars := ""
+	if len(calendarNames) > 0 {
+		calendars = fmt.Sprintf("<br><br>Calendars you can route to:<br>- %s", strings.Join(calendarNames, "<br>- "))
+	}
+
+	html := fmt.Sprintf(`%s%s
+
+<br><br>To add a route, send an email with one of these subjects:
+<br>- <strong>route family to Family</strong> for emails sent to %s+family@%s
+<br>- <strong>route from united.com to Travel</strong> for emails from united.com
+<br>- <strong>route keyword soccer to Kids</strong> for emails mentioning soccer
+
+<br><br>Send the same subject starting with "unroute" and without "to ..." to remove a route. Emails sent to %s+team-x@%s also go to a calendar called "Team X" without a route.
+
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, current, calendars, mainLocal, mainDomain, mainLocal, mainDomain, emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html}
+}
+
+func GetCalendarRouteSavedTemplate(description, calendarName, emailDomain string) EmailTemplate {
+	html := fmt.Sprintf(`Events from %s will now be added to <strong>%s</strong>.
+
+<br><br>Send "calendar routes" to see all your routes.
+
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, description, calendarName, emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html, Subject: "Calendar route saved"}
+}
+
+func GetCalendarRouteRemovedTemplate(description, emailDomain string) EmailTemplate {
+	html := fmt.Sprintf(`Events from %s will go to your default calendar again.
+
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, description, emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html, Subject: "Calendar route removed"}
+}
+
+func GetCalendarRouteFailedTemplate(reason string, calendarNames []string, emailDomain string) EmailTemplate {
+	calendars := ""
+	if len(calendarNames) > 0 {
+		calendars = fmt.Sprintf("<br><br>Calendars you can route to:<br>- %s", strings.Join(calendarNames, "<br>- "))
+	}
+
+	html := fmt.Sprintf(`We couldn't update your calendar routes: %s.%s
+
+<br><br>Send "calendar routes" to see your routes and how to add them.
+
+<br><br>If you need any assistance, we're here to help: <a href="mailto:hey@%s">hey@%s</a><br>`, reason, calendars, emailDomain, emailDomain)
+
+	return EmailTemplate{HTML: html, Subject: "We couldn't update your calendar routes"}
+}
@@ -70,3 +70,50 @@ func GetInvitedPageHTML() string {
 </body>
 </html>`
 }
+
+// GetMicrosoftNotLinkedPageHTML returns the HTML for a Microsoft sign-in that
+// isn't linked to a swiftcal account yet
+func GetMicrosoftNotLinkedPageHTML(emailDomain string) string {
+	return `<!DOCTYPE html>
+<html>
+<head>
+    <title>Connect Microsoft - swiftcal</title>
+    <style>
+        body { font-family: Arial, sans-serif; text-align: center; padding: 50px; }
+        .container { max-width: 600px; margin: 0 auto; }
+        h1 { color: #2c3e50; }
+        p { color: #7f8c8d; line-height: 1.6; }
+        .highlight { color: #3498db; font-weight: bold; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1>Let's connect your Microsoft calendar</h1>
+        <p>This Microsoft account isn't connected to swiftcal yet. To connect it, send an email with the subject <span class="highlight">connect microsoft</span> to <a href="mailto:swiftcal@` + emailDomain + `?subject=connect microsoft">swiftcal@` + emailDomain + `</a> from the address you'll forward events from. We'll reply with a link that connects your calendar to that address.</p>
+    </div>
+</body>
+</html>`
+}
+
+// GetMicrosoftLinkExpiredPageHTML returns the HTML for a connect link that
+// has expired or was altered
+func GetMicrosoftLinkExpiredPageHTML(emailDomain string) string {
+	return `<!DOCTYPE html>
+<html>
+<head>
+    <title>Link Expired - swiftcal</title>
+    <style>
+        body { font-family: Arial, sans-serif; text-align: center; padding: 50px; }
+        .container { max-width: 600px; margin: 0 auto; }
+        h1 { color: #e74c3c; }
+        p { color: #7f8c8d; line-height: 1.6; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1>This link has expired</h1>
+        <p>Links to connect a Microsoft calendar work for an hour. Please send another email with the subject "connect microsoft" to <a href="mailto:swiftcal@` + emailDomain + `?subject=connect microsoft">swiftcal@` + emailDomain + `</a> for a new one.</p>
+    </div>
+</body>
+</html>`
+}
@@ -14,9 +14,13 @@ I'll need you to return the information in this format:
       "location": "a location of the event if one has been given",
       "description": "a description of the event if one has been given",
       "conference_call": true or false, if the event is a conference call or virtual,
-      "date": "DD MMMM YYYY - the date of the event",
-      "start_time": "HH:mm - the start time of the event in 24 hour format",
+      "date": "DD MMMM YYYY - the date of the event, or the first day if it spans several",
+      "end_date": "DD MMMM YYYY - the last day of the event, only if it ends on a later day than it starts",
+      "start_time": "HH:mm - the start time of the event in 24 hour format, or null for all-day events",
       "end_time": "HH:mm - the end time of the event in 24 hour format",
+      "all_day": true or false, if the event has no particular time of day,
+      "deadline": true or false, if this is something due by a date rather than time to be spent,
+      "reminders": [{"method": "popup" or "email", "minutes": how many minutes before the start to remind}],
       "attendees": ["list of attendees email addresses"]
     }
   ]
@@ -27,10 +31,16 @@ Please make sure to capture all distinct events mentioned in the email. Each eve
 Here's what to look for:
 - The text begins with a Date - that's when the email was sent
 - The next line shows the subject of the email thread
+- Threads may be split into labelled messages such as "[Message 2 of 3]", most recent first, each with its own From, Date, To and Cc
 - For attendees, consider everyone in the thread, but also think about the email content and subject
 - If it's a transactional email (like a receipt or automated message), only include the sender as an attendee
 - If it's an email thread, focus on the most recent email but keep the context from the entire thread
-- Relative dates like "next tuesday" are perfectly fine - just calculate the actual date based on when the email was sent
+- Relative dates like "next tuesday" are perfectly fine - just calculate the actual date based on when the message containing them was sent
+- Dates in older messages may have been superseded by later ones, so prefer what the most recent messages settle on
+- Conferences, holidays, vacations and hotel stays usually have no time of day - set "all_day" to true, "start_time" and "end_time" to null, and give the last day as "end_date"
+- Events that run past midnight, like "10pm to 2am", keep the start date in "date" and the following day in "end_date"
+- Deadlines such as "due Friday" or "submit by March 3rd" are events too - set "deadline" to true, start the summary with "Due: ", and make them all-day unless a time is given
+- Only give "reminders" when the email asks for them, like "remind me a day before" (1440 minutes) or "email me a reminder an hour ahead" (an "email" reminder of 60 minutes) - otherwise leave the list empty
 - If there aren't enough details for the summary or description, simply use "Event" as a placeholder
 
 To create an event, you'll need at least a date. If you can't find a date for any event, please let me know with this response:
@@ -81,8 +91,12 @@ events_json:
       "description": "Case ID: 102258148113",
       "conference_call": false,
       "date": "3 April 2024",
+      "end_date": null,
       "start_time": "10:20",
       "end_time": null,
+      "all_day": false,
+      "deadline": false,
+      "reminders": [],
       "attendees": ["timmy@gmail.com"]
     }
   ]
@@ -137,8 +151,12 @@ events_json:
       "description": "Introduction to Soom Toom, Investing's progress on sourcing deals to date, potential opportunities to work together",
       "conference_call": true,
       "date": "26 March 2024",
+      "end_date": null,
       "start_time": "15:00",
       "end_time": null,
+      "all_day": false,
+      "deadline": false,
+      "reminders": [],
       "attendees": ["rsoom@toom.com", "jeff@investing.com", "Joe@investing.com"]
     }
   ]
@@ -161,14 +179,60 @@ events_json:
       "description": "find new suit from H&M",
       "conference_call": false,
       "date": "13 April 2024",
+      "end_date": null,
       "start_time": "14:00",
       "end_time": null,
+      "all_day": false,
+      "deadline": false,
+      "reminders": [],
       "attendees": ["jeff@john.com"]
     }
   ]
 }
 --- EXAMPLE 3 END ---
 
+---EXAMPLE 4 START---
+email_text:
+Date: Mon, 6 May 2024 09:12:44 +0000
+Subject: GopherCon EU logistics
+From: Anna Berg <anna@gophers.eu>
+Hi all, see you at GopherCon EU in Berlin from June 17 to June 20. Please send your slides by Friday - set yourselves a reminder two days before.
+
+events_json:
+{
+  "events": [
+    {
+      "summary": "GopherCon EU",
+      "location": "Berlin",
+      "description": null,
+      "conference_call": false,
+      "date": "17 June 2024",
+      "end_date": "20 June 2024",
+      "start_time": null,
+      "end_time": null,
+      "all_day": true,
+      "deadline": false,
+      "reminders": [],
+      "attendees": ["anna@gophers.eu"]
+    },
+    {
+      "summary": "Due: GopherCon EU slides",
+      "location": null,
+      "description": "Send slides to Anna",
+      "conference_call": false,
+      "date": "10 May 2024",
+      "end_date": null,
+      "start_time": null,
+      "end_time": null,
+      "all_day": true,
+      "deadline": true,
+      "reminders": [{"method": "popup", "minutes": 2880}],
+      "attendees": ["anna@gophers.eu"]
+    }
+  ]
+}
+--- EXAMPLE 4 END ---
+
 Please respond with JSON only.
 `
 }